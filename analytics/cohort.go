@@ -0,0 +1,138 @@
+package analytics
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/billing"
+)
+
+// Cohort granularities
+const (
+	CohortWeek  = "week"
+	CohortMonth = "month"
+)
+
+var ErrInvalidGranularity = errors.New("granularity must be week or month")
+
+// Span is a stretch of time a subscription was live
+type Span struct {
+	Start time.Time
+	End   *time.Time
+}
+
+// Customer is a user's subscription history, first subscription first
+type Customer struct {
+	UserID uint
+	Spans  []Span
+}
+
+// Cohort is the customers who first subscribed in one week or month and how
+// many of them were still subscribed each period later. Retained has an
+// entry per period that every member of the cohort has reached.
+type Cohort struct {
+	Start    time.Time `json:"start"`
+	Label    string    `json:"label"`
+	Size     int       `json:"size"`
+	Retained []int     `json:"retained"`
+	Rates    []float64 `json:"rates"`
+}
+
+// CohortReport is the result of Cohorts
+type CohortReport struct {
+	Granularity string   `json:"granularity"`
+	Periods     int      `json:"periods"`
+	PlanIDs     []uint   `json:"plan_ids,omitempty"`
+	Cohorts     []Cohort `json:"cohorts"`
+}
+
+// Cohorts groups customers by the week or month of their first subscription
+// in [from, to) and counts how many were subscribed 0 to periods-1 weeks or
+// months after they first subscribed. Subscribing again after cancelling
+// counts as retained. Periods that have not yet elapsed for the whole cohort
+// by now are left out.
+func Cohorts(customers []Customer, granularity string, periods int, from, to, now time.Time) (CohortReport, error) {
+	interval, err := cohortInterval(granularity)
+	if err != nil {
+		return CohortReport{}, err
+	}
+
+	byStart := make(map[time.Time]*Cohort)
+	members := make(map[time.Time][]Customer)
+	for _, customer := range customers {
+		if len(customer.Spans) == 0 {
+			continue
+		}
+		first := customer.Spans[0].Start
+		if first.Before(from) || !first.Before(to) {
+			continue
+		}
+		start := cohortStart(first, granularity)
+		if byStart[start] == nil {
+			byStart[start] = &Cohort{Start: start, Label: cohortLabel(start, granularity)}
+		}
+		byStart[start].Size++
+		members[start] = append(members[start], customer)
+	}
+
+	report := CohortReport{Granularity: granularity, Periods: periods, Cohorts: make([]Cohort, 0, len(byStart))}
+	for start, cohort := range byStart {
+		cohortEnd := interval.AddTo(start, 1)
+		for n := 0; n < periods; n++ {
+			// Every member must have been subscribed for n periods by now
+			if n > 0 && interval.AddTo(cohortEnd, n).After(now) {
+				break
+			}
+			retained := 0
+			for _, customer := range members[start] {
+				if customer.subscribedAt(interval.AddTo(customer.Spans[0].Start, n)) {
+					retained++
+				}
+			}
+			cohort.Retained = append(cohort.Retained, retained)
+			cohort.Rates = append(cohort.Rates, math.Round(float64(retained)/float64(cohort.Size)*10000)/10000)
+		}
+		report.Cohorts = append(report.Cohorts, *cohort)
+	}
+	sort.Slice(report.Cohorts, func(i, j int) bool { return report.Cohorts[i].Start.Before(report.Cohorts[j].Start) })
+	return report, nil
+}
+
+func (c Customer) subscribedAt(t time.Time) bool {
+	for _, span := range c.Spans {
+		if !span.Start.After(t) && (span.End == nil || span.End.After(t)) {
+			return true
+		}
+	}
+	return false
+}
+
+func cohortInterval(granularity string) (billing.Interval, error) {
+	switch granularity {
+	case CohortWeek:
+		return billing.Interval{Unit: billing.IntervalWeek, Count: 1}, nil
+	case CohortMonth:
+		return billing.Interval{Unit: billing.IntervalMonth, Count: 1}, nil
+	default:
+		return billing.Interval{}, ErrInvalidGranularity
+	}
+}
+
+// cohortStart is the Monday of the week or the first of the month t falls in
+func cohortStart(t time.Time, granularity string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if granularity == CohortWeek {
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func cohortLabel(start time.Time, granularity string) string {
+	if granularity == CohortWeek {
+		return start.Format("2006-01-02")
+	}
+	return start.Format("2006-01")
+}
@@ -0,0 +1,95 @@
+package analytics
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func span(start time.Time, end *time.Time) Span {
+	return Span{Start: start, End: end}
+}
+
+func TestCohorts(t *testing.T) {
+	tests := []struct {
+		name        string
+		customers   []Customer
+		granularity string
+		periods     int
+		from, to    time.Time
+		now         time.Time
+		want        []Cohort
+	}{
+		{
+			name: "monthly",
+			customers: []Customer{
+				{UserID: 1, Spans: []Span{span(on(time.January, 10), nil)}},
+				{UserID: 2, Spans: []Span{span(on(time.January, 20), ended(time.February, 5))}},
+				// Cancelled, then back from the end of March
+				{UserID: 3, Spans: []Span{span(on(time.January, 25), ended(time.February, 1)), span(on(time.March, 30), nil)}},
+				{UserID: 4, Spans: []Span{span(on(time.February, 14), nil)}},
+				// First subscribed outside the range
+				{UserID: 5, Spans: []Span{span(time.Date(2023, time.December, 20, 0, 0, 0, 0, time.UTC), nil)}},
+				{UserID: 6, Spans: []Span{span(on(time.April, 1), nil)}},
+				{UserID: 7},
+			},
+			granularity: CohortMonth,
+			periods:     6,
+			from:        on(time.January, 1),
+			to:          on(time.April, 1),
+			now:         on(time.June, 15),
+			want: []Cohort{
+				// July has not begun, so the January cohort stops at May
+				{Start: on(time.January, 1), Label: "2024-01", Size: 3, Retained: []int{3, 1, 1, 2, 2}, Rates: []float64{1, 0.3333, 0.3333, 0.6667, 0.6667}},
+				{Start: on(time.February, 1), Label: "2024-02", Size: 1, Retained: []int{1, 1, 1, 1}, Rates: []float64{1, 1, 1, 1}},
+			},
+		},
+		{
+			name: "weekly",
+			customers: []Customer{
+				{UserID: 1, Spans: []Span{span(time.Date(2024, time.March, 6, 10, 0, 0, 0, time.UTC), ended(time.March, 15))}},
+				{UserID: 2, Spans: []Span{span(on(time.March, 11), nil)}},
+			},
+			granularity: CohortWeek,
+			periods:     4,
+			from:        on(time.March, 4),
+			to:          on(time.March, 18),
+			now:         on(time.April, 1),
+			want: []Cohort{
+				{Start: on(time.March, 4), Label: "2024-03-04", Size: 1, Retained: []int{1, 1, 0, 0}, Rates: []float64{1, 1, 0, 0}},
+				{Start: on(time.March, 11), Label: "2024-03-11", Size: 1, Retained: []int{1, 1, 1}, Rates: []float64{1, 1, 1}},
+			},
+		},
+		{
+			name:        "nobody subscribed",
+			granularity: CohortMonth,
+			periods:     3,
+			from:        on(time.January, 1),
+			to:          on(time.April, 1),
+			now:         on(time.June, 15),
+			want:        []Cohort{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Cohorts(tt.customers, tt.granularity, tt.periods, tt.from, tt.to, tt.now)
+			if err != nil {
+				t.Fatalf("Cohorts: %v", err)
+			}
+			if report.Granularity != tt.granularity || report.Periods != tt.periods {
+				t.Errorf("report is for %d %s periods, want %d %s", report.Periods, report.Granularity, tt.periods, tt.granularity)
+			}
+			if !reflect.DeepEqual(report.Cohorts, tt.want) {
+				t.Errorf("Cohorts =\n%+v\nwant\n%+v", report.Cohorts, tt.want)
+			}
+		})
+	}
+}
+
+func TestCohortsRejectsUnknownGranularity(t *testing.T) {
+	_, err := Cohorts(nil, "day", 3, on(time.January, 1), on(time.April, 1), on(time.June, 1))
+	if !errors.Is(err, ErrInvalidGranularity) {
+		t.Errorf("err = %v, want ErrInvalidGranularity", err)
+	}
+}
@@ -0,0 +1,203 @@
+package analytics
+
+import (
+	"time"
+
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/pricing"
+	"gorm.io/gorm"
+)
+
+// averageMonthDays converts day and week based plans to a monthly amount
+const averageMonthDays = 365.25 / 12
+
+// neverStarted are the statuses of subscriptions whose first invoice has not
+// been paid; they never count as customers
+var neverStarted = []string{models.SubscriptionStatusIncomplete, models.SubscriptionStatusIncompleteExpired}
+
+// SubscriptionReport loads the subscriptions billed in currency that were live
+// at some point in [from, to) and computes their metrics. MRR is the plan's
+// current price book price normalised to a month; add-ons and discounts are
+// not included.
+func SubscriptionReport(db *gorm.DB, currency string, from, to time.Time) (Report, error) {
+	timelines, planNames, err := loadTimelines(db, currency, from, to)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Compute(timelines, from, to, planNames)
+	report.Currency = currency
+	return report, nil
+}
+
+func loadTimelines(db *gorm.DB, currency string, from, to time.Time) ([]Timeline, map[uint]string, error) {
+	query := db.Preload("User").
+		Where("start_date < ? AND (ended_at IS NULL OR ended_at >= ?)", to, from).
+		Where("status NOT IN ?", neverStarted)
+	if currency == config.Billing.BaseCurrency {
+		// Subscriptions from before multi-currency billing have no currency
+		query = query.Where("currency IN ?", []string{currency, ""})
+	} else {
+		query = query.Where("currency = ?", currency)
+	}
+
+	var subs []models.Subscription
+	if err := query.Find(&subs).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(subs) == 0 {
+		return nil, map[uint]string{}, nil
+	}
+
+	ids := make([]uint, len(subs))
+	for i, sub := range subs {
+		ids[i] = sub.ID
+	}
+	var events []models.SubscriptionEvent
+	if err := db.Where("subscription_id IN ? AND type = ?", ids, models.SubscriptionEventPlanChanged).
+		Order("created_at, id").
+		Find(&events).Error; err != nil {
+		return nil, nil, err
+	}
+	changes := make(map[uint][]models.SubscriptionEvent)
+	for _, event := range events {
+		changes[event.SubscriptionID] = append(changes[event.SubscriptionID], event)
+	}
+
+	// Deleted plans still priced the subscriptions that were on them
+	var plans []models.Plan
+	if err := db.Unscoped().Preload("Prices").Find(&plans).Error; err != nil {
+		return nil, nil, err
+	}
+	plansByID := make(map[uint]models.Plan, len(plans))
+	planNames := make(map[uint]string, len(plans))
+	for _, plan := range plans {
+		plansByID[plan.ID] = plan
+		planNames[plan.ID] = plan.Name
+	}
+
+	timelines := make([]Timeline, 0, len(subs))
+	for _, sub := range subs {
+		timelines = append(timelines, timeline(sub, changes[sub.ID], plansByID, currency))
+	}
+	return timelines, planNames, nil
+}
+
+func timeline(sub models.Subscription, changes []models.SubscriptionEvent, plans map[uint]models.Plan, currency string) Timeline {
+	tl := Timeline{SubscriptionID: sub.ID, Start: sub.StartDate, End: subscriptionEnd(sub)}
+
+	mrr := func(planID uint) float64 {
+		return monthlyAmount(plans[planID], currency, sub.User.Billing.Country)
+	}
+
+	initialPlan := sub.PlanID
+	if len(changes) > 0 && changes[0].FromPlanID != nil {
+		initialPlan = *changes[0].FromPlanID
+	}
+	tl.Segments = append(tl.Segments, Segment{PlanID: initialPlan, MRR: mrr(initialPlan), From: sub.StartDate})
+	for _, change := range changes {
+		if change.ToPlanID == nil {
+			continue
+		}
+		tl.Segments = append(tl.Segments, Segment{PlanID: *change.ToPlanID, MRR: mrr(*change.ToPlanID), From: change.CreatedAt})
+	}
+	return tl
+}
+
+// subscriptionEnd is when a subscription ended, if it has. Subscriptions
+// that ended before end dates were recorded fall back to their last update.
+func subscriptionEnd(sub models.Subscription) *time.Time {
+	if sub.EndedAt == nil && (sub.Status == models.SubscriptionStatusCancelled || sub.Status == models.SubscriptionStatusExpired) {
+		return &sub.UpdatedAt
+	}
+	return sub.EndedAt
+}
+
+// CohortRetention loads the subscription history of the customers who first
+// subscribed in [from, to) and builds their retention cohorts. With planIDs
+// only subscriptions that started on one of those plans count.
+func CohortRetention(db *gorm.DB, granularity string, periods int, planIDs []uint, from, to time.Time) (CohortReport, error) {
+	customers, err := loadCustomers(db, planIDs, from, to)
+	if err != nil {
+		return CohortReport{}, err
+	}
+
+	report, err := Cohorts(customers, granularity, periods, from, to, time.Now())
+	report.PlanIDs = planIDs
+	return report, err
+}
+
+func loadCustomers(db *gorm.DB, planIDs []uint, from, to time.Time) ([]Customer, error) {
+	var subs []models.Subscription
+	err := db.Where("user_id IN (?)", db.Model(&models.Subscription{}).
+		Select("user_id").
+		Where("start_date >= ? AND start_date < ?", from, to).
+		Where("status NOT IN ?", neverStarted)).
+		Where("status NOT IN ?", neverStarted).
+		Order("start_date, id").
+		Find(&subs).Error
+	if err != nil || len(subs) == 0 {
+		return nil, err
+	}
+
+	initialPlans := make(map[uint]uint, len(subs))
+	if len(planIDs) > 0 {
+		ids := make([]uint, len(subs))
+		for i, sub := range subs {
+			ids[i] = sub.ID
+			initialPlans[sub.ID] = sub.PlanID
+		}
+		var events []models.SubscriptionEvent
+		if err := db.Where("subscription_id IN ? AND type = ?", ids, models.SubscriptionEventPlanChanged).
+			Order("created_at DESC, id DESC").
+			Find(&events).Error; err != nil {
+			return nil, err
+		}
+		// Walking back through the changes leaves the plan each started on
+		for _, event := range events {
+			if event.FromPlanID != nil {
+				initialPlans[event.SubscriptionID] = *event.FromPlanID
+			}
+		}
+	}
+	wanted := make(map[uint]bool, len(planIDs))
+	for _, id := range planIDs {
+		wanted[id] = true
+	}
+
+	var customers []Customer
+	index := make(map[uint]int)
+	for _, sub := range subs {
+		if len(planIDs) > 0 && !wanted[initialPlans[sub.ID]] {
+			continue
+		}
+		i, ok := index[sub.UserID]
+		if !ok {
+			i = len(customers)
+			index[sub.UserID] = i
+			customers = append(customers, Customer{UserID: sub.UserID})
+		}
+		customers[i].Spans = append(customers[i].Spans, Span{Start: sub.StartDate, End: subscriptionEnd(sub)})
+	}
+	return customers, nil
+}
+
+// monthlyAmount is a plan's recurring price per month in currency, or zero
+// if the plan has no price in it
+func monthlyAmount(plan models.Plan, currency, country string) float64 {
+	quote, ok := pricing.Resolve(plan, currency, country)
+	if !ok || quote.Currency != currency {
+		return 0
+	}
+
+	interval := billing.PlanInterval(plan)
+	if months := interval.MonthsPerPeriod(); months > 0 {
+		return quote.Amount / float64(months)
+	}
+	if days := interval.ApproxDays(); days > 0 {
+		return quote.Amount * averageMonthDays / float64(days)
+	}
+	return 0
+}
@@ -0,0 +1,213 @@
+// Package analytics computes recurring revenue metrics from subscription
+// history.
+package analytics
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Segment is a stretch of a subscription spent on one plan
+type Segment struct {
+	PlanID uint
+	MRR    float64
+	From   time.Time
+}
+
+// Timeline is the history of one subscription: when it started, when it
+// ended if it has, and the plans it was on in between
+type Timeline struct {
+	SubscriptionID uint
+	Start          time.Time
+	End            *time.Time
+	Segments       []Segment // in order; the first starts at Start
+}
+
+// Metrics are recurring revenue figures over a date range. Starting figures
+// are taken just before the range and ending figures just before its end, so
+// StartingMRR + NetNewMRR = EndingMRR.
+type Metrics struct {
+	StartingMRR         float64 `json:"starting_mrr"`
+	EndingMRR           float64 `json:"ending_mrr"`
+	ARR                 float64 `json:"arr"`
+	StartingSubscribers int     `json:"starting_subscribers"`
+	EndingSubscribers   int     `json:"ending_subscribers"`
+	NewSubscribers      int     `json:"new_subscribers"`
+	ChurnedSubscribers  int     `json:"churned_subscribers"`
+	NewMRR              float64 `json:"new_mrr"`
+	ExpansionMRR        float64 `json:"expansion_mrr"`
+	ContractionMRR      float64 `json:"contraction_mrr"`
+	ChurnedMRR          float64 `json:"churned_mrr"`
+	NetNewMRR           float64 `json:"net_new_mrr"`
+	// Share of the subscribers at the start of the range who churned during it
+	CustomerChurnRate float64 `json:"customer_churn_rate"`
+	// Churned and contraction MRR as a share of the starting MRR
+	RevenueChurnRate float64 `json:"revenue_churn_rate"`
+}
+
+// PlanMetrics are the metrics of one plan. Plan changes move MRR between
+// plans rather than expanding or contracting it, so within a plan they are
+// reported as MRR moved in and out.
+type PlanMetrics struct {
+	PlanID   uint   `json:"plan_id"`
+	PlanName string `json:"plan_name"`
+	Metrics
+	MovedInMRR  float64 `json:"moved_in_mrr"`
+	MovedOutMRR float64 `json:"moved_out_mrr"`
+}
+
+// Report is the result of Compute
+type Report struct {
+	Currency string        `json:"currency"`
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Summary  Metrics       `json:"summary"`
+	Plans    []PlanMetrics `json:"plans"`
+}
+
+// Compute works out the metrics for the range [from, to) from subscription
+// timelines. planNames labels the per-plan breakdown.
+func Compute(timelines []Timeline, from, to time.Time, planNames map[uint]string) Report {
+	var summary Metrics
+	var churnedFromStart int
+	planChurnedFromStart := make(map[uint]int)
+	plans := make(map[uint]*PlanMetrics)
+	plan := func(id uint) *PlanMetrics {
+		if plans[id] == nil {
+			plans[id] = &PlanMetrics{PlanID: id, PlanName: planNames[id]}
+		}
+		return plans[id]
+	}
+	inRange := func(t time.Time) bool {
+		return !t.Before(from) && t.Before(to)
+	}
+
+	for _, tl := range timelines {
+		if len(tl.Segments) == 0 {
+			continue
+		}
+
+		startSegment, liveAtStart := tl.before(from)
+		if liveAtStart {
+			summary.StartingSubscribers++
+			summary.StartingMRR += startSegment.MRR
+			p := plan(startSegment.PlanID)
+			p.StartingSubscribers++
+			p.StartingMRR += startSegment.MRR
+		}
+		if endSegment, ok := tl.before(to); ok {
+			summary.EndingSubscribers++
+			summary.EndingMRR += endSegment.MRR
+			p := plan(endSegment.PlanID)
+			p.EndingSubscribers++
+			p.EndingMRR += endSegment.MRR
+		}
+
+		if inRange(tl.Start) {
+			first := tl.Segments[0]
+			summary.NewSubscribers++
+			summary.NewMRR += first.MRR
+			p := plan(first.PlanID)
+			p.NewSubscribers++
+			p.NewMRR += first.MRR
+		}
+
+		for i := 1; i < len(tl.Segments); i++ {
+			previous, current := tl.Segments[i-1], tl.Segments[i]
+			if !inRange(current.From) || (tl.End != nil && current.From.After(*tl.End)) {
+				continue
+			}
+			if delta := current.MRR - previous.MRR; delta > 0 {
+				summary.ExpansionMRR += delta
+			} else {
+				summary.ContractionMRR -= delta
+			}
+			plan(previous.PlanID).MovedOutMRR += previous.MRR
+			plan(current.PlanID).MovedInMRR += current.MRR
+		}
+
+		if tl.End != nil && inRange(*tl.End) {
+			last := tl.at(*tl.End)
+			summary.ChurnedSubscribers++
+			summary.ChurnedMRR += last.MRR
+			if liveAtStart {
+				churnedFromStart++
+				planChurnedFromStart[startSegment.PlanID]++
+			}
+			p := plan(last.PlanID)
+			p.ChurnedSubscribers++
+			p.ChurnedMRR += last.MRR
+		}
+	}
+
+	summary.finish(churnedFromStart)
+	report := Report{From: from, To: to, Summary: summary, Plans: make([]PlanMetrics, 0, len(plans))}
+	for _, p := range plans {
+		p.Metrics.finish(planChurnedFromStart[p.PlanID])
+		p.MovedInMRR = roundMoney(p.MovedInMRR)
+		p.MovedOutMRR = roundMoney(p.MovedOutMRR)
+		p.NetNewMRR = roundMoney(p.NewMRR + p.MovedInMRR - p.MovedOutMRR - p.ChurnedMRR)
+		report.Plans = append(report.Plans, *p)
+	}
+	sort.Slice(report.Plans, func(i, j int) bool { return report.Plans[i].PlanID < report.Plans[j].PlanID })
+	return report
+}
+
+// before returns the plan segment a subscription was on just before t, and
+// whether it was live then
+func (tl Timeline) before(t time.Time) (Segment, bool) {
+	if !tl.Start.Before(t) || (tl.End != nil && tl.End.Before(t)) {
+		return Segment{}, false
+	}
+	segment := tl.Segments[0]
+	for _, s := range tl.Segments[1:] {
+		if !s.From.Before(t) {
+			break
+		}
+		segment = s
+	}
+	return segment, true
+}
+
+// at returns the plan segment in effect at t, counting a change made at t
+func (tl Timeline) at(t time.Time) Segment {
+	segment := tl.Segments[0]
+	for _, s := range tl.Segments[1:] {
+		if s.From.After(t) {
+			break
+		}
+		segment = s
+	}
+	return segment
+}
+
+// finish derives the totals and rates and rounds the money figures.
+// churnedFromStart counts the subscribers present at the start of the range
+// who churned during it.
+func (m *Metrics) finish(churnedFromStart int) {
+	m.NetNewMRR = m.NewMRR + m.ExpansionMRR - m.ContractionMRR - m.ChurnedMRR
+	if m.StartingSubscribers > 0 {
+		m.CustomerChurnRate = roundRate(float64(churnedFromStart) / float64(m.StartingSubscribers))
+	}
+	if m.StartingMRR > 0 {
+		m.RevenueChurnRate = roundRate((m.ChurnedMRR + m.ContractionMRR) / m.StartingMRR)
+	}
+
+	m.StartingMRR = roundMoney(m.StartingMRR)
+	m.EndingMRR = roundMoney(m.EndingMRR)
+	m.ARR = roundMoney(m.EndingMRR * 12)
+	m.NewMRR = roundMoney(m.NewMRR)
+	m.ExpansionMRR = roundMoney(m.ExpansionMRR)
+	m.ContractionMRR = roundMoney(m.ContractionMRR)
+	m.ChurnedMRR = roundMoney(m.ChurnedMRR)
+	m.NetNewMRR = roundMoney(m.NetNewMRR)
+}
+
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func roundRate(rate float64) float64 {
+	return math.Round(rate*10000) / 10000
+}
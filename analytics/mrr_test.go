@@ -0,0 +1,211 @@
+package analytics
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// on is midnight UTC on a day of 2024
+func on(month time.Month, day int) time.Time {
+	return time.Date(2024, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func ended(month time.Month, day int) *time.Time {
+	t := on(month, day)
+	return &t
+}
+
+// The range every case below is computed over: March 2024
+var (
+	rangeFrom = on(time.March, 1)
+	rangeTo   = on(time.April, 1)
+)
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeline Timeline
+		want     Metrics
+	}{
+		{
+			name:     "live through the range",
+			timeline: Timeline{Start: on(time.January, 1), Segments: []Segment{{PlanID: 1, MRR: 10, From: on(time.January, 1)}}},
+			want:     Metrics{StartingSubscribers: 1, StartingMRR: 10, EndingSubscribers: 1, EndingMRR: 10, ARR: 120},
+		},
+		{
+			name:     "new in the range",
+			timeline: Timeline{Start: on(time.March, 10), Segments: []Segment{{PlanID: 1, MRR: 10, From: on(time.March, 10)}}},
+			want:     Metrics{EndingSubscribers: 1, EndingMRR: 10, ARR: 120, NewSubscribers: 1, NewMRR: 10, NetNewMRR: 10},
+		},
+		{
+			name:     "starts when the range starts",
+			timeline: Timeline{Start: on(time.March, 1), Segments: []Segment{{PlanID: 1, MRR: 10, From: on(time.March, 1)}}},
+			want:     Metrics{EndingSubscribers: 1, EndingMRR: 10, ARR: 120, NewSubscribers: 1, NewMRR: 10, NetNewMRR: 10},
+		},
+		{
+			name:     "starts when the range ends",
+			timeline: Timeline{Start: on(time.April, 1), Segments: []Segment{{PlanID: 1, MRR: 10, From: on(time.April, 1)}}},
+			want:     Metrics{},
+		},
+		{
+			name: "expansion",
+			timeline: Timeline{Start: on(time.January, 1), Segments: []Segment{
+				{PlanID: 1, MRR: 10, From: on(time.January, 1)},
+				{PlanID: 2, MRR: 25, From: on(time.March, 15)},
+			}},
+			want: Metrics{StartingSubscribers: 1, StartingMRR: 10, EndingSubscribers: 1, EndingMRR: 25, ARR: 300, ExpansionMRR: 15, NetNewMRR: 15},
+		},
+		{
+			name: "contraction",
+			timeline: Timeline{Start: on(time.January, 1), Segments: []Segment{
+				{PlanID: 2, MRR: 25, From: on(time.January, 1)},
+				{PlanID: 1, MRR: 10, From: on(time.March, 15)},
+			}},
+			want: Metrics{StartingSubscribers: 1, StartingMRR: 25, EndingSubscribers: 1, EndingMRR: 10, ARR: 120, ContractionMRR: 15, NetNewMRR: -15, RevenueChurnRate: 0.6},
+		},
+		{
+			name: "plan change before the range",
+			timeline: Timeline{Start: on(time.January, 1), Segments: []Segment{
+				{PlanID: 1, MRR: 10, From: on(time.January, 1)},
+				{PlanID: 2, MRR: 25, From: on(time.February, 1)},
+			}},
+			want: Metrics{StartingSubscribers: 1, StartingMRR: 25, EndingSubscribers: 1, EndingMRR: 25, ARR: 300},
+		},
+		{
+			name: "plan change when the range starts",
+			timeline: Timeline{Start: on(time.January, 1), Segments: []Segment{
+				{PlanID: 1, MRR: 10, From: on(time.January, 1)},
+				{PlanID: 2, MRR: 25, From: on(time.March, 1)},
+			}},
+			want: Metrics{StartingSubscribers: 1, StartingMRR: 10, EndingSubscribers: 1, EndingMRR: 25, ARR: 300, ExpansionMRR: 15, NetNewMRR: 15},
+		},
+		{
+			name: "plan change when the range ends",
+			timeline: Timeline{Start: on(time.January, 1), Segments: []Segment{
+				{PlanID: 1, MRR: 10, From: on(time.January, 1)},
+				{PlanID: 2, MRR: 25, From: on(time.April, 1)},
+			}},
+			want: Metrics{StartingSubscribers: 1, StartingMRR: 10, EndingSubscribers: 1, EndingMRR: 10, ARR: 120},
+		},
+		{
+			name:     "churn in the range",
+			timeline: Timeline{Start: on(time.January, 1), End: ended(time.March, 20), Segments: []Segment{{PlanID: 1, MRR: 10, From: on(time.January, 1)}}},
+			want:     Metrics{StartingSubscribers: 1, StartingMRR: 10, ChurnedSubscribers: 1, ChurnedMRR: 10, NetNewMRR: -10, CustomerChurnRate: 1, RevenueChurnRate: 1},
+		},
+		{
+			name:     "churn when the range starts",
+			timeline: Timeline{Start: on(time.January, 1), End: ended(time.March, 1), Segments: []Segment{{PlanID: 1, MRR: 10, From: on(time.January, 1)}}},
+			want:     Metrics{StartingSubscribers: 1, StartingMRR: 10, ChurnedSubscribers: 1, ChurnedMRR: 10, NetNewMRR: -10, CustomerChurnRate: 1, RevenueChurnRate: 1},
+		},
+		{
+			name:     "churn when the range ends",
+			timeline: Timeline{Start: on(time.January, 1), End: ended(time.April, 1), Segments: []Segment{{PlanID: 1, MRR: 10, From: on(time.January, 1)}}},
+			want:     Metrics{StartingSubscribers: 1, StartingMRR: 10, EndingSubscribers: 1, EndingMRR: 10, ARR: 120},
+		},
+		{
+			name:     "churn before the range",
+			timeline: Timeline{Start: on(time.January, 1), End: ended(time.February, 15), Segments: []Segment{{PlanID: 1, MRR: 10, From: on(time.January, 1)}}},
+			want:     Metrics{},
+		},
+		{
+			name:     "new and churned in the range",
+			timeline: Timeline{Start: on(time.March, 5), End: ended(time.March, 25), Segments: []Segment{{PlanID: 1, MRR: 10, From: on(time.March, 5)}}},
+			want:     Metrics{NewSubscribers: 1, NewMRR: 10, ChurnedSubscribers: 1, ChurnedMRR: 10},
+		},
+		{
+			name: "plan change and churn at the same time",
+			timeline: Timeline{Start: on(time.January, 1), End: ended(time.March, 20), Segments: []Segment{
+				{PlanID: 1, MRR: 10, From: on(time.January, 1)},
+				{PlanID: 2, MRR: 25, From: on(time.March, 20)},
+			}},
+			want: Metrics{StartingSubscribers: 1, StartingMRR: 10, ExpansionMRR: 15, ChurnedSubscribers: 1, ChurnedMRR: 25, NetNewMRR: -10, CustomerChurnRate: 1, RevenueChurnRate: 2.5},
+		},
+		{
+			name: "plan change after churn",
+			timeline: Timeline{Start: on(time.January, 1), End: ended(time.March, 20), Segments: []Segment{
+				{PlanID: 1, MRR: 10, From: on(time.January, 1)},
+				{PlanID: 2, MRR: 25, From: on(time.March, 25)},
+			}},
+			want: Metrics{StartingSubscribers: 1, StartingMRR: 10, ChurnedSubscribers: 1, ChurnedMRR: 10, NetNewMRR: -10, CustomerChurnRate: 1, RevenueChurnRate: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Compute([]Timeline{tt.timeline}, rangeFrom, rangeTo, nil)
+			if !reflect.DeepEqual(report.Summary, tt.want) {
+				t.Errorf("Compute summary =\n%+v\nwant\n%+v", report.Summary, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputePlanMoves(t *testing.T) {
+	timelines := []Timeline{
+		{SubscriptionID: 1, Start: on(time.January, 1), Segments: []Segment{
+			{PlanID: 1, MRR: 10, From: on(time.January, 1)},
+			{PlanID: 2, MRR: 25, From: on(time.March, 15)},
+		}},
+		{SubscriptionID: 2, Start: on(time.March, 10), Segments: []Segment{
+			{PlanID: 2, MRR: 25, From: on(time.March, 10)},
+		}},
+	}
+	report := Compute(timelines, rangeFrom, rangeTo, map[uint]string{1: "Basic", 2: "Pro"})
+
+	want := []PlanMetrics{
+		{
+			PlanID: 1, PlanName: "Basic",
+			Metrics:     Metrics{StartingSubscribers: 1, StartingMRR: 10, NetNewMRR: -10},
+			MovedOutMRR: 10,
+		},
+		{
+			PlanID: 2, PlanName: "Pro",
+			Metrics:    Metrics{EndingSubscribers: 2, EndingMRR: 50, ARR: 600, NewSubscribers: 1, NewMRR: 25, NetNewMRR: 50},
+			MovedInMRR: 25,
+		},
+	}
+	if !reflect.DeepEqual(report.Plans, want) {
+		t.Errorf("Compute plans =\n%+v\nwant\n%+v", report.Plans, want)
+	}
+
+	// A plan move is expansion overall, not new revenue
+	if report.Summary.ExpansionMRR != 15 || report.Summary.NewMRR != 25 {
+		t.Errorf("summary expansion %v and new %v, want 15 and 25", report.Summary.ExpansionMRR, report.Summary.NewMRR)
+	}
+}
+
+func TestComputeReconcilesStartingAndEndingMRR(t *testing.T) {
+	timelines := []Timeline{
+		{Start: on(time.January, 1), Segments: []Segment{{PlanID: 1, MRR: 10, From: on(time.January, 1)}}},
+		{Start: on(time.March, 1), Segments: []Segment{{PlanID: 2, MRR: 25, From: on(time.March, 1)}}},
+		{Start: on(time.March, 9), End: ended(time.March, 31), Segments: []Segment{{PlanID: 1, MRR: 10.33, From: on(time.March, 9)}}},
+		{Start: on(time.January, 5), End: ended(time.March, 1), Segments: []Segment{{PlanID: 2, MRR: 25, From: on(time.January, 5)}}},
+		{Start: on(time.January, 5), End: ended(time.April, 1), Segments: []Segment{{PlanID: 3, MRR: 99.99, From: on(time.January, 5)}}},
+		{Start: on(time.February, 1), Segments: []Segment{
+			{PlanID: 1, MRR: 10, From: on(time.February, 1)},
+			{PlanID: 2, MRR: 25, From: on(time.March, 1)},
+			{PlanID: 3, MRR: 99.99, From: on(time.March, 12)},
+			{PlanID: 1, MRR: 10, From: on(time.March, 30)},
+		}},
+		{Start: on(time.February, 10), End: ended(time.March, 18), Segments: []Segment{
+			{PlanID: 3, MRR: 99.99, From: on(time.February, 10)},
+			{PlanID: 2, MRR: 25, From: on(time.March, 18)},
+		}},
+		{Start: on(time.April, 1), Segments: []Segment{{PlanID: 1, MRR: 10, From: on(time.April, 1)}}},
+	}
+	report := Compute(timelines, rangeFrom, rangeTo, nil)
+
+	reconciles := func(name string, m Metrics) {
+		if got := roundMoney(m.StartingMRR + m.NetNewMRR); got != m.EndingMRR {
+			t.Errorf("%s: starting %v + net new %v = %v, want ending %v", name, m.StartingMRR, m.NetNewMRR, got, m.EndingMRR)
+		}
+	}
+	reconciles("summary", report.Summary)
+	for _, p := range report.Plans {
+		reconciles(fmt.Sprintf("plan %d", p.PlanID), p.Metrics)
+	}
+	if len(report.Plans) != 3 {
+		t.Errorf("%d plans reported, want 3", len(report.Plans))
+	}
+}
@@ -0,0 +1,77 @@
+package analytics
+
+import (
+	"time"
+
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+)
+
+// RevenueMonth is one month of the revenue recognition report
+type RevenueMonth struct {
+	Month string `json:"month"`
+	// Revenue from invoices paid in the month
+	Billed float64 `json:"billed"`
+	// Revenue earned in the month, whether or not it has been posted yet
+	Recognized float64 `json:"recognized"`
+	// Revenue paid for by the end of the month but earned after it
+	Deferred float64 `json:"deferred"`
+}
+
+// RevenueReport summarises the revenue schedules of a currency for each month
+// from the month of from to the month of to. It reflects the schedules as
+// they stand, after any refunds and cancellations.
+func RevenueReport(db *gorm.DB, currency string, from, to time.Time) ([]RevenueMonth, error) {
+	first, last := monthOf(from), monthOf(to)
+
+	var entries []struct {
+		Month     time.Time
+		Amount    float64
+		CreatedAt time.Time
+	}
+	err := db.Model(&models.RevenueScheduleEntry{}).
+		Joins("JOIN revenue_schedules ON revenue_schedules.id = revenue_schedule_entries.schedule_id").
+		Where("revenue_schedules.currency = ? AND revenue_schedule_entries.month >= ? AND revenue_schedules.created_at < ?",
+			currency, first, last.AddDate(0, 1, 0)).
+		Select("revenue_schedule_entries.month AS month, revenue_schedule_entries.amount AS amount, revenue_schedules.created_at AS created_at").
+		Scan(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var schedules []models.RevenueSchedule
+	if err := db.Where("currency = ? AND created_at >= ? AND created_at < ?", currency, first, last.AddDate(0, 1, 0)).
+		Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+
+	var months []RevenueMonth
+	for month := first; !month.After(last); month = month.AddDate(0, 1, 0) {
+		end := month.AddDate(0, 1, 0)
+		row := RevenueMonth{Month: month.Format("2006-01")}
+		for _, schedule := range schedules {
+			if !schedule.CreatedAt.Before(month) && schedule.CreatedAt.Before(end) {
+				row.Billed += schedule.Amount
+			}
+		}
+		for _, entry := range entries {
+			entryMonth := monthOf(entry.Month)
+			switch {
+			case entryMonth.Equal(month):
+				row.Recognized += entry.Amount
+			case entryMonth.After(month) && entry.CreatedAt.Before(end):
+				row.Deferred += entry.Amount
+			}
+		}
+		row.Billed = roundMoney(row.Billed)
+		row.Recognized = roundMoney(row.Recognized)
+		row.Deferred = roundMoney(row.Deferred)
+		months = append(months, row)
+	}
+	return months, nil
+}
+
+func monthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,136 @@
+// Package apperror defines the errors the API reports to callers. Each
+// carries a stable machine-readable code; Handler renders them, and any
+// other error a request fails with, as RFC 7807 problem details.
+package apperror
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Code identifies a kind of failure. Codes are part of the API and never
+// change meaning.
+type Code string
+
+const (
+	CodeBadRequest           Code = "bad_request"       // the request could not be read
+	CodeValidationFailed     Code = "validation_failed" // the request was read but breaks a rule
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not_found"
+	CodeMethodNotAllowed     Code = "method_not_allowed"
+	CodeConflict             Code = "conflict"
+	CodePreconditionFailed   Code = "precondition_failed"   // the record changed since the caller read it
+	CodePreconditionRequired Code = "precondition_required" // the update must say which version it expects
+	CodeUnprocessable        Code = "unprocessable"         // the request was valid but could not be carried out
+	CodePaymentRequired      Code = "payment_required"
+	CodePayloadTooLarge      Code = "payload_too_large"
+	CodeInternal             Code = "internal_error"
+	CodeUpstream             Code = "upstream_error" // a service the API relies on, such as the payment provider, failed
+	CodeUnavailable          Code = "unavailable"    // the feature is not configured on this server
+)
+
+// statuses maps each code to the HTTP status it is reported with
+var statuses = map[Code]int{
+	CodeBadRequest:           http.StatusBadRequest,
+	CodeValidationFailed:     http.StatusBadRequest,
+	CodeUnauthorized:         http.StatusUnauthorized,
+	CodeForbidden:            http.StatusForbidden,
+	CodeNotFound:             http.StatusNotFound,
+	CodeMethodNotAllowed:     http.StatusMethodNotAllowed,
+	CodeConflict:             http.StatusConflict,
+	CodePreconditionFailed:   http.StatusPreconditionFailed,
+	CodePreconditionRequired: http.StatusPreconditionRequired,
+	CodeUnprocessable:        http.StatusUnprocessableEntity,
+	CodePaymentRequired:      http.StatusPaymentRequired,
+	CodePayloadTooLarge:      http.StatusRequestEntityTooLarge,
+	CodeInternal:             http.StatusInternalServerError,
+	CodeUpstream:             http.StatusBadGateway,
+	CodeUnavailable:          http.StatusServiceUnavailable,
+}
+
+// Status returns the HTTP status a code is reported with
+func (c Code) Status() int {
+	if status, ok := statuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Field error codes
+const (
+	FieldRequired    = "required"
+	FieldInvalid     = "invalid"
+	FieldOutOfRange  = "out_of_range"
+	FieldUnsupported = "unsupported"
+	FieldNotFound    = "not_found"
+	FieldUnknown     = "unknown"   // the field is not part of the request
+	FieldForbidden   = "forbidden" // the caller may not change the field
+)
+
+// FieldError explains what is wrong with one field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is a failure reported to the caller. Detail is shown to the caller;
+// Err, if set, is the underlying cause and is only logged.
+type Error struct {
+	Code   Code
+	Detail string
+	Fields []FieldError
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Detail)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New returns an error with the given code and detail
+func New(code Code, detail string) *Error {
+	return &Error{Code: code, Detail: detail}
+}
+
+// Wrap returns an error with the given code and detail caused by err
+func Wrap(code Code, detail string, err error) *Error {
+	return &Error{Code: code, Detail: detail, Err: err}
+}
+
+func BadRequest(detail string) *Error { return New(CodeBadRequest, detail) }
+
+func Unauthorized(detail string) *Error { return New(CodeUnauthorized, detail) }
+
+func Forbidden(detail string) *Error { return New(CodeForbidden, detail) }
+
+func NotFound(detail string) *Error { return New(CodeNotFound, detail) }
+
+func Conflict(detail string) *Error { return New(CodeConflict, detail) }
+
+func PaymentRequired(detail string) *Error { return New(CodePaymentRequired, detail) }
+
+func PreconditionFailed(detail string) *Error { return New(CodePreconditionFailed, detail) }
+
+// Validation reports a request that breaks a rule, listing the offending
+// fields if there are any
+func Validation(detail string, fields ...FieldError) *Error {
+	return &Error{Code: CodeValidationFailed, Detail: detail, Fields: fields}
+}
+
+// Internal reports an unexpected failure. The detail is shown to the caller
+// and err is logged.
+func Internal(detail string, err error) *Error {
+	return Wrap(CodeInternal, detail, err)
+}
+
+// Upstream reports a failure of a service the API relies on. The detail is
+// shown to the caller and err is logged.
+func Upstream(detail string, err error) *Error {
+	return Wrap(CodeUpstream, detail, err)
+}
@@ -0,0 +1,70 @@
+package apperror
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ContentType is the media type of problem details
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem details document, extended with the error
+// code, the request ID and any field errors
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance"`
+	Code      Code         `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// Handler is the application's Fiber ErrorHandler. Errors that are not an
+// *Error are reported by their Fiber status, or as internal errors without
+// their message, which is logged instead. Server-side failures are logged
+// with the request ID.
+func Handler(c *fiber.Ctx, err error) error {
+	var appErr *Error
+	var fiberErr *fiber.Error
+	switch {
+	case errors.As(err, &appErr):
+	case errors.As(err, &fiberErr):
+		appErr = New(codeForStatus(fiberErr.Code), fiberErr.Message)
+	default:
+		appErr = Internal("The server could not complete the request", err)
+	}
+
+	requestID := c.GetRespHeader(fiber.HeaderXRequestID)
+	status := appErr.Code.Status()
+	if status >= http.StatusInternalServerError {
+		log.Printf("request %s %s %s failed: %v", requestID, c.Method(), c.OriginalURL(), err)
+	}
+
+	return c.Status(status).JSON(Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    appErr.Detail,
+		Instance:  c.OriginalURL(),
+		Code:      appErr.Code,
+		RequestID: requestID,
+		Errors:    appErr.Fields,
+	}, ContentType)
+}
+
+func codeForStatus(status int) Code {
+	for code, s := range statuses {
+		if s == status && code != CodeValidationFailed {
+			return code
+		}
+	}
+	if status < http.StatusInternalServerError {
+		return CodeBadRequest
+	}
+	return CodeInternal
+}
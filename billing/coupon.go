@@ -0,0 +1,200 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidCoupon           = errors.New("a coupon needs either percent_off between 0 and 100 or a positive amount_off with a supported currency, and a duration of once, repeating or forever")
+	ErrInvalidPromotionCode    = errors.New("promotion code is not valid")
+	ErrPromotionCodeExpired    = errors.New("promotion code has expired")
+	ErrPromotionCodeExhausted  = errors.New("promotion code has reached its redemption limit")
+	ErrPromotionCodeNotForPlan = errors.New("promotion code does not apply to this plan")
+	ErrCouponCurrency          = errors.New("coupon currency does not match the subscription currency")
+)
+
+// ValidateCoupon checks that a coupon describes exactly one kind of discount
+// and how long it lasts
+func ValidateCoupon(coupon *models.Coupon) error {
+	coupon.Currency = strings.ToUpper(coupon.Currency)
+
+	switch {
+	case coupon.PercentOff > 0 && coupon.AmountOff > 0:
+		return ErrInvalidCoupon
+	case coupon.PercentOff > 0:
+		if coupon.PercentOff > 100 {
+			return ErrInvalidCoupon
+		}
+		coupon.Currency = ""
+	case coupon.AmountOff > 0:
+		if !config.Billing.IsSupportedCurrency(coupon.Currency) {
+			return ErrInvalidCoupon
+		}
+		coupon.AmountOff = roundMoney(coupon.AmountOff)
+	default:
+		return ErrInvalidCoupon
+	}
+
+	switch coupon.Duration {
+	case models.CouponDurationOnce, models.CouponDurationForever:
+		coupon.DurationInPeriods = 0
+	case models.CouponDurationRepeating:
+		if coupon.DurationInPeriods <= 0 {
+			return ErrInvalidCoupon
+		}
+	default:
+		return ErrInvalidCoupon
+	}
+	return nil
+}
+
+// NormalizePromotionCode gives the stored form of a customer-entered code
+func NormalizePromotionCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// RedeemPromotionCode applies the coupon behind a promotion code to a
+// subscription, replacing any discount it already has. The discount starts
+// with the subscription's next period invoice.
+func RedeemPromotionCode(tx *gorm.DB, sub *models.Subscription, code string) (*models.Discount, error) {
+	var promo models.PromotionCode
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("code = ?", NormalizePromotionCode(code)).
+		First(&promo).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidPromotionCode
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Preload("Coupon").Preload("Plans").First(&promo, promo.ID).Error; err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	switch {
+	case !promo.Active:
+		return nil, ErrInvalidPromotionCode
+	case promo.ExpiresAt != nil && !now.Before(*promo.ExpiresAt):
+		return nil, ErrPromotionCodeExpired
+	case promo.MaxRedemptions > 0 && promo.TimesRedeemed >= promo.MaxRedemptions:
+		return nil, ErrPromotionCodeExhausted
+	case !appliesToPlan(promo, sub.PlanID):
+		return nil, ErrPromotionCodeNotForPlan
+	case promo.Coupon.AmountOff > 0 && sub.Currency != "" && promo.Coupon.Currency != sub.Currency:
+		return nil, ErrCouponCurrency
+	}
+
+	if err := endDiscount(tx, sub, now); err != nil {
+		return nil, err
+	}
+
+	discount := models.Discount{
+		SubscriptionID:  sub.ID,
+		CouponID:        promo.CouponID,
+		Coupon:          promo.Coupon,
+		PromotionCodeID: &promo.ID,
+	}
+	switch promo.Coupon.Duration {
+	case models.CouponDurationOnce:
+		discount.PeriodsRemaining = 1
+	case models.CouponDurationRepeating:
+		discount.PeriodsRemaining = promo.Coupon.DurationInPeriods
+	}
+	if err := tx.Omit("Coupon", "PromotionCode").Create(&discount).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Model(&promo).Update("times_redeemed", gorm.Expr("times_redeemed + 1")).Error; err != nil {
+		return nil, err
+	}
+	if err := RecordEvent(tx, sub, models.SubscriptionEventDiscounted, nil, "Promotion code %s applied: %s", promo.Code, couponLabel(promo.Coupon)); err != nil {
+		return nil, err
+	}
+
+	sub.Discount = &discount
+	return &discount, nil
+}
+
+// discountLine adds the subscription's discount, if any, to a period
+// invoice and counts the period against it
+func discountLine(tx *gorm.DB, sub *models.Subscription, invoice *models.Invoice) error {
+	var discount models.Discount
+	err := tx.Preload("Coupon").
+		Where("subscription_id = ? AND ended_at IS NULL", sub.ID).
+		First(&discount).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var base float64
+	for _, line := range invoice.LineItems {
+		base += roundMoney(line.UnitAmount * float64(line.Quantity))
+	}
+
+	var amount float64
+	coupon := discount.Coupon
+	switch {
+	case coupon.PercentOff > 0:
+		amount = roundMoney(base * coupon.PercentOff / 100)
+	case coupon.Currency == invoice.Currency:
+		amount = math.Min(coupon.AmountOff, base)
+	}
+	if amount > 0 {
+		invoice.LineItems = append(invoice.LineItems, models.InvoiceLineItem{
+			Description: "Discount: " + couponLabel(coupon),
+			DiscountID:  &discount.ID,
+			Quantity:    1,
+			UnitAmount:  -amount,
+			PeriodStart: invoice.PeriodStart,
+			PeriodEnd:   invoice.PeriodEnd,
+		})
+	}
+
+	if coupon.Duration == models.CouponDurationForever {
+		return nil
+	}
+	discount.PeriodsRemaining--
+	if discount.PeriodsRemaining <= 0 {
+		now := time.Now()
+		discount.EndedAt = &now
+	}
+	return tx.Model(&discount).Select("periods_remaining", "ended_at").Updates(&discount).Error
+}
+
+func endDiscount(tx *gorm.DB, sub *models.Subscription, at time.Time) error {
+	return tx.Model(&models.Discount{}).
+		Where("subscription_id = ? AND ended_at IS NULL", sub.ID).
+		Update("ended_at", at).Error
+}
+
+func appliesToPlan(promo models.PromotionCode, planID uint) bool {
+	if len(promo.Plans) == 0 {
+		return true
+	}
+	for _, plan := range promo.Plans {
+		if plan.ID == planID {
+			return true
+		}
+	}
+	return false
+}
+
+func couponLabel(coupon models.Coupon) string {
+	if coupon.PercentOff > 0 {
+		return fmt.Sprintf("%s (%g%% off)", coupon.Name, coupon.PercentOff)
+	}
+	return fmt.Sprintf("%s (%s off)", coupon.Name, formatMoney(coupon.AmountOff, coupon.Currency))
+}
@@ -0,0 +1,346 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/notify"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// retryHold is how long a payment retry in progress keeps other schedulers
+// away from its invoice
+const retryHold = time.Hour
+
+// Notifier tells customers about failed payments and their consequences
+var Notifier notify.Notifier = notify.LogNotifier{}
+
+// RenewDue renews every active subscription whose period has ended and
+// charges the renewal invoice. A failed charge starts dunning.
+func RenewDue(ctx context.Context, db *gorm.DB, now time.Time) error {
+	var ids []uint
+	if err := db.Model(&models.Subscription{}).
+		Where("status = ? AND active = ? AND expires_at <= ?", models.SubscriptionStatusActive, true, now).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := renewOne(ctx, db, id, now); err != nil {
+			log.Printf("Renewing subscription %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func renewOne(ctx context.Context, db *gorm.DB, id uint, now time.Time) error {
+	var invoice *models.Invoice
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Lock and re-check so concurrent schedulers renew each period once
+		var sub models.Subscription
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sub, id).Error; err != nil {
+			return err
+		}
+		if sub.Status != models.SubscriptionStatusActive || sub.ExpiresAt.After(now) {
+			return nil
+		}
+
+		var err error
+		invoice, err = Renew(tx, &sub)
+		return err
+	})
+	if err != nil || invoice == nil || invoice.Status != models.InvoiceStatusOpen {
+		return err
+	}
+
+	err = Collect(ctx, db, invoice, func(tx *gorm.DB, invoice *models.Invoice, paymentErr error) error {
+		if paymentErr == nil {
+			return nil
+		}
+		sub, err := lockSubscription(tx, invoice)
+		if err != nil {
+			return err
+		}
+		return StartDunning(ctx, tx, sub, invoice, paymentErr.Error())
+	})
+	if isPaymentFailure(err) {
+		return nil
+	}
+	return err
+}
+
+// StartDunning marks a subscription past due after its invoice could not be
+// collected and schedules the first retry. It does nothing if the invoice is
+// already being retried.
+func StartDunning(ctx context.Context, tx *gorm.DB, sub *models.Subscription, invoice *models.Invoice, reason string) error {
+	if invoice.NextPaymentAttemptAt != nil || invoice.Status != models.InvoiceStatusOpen {
+		return nil
+	}
+
+	if err := SetSubscriptionStatus(tx, sub, models.SubscriptionStatusPastDue, "Payment failed: "+reason); err != nil {
+		return err
+	}
+	if err := RecordEvent(tx, sub, models.SubscriptionEventPaymentFailed, invoice, "Payment of invoice %s failed: %s", invoice.Number, reason); err != nil {
+		return err
+	}
+
+	policy := config.Billing.Dunning
+	if len(policy.RetryDays) == 0 {
+		return exhaustDunning(ctx, tx, sub, invoice)
+	}
+
+	next := sub.PastDueSince.AddDate(0, 0, policy.RetryDays[0])
+	invoice.NextPaymentAttemptAt = &next
+	if err := tx.Model(invoice).Update("next_payment_attempt_at", next).Error; err != nil {
+		return err
+	}
+
+	return notifyCustomer(ctx, tx, sub, notify.PaymentFailed,
+		"Your payment failed",
+		fmt.Sprintf("We could not collect %.2f %s for invoice %s (%s). We will try again on %s.",
+			invoice.AmountDue-invoice.AmountPaid, invoice.Currency, invoice.Number, reason, next.Format("Jan 2, 2006")))
+}
+
+// RetryDuePayments makes every retry the dunning schedule has due by now
+func RetryDuePayments(ctx context.Context, db *gorm.DB, now time.Time) error {
+	var ids []uint
+	if err := db.Model(&models.Invoice{}).
+		Where("status = ? AND next_payment_attempt_at <= ?", models.InvoiceStatusOpen, now).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := retryOne(ctx, db, id, now); err != nil {
+			log.Printf("Retrying payment of invoice %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+func retryOne(ctx context.Context, db *gorm.DB, id uint, now time.Time) error {
+	var invoice models.Invoice
+	due := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&invoice, id).Error; err != nil {
+			return err
+		}
+		if invoice.Status != models.InvoiceStatusOpen || invoice.NextPaymentAttemptAt == nil || invoice.NextPaymentAttemptAt.After(now) {
+			return nil
+		}
+		sub, err := lockSubscription(tx, &invoice)
+		if err != nil {
+			return err
+		}
+
+		// A subscription that lost access and was replaced cannot come back,
+		// so it is not charged for
+		replaced, err := isReplaced(tx, sub)
+		if err != nil {
+			return err
+		}
+		if replaced {
+			if err := Void(tx, &invoice); err != nil {
+				return err
+			}
+			return CancelSubscription(tx, sub, "Replaced by another subscription")
+		}
+
+		// Hold the retry for a while so other schedulers skip it; if its
+		// outcome is never recorded it is made again once the hold ends
+		hold := now.Add(retryHold)
+		invoice.DunningRetries++
+		invoice.NextPaymentAttemptAt = &hold
+		due = true
+		return tx.Model(&invoice).Select("dunning_retries", "next_payment_attempt_at").Updates(&invoice).Error
+	})
+	if err != nil || !due {
+		return err
+	}
+
+	err = Collect(ctx, db, &invoice, func(tx *gorm.DB, invoice *models.Invoice, paymentErr error) error {
+		sub, err := lockSubscription(tx, invoice)
+		if err != nil {
+			return err
+		}
+		return settleRetry(ctx, tx, sub, invoice, paymentErr, now)
+	})
+	if isPaymentFailure(err) {
+		return nil
+	}
+	return err
+}
+
+// settleRetry moves a past due subscription along with the outcome of a
+// payment retry
+func settleRetry(ctx context.Context, tx *gorm.DB, sub *models.Subscription, invoice *models.Invoice, paymentErr error, now time.Time) error {
+	if paymentErr == nil {
+		if err := RecordEvent(tx, sub, models.SubscriptionEventPaymentRetry, invoice, "Retry %d succeeded", invoice.DunningRetries); err != nil {
+			return err
+		}
+		resumed, err := ResumeSubscription(tx, sub, invoice, "Payment recovered")
+		if err != nil || !resumed {
+			return err
+		}
+		return notifyCustomer(ctx, tx, sub, notify.PaymentRecovered,
+			"Payment received",
+			fmt.Sprintf("Thank you, invoice %s has been paid and your subscription is active again.", invoice.Number))
+	}
+
+	if err := RecordEvent(tx, sub, models.SubscriptionEventPaymentRetry, invoice, "Retry %d failed: %s", invoice.DunningRetries, paymentErr); err != nil {
+		return err
+	}
+
+	policy := config.Billing.Dunning
+	if invoice.DunningRetries >= len(policy.RetryDays) || sub.PastDueSince == nil {
+		return exhaustDunning(ctx, tx, sub, invoice)
+	}
+
+	next := sub.PastDueSince.AddDate(0, 0, policy.RetryDays[invoice.DunningRetries])
+	if next.Before(now) {
+		next = now
+	}
+	invoice.NextPaymentAttemptAt = &next
+	if err := tx.Model(invoice).Update("next_payment_attempt_at", next).Error; err != nil {
+		return err
+	}
+
+	return notifyCustomer(ctx, tx, sub, notify.PaymentRetryFailed,
+		"Your payment failed again",
+		fmt.Sprintf("We still could not collect payment for invoice %s (%s). We will try again on %s; please update your payment method.",
+			invoice.Number, paymentErr, next.Format("Jan 2, 2006")))
+}
+
+// RevokeExpiredGrace removes access from subscriptions that have been past
+// due for longer than the grace period. Dunning carries on; a later
+// successful retry restores access.
+func RevokeExpiredGrace(ctx context.Context, db *gorm.DB, now time.Time) error {
+	cutoff := now.Add(-config.Billing.Dunning.GracePeriod)
+
+	var subs []models.Subscription
+	if err := db.Where("status = ? AND active = ? AND past_due_since <= ?", models.SubscriptionStatusPastDue, true, cutoff).
+		Find(&subs).Error; err != nil {
+		return err
+	}
+
+	for i := range subs {
+		sub := &subs[i]
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// The invoice may have been paid or the subscription cancelled
+			// since it was read; only a subscription still past due loses
+			// access, and only the run that revoked it records and notifies
+			result := tx.Model(&models.Subscription{}).
+				Where("id = ? AND status = ? AND active AND past_due_since <= ?", sub.ID, models.SubscriptionStatusPastDue, cutoff).
+				Update("active", false)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != 1 {
+				return nil
+			}
+			sub.Active = false
+			if err := RecordEvent(tx, sub, models.SubscriptionEventAccessRevoked, nil, "Grace period ended"); err != nil {
+				return err
+			}
+			return notifyCustomer(ctx, tx, sub, notify.AccessSuspended,
+				"Your subscription is suspended",
+				"Your grace period has ended. Access will be restored as soon as your outstanding invoice is paid.")
+		})
+		if err != nil {
+			log.Printf("Revoking access of subscription %d: %v", sub.ID, err)
+		}
+	}
+	return nil
+}
+
+// exhaustDunning applies the final action once every retry has failed: the
+// invoice is voided and the subscription cancelled or downgraded
+func exhaustDunning(ctx context.Context, tx *gorm.DB, sub *models.Subscription, invoice *models.Invoice) error {
+	if err := Void(tx, invoice); err != nil {
+		return err
+	}
+
+	policy := config.Billing.Dunning
+	if policy.FinalAction == config.DunningFinalDowngrade {
+		var plan models.Plan
+		if err := tx.First(&plan, policy.DowngradePlanID).Error; err != nil {
+			return fmt.Errorf("loading downgrade plan: %w", err)
+		}
+
+		fromPlanID := sub.PlanID
+		event := models.SubscriptionEvent{
+			SubscriptionID: sub.ID,
+			Type:           models.SubscriptionEventPlanChanged,
+			FromPlanID:     &fromPlanID,
+			ToPlanID:       &plan.ID,
+			InvoiceID:      &invoice.ID,
+			Message:        "Downgraded after failed payment retries",
+		}
+		if err := tx.Create(&event).Error; err != nil {
+			return err
+		}
+
+		// The unpaid period is forfeited and a period on the downgrade plan
+		// starts now without an invoice; otherwise the next scheduler run
+		// would find the subscription due and charge it at once
+		now := time.Now()
+		sub.PlanID = plan.ID
+		sub.BillingCycleAnchor = now
+		sub.CurrentPeriodStart = now
+		sub.ExpiresAt = PlanInterval(plan).AddTo(now, 1)
+		if err := tx.Model(sub).Select("plan_id", "billing_cycle_anchor", "current_period_start", "expires_at").Updates(sub).Error; err != nil {
+			return err
+		}
+		if err := SetSubscriptionStatus(tx, sub, models.SubscriptionStatusActive, "Downgraded after failed payment retries"); err != nil {
+			return err
+		}
+
+		return notifyCustomer(ctx, tx, sub, notify.SubscriptionDowngrade,
+			"Your subscription has been downgraded",
+			fmt.Sprintf("We could not collect payment for invoice %s, so your subscription has been moved to the %s plan.", invoice.Number, plan.Name))
+	}
+
+	if err := CancelSubscription(tx, sub, "Cancelled after failed payment retries"); err != nil {
+		return err
+	}
+	return notifyCustomer(ctx, tx, sub, notify.SubscriptionCancelled,
+		"Your subscription has been cancelled",
+		fmt.Sprintf("We could not collect payment for invoice %s after several attempts, so your subscription has been cancelled.", invoice.Number))
+}
+
+// lockSubscription locks the subscription an invoice bills
+func lockSubscription(tx *gorm.DB, invoice *models.Invoice) (*models.Subscription, error) {
+	if invoice.SubscriptionID == nil {
+		return nil, errors.New("invoice has no subscription")
+	}
+	var sub models.Subscription
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sub, *invoice.SubscriptionID).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+// isPaymentFailure reports whether a collection failed for want of payment
+// rather than an error of its own
+func isPaymentFailure(err error) bool {
+	return errors.Is(err, ErrPaymentFailed) || errors.Is(err, ErrNoPaymentMethod)
+}
+
+func notifyCustomer(ctx context.Context, tx *gorm.DB, sub *models.Subscription, notificationType, subject, body string) error {
+	var user models.User
+	if err := tx.First(&user, sub.UserID).Error; err != nil {
+		return err
+	}
+
+	// A notification that cannot be sent must not undo the billing change
+	if err := Notifier.Notify(ctx, notify.Notification{Type: notificationType, To: BillingEmail(user), Subject: subject, Body: body}); err != nil {
+		log.Printf("Notifying subscription %d: %v", sub.ID, err)
+	}
+	return nil
+}
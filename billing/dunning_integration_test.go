@@ -0,0 +1,335 @@
+//go:build integration
+
+package billing_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/payments"
+	"github.com/chandra-devs/subscription_app/testdb"
+	"gorm.io/gorm"
+)
+
+// renewal is a migrated database holding a monthly subscription whose
+// period has just ended, paid with a card that behaves as the token it was
+// attached with, and the fake provider charging it
+type renewal struct {
+	db       *gorm.DB
+	provider *payments.FakeProvider
+	sub      models.Subscription
+}
+
+func newRenewal(t *testing.T, token string) *renewal {
+	t.Helper()
+	config.InitBillingConfig()
+	config.Billing.Dunning = config.DunningConfig{
+		RetryDays:   []int{1, 3},
+		GracePeriod: 7 * 24 * time.Hour,
+		FinalAction: config.DunningFinalCancel,
+	}
+	db := testdb.Open(t)
+	provider := payments.NewFakeProvider()
+	previous := billing.Payments
+	billing.Payments = provider
+	t.Cleanup(func() { billing.Payments = previous })
+
+	user := &models.User{Name: "Ada Lovelace", Email: "ada@example.com", Password: "not a real hash"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := billing.AddPaymentMethod(context.Background(), db, user, token); err != nil {
+		t.Fatal(err)
+	}
+	plan := &models.Plan{Name: "Pro", Price: 20, Duration: 30, IntervalUnit: billing.IntervalMonth, IntervalCount: 1}
+	if err := db.Create(plan).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().AddDate(0, -1, 0).Add(-time.Hour)
+	r := &renewal{db: db, provider: provider, sub: models.Subscription{
+		UserID:             user.ID,
+		PlanID:             plan.ID,
+		Status:             models.SubscriptionStatusActive,
+		Active:             true,
+		StartDate:          start,
+		BillingCycleAnchor: start,
+		CurrentPeriodStart: start,
+		ExpiresAt:          start.AddDate(0, 1, 0),
+		Currency:           config.Billing.BaseCurrency,
+	}}
+	if err := db.Create(&r.sub).Error; err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// renew runs the scheduler's renewal and returns the renewal invoice
+func (r *renewal) renew(t *testing.T) models.Invoice {
+	t.Helper()
+	if err := billing.RenewDue(context.Background(), r.db, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	return r.invoice(t)
+}
+
+// retry runs the scheduler's payment retries when the next one is due
+func (r *renewal) retry(t *testing.T) models.Invoice {
+	t.Helper()
+	invoice := r.invoice(t)
+	if invoice.NextPaymentAttemptAt == nil {
+		t.Fatalf("invoice %s has no retry scheduled", invoice.Number)
+	}
+	if err := billing.RetryDuePayments(context.Background(), r.db, *invoice.NextPaymentAttemptAt); err != nil {
+		t.Fatal(err)
+	}
+	return r.invoice(t)
+}
+
+func (r *renewal) invoice(t *testing.T) models.Invoice {
+	t.Helper()
+	var invoice models.Invoice
+	if err := r.db.Where("subscription_id = ?", r.sub.ID).Order("id DESC").First(&invoice).Error; err != nil {
+		t.Fatal(err)
+	}
+	return invoice
+}
+
+func (r *renewal) subscription(t *testing.T) models.Subscription {
+	t.Helper()
+	var sub models.Subscription
+	if err := r.db.First(&sub, r.sub.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
+func collectionKey(invoice models.Invoice, collection int) string {
+	return fmt.Sprintf("invoice-%d-collection-%d", invoice.ID, collection)
+}
+
+func TestRenewDueThroughTheFakeProvider(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		lose       error // reported after the charge is made
+		wantErr    error
+		wantKept   bool // whether the idempotency key is kept for the retry
+		wantCharge bool
+	}{
+		{name: "paid", token: payments.TokenVisa, wantCharge: true},
+		{name: "card declined", token: payments.TokenCardDeclined, wantErr: payments.ErrCardDeclined},
+		{name: "insufficient funds", token: payments.TokenInsufficientFunds, wantErr: payments.ErrInsufficientFunds},
+		{name: "timeout", token: payments.TokenNetworkTimeout, wantErr: payments.ErrNetworkTimeout, wantKept: true},
+		{name: "timeout after the charge", token: payments.TokenVisa, lose: payments.ErrNetworkTimeout, wantErr: payments.ErrNetworkTimeout, wantKept: true, wantCharge: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRenewal(t, tt.token)
+			if tt.lose != nil {
+				r.provider.FailNextAfterCharge(tt.lose)
+			}
+
+			invoice := r.renew(t)
+			sub := r.subscription(t)
+			if !sub.ExpiresAt.After(time.Now()) {
+				t.Errorf("subscription still expires at %s", sub.ExpiresAt)
+			}
+			if charged := len(r.provider.Charges()) == 1; charged != tt.wantCharge {
+				t.Errorf("%d charges made", len(r.provider.Charges()))
+			}
+
+			if tt.wantErr == nil {
+				if invoice.Status != models.InvoiceStatusPaid || sub.Status != models.SubscriptionStatusActive {
+					t.Errorf("invoice %s and subscription %s, want paid and active", invoice.Status, sub.Status)
+				}
+				if invoice.ChargeID != r.provider.Charges()[0].ID {
+					t.Errorf("invoice records charge %q", invoice.ChargeID)
+				}
+				return
+			}
+
+			if invoice.Status != models.InvoiceStatusOpen || sub.Status != models.SubscriptionStatusPastDue || !sub.Active {
+				t.Errorf("invoice %s and subscription %s (active %v), want open and past due with access", invoice.Status, sub.Status, sub.Active)
+			}
+			if !strings.Contains(invoice.LastPaymentError, tt.wantErr.Error()) {
+				t.Errorf("last payment error %q, want %q", invoice.LastPaymentError, tt.wantErr)
+			}
+			if invoice.NextPaymentAttemptAt == nil || sub.PastDueSince == nil ||
+				!invoice.NextPaymentAttemptAt.Equal(sub.PastDueSince.AddDate(0, 0, 1)) {
+				t.Errorf("next attempt at %v, want a day after %v", invoice.NextPaymentAttemptAt, sub.PastDueSince)
+			}
+			wantKey := ""
+			if tt.wantKept {
+				wantKey = collectionKey(invoice, 1)
+			}
+			if invoice.PaymentKey != wantKey {
+				t.Errorf("payment key %q, want %q", invoice.PaymentKey, wantKey)
+			}
+		})
+	}
+}
+
+func TestRetryDuePaymentsRecovers(t *testing.T) {
+	tests := []struct {
+		name string
+		// fail makes the renewal charge fail; the card works afterwards
+		fail           func(*payments.FakeProvider)
+		wantCollection int // the collection the retry is charged under
+	}{
+		{
+			name:           "after a decline",
+			fail:           func(p *payments.FakeProvider) { p.FailNext(payments.ErrCardDeclined) },
+			wantCollection: 2,
+		},
+		{
+			name:           "after insufficient funds",
+			fail:           func(p *payments.FakeProvider) { p.FailNext(payments.ErrInsufficientFunds) },
+			wantCollection: 2,
+		},
+		{
+			name:           "after a timeout",
+			fail:           func(p *payments.FakeProvider) { p.FailNext(payments.ErrNetworkTimeout) },
+			wantCollection: 1,
+		},
+		{
+			// The renewal's charge went through; the retry finds it
+			name:           "after a timeout once charged",
+			fail:           func(p *payments.FakeProvider) { p.FailNextAfterCharge(payments.ErrNetworkTimeout) },
+			wantCollection: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRenewal(t, payments.TokenVisa)
+			tt.fail(r.provider)
+
+			if invoice := r.renew(t); invoice.Status != models.InvoiceStatusOpen {
+				t.Fatalf("renewal invoice is %s, want open", invoice.Status)
+			}
+			invoice := r.retry(t)
+			sub := r.subscription(t)
+
+			if invoice.Status != models.InvoiceStatusPaid || sub.Status != models.SubscriptionStatusActive || !sub.Active {
+				t.Fatalf("invoice %s and subscription %s (active %v), want paid and active", invoice.Status, sub.Status, sub.Active)
+			}
+			charges := r.provider.Charges()
+			if len(charges) != 1 {
+				t.Fatalf("customer charged %d times, want once", len(charges))
+			}
+			if invoice.ChargeID != charges[0].ID || invoice.NextPaymentAttemptAt != nil || invoice.DunningRetries != 1 {
+				t.Errorf("invoice records charge %q, next attempt %v and %d retries", invoice.ChargeID, invoice.NextPaymentAttemptAt, invoice.DunningRetries)
+			}
+			if want := collectionKey(invoice, tt.wantCollection); invoice.PaymentKey != want {
+				t.Errorf("paid under key %q, want %q", invoice.PaymentKey, want)
+			}
+		})
+	}
+}
+
+func TestRetryDuePaymentsExhausted(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"card declined", payments.TokenCardDeclined, payments.ErrCardDeclined},
+		{"insufficient funds", payments.TokenInsufficientFunds, payments.ErrInsufficientFunds},
+		{"timeout", payments.TokenNetworkTimeout, payments.ErrNetworkTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRenewal(t, tt.token)
+			r.renew(t)
+
+			// The first retry fails and schedules the second, three days
+			// after the first failure
+			invoice := r.retry(t)
+			sub := r.subscription(t)
+			if invoice.Status != models.InvoiceStatusOpen || sub.Status != models.SubscriptionStatusPastDue || invoice.DunningRetries != 1 {
+				t.Fatalf("after one retry invoice %s with %d retries and subscription %s", invoice.Status, invoice.DunningRetries, sub.Status)
+			}
+			if invoice.NextPaymentAttemptAt == nil || !invoice.NextPaymentAttemptAt.Equal(sub.PastDueSince.AddDate(0, 0, 3)) {
+				t.Errorf("next attempt at %v, want three days after %v", invoice.NextPaymentAttemptAt, sub.PastDueSince)
+			}
+
+			// The last retry fails and the policy cancels the subscription
+			invoice = r.retry(t)
+			sub = r.subscription(t)
+			if invoice.Status != models.InvoiceStatusVoid || invoice.DunningRetries != 2 {
+				t.Errorf("after the last retry invoice %s with %d retries, want void with 2", invoice.Status, invoice.DunningRetries)
+			}
+			if sub.Status != models.SubscriptionStatusCancelled || sub.Active {
+				t.Errorf("subscription %s (active %v), want cancelled", sub.Status, sub.Active)
+			}
+			if !strings.Contains(invoice.LastPaymentError, tt.wantErr.Error()) {
+				t.Errorf("last payment error %q, want %q", invoice.LastPaymentError, tt.wantErr)
+			}
+			if len(r.provider.Charges()) != 0 {
+				t.Errorf("%d charges made", len(r.provider.Charges()))
+			}
+
+			var failures int64
+			r.db.Model(&models.SubscriptionEvent{}).
+				Where("subscription_id = ? AND type IN ?", sub.ID, []string{models.SubscriptionEventPaymentFailed, models.SubscriptionEventPaymentRetry}).
+				Count(&failures)
+			if failures != 3 {
+				t.Errorf("%d payment failures recorded, want the renewal and both retries", failures)
+			}
+		})
+	}
+}
+
+func TestCollectReportsProviderErrors(t *testing.T) {
+	r := newRenewal(t, payments.TokenCardDeclined)
+	r.renew(t)
+	invoice := r.invoice(t)
+
+	err := billing.Collect(context.Background(), r.db, &invoice, nil)
+	if !errors.Is(err, billing.ErrPaymentFailed) || !errors.Is(err, payments.ErrCardDeclined) {
+		t.Errorf("err = %v, want ErrPaymentFailed wrapping ErrCardDeclined", err)
+	}
+	if invoice.PaymentAttempts != 2 || invoice.PaymentKey != "" {
+		t.Errorf("invoice has %d attempts and key %q, want 2 and none", invoice.PaymentAttempts, invoice.PaymentKey)
+	}
+}
+
+func TestRevokeExpiredGraceOnce(t *testing.T) {
+	r := newRenewal(t, payments.TokenCardDeclined)
+	r.renew(t)
+
+	// Runs that overlap find the same subscription; only one revokes it
+	after := time.Now().Add(config.Billing.Dunning.GracePeriod + time.Hour)
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := billing.RevokeExpiredGrace(context.Background(), r.db, after); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if sub := r.subscription(t); sub.Active || sub.Status != models.SubscriptionStatusPastDue {
+		t.Errorf("subscription %s (active %v), want past due without access", sub.Status, sub.Active)
+	}
+	var revoked int64
+	if err := r.db.Model(&models.SubscriptionEvent{}).
+		Where("subscription_id = ? AND type = ?", r.sub.ID, models.SubscriptionEventAccessRevoked).
+		Count(&revoked).Error; err != nil {
+		t.Fatal(err)
+	}
+	if revoked != 1 {
+		t.Errorf("%d access_revoked events, want 1", revoked)
+	}
+}
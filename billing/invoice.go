@@ -0,0 +1,456 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/pricing"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Billing reasons recorded on invoices
+const (
+	ReasonSubscriptionCreate = "subscription_create"
+	ReasonSubscriptionCycle  = "subscription_cycle"
+	ReasonSubscriptionUpdate = "subscription_update"
+	ReasonAddOnUpdate        = "addon_update"
+)
+
+// PaymentTerms is how long an open invoice stays payable
+const PaymentTerms = 14 * 24 * time.Hour
+
+var (
+	ErrInvalidInvoiceState = errors.New("invoice cannot make that transition in its current state")
+	ErrNoPrice             = errors.New("plan has no price in the subscription currency")
+	ErrCurrencyMismatch    = errors.New("add-on currency does not match the subscription currency")
+	ErrNotActive           = errors.New("subscription is not active")
+	ErrPlanChanged         = errors.New("subscription changed plan while the change was made")
+)
+
+// InvoiceSubscriptionStart bills the first period of a new subscription
+func InvoiceSubscriptionStart(tx *gorm.DB, sub *models.Subscription) (*models.Invoice, error) {
+	invoice, err := invoicePeriod(tx, sub, ReasonSubscriptionCreate)
+	if err != nil {
+		return nil, err
+	}
+	if err := RecordEvent(tx, sub, models.SubscriptionEventCreated, invoice, "Subscribed to plan %d", sub.PlanID); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// Renew moves a subscription into its next billing period and bills it
+func Renew(tx *gorm.DB, sub *models.Subscription) (*models.Invoice, error) {
+	var plan models.Plan
+	if err := tx.First(&plan, sub.PlanID).Error; err != nil {
+		return nil, err
+	}
+
+	start, end := PlanInterval(plan).Period(sub.BillingCycleAnchor, sub.ExpiresAt)
+	sub.CurrentPeriodStart = start
+	sub.ExpiresAt = end
+	if err := tx.Model(sub).Select("current_period_start", "expires_at").Updates(sub).Error; err != nil {
+		return nil, err
+	}
+
+	invoice, err := invoicePeriod(tx, sub, ReasonSubscriptionCycle)
+	if err != nil {
+		return nil, err
+	}
+	if err := RecordEvent(tx, sub, models.SubscriptionEventRenewed, invoice, "Renewed for %s", periodLabel(start, end)); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// ChangePlan switches a subscription to another plan mid-period. The unused
+// time on the old plan is credited and the remainder of the period on the new
+// plan charged.
+func ChangePlan(tx *gorm.DB, sub *models.Subscription, newPlan models.Plan) (*models.Invoice, error) {
+	if err := lockForChange(tx, sub); err != nil {
+		return nil, err
+	}
+	user, oldPlan, err := loadCustomerAndPlan(tx, sub)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&newPlan).Association("Prices").Find(&newPlan.Prices); err != nil {
+		return nil, err
+	}
+
+	// Both sides of the proration must be priced in the subscription's
+	// currency, not a fallback
+	oldQuote, ok := pricing.Resolve(oldPlan, sub.Currency, user.Billing.Country)
+	if !ok || oldQuote.Currency != sub.Currency {
+		return nil, ErrNoPrice
+	}
+	newQuote, ok := pricing.Resolve(newPlan, sub.Currency, user.Billing.Country)
+	if !ok || newQuote.Currency != sub.Currency {
+		return nil, ErrNoPrice
+	}
+
+	now := time.Now()
+	factor := prorationFactor(sub.CurrentPeriodStart, sub.ExpiresAt, now)
+
+	invoice := newInvoice(sub, ReasonSubscriptionUpdate, now, sub.ExpiresAt)
+	invoice.LineItems = []models.InvoiceLineItem{
+		{
+			Description: fmt.Sprintf("Unused time on %s (%s)", oldPlan.Name, periodLabel(now, sub.ExpiresAt)),
+			PlanID:      &oldPlan.ID,
+			Quantity:    1,
+			UnitAmount:  roundMoney(-oldQuote.Amount * factor),
+			Proration:   true,
+			PeriodStart: now,
+			PeriodEnd:   sub.ExpiresAt,
+		},
+		{
+			Description: fmt.Sprintf("Remaining time on %s (%s)", newPlan.Name, periodLabel(now, sub.ExpiresAt)),
+			PlanID:      &newPlan.ID,
+			Quantity:    1,
+			UnitAmount:  roundMoney(newQuote.Amount * factor),
+			Proration:   true,
+			PeriodStart: now,
+			PeriodEnd:   sub.ExpiresAt,
+		},
+	}
+
+	sub.PlanID = newPlan.ID
+	if err := tx.Model(sub).Update("plan_id", newPlan.ID).Error; err != nil {
+		return nil, err
+	}
+
+	if _, err := createAndFinalize(tx, invoice); err != nil {
+		return nil, err
+	}
+
+	event := models.SubscriptionEvent{
+		SubscriptionID: sub.ID,
+		Type:           models.SubscriptionEventPlanChanged,
+		FromPlanID:     &oldPlan.ID,
+		ToPlanID:       &newPlan.ID,
+		InvoiceID:      &invoice.ID,
+		Message:        fmt.Sprintf("Changed plan from %s to %s", oldPlan.Name, newPlan.Name),
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// ChangeAddOn sets the quantity of an add-on on a subscription, billing or
+// crediting the difference for the rest of the current period
+func ChangeAddOn(tx *gorm.DB, sub *models.Subscription, addOn models.AddOn, quantity int) (*models.Invoice, error) {
+	if err := lockForChange(tx, sub); err != nil {
+		return nil, err
+	}
+	if addOn.Currency != sub.Currency {
+		return nil, ErrCurrencyMismatch
+	}
+
+	var item models.SubscriptionAddOn
+	err := tx.Where("subscription_id = ? AND add_on_id = ?", sub.ID, addOn.ID).First(&item).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	delta := quantity - item.Quantity
+	switch {
+	case quantity == 0 && item.ID != 0:
+		err = tx.Delete(&item).Error
+	case item.ID == 0:
+		item = models.SubscriptionAddOn{SubscriptionID: sub.ID, AddOnID: addOn.ID, Quantity: quantity}
+		err = tx.Create(&item).Error
+	default:
+		err = tx.Model(&item).Update("quantity", quantity).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+	if delta == 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	factor := prorationFactor(sub.CurrentPeriodStart, sub.ExpiresAt, now)
+
+	invoice := newInvoice(sub, ReasonAddOnUpdate, now, sub.ExpiresAt)
+	invoice.LineItems = []models.InvoiceLineItem{
+		{
+			Description: fmt.Sprintf("%d × %s (%s)", delta, addOn.Name, periodLabel(now, sub.ExpiresAt)),
+			AddOnID:     &addOn.ID,
+			Quantity:    delta,
+			UnitAmount:  roundMoney(addOn.Price * factor),
+			Proration:   true,
+			PeriodStart: now,
+			PeriodEnd:   sub.ExpiresAt,
+		},
+	}
+
+	return createAndFinalize(tx, invoice)
+}
+
+// lockForChange locks a subscription and reads it again, so a change is
+// prorated from the stored row rather than a copy read before the
+// transaction, and concurrent changes credit unused time once. It fails if
+// the subscription has ended or moved to another plan since the copy was
+// read.
+func lockForChange(tx *gorm.DB, sub *models.Subscription) error {
+	planID := sub.PlanID
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(sub, sub.ID).Error; err != nil {
+		return err
+	}
+	if !sub.Active {
+		return ErrNotActive
+	}
+	if sub.PlanID != planID {
+		return ErrPlanChanged
+	}
+	return nil
+}
+
+// Finalize issues a draft invoice, giving it the next number of the year
+func Finalize(tx *gorm.DB, invoice *models.Invoice) error {
+	if invoice.Status != models.InvoiceStatusDraft {
+		return ErrInvalidInvoiceState
+	}
+
+	var user models.User
+	if err := tx.First(&user, invoice.UserID).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	number, err := nextNumber(tx, "INV", now.Year())
+	if err != nil {
+		return err
+	}
+
+	dueAt := now.Add(PaymentTerms)
+	invoice.Number = number
+	invoice.Status = models.InvoiceStatusOpen
+	invoice.IssuedAt = &now
+	invoice.DueAt = &dueAt
+	snapshotCustomer(invoice, user)
+
+	if invoice.LineItems == nil {
+		if err := tx.Where("invoice_id = ?", invoice.ID).Find(&invoice.LineItems).Error; err != nil {
+			return err
+		}
+	}
+	if invoice.Taxes == nil {
+		if err := tx.Where("invoice_id = ?", invoice.ID).Find(&invoice.Taxes).Error; err != nil {
+			return err
+		}
+	}
+	if err := recordInvoice(tx, invoice); err != nil {
+		return err
+	}
+	if err := applyCustomerCredit(tx, invoice); err != nil {
+		return err
+	}
+
+	// Nothing to collect, e.g. a downgrade credited in full
+	if invoice.AmountDue <= 0 {
+		invoice.Status = models.InvoiceStatusPaid
+		invoice.PaidAt = &now
+		if err := scheduleRevenue(tx, invoice); err != nil {
+			return err
+		}
+	}
+
+	columns := []string{"number", "status", "issued_at", "due_at", "paid_at", "amount_due", "credit_applied", "customer_name"}
+	return tx.Model(invoice).
+		Select(append(columns, models.BillingProfileColumns("customer_")...)).
+		Updates(invoice).Error
+}
+
+// MarkPaid records full payment of an open invoice
+func MarkPaid(tx *gorm.DB, invoice *models.Invoice) error {
+	if invoice.Status != models.InvoiceStatusOpen {
+		return ErrInvalidInvoiceState
+	}
+
+	if err := recordPayment(tx, invoice, roundMoney(invoice.AmountDue-invoice.AmountPaid)); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	invoice.Status = models.InvoiceStatusPaid
+	invoice.AmountPaid = invoice.AmountDue
+	invoice.PaidAt = &now
+
+	if err := tx.Model(invoice).Select("status", "amount_paid", "paid_at").Updates(invoice).Error; err != nil {
+		return err
+	}
+	return scheduleRevenue(tx, invoice)
+}
+
+// Void cancels a draft or open invoice. Its number, if any, stays used.
+func Void(tx *gorm.DB, invoice *models.Invoice) error {
+	if invoice.Status != models.InvoiceStatusDraft && invoice.Status != models.InvoiceStatusOpen {
+		return ErrInvalidInvoiceState
+	}
+	if invoice.Status == models.InvoiceStatusOpen {
+		if err := recordVoid(tx, invoice); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	invoice.Status = models.InvoiceStatusVoid
+	invoice.VoidedAt = &now
+
+	return tx.Model(invoice).Select("status", "voided_at").Updates(invoice).Error
+}
+
+// invoicePeriod bills the plan and add-ons of a subscription for its current
+// period, less any discount
+func invoicePeriod(tx *gorm.DB, sub *models.Subscription, reason string) (*models.Invoice, error) {
+	user, plan, err := loadCustomerAndPlan(tx, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	// A subscription is billed in the currency it started in; a fallback to
+	// another currency would charge the wrong amount under its label
+	quote, ok := pricing.Resolve(plan, sub.Currency, user.Billing.Country)
+	if !ok || (sub.Currency != "" && quote.Currency != sub.Currency) {
+		return nil, ErrNoPrice
+	}
+	if sub.Currency == "" {
+		sub.Currency = quote.Currency
+		if err := tx.Model(sub).Update("currency", sub.Currency).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	start, end := sub.CurrentPeriodStart, sub.ExpiresAt
+	invoice := newInvoice(sub, reason, start, end)
+	invoice.LineItems = []models.InvoiceLineItem{
+		{
+			Description: fmt.Sprintf("%s (%s)", plan.Name, periodLabel(start, end)),
+			PlanID:      &plan.ID,
+			Quantity:    1,
+			UnitAmount:  quote.Amount,
+			PeriodStart: start,
+			PeriodEnd:   end,
+		},
+	}
+
+	var addOns []models.SubscriptionAddOn
+	if err := tx.Preload("AddOn").Where("subscription_id = ?", sub.ID).Find(&addOns).Error; err != nil {
+		return nil, err
+	}
+	for _, item := range addOns {
+		invoice.LineItems = append(invoice.LineItems, models.InvoiceLineItem{
+			Description: fmt.Sprintf("%s (%s)", item.AddOn.Name, periodLabel(start, end)),
+			AddOnID:     &item.AddOnID,
+			Quantity:    item.Quantity,
+			UnitAmount:  item.AddOn.Price,
+			PeriodStart: start,
+			PeriodEnd:   end,
+		})
+	}
+
+	if err := discountLine(tx, sub, invoice); err != nil {
+		return nil, err
+	}
+
+	return createAndFinalize(tx, invoice)
+}
+
+func loadCustomerAndPlan(tx *gorm.DB, sub *models.Subscription) (models.User, models.Plan, error) {
+	var user models.User
+	if err := tx.First(&user, sub.UserID).Error; err != nil {
+		return user, models.Plan{}, err
+	}
+	var plan models.Plan
+	if err := tx.Preload("Prices").First(&plan, sub.PlanID).Error; err != nil {
+		return user, plan, err
+	}
+	return user, plan, nil
+}
+
+func newInvoice(sub *models.Subscription, reason string, start, end time.Time) *models.Invoice {
+	return &models.Invoice{
+		UserID:         sub.UserID,
+		SubscriptionID: &sub.ID,
+		Status:         models.InvoiceStatusDraft,
+		BillingReason:  reason,
+		Currency:       sub.Currency,
+		PeriodStart:    start,
+		PeriodEnd:      end,
+	}
+}
+
+// createAndFinalize totals and taxes a draft invoice, stores it with its line
+// items and issues it
+func createAndFinalize(tx *gorm.DB, invoice *models.Invoice) (*models.Invoice, error) {
+	var subtotal float64
+	for i := range invoice.LineItems {
+		line := &invoice.LineItems[i]
+		line.Amount = roundMoney(line.UnitAmount * float64(line.Quantity))
+		subtotal += line.Amount
+	}
+	invoice.Subtotal = roundMoney(subtotal)
+	invoice.Total = invoice.Subtotal
+	if err := applyTax(tx, invoice); err != nil {
+		return nil, err
+	}
+	invoice.AmountDue = math.Max(invoice.Total, 0)
+
+	if err := tx.Create(invoice).Error; err != nil {
+		return nil, err
+	}
+	if err := Finalize(tx, invoice); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// nextNumber takes the next number in a prefix's sequence for the year. The
+// sequence row stays locked until the surrounding transaction ends, so a
+// rolled back document gives its number back and concurrent documents queue
+// up behind it.
+func nextNumber(tx *gorm.DB, prefix string, year int) (string, error) {
+	seq := models.InvoiceSequence{Prefix: prefix, Year: year}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&seq).Error; err != nil {
+		return "", err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&seq, "prefix = ? AND year = ?", prefix, year).Error; err != nil {
+		return "", err
+	}
+
+	seq.LastNumber++
+	if err := tx.Model(&models.InvoiceSequence{}).
+		Where("prefix = ? AND year = ?", prefix, year).
+		Update("last_number", seq.LastNumber).Error; err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s-%d-%06d", prefix, year, seq.LastNumber), nil
+}
+
+// prorationFactor is the share of the period [start, end) left at now
+func prorationFactor(start, end, now time.Time) float64 {
+	total := end.Sub(start)
+	if total <= 0 || !now.Before(end) {
+		return 0
+	}
+	if now.Before(start) {
+		return 1
+	}
+	return float64(end.Sub(now)) / float64(total)
+}
+
+func periodLabel(start, end time.Time) string {
+	return fmt.Sprintf("%s - %s", start.Format("Jan 2, 2006"), end.Format("Jan 2, 2006"))
+}
+
+func roundMoney(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
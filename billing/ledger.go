@@ -0,0 +1,149 @@
+package billing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/ledger"
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+)
+
+// Journal entry sources
+const (
+	SourceInvoice       = "invoice"
+	SourceCreditApplied = "credit_applied"
+	SourcePayment       = "payment"
+	SourceCreditNote    = "credit_note"
+	SourceRefund        = "refund"
+	SourceVoid          = "void"
+	SourceCreditGrant   = "credit_grant"
+
+	SourceRevenueDeferral    = "revenue_deferral"
+	SourceRevenueRecognition = "revenue_recognition"
+	SourceRefundDeferral     = "refund_deferral"
+)
+
+var ErrInvalidCurrency = errors.New("currency is not supported")
+
+// recordInvoice posts an issued invoice: what the customer owes against the
+// revenue it earns and the tax collected on it. A negative total, such as a downgrade credited for more
+// than the new plan costs, becomes customer credit instead of a receivable.
+func recordInvoice(tx *gorm.DB, invoice *models.Invoice) error {
+	lines := make([]ledger.Line, 0, len(invoice.LineItems)+1)
+	for _, item := range invoice.LineItems {
+		account := ledger.AccountRevenue
+		switch {
+		case item.DiscountID != nil:
+			account = ledger.AccountDiscounts
+		case item.Proration:
+			account = ledger.AccountProration
+		}
+		lines = append(lines, ledger.Credit(account, 0, item.Amount))
+	}
+	for _, line := range invoice.Taxes {
+		lines = append(lines, ledger.Credit(ledger.AccountTaxPayable, 0, line.Amount))
+		// Inclusive prices were credited to revenue with the tax in them
+		lines = append(lines, ledger.Debit(ledger.AccountRevenue, 0, invoice.Subtotal-line.TaxableAmount))
+	}
+	if invoice.Total >= 0 {
+		lines = append(lines, ledger.Debit(ledger.AccountReceivable, invoice.UserID, invoice.Total))
+	} else {
+		lines = append(lines, ledger.Credit(ledger.AccountCustomerCredit, invoice.UserID, -invoice.Total))
+	}
+
+	_, err := ledger.Post(tx, invoice.Currency, "Invoice "+invoice.Number, SourceInvoice, invoice.ID, lines...)
+	return err
+}
+
+// applyCustomerCredit settles as much of a newly issued invoice as the
+// customer's credit balance in its currency covers
+func applyCustomerCredit(tx *gorm.DB, invoice *models.Invoice) error {
+	if invoice.AmountDue <= 0 {
+		return nil
+	}
+
+	if err := ledger.LockAccount(tx, ledger.AccountCustomerCredit, invoice.UserID, invoice.Currency); err != nil {
+		return err
+	}
+	balance, err := ledger.Balance(tx, ledger.AccountCustomerCredit, invoice.UserID, invoice.Currency)
+	if err != nil {
+		return err
+	}
+	available := ledger.FromMinor(-balance)
+	if available <= 0 {
+		return nil
+	}
+
+	applied := roundMoney(math.Min(available, invoice.AmountDue))
+	if _, err := ledger.Post(tx, invoice.Currency, "Credit applied to invoice "+invoice.Number, SourceCreditApplied, invoice.ID,
+		ledger.Debit(ledger.AccountCustomerCredit, invoice.UserID, applied),
+		ledger.Credit(ledger.AccountReceivable, invoice.UserID, applied),
+	); err != nil {
+		return err
+	}
+
+	invoice.CreditApplied = applied
+	invoice.AmountDue = roundMoney(invoice.AmountDue - applied)
+	return nil
+}
+
+func recordPayment(tx *gorm.DB, invoice *models.Invoice, amount float64) error {
+	_, err := ledger.Post(tx, invoice.Currency, "Payment of invoice "+invoice.Number, SourcePayment, invoice.ID,
+		ledger.Debit(ledger.AccountCash, 0, amount),
+		ledger.Credit(ledger.AccountReceivable, invoice.UserID, amount),
+	)
+	return err
+}
+
+func recordCreditNote(tx *gorm.DB, invoice *models.Invoice, note *models.CreditNote) error {
+	_, err := ledger.Post(tx, invoice.Currency, fmt.Sprintf("Credit note %s on invoice %s", note.Number, invoice.Number), SourceCreditNote, note.ID,
+		ledger.Debit(ledger.AccountCreditNotes, 0, note.Amount),
+		ledger.Credit(ledger.AccountReceivable, invoice.UserID, note.Amount),
+	)
+	return err
+}
+
+func recordRefund(tx *gorm.DB, invoice *models.Invoice, refund *models.Refund) error {
+	_, err := ledger.Post(tx, invoice.Currency, "Refund on invoice "+invoice.Number, SourceRefund, refund.ID,
+		ledger.Debit(ledger.AccountRefunds, 0, refund.Amount),
+		ledger.Credit(ledger.AccountCash, 0, refund.Amount),
+	)
+	return err
+}
+
+// recordVoid writes off what was still owed on a voided invoice
+func recordVoid(tx *gorm.DB, invoice *models.Invoice) error {
+	outstanding := roundMoney(invoice.AmountDue - invoice.AmountPaid)
+	if outstanding <= 0 {
+		return nil
+	}
+	_, err := ledger.Post(tx, invoice.Currency, "Void of invoice "+invoice.Number, SourceVoid, invoice.ID,
+		ledger.Debit(ledger.AccountWriteOffs, 0, outstanding),
+		ledger.Credit(ledger.AccountReceivable, invoice.UserID, outstanding),
+	)
+	return err
+}
+
+// GrantCredit adds promotional credit to a customer's balance. It is applied
+// automatically to the customer's next invoices in that currency.
+func GrantCredit(tx *gorm.DB, user *models.User, amount float64, currency, memo string) (*models.JournalEntry, error) {
+	amount = roundMoney(amount)
+	if amount <= 0 {
+		return nil, ErrInvalidAmount
+	}
+	if !config.Billing.IsSupportedCurrency(currency) {
+		return nil, ErrInvalidCurrency
+	}
+
+	description := fmt.Sprintf("Credit granted to %s", user.Email)
+	if memo != "" {
+		description += ": " + memo
+	}
+	return ledger.Post(tx, currency, description, SourceCreditGrant, 0,
+		ledger.Debit(ledger.AccountPromotionalCredits, 0, amount),
+		ledger.Credit(ledger.AccountCustomerCredit, user.ID, amount),
+	)
+}
@@ -0,0 +1,234 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/payments"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Payments is the payment provider used to collect invoices, set up in main
+var Payments payments.Provider
+
+var (
+	ErrNoPaymentMethod = errors.New("customer has no payment method on file")
+	ErrPaymentFailed   = errors.New("payment failed")
+
+	// errInvoiceClosed is an invoice closing while a charge for it was made
+	errInvoiceClosed = errors.New("invoice closed during collection")
+)
+
+// EnsureCustomer creates the provider customer for a user on first use
+func EnsureCustomer(ctx context.Context, tx *gorm.DB, user *models.User) error {
+	if user.PaymentCustomerID != "" {
+		return nil
+	}
+
+	customer, err := Payments.CreateCustomer(ctx, user.Email, user.Name)
+	if err != nil {
+		return err
+	}
+
+	user.PaymentCustomerID = customer.ID
+	return tx.Model(user).Update("payment_customer_id", customer.ID).Error
+}
+
+// AddPaymentMethod stores a tokenized payment method with the provider and
+// makes it the user's default
+func AddPaymentMethod(ctx context.Context, tx *gorm.DB, user *models.User, token string) (*payments.PaymentMethod, error) {
+	if err := EnsureCustomer(ctx, tx, user); err != nil {
+		return nil, err
+	}
+
+	method, err := Payments.AttachPaymentMethod(ctx, user.PaymentCustomerID, token)
+	if err != nil {
+		return nil, err
+	}
+
+	user.DefaultPaymentMethodID = method.ID
+	if err := tx.Model(user).Update("default_payment_method_id", method.ID).Error; err != nil {
+		return nil, err
+	}
+	return method, nil
+}
+
+// Settlement moves a subscription along with the outcome of a payment. It
+// runs in the transaction that records the outcome, given the invoice as
+// stored and the payment error, nil if the invoice was paid.
+type Settlement func(tx *gorm.DB, invoice *models.Invoice, paymentErr error) error
+
+// recordAttempts is how often recording the outcome of a charge is tried
+// before giving up. A charge left unrecorded keeps the invoice's payment
+// key, so the next collection finds it rather than charging again.
+const recordAttempts = 3
+
+// Collect charges the customer's default payment method for an open invoice.
+// A failed attempt is recorded on the invoice, which stays open, and the
+// provider error is returned wrapped in ErrPaymentFailed. Attempts share an
+// idempotency key until the provider declines one, so a charge whose outcome
+// was lost is never made twice.
+//
+// No rows are locked while the provider is called, so db must not be in a
+// transaction: the attempt is committed first, and the outcome recorded in a
+// second transaction, retried if it fails, that locks the invoice again.
+// settle, if not nil, runs in that second transaction.
+func Collect(ctx context.Context, db *gorm.DB, invoice *models.Invoice, settle Settlement) error {
+	params, err := beginAttempt(db, invoice)
+	if err != nil && !errors.Is(err, ErrNoPaymentMethod) {
+		return err
+	}
+
+	var charge *payments.Charge
+	chargeErr := err
+	if chargeErr == nil {
+		charge, chargeErr = Payments.Charge(ctx, params)
+	}
+
+	// A charge once made is recorded even if the caller has given up
+	record := db.WithContext(context.WithoutCancel(db.Statement.Context))
+	for attempt := 1; ; attempt++ {
+		err = record.Transaction(func(tx *gorm.DB) error {
+			return recordOutcome(tx, invoice, charge, chargeErr, settle)
+		})
+		if err == nil {
+			return paymentError(chargeErr)
+		}
+		if errors.Is(err, errInvoiceClosed) {
+			break
+		}
+		if attempt == recordAttempts {
+			return err
+		}
+		log.Printf("Recording payment of invoice %d: %v", invoice.ID, err)
+		time.Sleep(time.Duration(attempt) * 100 * time.Millisecond)
+	}
+
+	// The invoice was paid some other way or voided while the charge was
+	// made, so the money goes back
+	if charge != nil {
+		if _, err := Payments.Refund(context.WithoutCancel(ctx), charge.ID, charge.Amount, models.CreditReasonDuplicate); err != nil {
+			log.Printf("Refunding charge %s of closed invoice %d: %v", charge.ID, invoice.ID, err)
+		}
+	}
+	return ErrInvalidInvoiceState
+}
+
+// beginAttempt commits a payment attempt on an open invoice and returns the
+// charge to make for it
+func beginAttempt(db *gorm.DB, invoice *models.Invoice) (payments.ChargeParams, error) {
+	var params payments.ChargeParams
+	err := db.Transaction(func(tx *gorm.DB) error {
+		stored, err := lockInvoice(tx, invoice)
+		if err != nil {
+			return err
+		}
+		if stored.Status != models.InvoiceStatusOpen {
+			return ErrInvalidInvoiceState
+		}
+
+		var user models.User
+		if err := tx.First(&user, stored.UserID).Error; err != nil {
+			return err
+		}
+		if user.PaymentCustomerID == "" || user.DefaultPaymentMethodID == "" {
+			return ErrNoPaymentMethod
+		}
+
+		stored.PaymentAttempts++
+		if stored.PaymentKey == "" {
+			stored.PaymentKey = fmt.Sprintf("invoice-%d-collection-%d", stored.ID, stored.PaymentAttempts)
+		}
+		if err := tx.Model(stored).Select("payment_attempts", "payment_key").Updates(stored).Error; err != nil {
+			return err
+		}
+		refreshInvoice(invoice, stored)
+
+		params = payments.ChargeParams{
+			CustomerID:      user.PaymentCustomerID,
+			PaymentMethodID: user.DefaultPaymentMethodID,
+			Amount:          roundMoney(stored.AmountDue - stored.AmountPaid),
+			Currency:        stored.Currency,
+			Description:     fmt.Sprintf("Invoice %s", stored.Number),
+			IdempotencyKey:  stored.PaymentKey,
+			Metadata:        map[string]string{"invoice_id": fmt.Sprint(stored.ID)},
+		}
+		return nil
+	})
+	return params, err
+}
+
+// recordOutcome records the outcome of a payment attempt, the charge made or
+// why none was, and settles it. It is keyed by the charge, so recording a
+// charge again, or one a webhook has recorded already, changes nothing.
+func recordOutcome(tx *gorm.DB, invoice *models.Invoice, charge *payments.Charge, chargeErr error, settle Settlement) error {
+	stored, err := lockInvoice(tx, invoice)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case charge != nil && stored.ChargeID == charge.ID:
+		// Already recorded
+	case stored.Status != models.InvoiceStatusOpen:
+		return errInvoiceClosed
+	case charge != nil:
+		stored.ChargeID = charge.ID
+		stored.LastPaymentError = ""
+		if err := tx.Model(stored).Select("charge_id", "last_payment_error").Updates(stored).Error; err != nil {
+			return err
+		}
+		if err := MarkPaid(tx, stored); err != nil {
+			return err
+		}
+	default:
+		stored.LastPaymentError = chargeErr.Error()
+		if payments.IsDeclined(chargeErr) {
+			// Nothing was charged; the next attempt is a new collection
+			stored.PaymentKey = ""
+		}
+		if err := tx.Model(stored).Select("payment_key", "last_payment_error").Updates(stored).Error; err != nil {
+			return err
+		}
+	}
+
+	if settle != nil {
+		if err := settle(tx, stored, paymentError(chargeErr)); err != nil {
+			return err
+		}
+	}
+	refreshInvoice(invoice, stored)
+	return nil
+}
+
+// paymentError is what a failed charge is reported as: the provider's error
+// wrapped in ErrPaymentFailed, or ErrNoPaymentMethod when none was made
+func paymentError(chargeErr error) error {
+	if chargeErr == nil || errors.Is(chargeErr, ErrNoPaymentMethod) {
+		return chargeErr
+	}
+	return fmt.Errorf("%w: %w", ErrPaymentFailed, chargeErr)
+}
+
+// lockInvoice reads the stored state of an invoice and locks it for the rest
+// of the transaction
+func lockInvoice(tx *gorm.DB, invoice *models.Invoice) (*models.Invoice, error) {
+	var stored models.Invoice
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&stored, invoice.ID).Error; err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
+
+// refreshInvoice copies the stored state of an invoice over the caller's
+// copy, keeping the associations it has loaded
+func refreshInvoice(invoice, stored *models.Invoice) {
+	lineItems, taxes, creditNotes := invoice.LineItems, invoice.Taxes, invoice.CreditNotes
+	*invoice = *stored
+	invoice.LineItems, invoice.Taxes, invoice.CreditNotes = lineItems, taxes, creditNotes
+}
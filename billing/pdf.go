@@ -0,0 +1,238 @@
+package billing
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// compressPDF compresses page content. Tests turn it off so golden files
+// can be read and diffed.
+var compressPDF = true
+
+// RenderInvoicePDF writes an invoice as a PDF document. Paid invoices are
+// rendered as receipts. The output depends only on the invoice and company
+// details, so the same invoice always renders to the same bytes.
+func RenderInvoicePDF(w io.Writer, invoice models.Invoice, company config.CompanyInfo) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	title := "INVOICE"
+	if invoice.Status == models.InvoiceStatusPaid {
+		title = "RECEIPT"
+	}
+
+	pdf.SetTitle(fmt.Sprintf("%s %s", title, invoice.Number), true)
+	pdf.SetAuthor(company.Name, true)
+	pdf.SetCreationDate(invoice.CreatedAt)
+	pdf.SetModificationDate(invoice.UpdatedAt)
+	pdf.SetCatalogSort(true)
+	pdf.SetCompression(compressPDF)
+	pdf.AddPage()
+
+	pageWidth, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	contentWidth := pageWidth - left - right
+
+	// Company header
+	pdf.SetFont("Arial", "B", 16)
+	pdf.CellFormat(contentWidth/2, 8, tr(company.Name), "", 0, "L", false, 0, "")
+	pdf.SetFont("Arial", "B", 20)
+	pdf.CellFormat(contentWidth/2, 8, title, "", 1, "R", false, 0, "")
+
+	pdf.SetFont("Arial", "", 9)
+	header := append(append([]string{}, company.Address...), company.Email)
+	if company.TaxID != "" {
+		header = append(header, "VAT ID: "+company.TaxID)
+	}
+	for _, line := range header {
+		if line != "" {
+			pdf.CellFormat(contentWidth, 4.5, tr(line), "", 1, "L", false, 0, "")
+		}
+	}
+	pdf.Ln(6)
+
+	// Billing address and invoice details side by side
+	top := pdf.GetY()
+	pdf.SetFont("Arial", "B", 10)
+	pdf.CellFormat(contentWidth/2, 5, "Bill to", "", 1, "L", false, 0, "")
+	pdf.SetFont("Arial", "", 10)
+	for _, line := range billingAddress(invoice) {
+		pdf.CellFormat(contentWidth/2, 5, tr(line), "", 1, "L", false, 0, "")
+	}
+	bottom := pdf.GetY()
+
+	pdf.SetY(top)
+	for _, row := range invoiceDetails(invoice) {
+		pdf.SetX(left + contentWidth/2)
+		pdf.SetFont("Arial", "B", 10)
+		pdf.CellFormat(contentWidth/4, 5, row[0], "", 0, "L", false, 0, "")
+		pdf.SetFont("Arial", "", 10)
+		pdf.CellFormat(contentWidth/4, 5, tr(row[1]), "", 1, "R", false, 0, "")
+	}
+	if pdf.GetY() < bottom {
+		pdf.SetY(bottom)
+	}
+	pdf.Ln(8)
+
+	// Line items
+	widths := []float64{contentWidth * 0.55, contentWidth * 0.1, contentWidth * 0.175, contentWidth * 0.175}
+	pdf.SetFillColor(235, 235, 235)
+	pdf.SetFont("Arial", "B", 10)
+	for i, heading := range []string{"Description", "Qty", "Unit price", "Amount"} {
+		align := "R"
+		if i == 0 {
+			align = "L"
+		}
+		pdf.CellFormat(widths[i], 7, heading, "B", 0, align, true, 0, "")
+	}
+	pdf.Ln(-1)
+
+	pdf.SetFont("Arial", "", 10)
+	for _, line := range invoice.LineItems {
+		pdf.CellFormat(widths[0], 7, tr(truncate(line.Description, 70)), "", 0, "L", false, 0, "")
+		pdf.CellFormat(widths[1], 7, fmt.Sprintf("%d", line.Quantity), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[2], 7, formatAmount(line.UnitAmount), "", 0, "R", false, 0, "")
+		pdf.CellFormat(widths[3], 7, formatAmount(line.Amount), "", 1, "R", false, 0, "")
+	}
+	pdf.Line(left, pdf.GetY(), left+contentWidth, pdf.GetY())
+	pdf.Ln(2)
+
+	// Totals
+	for _, row := range invoiceTotals(invoice) {
+		style := ""
+		if row.bold {
+			style = "B"
+		}
+		pdf.SetFont("Arial", style, 10)
+		pdf.SetX(left + contentWidth/2)
+		pdf.CellFormat(contentWidth/4, 6, tr(row.label), "", 0, "L", false, 0, "")
+		pdf.CellFormat(contentWidth/4, 6, formatMoney(row.amount, invoice.Currency), "", 1, "R", false, 0, "")
+	}
+	pdf.Ln(8)
+
+	if invoice.ReverseCharge {
+		pdf.SetFont("Arial", "", 9)
+		pdf.MultiCell(contentWidth, 4.5, "Reverse charge: VAT to be accounted for by the recipient (Article 196, Council Directive 2006/112/EC).", "", "L", false)
+		pdf.Ln(4)
+	}
+
+	// Payment status
+	pdf.SetFont("Arial", "B", 11)
+	pdf.CellFormat(contentWidth, 6, paymentStatus(invoice), "", 1, "L", false, 0, "")
+
+	return pdf.Output(w)
+}
+
+type totalRow struct {
+	label  string
+	amount float64
+	bold   bool
+}
+
+func invoiceTotals(invoice models.Invoice) []totalRow {
+	rows := []totalRow{
+		{label: "Subtotal", amount: invoice.Subtotal},
+	}
+	for _, line := range invoice.Taxes {
+		rows = append(rows, totalRow{label: taxLabel(line), amount: line.Amount})
+	}
+	if len(invoice.Taxes) == 0 {
+		rows = append(rows, totalRow{label: "Tax", amount: 0})
+	}
+	rows = append(rows, totalRow{label: "Total", amount: invoice.Total, bold: true})
+	if invoice.CreditApplied > 0 {
+		rows = append(rows, totalRow{label: "Credit applied", amount: -invoice.CreditApplied})
+	}
+	if invoice.AmountCredited > 0 {
+		rows = append(rows, totalRow{label: "Credited", amount: -invoice.AmountCredited})
+	}
+	rows = append(rows, totalRow{label: "Amount paid", amount: invoice.AmountPaid})
+	if invoice.AmountRefunded > 0 {
+		rows = append(rows, totalRow{label: "Refunded", amount: -invoice.AmountRefunded})
+	}
+	return append(rows, totalRow{label: "Amount due", amount: invoice.AmountDue - invoice.AmountPaid, bold: true})
+}
+
+func taxLabel(line models.InvoiceTax) string {
+	label := fmt.Sprintf("%s %g%%", line.Name, line.Percentage)
+	switch {
+	case line.ReverseCharge:
+		label += " (reverse charge)"
+	case line.Inclusive:
+		label += " (included)"
+	}
+	return label
+}
+
+func billingAddress(invoice models.Invoice) []string {
+	customer := invoice.Customer
+	cityLine := strings.TrimSpace(customer.PostalCode + " " + customer.City)
+	if customer.Region != "" {
+		cityLine = strings.TrimSpace(cityLine + ", " + customer.Region)
+	}
+	taxID := ""
+	if customer.TaxID != "" {
+		taxID = "VAT ID: " + customer.TaxID
+	}
+
+	var lines []string
+	for _, line := range []string{customer.CompanyName, invoice.CustomerName, customer.AddressLine1, customer.AddressLine2, cityLine, customer.Country, customer.Email, taxID} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func invoiceDetails(invoice models.Invoice) [][2]string {
+	number := invoice.Number
+	if number == "" {
+		number = "DRAFT"
+	}
+
+	details := [][2]string{{"Invoice number", number}}
+	if invoice.IssuedAt != nil {
+		details = append(details, [2]string{"Date issued", invoice.IssuedAt.Format("Jan 2, 2006")})
+	}
+	if invoice.PaidAt != nil {
+		details = append(details, [2]string{"Date paid", invoice.PaidAt.Format("Jan 2, 2006")})
+	} else if invoice.DueAt != nil {
+		details = append(details, [2]string{"Date due", invoice.DueAt.Format("Jan 2, 2006")})
+	}
+	details = append(details, [2]string{"Period", periodLabel(invoice.PeriodStart, invoice.PeriodEnd)})
+	return details
+}
+
+func paymentStatus(invoice models.Invoice) string {
+	switch invoice.Status {
+	case models.InvoiceStatusPaid:
+		return fmt.Sprintf("Paid %s - thank you", formatMoney(invoice.AmountPaid, invoice.Currency))
+	case models.InvoiceStatusVoid:
+		return "This invoice has been voided"
+	case models.InvoiceStatusDraft:
+		return "Draft - not yet issued"
+	default:
+		return fmt.Sprintf("%s due", formatMoney(invoice.AmountDue-invoice.AmountPaid, invoice.Currency))
+	}
+}
+
+func formatAmount(amount float64) string {
+	return fmt.Sprintf("%.2f", amount)
+}
+
+func formatMoney(amount float64, currency string) string {
+	return fmt.Sprintf("%.2f %s", amount, currency)
+}
+
+func truncate(value string, max int) string {
+	runes := []rune(value)
+	if len(runes) <= max {
+		return value
+	}
+	return strings.TrimSpace(string(runes[:max-3])) + "..."
+}
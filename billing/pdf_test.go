@@ -0,0 +1,147 @@
+package billing
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+var pdfCompany = config.CompanyInfo{
+	Name:    "Subscriptions GmbH",
+	Address: []string{"Leopoldstraße 12", "80802 München"},
+	Email:   "billing@subscriptions.example",
+	Country: "DE",
+	TaxID:   "DE811907980",
+}
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 9, 30, 0, 0, time.UTC)
+}
+
+func datePtr(at time.Time) *time.Time {
+	return &at
+}
+
+// pdfInvoice is an issued, unpaid monthly invoice with German VAT
+func pdfInvoice() models.Invoice {
+	return models.Invoice{
+		CreatedAt:   day(2024, time.March, 1),
+		UpdatedAt:   day(2024, time.March, 1),
+		Number:      "INV-2024-000042",
+		Status:      models.InvoiceStatusOpen,
+		Currency:    "EUR",
+		Subtotal:    49.98,
+		Tax:         9.50,
+		Total:       59.48,
+		AmountDue:   59.48,
+		PeriodStart: day(2024, time.March, 1),
+		PeriodEnd:   day(2024, time.April, 1),
+		IssuedAt:    datePtr(day(2024, time.March, 1)),
+		DueAt:       datePtr(day(2024, time.March, 15)),
+
+		CustomerName: "Jörg Müller",
+		Customer: models.BillingProfile{
+			AddressLine1: "Hauptstraße 1",
+			City:         "Köln",
+			PostalCode:   "50667",
+			Country:      "DE",
+			Email:        "joerg@example.com",
+		},
+		LineItems: []models.InvoiceLineItem{
+			{Description: "Pro (Mar 1, 2024 - Apr 1, 2024)", Quantity: 1, UnitAmount: 29.99, Amount: 29.99},
+			{Description: "Extra seats (Mar 1, 2024 - Apr 1, 2024)", Quantity: 2, UnitAmount: 9.995, Amount: 19.99},
+		},
+		Taxes: []models.InvoiceTax{
+			{Name: "VAT", Country: "DE", Percentage: 19, TaxableAmount: 49.98, Amount: 9.50},
+		},
+	}
+}
+
+func TestRenderInvoicePDF(t *testing.T) {
+	compressPDF = false
+	t.Cleanup(func() { compressPDF = true })
+
+	paid := pdfInvoice()
+	paid.Status = models.InvoiceStatusPaid
+	paid.AmountPaid = paid.AmountDue
+	paid.PaidAt = datePtr(day(2024, time.March, 2))
+	paid.UpdatedAt = day(2024, time.March, 2)
+
+	reverseCharge := pdfInvoice()
+	reverseCharge.Customer = models.BillingProfile{
+		CompanyName:  "Acme B.V.",
+		AddressLine1: "Keizersgracht 100",
+		City:         "Amsterdam",
+		PostalCode:   "1015 AA",
+		Country:      "NL",
+		TaxID:        "NL123456789B01",
+	}
+	reverseCharge.ReverseCharge = true
+	reverseCharge.Tax = 0
+	reverseCharge.Total = 49.98
+	reverseCharge.AmountDue = 49.98
+	reverseCharge.Taxes = []models.InvoiceTax{
+		{Name: "VAT", Country: "NL", Percentage: 21, TaxableAmount: 49.98, ReverseCharge: true},
+	}
+
+	void := pdfInvoice()
+	void.Status = models.InvoiceStatusVoid
+	void.VoidedAt = datePtr(day(2024, time.March, 20))
+	void.LineItems[0].Description = "Pro plan with a description long enough that it has to be cut short on the invoice"
+
+	tests := []struct {
+		name    string
+		invoice models.Invoice
+	}{
+		{"open", pdfInvoice()},
+		{"paid", paid},
+		{"reverse_charge", reverseCharge},
+		{"void", void},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bytes.Buffer
+			if err := RenderInvoicePDF(&got, tt.invoice, pdfCompany); err != nil {
+				t.Fatalf("RenderInvoicePDF: %v", err)
+			}
+
+			golden := filepath.Join("testdata", "invoice_"+tt.name+".pdf")
+			if *update {
+				if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("reading %s (run with -update to create it): %v", golden, err)
+			}
+			if !bytes.Equal(got.Bytes(), want) {
+				out := filepath.Join(t.TempDir(), filepath.Base(golden))
+				_ = os.WriteFile(out, got.Bytes(), 0o644)
+				t.Errorf("rendered PDF differs from %s; got written to %s (run with -update if the change is intended)", golden, out)
+			}
+		})
+	}
+}
+
+func TestRenderInvoicePDFIsDeterministic(t *testing.T) {
+	var first, second bytes.Buffer
+	if err := RenderInvoicePDF(&first, pdfInvoice(), pdfCompany); err != nil {
+		t.Fatal(err)
+	}
+	if err := RenderInvoicePDF(&second, pdfInvoice(), pdfCompany); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("rendering the same invoice twice gave different bytes")
+	}
+}
@@ -0,0 +1,154 @@
+// Package billing holds the billing rules shared by the subscription handlers:
+// billing periods, invoicing and payment collection.
+package billing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/models"
+)
+
+// Interval units a plan can be billed in
+const (
+	IntervalDay   = "day"
+	IntervalWeek  = "week"
+	IntervalMonth = "month"
+	IntervalYear  = "year"
+)
+
+// Interval is the length of one billing period, e.g. 3 months
+type Interval struct {
+	Unit  string
+	Count int
+}
+
+// PlanInterval returns the billing interval of a plan. Plans created before
+// interval units existed only carry a day count in Duration.
+func PlanInterval(plan models.Plan) Interval {
+	if plan.IntervalUnit == "" {
+		return Interval{Unit: IntervalDay, Count: plan.Duration}
+	}
+	count := plan.IntervalCount
+	if count == 0 {
+		count = 1
+	}
+	return Interval{Unit: plan.IntervalUnit, Count: count}
+}
+
+// Validate checks the unit is known and the count positive
+func (i Interval) Validate() error {
+	switch i.Unit {
+	case IntervalDay, IntervalWeek, IntervalMonth, IntervalYear:
+	default:
+		return fmt.Errorf("interval unit must be one of day, week, month or year")
+	}
+	if i.Count <= 0 {
+		return fmt.Errorf("interval count must be positive")
+	}
+	return nil
+}
+
+// ApproxDays is the nominal length of the interval in days, kept on plans for
+// clients that still read Duration
+func (i Interval) ApproxDays() int {
+	switch i.Unit {
+	case IntervalWeek:
+		return 7 * i.Count
+	case IntervalMonth:
+		return 30 * i.Count
+	case IntervalYear:
+		return 365 * i.Count
+	default:
+		return i.Count
+	}
+}
+
+// MonthsPerPeriod is the length of the interval in months, or zero for day
+// and week based intervals
+func (i Interval) MonthsPerPeriod() int {
+	switch i.Unit {
+	case IntervalMonth:
+		return i.Count
+	case IntervalYear:
+		return 12 * i.Count
+	default:
+		return 0
+	}
+}
+
+// AddTo advances anchor by n intervals. Month and year steps are always taken
+// from the anchor itself and clamped to the end of the target month, so an
+// anchor on Jan 31 yields Feb 28 (or 29), Mar 31, Apr 30 and so on without
+// drifting.
+func (i Interval) AddTo(anchor time.Time, n int) time.Time {
+	switch i.Unit {
+	case IntervalWeek:
+		return anchor.AddDate(0, 0, 7*i.Count*n)
+	case IntervalMonth, IntervalYear:
+		return addMonthsClamped(anchor, i.MonthsPerPeriod()*n)
+	default:
+		return anchor.AddDate(0, 0, i.Count*n)
+	}
+}
+
+// Period returns the billing period containing at for a subscription whose
+// cycle is anchored at anchor. When the anchor is still in the future the
+// first period runs from at up to the anchor.
+func (i Interval) Period(anchor, at time.Time) (time.Time, time.Time) {
+	if i.Count <= 0 {
+		return at, at
+	}
+	if at.Before(anchor) {
+		return at, anchor
+	}
+
+	n := i.periodsBetween(anchor, at)
+	for i.AddTo(anchor, n).After(at) {
+		n--
+	}
+	for !i.AddTo(anchor, n+1).After(at) {
+		n++
+	}
+	return i.AddTo(anchor, n), i.AddTo(anchor, n+1)
+}
+
+// periodsBetween estimates how many whole intervals fit between from and to
+func (i Interval) periodsBetween(from, to time.Time) int {
+	if months := i.MonthsPerPeriod(); months > 0 {
+		elapsed := (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+		return elapsed / months
+	}
+	days := int(to.Sub(from).Hours() / 24)
+	return days / i.ApproxDays()
+}
+
+// FirstPeriod works out the billing cycle anchor and first period of a
+// subscription starting at start. Without an explicit anchor the cycle is
+// anchored on the start date; an explicit anchor must fall within one
+// interval after the start, making the first period a shorter one.
+func (i Interval) FirstPeriod(start time.Time, anchor *time.Time) (time.Time, time.Time, time.Time, error) {
+	if anchor == nil {
+		return start, start, i.AddTo(start, 1), nil
+	}
+	if anchor.Before(start) || anchor.After(i.AddTo(start, 1)) {
+		return time.Time{}, time.Time{}, time.Time{}, fmt.Errorf("billing cycle anchor must fall within one billing interval of the start date")
+	}
+	if anchor.Equal(start) {
+		return start, start, i.AddTo(start, 1), nil
+	}
+	return *anchor, start, *anchor, nil
+}
+
+func addMonthsClamped(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := daysIn(first.Year(), first.Month()); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,80 @@
+package billing
+
+import (
+	"errors"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/tax"
+)
+
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+// NormalizeProfile tidies and validates a billing profile entered by a
+// customer or administrator
+func NormalizeProfile(profile *models.BillingProfile) error {
+	profile.CompanyName = strings.TrimSpace(profile.CompanyName)
+	profile.Email = strings.TrimSpace(profile.Email)
+	profile.AddressLine1 = strings.TrimSpace(profile.AddressLine1)
+	profile.AddressLine2 = strings.TrimSpace(profile.AddressLine2)
+	profile.City = strings.TrimSpace(profile.City)
+	profile.PostalCode = strings.ToUpper(strings.TrimSpace(profile.PostalCode))
+	profile.Region = strings.ToUpper(strings.TrimSpace(profile.Region))
+	profile.Country = strings.ToUpper(strings.TrimSpace(profile.Country))
+	profile.TaxID = tax.NormalizeVATID(profile.TaxID)
+	profile.Currency = strings.ToUpper(strings.TrimSpace(profile.Currency))
+	profile.Locale = normalizeLocale(profile.Locale)
+
+	if profile.Currency != "" && !config.Billing.IsSupportedCurrency(profile.Currency) {
+		return errors.New("Billing currency is not supported")
+	}
+	if profile.Country != "" && len(profile.Country) != 2 {
+		return errors.New("Billing country must be an ISO 3166-1 alpha-2 code")
+	}
+	if profile.Email != "" {
+		if _, err := mail.ParseAddress(profile.Email); err != nil {
+			return errors.New("Billing email is not a valid email address")
+		}
+	}
+	if profile.Locale != "" && !localePattern.MatchString(profile.Locale) {
+		return errors.New("Locale must be a language tag such as en or de-DE")
+	}
+	if profile.TaxID != "" && tax.IsEU(profile.Country) && !tax.ValidVATID(profile.TaxID) {
+		return errors.New("Tax ID is not a valid EU VAT ID")
+	}
+	if profile.AddressLine1 != "" && (profile.City == "" || profile.Country == "") {
+		return errors.New("A billing address needs a city and country")
+	}
+	return nil
+}
+
+// snapshotCustomer copies the customer's billing profile onto an invoice
+// being issued, so later profile changes leave it untouched
+func snapshotCustomer(invoice *models.Invoice, user models.User) {
+	invoice.CustomerName = user.Name
+	invoice.Customer = user.Billing
+	if invoice.Customer.Email == "" {
+		invoice.Customer.Email = user.Email
+	}
+}
+
+// BillingEmail is where a customer's invoices and billing notices go
+func BillingEmail(user models.User) string {
+	if user.Billing.Email != "" {
+		return user.Billing.Email
+	}
+	return user.Email
+}
+
+// normalizeLocale accepts en_us, EN-us and the like
+func normalizeLocale(locale string) string {
+	locale = strings.ReplaceAll(strings.TrimSpace(locale), "_", "-")
+	language, region, found := strings.Cut(locale, "-")
+	if !found {
+		return strings.ToLower(language)
+	}
+	return strings.ToLower(language) + "-" + strings.ToUpper(region)
+}
@@ -0,0 +1,193 @@
+package billing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAmount = errors.New("amount must be positive and no more than the outstanding balance")
+	ErrNotRefundable = errors.New("invoice was not paid through the payment provider")
+	ErrInvalidReason = errors.New("reason must be one of duplicate, fraudulent, requested_by_customer, service_issue or other")
+)
+
+var validCreditReasons = map[string]bool{
+	models.CreditReasonDuplicate:           true,
+	models.CreditReasonFraudulent:          true,
+	models.CreditReasonRequestedByCustomer: true,
+	models.CreditReasonServiceIssue:        true,
+	models.CreditReasonOther:               true,
+}
+
+// CreditParams describes a credit note or refund approved by an administrator
+type CreditParams struct {
+	// Amount to credit or refund; zero means everything outstanding
+	Amount       float64
+	Reason       string
+	Memo         string
+	ApprovedByID uint
+	// CancelSubscription ends the invoice's subscription immediately
+	CancelSubscription bool
+}
+
+// CreditInvoice issues a credit note lowering what is still owed on an open
+// invoice. Crediting the full balance settles the invoice.
+func CreditInvoice(tx *gorm.DB, invoice *models.Invoice, params CreditParams) (*models.CreditNote, error) {
+	if invoice.Status != models.InvoiceStatusOpen {
+		return nil, ErrInvalidInvoiceState
+	}
+	if !validCreditReasons[params.Reason] {
+		return nil, ErrInvalidReason
+	}
+
+	outstanding := roundMoney(invoice.AmountDue - invoice.AmountPaid)
+	amount, err := creditAmount(params.Amount, outstanding)
+	if err != nil {
+		return nil, err
+	}
+
+	note, err := issueCreditNote(tx, invoice, amount, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordCreditNote(tx, invoice, note); err != nil {
+		return nil, err
+	}
+
+	invoice.AmountDue = roundMoney(invoice.AmountDue - amount)
+	invoice.AmountCredited = roundMoney(invoice.AmountCredited + amount)
+	if invoice.AmountDue <= invoice.AmountPaid {
+		now := time.Now()
+		invoice.Status = models.InvoiceStatusPaid
+		invoice.PaidAt = &now
+		invoice.NextPaymentAttemptAt = nil
+	}
+	if err := tx.Model(invoice).
+		Select("amount_due", "amount_credited", "status", "paid_at", "next_payment_attempt_at").
+		Updates(invoice).Error; err != nil {
+		return nil, err
+	}
+
+	if err := cancelIfRequested(tx, invoice, params); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+// RefundInvoice returns money paid on an invoice through the payment
+// provider, documenting it with a credit note
+func RefundInvoice(ctx context.Context, tx *gorm.DB, invoice *models.Invoice, params CreditParams) (*models.CreditNote, error) {
+	if invoice.Status != models.InvoiceStatusPaid {
+		return nil, ErrInvalidInvoiceState
+	}
+	if invoice.ChargeID == "" {
+		return nil, ErrNotRefundable
+	}
+	if !validCreditReasons[params.Reason] {
+		return nil, ErrInvalidReason
+	}
+
+	refundable := roundMoney(invoice.AmountPaid - invoice.AmountRefunded)
+	amount, err := creditAmount(params.Amount, refundable)
+	if err != nil {
+		return nil, err
+	}
+
+	providerRefund, err := Payments.Refund(ctx, invoice.ChargeID, amount, params.Reason)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPaymentFailed, err)
+	}
+
+	refund := models.Refund{
+		InvoiceID:        invoice.ID,
+		UserID:           invoice.UserID,
+		Amount:           amount,
+		Currency:         invoice.Currency,
+		Reason:           params.Reason,
+		ApprovedByID:     params.ApprovedByID,
+		ProviderRefundID: providerRefund.ID,
+	}
+	if err := tx.Create(&refund).Error; err != nil {
+		return nil, err
+	}
+	if err := recordRefund(tx, invoice, &refund); err != nil {
+		return nil, err
+	}
+	if err := releaseDeferredRevenue(tx, invoice, &refund); err != nil {
+		return nil, err
+	}
+
+	note, err := issueCreditNote(tx, invoice, amount, params, &refund)
+	if err != nil {
+		return nil, err
+	}
+
+	invoice.AmountRefunded = roundMoney(invoice.AmountRefunded + amount)
+	if err := tx.Model(invoice).Update("amount_refunded", invoice.AmountRefunded).Error; err != nil {
+		return nil, err
+	}
+
+	if err := cancelIfRequested(tx, invoice, params); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+func issueCreditNote(tx *gorm.DB, invoice *models.Invoice, amount float64, params CreditParams, refund *models.Refund) (*models.CreditNote, error) {
+	number, err := nextNumber(tx, "CN", time.Now().Year())
+	if err != nil {
+		return nil, err
+	}
+
+	note := models.CreditNote{
+		Number:       number,
+		InvoiceID:    invoice.ID,
+		UserID:       invoice.UserID,
+		Amount:       amount,
+		Currency:     invoice.Currency,
+		Reason:       params.Reason,
+		Memo:         params.Memo,
+		ApprovedByID: params.ApprovedByID,
+		Refund:       refund,
+	}
+	if refund != nil {
+		note.RefundID = &refund.ID
+	}
+	if err := tx.Omit("Refund").Create(&note).Error; err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// cancelIfRequested ends the invoice's subscription when the credit or
+// refund accompanies a cancellation
+func cancelIfRequested(tx *gorm.DB, invoice *models.Invoice, params CreditParams) error {
+	if !params.CancelSubscription || invoice.SubscriptionID == nil {
+		return nil
+	}
+
+	var sub models.Subscription
+	if err := tx.First(&sub, *invoice.SubscriptionID).Error; err != nil {
+		return err
+	}
+	if sub.Status == models.SubscriptionStatusCancelled {
+		return nil
+	}
+	return CancelSubscription(tx, &sub, fmt.Sprintf("Cancelled with credit on invoice %s (%s)", invoice.Number, params.Reason))
+}
+
+func creditAmount(requested, available float64) (float64, error) {
+	if requested == 0 {
+		requested = available
+	}
+	requested = roundMoney(requested)
+	if requested <= 0 || requested > available {
+		return 0, ErrInvalidAmount
+	}
+	return requested, nil
+}
@@ -0,0 +1,231 @@
+package billing
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/ledger"
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// scheduleRevenue defers the revenue of a newly paid invoice and spreads it
+// over the months of each line's service period. Revenue is net of tax and
+// of credit notes issued before payment.
+func scheduleRevenue(tx *gorm.DB, invoice *models.Invoice) error {
+	if invoice.Subtotal == 0 {
+		return nil
+	}
+	net := invoice.Total - invoice.Tax - invoice.AmountCredited
+	factor := net / invoice.Subtotal
+
+	var scheduled int64
+	if err := tx.Model(&models.RevenueSchedule{}).Where("invoice_id = ?", invoice.ID).Count(&scheduled).Error; err != nil || scheduled > 0 {
+		return err
+	}
+
+	var lines []models.InvoiceLineItem
+	if err := tx.Where("invoice_id = ?", invoice.ID).Order("id").Find(&lines).Error; err != nil {
+		return err
+	}
+
+	issued := time.Now()
+	if invoice.IssuedAt != nil {
+		issued = *invoice.IssuedAt
+	}
+
+	var deferred float64
+	for _, line := range lines {
+		amount := roundMoney(line.Amount * factor)
+		if amount == 0 {
+			continue
+		}
+		start, end := line.PeriodStart, line.PeriodEnd
+		if !start.Before(end) {
+			// One-off charges are earned when issued
+			start, end = issued, issued
+		}
+
+		schedule := models.RevenueSchedule{
+			InvoiceID:      invoice.ID,
+			LineItemID:     line.ID,
+			SubscriptionID: invoice.SubscriptionID,
+			UserID:         invoice.UserID,
+			Currency:       invoice.Currency,
+			Amount:         amount,
+			PeriodStart:    start,
+			PeriodEnd:      end,
+			Entries:        allocateMonths(amount, start, end),
+		}
+		if err := tx.Create(&schedule).Error; err != nil {
+			return err
+		}
+		deferred += amount
+	}
+
+	_, err := ledger.Post(tx, invoice.Currency, "Revenue deferred for invoice "+invoice.Number, SourceRevenueDeferral, invoice.ID,
+		ledger.Debit(ledger.AccountRevenue, 0, roundMoney(deferred)),
+		ledger.Credit(ledger.AccountDeferredRevenue, 0, roundMoney(deferred)),
+	)
+	return err
+}
+
+// RecognizeRevenue recognizes the schedule entries of every month that has
+// ended by now
+func RecognizeRevenue(ctx context.Context, db *gorm.DB, now time.Time) error {
+	var ids []uint
+	if err := db.Model(&models.RevenueScheduleEntry{}).
+		Where("recognized_at IS NULL AND month < ?", monthStart(now)).
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var entry models.RevenueScheduleEntry
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&entry, id).Error; err != nil {
+				return err
+			}
+			if entry.RecognizedAt != nil {
+				return nil
+			}
+			return recognizeEntry(tx, &entry, now)
+		})
+		if err != nil {
+			log.Printf("Recognizing revenue entry %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// releaseDeferredRevenue lowers the revenue still to be recognized on a
+// refunded invoice by the refund's share of revenue
+func releaseDeferredRevenue(tx *gorm.DB, invoice *models.Invoice, refund *models.Refund) error {
+	if invoice.Total <= 0 {
+		return nil
+	}
+	entries, err := pendingEntries(tx.Where("revenue_schedules.invoice_id = ?", invoice.ID))
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+
+	var pending float64
+	for _, entry := range entries {
+		pending += entry.Amount
+	}
+	release := roundMoney(math.Min(refund.Amount*(invoice.Total-invoice.Tax)/invoice.Total, pending))
+	if release <= 0 {
+		return nil
+	}
+
+	// Lower each entry in proportion, leaving any rounding on the last
+	remaining := release
+	for i := range entries {
+		entry := &entries[i]
+		cut := roundMoney(release * entry.Amount / pending)
+		if i == len(entries)-1 {
+			cut = remaining
+		}
+		remaining = roundMoney(remaining - cut)
+		entry.Amount = roundMoney(entry.Amount - cut)
+		if err := tx.Model(entry).Update("amount", entry.Amount).Error; err != nil {
+			return err
+		}
+	}
+
+	_, err = ledger.Post(tx, invoice.Currency, "Deferred revenue released by refund on invoice "+invoice.Number, SourceRefundDeferral, refund.ID,
+		ledger.Debit(ledger.AccountDeferredRevenue, 0, release),
+		ledger.Credit(ledger.AccountRefunds, 0, release),
+	)
+	return err
+}
+
+// recognizeRemainingRevenue brings forward the revenue not yet recognized on
+// a cancelled subscription: nothing more is owed to the customer, so it is
+// earned now
+func recognizeRemainingRevenue(tx *gorm.DB, sub *models.Subscription, at time.Time) error {
+	entries, err := pendingEntries(tx.Where("revenue_schedules.subscription_id = ?", sub.ID))
+	if err != nil {
+		return err
+	}
+
+	month := monthStart(at)
+	for i := range entries {
+		entry := &entries[i]
+		if entry.Month.After(month) {
+			entry.Month = month
+		}
+		if err := recognizeEntry(tx, entry, at); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func recognizeEntry(tx *gorm.DB, entry *models.RevenueScheduleEntry, at time.Time) error {
+	var schedule models.RevenueSchedule
+	if err := tx.First(&schedule, entry.ScheduleID).Error; err != nil {
+		return err
+	}
+
+	if _, err := ledger.Post(tx, schedule.Currency, "Revenue recognized for "+entry.Month.Format("January 2006"), SourceRevenueRecognition, entry.ID,
+		ledger.Debit(ledger.AccountDeferredRevenue, 0, entry.Amount),
+		ledger.Credit(ledger.AccountRevenue, 0, entry.Amount),
+	); err != nil {
+		return err
+	}
+
+	entry.RecognizedAt = &at
+	return tx.Model(entry).Select("month", "recognized_at").Updates(entry).Error
+}
+
+// pendingEntries locks and returns the entries not yet recognized of the
+// schedules matched by scope
+func pendingEntries(scope *gorm.DB) ([]models.RevenueScheduleEntry, error) {
+	var entries []models.RevenueScheduleEntry
+	err := scope.Clauses(clause.Locking{Strength: "UPDATE", Table: clause.Table{Name: "revenue_schedule_entries"}}).
+		Joins("JOIN revenue_schedules ON revenue_schedules.id = revenue_schedule_entries.schedule_id").
+		Where("revenue_schedule_entries.recognized_at IS NULL").
+		Order("revenue_schedule_entries.month, revenue_schedule_entries.id").
+		Find(&entries).Error
+	return entries, err
+}
+
+// allocateMonths splits amount over the calendar months of [start, end) in
+// proportion to the time falling in each, putting any rounding difference
+// on the last month. An empty period yields a single entry.
+func allocateMonths(amount float64, start, end time.Time) []models.RevenueScheduleEntry {
+	start, end = start.UTC(), end.UTC()
+	if !start.Before(end) {
+		return []models.RevenueScheduleEntry{{Month: monthStart(start), Amount: amount}}
+	}
+
+	total := end.Sub(start).Seconds()
+	var entries []models.RevenueScheduleEntry
+	remaining := amount
+	for month := monthStart(start); month.Before(end); month = month.AddDate(0, 1, 0) {
+		from, to := month, month.AddDate(0, 1, 0)
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+
+		share := roundMoney(amount * to.Sub(from).Seconds() / total)
+		if !month.AddDate(0, 1, 0).Before(end) {
+			share = roundMoney(remaining)
+		}
+		remaining -= share
+		entries = append(entries, models.RevenueScheduleEntry{Month: month, Amount: share})
+	}
+	return entries
+}
+
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
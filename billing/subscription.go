@@ -0,0 +1,124 @@
+package billing
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+)
+
+// SetSubscriptionStatus moves a subscription to a new status and records the
+// change in its history. Past due subscriptions keep access; expired and
+// cancelled ones lose it.
+func SetSubscriptionStatus(tx *gorm.DB, sub *models.Subscription, status, message string) error {
+	if sub.Status == status {
+		return nil
+	}
+
+	event := models.SubscriptionEvent{
+		SubscriptionID: sub.ID,
+		Type:           models.SubscriptionEventStatusChanged,
+		FromStatus:     sub.Status,
+		ToStatus:       status,
+		Message:        message,
+	}
+
+	now := time.Now()
+	sub.Status = status
+	sub.Active = status == models.SubscriptionStatusActive || status == models.SubscriptionStatusPastDue
+	if status == models.SubscriptionStatusPastDue {
+		sub.PastDueSince = &now
+	} else {
+		sub.PastDueSince = nil
+	}
+	if !sub.Active {
+		sub.EndedAt = &now
+	}
+
+	if err := tx.Model(sub).Select("status", "active", "past_due_since", "ended_at").Updates(sub).Error; err != nil {
+		return err
+	}
+	return tx.Create(&event).Error
+}
+
+// CancelSubscription ends a subscription immediately, stops any payment
+// retries for its open invoices and recognizes the revenue it had deferred
+func CancelSubscription(tx *gorm.DB, sub *models.Subscription, message string) error {
+	if err := tx.Model(&models.Invoice{}).
+		Where("subscription_id = ? AND status = ?", sub.ID, models.InvoiceStatusOpen).
+		Update("next_payment_attempt_at", nil).Error; err != nil {
+		return err
+	}
+	if err := SetSubscriptionStatus(tx, sub, models.SubscriptionStatusCancelled, message); err != nil {
+		return err
+	}
+	return recognizeRemainingRevenue(tx, sub, time.Now())
+}
+
+// ResumeSubscription returns a subscription that was waiting on its invoice
+// to active once the invoice is paid: an incomplete one starts, a past due
+// one recovers. A user holds one active subscription, so a subscription
+// that lost access while past due is not given it back if its user has
+// taken out another meanwhile; it is cancelled instead, keeping the
+// payment for the time it was used, and ResumeSubscription reports false.
+func ResumeSubscription(tx *gorm.DB, sub *models.Subscription, invoice *models.Invoice, message string) (bool, error) {
+	if sub.Status != models.SubscriptionStatusIncomplete && sub.Status != models.SubscriptionStatusPastDue {
+		return false, nil
+	}
+	if invoice.NextPaymentAttemptAt != nil {
+		invoice.NextPaymentAttemptAt = nil
+		if err := tx.Model(invoice).Update("next_payment_attempt_at", nil).Error; err != nil {
+			return false, err
+		}
+	}
+
+	replaced, err := isReplaced(tx, sub)
+	if err != nil {
+		return false, err
+	}
+	if replaced {
+		return false, CancelSubscription(tx, sub, fmt.Sprintf("Invoice %s paid after the subscription was replaced by another", invoice.Number))
+	}
+	return true, SetSubscriptionStatus(tx, sub, models.SubscriptionStatusActive, message)
+}
+
+// ResumeOnPayment is the Settlement of a customer paying an invoice: once it
+// is paid, the subscription it bills is resumed
+func ResumeOnPayment(tx *gorm.DB, invoice *models.Invoice, paymentErr error) error {
+	if paymentErr != nil || invoice.SubscriptionID == nil {
+		return nil
+	}
+	sub, err := lockSubscription(tx, invoice)
+	if err != nil {
+		return err
+	}
+	_, err = ResumeSubscription(tx, sub, invoice, "Payment received")
+	return err
+}
+
+// isReplaced reports whether a subscription without access has been
+// replaced by another one its user holds
+func isReplaced(tx *gorm.DB, sub *models.Subscription) (bool, error) {
+	if sub.Active {
+		return false, nil
+	}
+	var held int64
+	err := tx.Model(&models.Subscription{}).
+		Where("user_id = ? AND id <> ? AND (active OR status = ?)", sub.UserID, sub.ID, models.SubscriptionStatusIncomplete).
+		Count(&held).Error
+	return held > 0, err
+}
+
+// RecordEvent adds an entry to a subscription's history
+func RecordEvent(tx *gorm.DB, sub *models.Subscription, eventType string, invoice *models.Invoice, format string, args ...interface{}) error {
+	event := models.SubscriptionEvent{
+		SubscriptionID: sub.ID,
+		Type:           eventType,
+		Message:        fmt.Sprintf(format, args...),
+	}
+	if invoice != nil {
+		event.InvoiceID = &invoice.ID
+	}
+	return tx.Create(&event).Error
+}
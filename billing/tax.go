@@ -0,0 +1,55 @@
+package billing
+
+import (
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/tax"
+	"gorm.io/gorm"
+)
+
+// applyTax adds the customer's sales tax to a totalled draft invoice. EU
+// business customers in another member state are reverse charged: the tax
+// line is recorded at zero and the customer accounts for the VAT.
+func applyTax(tx *gorm.DB, invoice *models.Invoice) error {
+	var user models.User
+	if err := tx.First(&user, invoice.UserID).Error; err != nil {
+		return err
+	}
+
+	rate, err := tax.FindRate(tx, user.Billing.Country, user.Billing.Region)
+	if err != nil || rate == nil {
+		return err
+	}
+
+	line := models.InvoiceTax{
+		TaxRateID:     &rate.ID,
+		Name:          rate.Name,
+		Country:       rate.Country,
+		Region:        rate.Region,
+		Percentage:    rate.Percentage,
+		Inclusive:     rate.Inclusive,
+		TaxableAmount: invoice.Subtotal,
+	}
+
+	if tax.ReverseCharge(config.Billing.Company.Country, user.Billing.Country, user.Billing.TaxID) {
+		line.ReverseCharge = true
+		invoice.ReverseCharge = true
+		if rate.Inclusive {
+			// The customer pays the net price; the VAT is theirs to account for
+			line.TaxableAmount = roundMoney(invoice.Subtotal - tax.Amount(*rate, invoice.Subtotal))
+			invoice.Total = line.TaxableAmount
+		}
+		invoice.Taxes = []models.InvoiceTax{line}
+		return nil
+	}
+
+	line.Amount = tax.Amount(*rate, invoice.Subtotal)
+	if rate.Inclusive {
+		line.TaxableAmount = roundMoney(invoice.Subtotal - line.Amount)
+	} else {
+		invoice.Total = roundMoney(invoice.Subtotal + line.Amount)
+	}
+	invoice.Tax = line.Amount
+	invoice.Taxes = []models.InvoiceTax{line}
+	return nil
+}
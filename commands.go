@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/migrations"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/webhooks"
+)
+
+const usage = `usage:
+  main                                   start the API server
+  main migrate up                        apply every pending schema migration
+  main migrate down [steps]              revert the last applied migrations (default 1)
+  main migrate status                    list migrations and when they were applied
+  main webhooks replay <event-id>...     process stored webhook events again
+  main webhooks replay --failed          process every failed webhook event again`
+
+// runCommand runs the maintenance command named by args
+func runCommand(args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrateCommand(args[1:])
+	case "webhooks":
+		return runWebhooksCommand(args[1:])
+	default:
+		return errors.New(usage)
+	}
+}
+
+func runMigrateCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	db, err := config.DB.DB()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrations.Up(ctx, db)
+		for _, m := range applied {
+			log.Printf("Applied %04d_%s", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			log.Println("Schema is up to date")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := migrations.Down(ctx, db, steps)
+		for _, m := range reverted {
+			log.Printf("Reverted %04d_%s", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		states, err := migrations.Status(ctx, db)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = "applied " + state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			name := state.Name
+			if name == "" {
+				name = "(unknown to this binary)"
+			}
+			fmt.Printf("%04d  %-40s  %s\n", state.Version, name, applied)
+		}
+		return nil
+	default:
+		return errors.New(usage)
+	}
+}
+
+func runWebhooksCommand(args []string) error {
+	if len(args) < 2 || args[0] != "replay" {
+		return errors.New(usage)
+	}
+
+	var ids []uint
+	if args[1] == "--failed" {
+		if err := config.DB.Model(&models.WebhookEvent{}).
+			Where("status = ?", models.WebhookStatusFailed).
+			Order("id").
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+	} else {
+		for _, arg := range args[1:] {
+			id, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid event ID %q", arg)
+			}
+			ids = append(ids, uint(id))
+		}
+	}
+
+	failed := 0
+	for _, id := range ids {
+		event, err := webhooks.Process(config.DB, id, true)
+		if err != nil {
+			failed++
+			log.Printf("Event %d: %v", id, err)
+			continue
+		}
+		log.Printf("Event %d (%s %s): %s", id, event.EventID, event.Type, event.Status)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d events failed", failed, len(ids))
+	}
+	return nil
+}
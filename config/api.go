@@ -0,0 +1,25 @@
+package config
+
+import (
+	"os"
+	"time"
+)
+
+type APIConfig struct {
+	// LegacyResponses serves the auth, user and subscription endpoints in
+	// the response shapes they had before the handlers package became the
+	// canonical API, for clients that have not moved yet
+	LegacyResponses bool
+	// IdempotencyTTL is how long the response to a request sent with an
+	// Idempotency-Key is kept for retries
+	IdempotencyTTL time.Duration
+}
+
+var API *APIConfig
+
+func InitAPIConfig() {
+	API = &APIConfig{
+		LegacyResponses: os.Getenv("API_COMPAT_LEGACY") == "true",
+		IdempotencyTTL:  getDurationOrDefault("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+	}
+}
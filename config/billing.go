@@ -0,0 +1,146 @@
+package config
+
+import (
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Price fallback policies applied when a plan has no price for the
+// requested currency.
+const (
+	PriceFallbackBase = "base" // quote the plan's base price in the base currency
+	PriceFallbackOmit = "omit" // leave the plan out of the listing
+)
+
+type BillingConfig struct {
+	BaseCurrency        string
+	SupportedCurrencies []string
+	PriceFallback       string
+	PaymentProvider     string
+	AllowFakePayments   bool // development and test setups only
+	WebhookSecret       []byte
+	WebhookTolerance    time.Duration
+	SchedulerInterval   time.Duration
+	Dunning             DunningConfig
+	Company             CompanyInfo
+}
+
+// Final dunning actions once every retry has failed
+const (
+	DunningFinalCancel    = "cancel"
+	DunningFinalDowngrade = "downgrade"
+)
+
+// DunningConfig is the schedule for retrying failed renewal payments
+type DunningConfig struct {
+	RetryDays       []int // days after the first failure to retry the charge
+	GracePeriod     time.Duration
+	FinalAction     string
+	DowngradePlanID uint
+}
+
+// CompanyInfo is the seller shown in invoice and receipt headers
+type CompanyInfo struct {
+	Name    string
+	Address []string
+	Email   string
+	Country string // ISO 3166-1 alpha-2; decides whether EU sales are cross-border
+	TaxID   string
+}
+
+var Billing *BillingConfig
+
+func InitBillingConfig() {
+	base := strings.ToUpper(getEnvOrDefault("BASE_CURRENCY", "USD"))
+
+	supported := []string{base}
+	for _, code := range strings.Split(getEnvOrDefault("SUPPORTED_CURRENCIES", "EUR,GBP,INR"), ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if code != "" && code != base {
+			supported = append(supported, code)
+		}
+	}
+
+	fallback := getEnvOrDefault("PRICE_FALLBACK", PriceFallbackBase)
+	if fallback != PriceFallbackOmit {
+		fallback = PriceFallbackBase
+	}
+
+	Billing = &BillingConfig{
+		BaseCurrency:        base,
+		SupportedCurrencies: supported,
+		PriceFallback:       fallback,
+		PaymentProvider:     os.Getenv("PAYMENT_PROVIDER"),
+		AllowFakePayments:   os.Getenv("ALLOW_FAKE_PAYMENTS") == "true",
+		WebhookSecret:       []byte(os.Getenv("WEBHOOK_SECRET")),
+		WebhookTolerance:    5 * time.Minute,
+		SchedulerInterval:   getDurationOrDefault("SCHEDULER_INTERVAL", time.Hour),
+		Dunning:             loadDunningConfig(),
+		Company: CompanyInfo{
+			Name:    getEnvOrDefault("COMPANY_NAME", "Subscription App"),
+			Address: splitLines(os.Getenv("COMPANY_ADDRESS")),
+			Email:   os.Getenv("COMPANY_EMAIL"),
+			Country: strings.ToUpper(os.Getenv("COMPANY_COUNTRY")),
+			TaxID:   os.Getenv("COMPANY_TAX_ID"),
+		},
+	}
+}
+
+// IsSupportedCurrency reports whether code is one of the currencies we sell in
+func (b *BillingConfig) IsSupportedCurrency(code string) bool {
+	for _, supported := range b.SupportedCurrencies {
+		if strings.EqualFold(supported, code) {
+			return true
+		}
+	}
+	return false
+}
+
+func loadDunningConfig() DunningConfig {
+	var retryDays []int
+	for _, day := range strings.Split(getEnvOrDefault("DUNNING_RETRY_DAYS", "1,3,7"), ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(day)); err == nil && n > 0 {
+			retryDays = append(retryDays, n)
+		}
+	}
+	sort.Ints(retryDays)
+
+	graceDays, err := strconv.Atoi(getEnvOrDefault("DUNNING_GRACE_DAYS", "7"))
+	if err != nil || graceDays < 0 {
+		graceDays = 7
+	}
+
+	finalAction := getEnvOrDefault("DUNNING_FINAL_ACTION", DunningFinalCancel)
+	downgradePlanID, _ := strconv.ParseUint(os.Getenv("DUNNING_DOWNGRADE_PLAN_ID"), 10, 64)
+	if finalAction != DunningFinalDowngrade || downgradePlanID == 0 {
+		finalAction = DunningFinalCancel
+	}
+
+	return DunningConfig{
+		RetryDays:       retryDays,
+		GracePeriod:     time.Duration(graceDays) * 24 * time.Hour,
+		FinalAction:     finalAction,
+		DowngradePlanID: uint(downgradePlanID),
+	}
+}
+
+func getDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// splitLines splits a semicolon separated address into its lines
+func splitLines(value string) []string {
+	var lines []string
+	for _, line := range strings.Split(value, ";") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -3,156 +3,88 @@ package controllers
 
 import (
 	"errors"
-	"time"
 
-	"github.com/chandra-devs/subscription_app/config"
-	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/handlers"
+	"github.com/chandra-devs/subscription_app/service"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
 )
 
-type LoginInput struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
+// AuthController registers and signs in users, answering in the legacy
+// shape: the token pair unwrapped and errors as {"error": ...}
+type AuthController struct {
+	Users *service.UserService
 }
 
-type RegisterInput struct {
-	Name     string `json:"name" validate:"required"`
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
+func NewAuthController(users *service.UserService) *AuthController {
+	return &AuthController{Users: users}
 }
 
-type TokenResponse struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
-	ExpiresIn    int64  `json:"expires_in"`
-}
-
-func Register(c *fiber.Ctx) error {
-	input := new(RegisterInput)
-	if err := c.BodyParser(input); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid input format",
-		})
+func (ctrl *AuthController) Register(c *fiber.Ctx) error {
+	input := new(handlers.RegisterInput)
+	if err := handlers.Bind(c, input); err != nil {
+		return badRequest(c, err)
 	}
 
-	// Validate input
-	if len(input.Password) < 8 {
+	user, err := ctrl.Users.Register(c.UserContext(), input.Registration())
+	var invalid *service.InvalidError
+	switch {
+	case errors.Is(err, service.ErrPasswordTooShort):
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Password must be at least 8 characters long",
 		})
-	}
-
-	// Check if email already exists
-	var existingUser models.User
-	if result := config.DB.Where("email = ?", input.Email).First(&existingUser); result.Error == nil {
+	case errors.Is(err, service.ErrEmailTaken):
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 			"error": "Email already registered",
 		})
-	}
-
-	// Hash password with appropriate cost
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), 12)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to process registration",
+	case errors.As(err, &invalid):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
 		})
-	}
-
-	user := &models.User{
-		Name:     input.Name,
-		Email:    input.Email,
-		Password: string(hashedPassword),
-	}
-
-	if result := config.DB.Create(user); result.Error != nil {
+	case err != nil:
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create user",
 		})
 	}
 
 	// Generate tokens
-	tokens, err := generateTokens(user.ID)
+	tokens, err := handlers.IssueTokens(user.ID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate authentication tokens",
 		})
 	}
 
+	// Responses carrying tokens are never cached or kept for replay
+	c.Set(fiber.HeaderCacheControl, "no-store")
 	return c.Status(fiber.StatusCreated).JSON(tokens)
 }
 
-func Login(c *fiber.Ctx) error {
-	input := new(LoginInput)
-	if err := c.BodyParser(input); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid input format",
-		})
+func (ctrl *AuthController) Login(c *fiber.Ctx) error {
+	input := new(handlers.LoginInput)
+	if err := handlers.Bind(c, input); err != nil {
+		return badRequest(c, err)
 	}
 
-	var user models.User
-	if result := config.DB.Where("email = ?", input.Email).First(&user); result.Error != nil {
+	user, err := ctrl.Users.Authenticate(c.UserContext(), input.Email, input.Password)
+	if errors.Is(err, service.ErrInvalidCredentials) {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid credentials",
 		})
 	}
-
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid credentials",
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to sign in",
 		})
 	}
 
 	// Generate tokens
-	tokens, err := generateTokens(user.ID)
+	tokens, err := handlers.IssueTokens(user.ID)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate authentication tokens",
 		})
 	}
 
+	c.Set(fiber.HeaderCacheControl, "no-store")
 	return c.JSON(tokens)
 }
-
-var tokenGenerationLimit = make(chan struct{}, 1000) // Limit concurrent token generations
-
-func generateTokens(userID uint) (*TokenResponse, error) {
-	// Limit concurrent token generations
-	select {
-	case tokenGenerationLimit <- struct{}{}:
-		defer func() { <-tokenGenerationLimit }()
-	default:
-		return nil, errors.New("token generation limit reached")
-	}
-
-	// Access token
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(config.JWT.AccessTokenDuration).Unix(),
-		"type":    "access",
-	})
-
-	accessTokenString, err := accessToken.SignedString(config.JWT.Secret)
-	if err != nil {
-		return nil, err
-	}
-
-	// Refresh token
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(config.JWT.RefreshTokenDuration).Unix(),
-		"type":    "refresh",
-	})
-
-	refreshTokenString, err := refreshToken.SignedString(config.JWT.Secret)
-	if err != nil {
-		return nil, err
-	}
-
-	return &TokenResponse{
-		AccessToken:  accessTokenString,
-		RefreshToken: refreshTokenString,
-		ExpiresIn:    time.Now().Add(config.JWT.AccessTokenDuration).Unix(),
-	}, nil
-}
@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"errors"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/gofiber/fiber/v2"
+)
+
+// badRequest answers a body refused by handlers.Bind, or a query refused by
+// a list spec, in the legacy shape. Legacy errors carry one message, so
+// only the first broken field is reported.
+func badRequest(c *fiber.Ctx, err error) error {
+	message := "Invalid input"
+	var invalid *apperror.Error
+	if errors.As(err, &invalid) {
+		message = invalid.Detail
+		if len(invalid.Fields) > 0 {
+			message = invalid.Fields[0].Message
+		}
+	}
+	return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": message})
+}
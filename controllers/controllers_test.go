@@ -0,0 +1,90 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/controllers"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/repository/memory"
+	"github.com/chandra-devs/subscription_app/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// newApp serves the legacy user and subscription endpoints from the
+// in-memory repositories, with every request made by an administrator
+func newApp(t *testing.T) *fiber.App {
+	t.Helper()
+	config.InitBillingConfig()
+
+	users := memory.NewUsers(models.User{Name: "Admin", Email: "admin@example.com", Role: models.RoleAdmin})
+	plans := memory.NewPlans(models.Plan{Name: "Pro", Price: 20, Duration: 30})
+	subs := memory.NewSubscriptions()
+	biller := &memory.Biller{Subscriptions: subs}
+	audit := memory.NewAudit()
+	userController := controllers.NewUserController(service.NewUserService(users, subs, biller, audit))
+	subscriptionController := controllers.NewSubscriptionController(service.NewSubscriptionService(users, plans, subs, biller, audit))
+
+	app := fiber.New(fiber.Config{ErrorHandler: apperror.Handler})
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_id", uint(1))
+		c.Locals("is_admin", true)
+		return c.Next()
+	})
+	app.Post("/users", userController.CreateUser)
+	app.Put("/users/:id", userController.UpdateUser)
+	app.Post("/subscriptions", subscriptionController.CreateSubscription)
+	return app
+}
+
+func TestLegacyBodiesAreValidated(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		error  string // the legacy error message, if any
+	}{
+		{"user", http.MethodPost, "/users", `{"name": "Alan Turing", "email": "alan@example.com"}`, http.StatusCreated, ""},
+		{"user with a bad email", http.MethodPost, "/users", `{"name": "Alan Turing", "email": "alan"}`, http.StatusBadRequest, "email"},
+		{"user with a role", http.MethodPost, "/users", `{"name": "Alan Turing", "email": "alan@example.com", "role": "admin"}`, http.StatusBadRequest, "role is not a known field"},
+		{"malformed JSON", http.MethodPost, "/users", `{"name": `, http.StatusBadRequest, "Invalid input format"},
+		{"patch with a null name", http.MethodPut, "/users/1", `{"name": null}`, http.StatusBadRequest, "name"},
+		{"subscription", http.MethodPost, "/subscriptions", `{"plan_id": 1}`, http.StatusCreated, ""},
+		{"subscription without a plan", http.MethodPost, "/subscriptions", `{}`, http.StatusBadRequest, "plan_id"},
+		{"subscription with a mistyped plan", http.MethodPost, "/subscriptions", `{"plan_id": "pro"}`, http.StatusBadRequest, "plan_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+			res, err := newApp(t).Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			var body map[string]any
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tt.status {
+				t.Fatalf("status %d, want %d; body %v", res.StatusCode, tt.status, body)
+			}
+			if tt.error == "" {
+				return
+			}
+			// Refusals keep the legacy shape, naming the broken field
+			message, _ := body["error"].(string)
+			if len(body) != 1 || !strings.Contains(message, tt.error) {
+				t.Errorf("body %v, want {\"error\": ...} mentioning %q", body, tt.error)
+			}
+		})
+	}
+}
@@ -1,152 +1,65 @@
 package controllers
 
 import (
-	"github.com/chandra-devs/subscription_app/config"
-	"github.com/chandra-devs/subscription_app/models"
+	"errors"
+
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/handlers"
+	"github.com/chandra-devs/subscription_app/middleware"
+	"github.com/chandra-devs/subscription_app/service"
 	"github.com/gofiber/fiber/v2"
 )
 
-func CreateSubscription(c *fiber.Ctx) error {
-	subscription := new(models.Subscription)
-	if err := c.BodyParser(subscription); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Invalid input",
-		})
-	}
-
-	if result := config.DB.Create(&subscription); result.Error != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Failed to create subscription",
-		})
-	}
-
-	return c.Status(201).JSON(fiber.Map{
-		"status":  "success",
-		"message": "Subscription created successfully",
-		"data":    subscription,
-	})
+// SubscriptionController serves the subscription endpoints whose legacy
+// shape differs from the canonical one: records unwrapped and errors as
+// {"error": ...}
+type SubscriptionController struct {
+	Subscriptions *service.SubscriptionService
 }
 
-func GetSubscriptions(c *fiber.Ctx) error {
-	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 50)
-	if limit > 100 {
-		limit = 100 // Prevent memory exhaustion from large queries
-	}
-
-	offset := (page - 1) * limit
-	var total int64
-	var subscriptions []models.Subscription
+func NewSubscriptionController(subscriptions *service.SubscriptionService) *SubscriptionController {
+	return &SubscriptionController{Subscriptions: subscriptions}
+}
 
-	// Get total count with a separate query
-	if err := config.DB.Model(&models.Subscription{}).Count(&total).Error; err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Failed to fetch subscriptions count",
-		})
+func (ctrl *SubscriptionController) GetUserSubscriptions(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("userId")
+	callerID, _ := middleware.UserID(c)
+	if err != nil || userID <= 0 || (uint(userID) != callerID && !middleware.IsAdmin(c)) {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
 	}
-
-	// Get paginated data
-	if result := config.DB.
-		Preload("User"). // Use preload instead of eager loading
-		Preload("Plan"). // Preload related data
-		Limit(limit).
-		Offset(offset).
-		Find(&subscriptions); result.Error != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Failed to fetch subscriptions",
-		})
+	subscriptions, err := ctrl.Subscriptions.ListForUser(c.UserContext(), uint(userID))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Could not retrieve subscriptions"})
 	}
-
-	return c.JSON(fiber.Map{
-		"status": "success",
-		"data": fiber.Map{
-			"subscriptions": subscriptions,
-			"pagination": fiber.Map{
-				"current_page": page,
-				"total_pages":  (total + int64(limit) - 1) / int64(limit),
-				"total_items":  total,
-				"per_page":     limit,
-			},
-		},
-	})
+	return c.JSON(subscriptions)
 }
 
-func GetSubscription(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var subscription models.Subscription
-	if result := config.DB.First(&subscription, id); result.Error != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Subscription not found",
-		})
+func (ctrl *SubscriptionController) CreateSubscription(c *fiber.Ctx) error {
+	var req handlers.NewSubscriptionRequest
+	if err := handlers.Bind(c, &req); err != nil {
+		return badRequest(c, err)
 	}
-
-	return c.JSON(fiber.Map{
-		"status": "success",
-		"data":   subscription,
-	})
-}
-
-func UpdateSubscription(c *fiber.Ctx) error {
-	id := c.Params("id")
-	subscription := new(models.Subscription)
-
-	if result := config.DB.First(&subscription, id); result.Error != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Subscription not found",
-		})
+	userID, ok := middleware.ActingFor(c, req.UserID)
+	if !ok {
+		return c.Status(403).JSON(fiber.Map{"error": "Only administrators can subscribe other users"})
 	}
 
-	if err := c.BodyParser(subscription); err != nil {
-		return c.Status(400).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Invalid input",
-		})
+	subscription, _, err := ctrl.Subscriptions.Subscribe(c.UserContext(), service.SubscribeParams{UserID: userID, PlanID: req.PlanID})
+	if errors.Is(err, service.ErrPlanNotFound) || errors.Is(err, service.ErrPlanUnavailable) {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid plan"})
 	}
-
-	config.DB.Save(&subscription)
-	return c.JSON(fiber.Map{
-		"status":  "success",
-		"message": "Subscription updated successfully",
-		"data":    subscription,
-	})
-}
-
-func DeleteSubscription(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var subscription models.Subscription
-	if result := config.DB.First(&subscription, id); result.Error != nil {
-		return c.Status(404).JSON(fiber.Map{
-			"status":  "error",
-			"message": "Subscription not found",
-		})
+	if errors.Is(err, service.ErrUserNotFound) {
+		return c.Status(400).JSON(fiber.Map{"error": "Invalid user"})
+	}
+	if errors.Is(err, service.ErrAlreadySubscribed) {
+		return c.Status(409).JSON(fiber.Map{"error": "User already has an active subscription"})
+	}
+	if errors.Is(err, billing.ErrPaymentFailed) || errors.Is(err, billing.ErrNoPaymentMethod) {
+		return c.Status(402).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to create subscription"})
 	}
 
-	config.DB.Delete(&subscription)
-	return c.JSON(fiber.Map{
-		"status":  "success",
-		"message": "Subscription deleted successfully",
-	})
-}
-
-func GetSubscriptionStats(c *fiber.Ctx) error {
-	var totalSubscriptions int64
-	var totalAmount float64
-
-	config.DB.Model(&models.Subscription{}).Count(&totalSubscriptions)
-	config.DB.Model(&models.Subscription{}).Select("sum(amount)").Row().Scan(&totalAmount)
-
-	return c.JSON(fiber.Map{
-		"status": "success",
-		"data": fiber.Map{
-			"total_subscriptions": totalSubscriptions,
-			"total_amount":        totalAmount,
-			"monthly_spending":    totalAmount,
-		},
-	})
+	return c.Status(201).JSON(subscription)
 }
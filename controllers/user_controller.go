@@ -1,105 +1,134 @@
 package controllers
 
 import (
-	"github.com/chandra-devs/subscription_app/config"
-	"github.com/chandra-devs/subscription_app/models"
+	"errors"
+
+	"github.com/chandra-devs/subscription_app/handlers"
+	"github.com/chandra-devs/subscription_app/middleware"
+	"github.com/chandra-devs/subscription_app/service"
 	"github.com/gofiber/fiber/v2"
 )
 
-func GetUsers(c *fiber.Ctx) error {
-	page := c.QueryInt("page", 1)
-	limit := c.QueryInt("limit", 50)
+// UserController manages user accounts, answering in the legacy shape:
+// records unwrapped and errors as {"error": ...}
+type UserController struct {
+	Users *service.UserService
+}
 
-	var users []models.User
-	offset := (page - 1) * limit
+func NewUserController(users *service.UserService) *UserController {
+	return &UserController{Users: users}
+}
+
+// GetUsers lists users by page number. It takes the filters and sort order
+// of handlers.UserHandler.GetUsers, and the same cap on limit.
+func (ctrl *UserController) GetUsers(c *fiber.Ctx) error {
+	q, err := handlers.UserList.Parse(c.Queries())
+	if err != nil {
+		return badRequest(c, err)
+	}
+	page := max(c.QueryInt("page", 1), 1)
+	q.Offset = (page - 1) * q.Limit
 
-	if result := config.DB.
-		Preload("Subscriptions").
-		Limit(limit).
-		Offset(offset).
-		Find(&users); result.Error != nil {
+	users, err := ctrl.Users.List(c.UserContext(), q)
+	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch users"})
 	}
 
 	return c.JSON(fiber.Map{
 		"page":  page,
-		"limit": limit,
-		"data":  users,
+		"limit": q.Limit,
+		"data":  users.Items,
 	})
 }
 
-func GetUser(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var user models.User
-	if result := config.DB.Preload("Subscriptions").First(&user, id); result.Error != nil {
+func (ctrl *UserController) GetUser(c *fiber.Ctx) error {
+	id, ok := idParam(c)
+	callerID, _ := middleware.UserID(c)
+	if !ok || (id != callerID && !middleware.IsAdmin(c)) {
 		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
 	}
+
+	user, err := ctrl.Users.Get(c.UserContext(), id)
+	if errors.Is(err, service.ErrUserNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to fetch user"})
+	}
 	return c.JSON(user)
 }
 
-func CreateUser(c *fiber.Ctx) error {
-	user := new(models.User)
-	if err := c.BodyParser(user); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+func (ctrl *UserController) CreateUser(c *fiber.Ctx) error {
+	var req handlers.NewUserRequest
+	if err := handlers.Bind(c, &req); err != nil {
+		return badRequest(c, err)
 	}
+	user := req.User()
 
-	if result := config.DB.Create(&user); result.Error != nil {
+	var invalid *service.InvalidError
+	if err := ctrl.Users.Create(c.UserContext(), user); errors.As(err, &invalid) {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	} else if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Failed to create user"})
 	}
 	return c.Status(201).JSON(user)
 }
 
-func UpdateUser(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var user models.User
-	if result := config.DB.First(&user, id); result.Error != nil {
+// UpdateUser applies the members of the body to a user with the same rules
+// as handlers.UserHandler.UpdateUser, except that legacy clients do not
+// send If-Match and so are not checked for conflicting updates
+func (ctrl *UserController) UpdateUser(c *fiber.Ctx) error {
+	id, ok := idParam(c)
+	callerID, _ := middleware.UserID(c)
+	if !ok || (id != callerID && !middleware.IsAdmin(c)) {
 		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
 	}
 
-	if err := c.BodyParser(&user); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+	var req handlers.UserPatch
+	if err := handlers.Bind(c, &req); err != nil {
+		return badRequest(c, err)
+	}
+	if req.Role.Set && !middleware.IsAdmin(c) {
+		return c.Status(403).JSON(fiber.Map{"error": "Role cannot be changed"})
 	}
 
-	config.DB.Save(&user)
-	return c.JSON(user)
-}
-
-func DeleteUser(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var user models.User
-	if result := config.DB.First(&user, id); result.Error != nil {
+	user, err := ctrl.Users.Patch(c.UserContext(), callerID, id, 0, req.Apply)
+	var invalid *service.InvalidError
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
 		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
+	case errors.Is(err, service.ErrEmailTaken):
+		return c.Status(409).JSON(fiber.Map{"error": "Email already registered"})
+	case errors.As(err, &invalid):
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	case err != nil:
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to update user"})
 	}
-
-	config.DB.Delete(&user)
-	return c.JSON(fiber.Map{"message": "User deleted successfully"})
+	return c.JSON(user)
 }
 
-func AddSubscription(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var user models.User
-	if result := config.DB.First(&user, id); result.Error != nil {
+func (ctrl *UserController) DeleteUser(c *fiber.Ctx) error {
+	id, ok := idParam(c)
+	callerID, _ := middleware.UserID(c)
+	if !ok || (id != callerID && !middleware.IsAdmin(c)) {
 		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
 	}
 
-	subscription := new(models.Subscription)
-	if err := c.BodyParser(subscription); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+	err := ctrl.Users.Delete(c.UserContext(), id)
+	if errors.Is(err, service.ErrUserNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "User not found"})
 	}
-
-	subscription.UserID = user.ID
-	if result := config.DB.Create(&subscription); result.Error != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Failed to create subscription"})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to delete user"})
 	}
-
-	return c.Status(201).JSON(subscription)
+	return c.JSON(fiber.Map{"message": "User deleted successfully"})
 }
 
-func GetUserSubscriptions(c *fiber.Ctx) error {
-	id := c.Params("id")
-	var subscriptions []models.Subscription
-	if result := config.DB.Where("user_id = ?", id).Find(&subscriptions); result.Error != nil {
-		return c.Status(404).JSON(fiber.Map{"error": "Subscriptions not found"})
+// idParam reads the numeric id route parameter
+func idParam(c *fiber.Ctx) (uint, bool) {
+	id, err := c.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return 0, false
 	}
-	return c.JSON(subscriptions)
+	return uint(id), true
 }
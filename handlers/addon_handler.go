@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// AddOnRequest represents the add-on request payload
+type AddOnRequest struct {
+	Name        string  `json:"name" validate:"required"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price" validate:"required"`
+	Currency    string  `json:"currency" validate:"required,len=3"`
+}
+
+// AddOnQuantityRequest sets how many units of an add-on a subscription has
+type AddOnQuantityRequest struct {
+	Quantity int `json:"quantity" validate:"min=0"`
+}
+
+// GetAddOns lists the available add-ons
+func GetAddOns(c *fiber.Ctx) error {
+	q, err := addOnList.Parse(c.Queries())
+	if err != nil {
+		return err
+	}
+
+	var addOns []models.AddOn
+	if err := q.Apply(config.DB).Find(&addOns).Error; err != nil {
+		return apperror.Internal("Could not retrieve add-ons", err)
+	}
+	return sendPage(c, listquery.NewPage(q, addOns))
+}
+
+// CreateAddOn adds a new add-on to the catalogue
+func CreateAddOn(c *fiber.Ctx) error {
+	var req AddOnRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	req.Currency = strings.ToUpper(req.Currency)
+	if req.Price <= 0 {
+		return invalidField("price", apperror.FieldOutOfRange, "Price must be positive")
+	}
+	if !config.Billing.IsSupportedCurrency(req.Currency) {
+		return invalidField("currency", apperror.FieldUnsupported, "Currency is not supported")
+	}
+
+	addOn := models.AddOn{
+		Name:        req.Name,
+		Description: req.Description,
+		Price:       req.Price,
+		Currency:    req.Currency,
+	}
+	if err := config.DB.Create(&addOn).Error; err != nil {
+		return apperror.Internal("Could not create add-on", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    addOn,
+	})
+}
+
+// SetSubscriptionAddOn changes the quantity of an add-on on a subscription.
+// A quantity of zero removes the add-on.
+func (h *SubscriptionHandler) SetSubscriptionAddOn(c *fiber.Ctx) error {
+	subscription, err := h.findCallerSubscription(c)
+	if err != nil {
+		return err
+	}
+
+	var req AddOnQuantityRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	addOnID, _ := idParam(c, "addonId")
+	change, err := h.Subscriptions.SetAddOn(c.UserContext(), subscription, addOnID, req.Quantity)
+	if errors.Is(err, service.ErrAddOnNotFound) {
+		return apperror.NotFound("Add-on not found")
+	}
+	if errors.Is(err, billing.ErrCurrencyMismatch) {
+		return apperror.Validation(err.Error())
+	}
+	if errors.Is(err, service.ErrNotActive) {
+		return apperror.Conflict("Subscription is not active")
+	}
+	if err != nil {
+		return apperror.Internal("Could not update add-on", err)
+	}
+
+	return c.JSON(SubscriptionResponse{
+		Success:      true,
+		Data:         subscription,
+		Invoice:      change.Invoice,
+		PaymentError: change.PaymentError,
+	})
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/analytics"
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+const dateLayout = "2006-01-02"
+
+// Longest cohort reports, in periods
+const (
+	maxCohortWeeks  = 104
+	maxCohortMonths = 60
+)
+
+// GetSubscriptionStats reports MRR, ARR, subscriber counts, MRR movements and
+// churn over a date range, overall and by plan. from and to are inclusive
+// dates (YYYY-MM-DD, UTC) and default to the last 30 days; currency defaults
+// to the base currency.
+func GetSubscriptionStats(c *fiber.Ctx) error {
+	from, to, err := parseDateRange(c, func(to time.Time) time.Time { return to.AddDate(0, 0, -30) })
+	if err != nil {
+		return err
+	}
+
+	currency := strings.ToUpper(c.Query("currency", config.Billing.BaseCurrency))
+	if !config.Billing.IsSupportedCurrency(currency) {
+		return invalidField("currency", apperror.FieldUnsupported, "Currency is not supported")
+	}
+
+	report, err := analytics.SubscriptionReport(config.DB, currency, from, to)
+	if err != nil {
+		return apperror.Internal("Could not compute subscription statistics", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// GetCohortRetention reports how many customers who first subscribed in each
+// week or month were still subscribed 0, 1, 2... periods later. Cohorts are
+// taken from the from and to dates, by default the last 12 periods, and can
+// be limited to customers who subscribed to the plans in plan_id. With
+// format=csv the retention matrix is returned as CSV.
+func GetCohortRetention(c *fiber.Ctx) error {
+	granularity := c.Query("granularity", analytics.CohortMonth)
+	maxPeriods := maxCohortMonths
+	if granularity == analytics.CohortWeek {
+		maxPeriods = maxCohortWeeks
+	}
+	periods := c.QueryInt("periods", 12)
+	if periods < 1 || periods > maxPeriods {
+		return invalidField("periods", apperror.FieldOutOfRange, fmt.Sprintf("periods must be between 1 and %d", maxPeriods))
+	}
+
+	from, to, err := parseDateRange(c, func(to time.Time) time.Time {
+		if granularity == analytics.CohortWeek {
+			return to.AddDate(0, 0, -7*periods)
+		}
+		return to.AddDate(0, -periods, 0)
+	})
+	if err != nil {
+		return err
+	}
+
+	var planIDs []uint
+	if value := c.Query("plan_id"); value != "" {
+		for _, part := range strings.Split(value, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 64)
+			if err != nil || id == 0 {
+				return invalidField("plan_id", apperror.FieldInvalid, "plan_id must be a comma-separated list of plan IDs")
+			}
+			planIDs = append(planIDs, uint(id))
+		}
+	}
+
+	report, err := analytics.CohortRetention(config.DB, granularity, periods, planIDs, from, to)
+	if errors.Is(err, analytics.ErrInvalidGranularity) {
+		return invalidField("granularity", apperror.FieldInvalid, err.Error())
+	}
+	if err != nil {
+		return apperror.Internal("Could not compute cohort retention", err)
+	}
+
+	if c.Query("format") == "csv" {
+		return sendCohortCSV(c, report)
+	}
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// sendCohortCSV writes one row per cohort with its size and the number of
+// customers retained after each period; periods not yet reached are empty
+func sendCohortCSV(c *fiber.Ctx, report analytics.CohortReport) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	header := []string{"cohort", "size"}
+	for n := 0; n < report.Periods; n++ {
+		header = append(header, fmt.Sprintf("%s_%d", report.Granularity, n))
+	}
+	w.Write(header)
+
+	for _, cohort := range report.Cohorts {
+		row := []string{cohort.Label, strconv.Itoa(cohort.Size)}
+		for n := 0; n < report.Periods; n++ {
+			value := ""
+			if n < len(cohort.Retained) {
+				value = strconv.Itoa(cohort.Retained[n])
+			}
+			row = append(row, value)
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return apperror.Internal("Could not write cohort report", err)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="cohorts-%s.csv"`, report.Granularity))
+	return c.Send(buf.Bytes())
+}
+
+// parseDateRange reads the inclusive from and to query dates (YYYY-MM-DD,
+// UTC) and returns the range as [from, day after to). to defaults to today
+// and from to defaultFrom(to).
+func parseDateRange(c *fiber.Ctx, defaultFrom func(to time.Time) time.Time) (time.Time, time.Time, error) {
+	to := time.Now().UTC().Truncate(24 * time.Hour)
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, invalidField("to", apperror.FieldInvalid, "to must be a date in the format YYYY-MM-DD")
+		}
+		to = parsed
+	}
+	to = to.AddDate(0, 0, 1)
+
+	from := defaultFrom(to)
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return time.Time{}, time.Time{}, invalidField("from", apperror.FieldInvalid, "from must be a date in the format YYYY-MM-DD")
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, invalidField("from", apperror.FieldOutOfRange, "from must not be after to")
+	}
+	return from, to, nil
+}
+
+// GetRevenueReport reports, for each month between from and to, the revenue
+// billed, recognized and still deferred at month end. Dates default to the
+// last 12 months; with format=csv the report is returned as CSV.
+func GetRevenueReport(c *fiber.Ctx) error {
+	from, to, err := parseDateRange(c, func(to time.Time) time.Time { return to.AddDate(0, -12, 0) })
+	if err != nil {
+		return err
+	}
+
+	currency := strings.ToUpper(c.Query("currency", config.Billing.BaseCurrency))
+	if !config.Billing.IsSupportedCurrency(currency) {
+		return invalidField("currency", apperror.FieldUnsupported, "Currency is not supported")
+	}
+
+	months, err := analytics.RevenueReport(config.DB, currency, from, to.AddDate(0, 0, -1))
+	if err != nil {
+		return apperror.Internal("Could not compute revenue report", err)
+	}
+
+	if c.Query("format") == "csv" {
+		return sendRevenueCSV(c, currency, months)
+	}
+	return c.JSON(fiber.Map{
+		"success":  true,
+		"currency": currency,
+		"data":     months,
+	})
+}
+
+func sendRevenueCSV(c *fiber.Ctx, currency string, months []analytics.RevenueMonth) error {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	w.Write([]string{"month", "currency", "billed", "recognized", "deferred"})
+	for _, month := range months {
+		w.Write([]string{
+			month.Month,
+			currency,
+			strconv.FormatFloat(month.Billed, 'f', 2, 64),
+			strconv.FormatFloat(month.Recognized, 'f', 2, 64),
+			strconv.FormatFloat(month.Deferred, 'f', 2, 64),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return apperror.Internal("Could not write revenue report", err)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="revenue-%s.csv"`, strings.ToLower(currency)))
+	return c.Send(buf.Bytes())
+}
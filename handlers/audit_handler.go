@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetAuditLogs lists recorded changes, newest first by default, optionally
+// for one record (entity_type and entity_id) or one actor (actor_id)
+func GetAuditLogs(c *fiber.Ctx) error {
+	q, err := auditLogList.Parse(c.Queries())
+	if err != nil {
+		return err
+	}
+
+	var entries []models.AuditLog
+	if err := q.Apply(config.DB.Model(&models.AuditLog{})).Find(&entries).Error; err != nil {
+		return apperror.Internal("Could not retrieve audit logs", err)
+	}
+	return sendPage(c, listquery.NewPage(q, entries))
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/service"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type LoginInput struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8"`
+}
+
+type RegisterInput struct {
+	Name     string `json:"name" validate:"required"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8"`
+	Currency string `json:"billing_currency" validate:"omitempty,len=3"`
+	Country  string `json:"billing_country" validate:"omitempty,len=2"`
+	Region   string `json:"billing_region"`
+	TaxID    string `json:"tax_id"`
+}
+
+// Registration turns the input into what the user service signs up
+func (input RegisterInput) Registration() service.Registration {
+	return service.Registration{
+		Name:     input.Name,
+		Email:    input.Email,
+		Password: input.Password,
+		Billing: models.BillingProfile{
+			Currency: input.Currency,
+			Country:  input.Country,
+			Region:   input.Region,
+			TaxID:    input.TaxID,
+		},
+	}
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// AuthHandler registers and signs in users
+type AuthHandler struct {
+	Users *service.UserService
+}
+
+func NewAuthHandler(users *service.UserService) *AuthHandler {
+	return &AuthHandler{Users: users}
+}
+
+func (h *AuthHandler) Register(c *fiber.Ctx) error {
+	input := new(RegisterInput)
+	if err := bind(c, input); err != nil {
+		return err
+	}
+
+	user, err := h.Users.Register(c.UserContext(), input.Registration())
+	var invalid *service.InvalidError
+	switch {
+	case errors.Is(err, service.ErrPasswordTooShort):
+		return invalidField("password", apperror.FieldOutOfRange, "Password must be at least 8 characters long")
+	case errors.Is(err, service.ErrEmailTaken):
+		return apperror.Conflict("Email already registered")
+	case errors.As(err, &invalid):
+		return apperror.Validation(err.Error())
+	case err != nil:
+		return apperror.Internal("Failed to create user", err)
+	}
+
+	tokens, err := IssueTokens(user.ID)
+	if err != nil {
+		return apperror.Internal("Failed to generate authentication tokens", err)
+	}
+
+	// Responses carrying tokens are never cached or kept for replay
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    tokens,
+	})
+}
+
+func (h *AuthHandler) Login(c *fiber.Ctx) error {
+	input := new(LoginInput)
+	if err := bind(c, input); err != nil {
+		return err
+	}
+
+	user, err := h.Users.Authenticate(c.UserContext(), input.Email, input.Password)
+	if errors.Is(err, service.ErrInvalidCredentials) {
+		return apperror.Unauthorized("Invalid credentials")
+	}
+	if err != nil {
+		return apperror.Internal("Failed to sign in", err)
+	}
+
+	tokens, err := IssueTokens(user.ID)
+	if err != nil {
+		return apperror.Internal("Failed to generate authentication tokens", err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    tokens,
+	})
+}
+
+var tokenGenerationLimit = make(chan struct{}, 1000) // Limit concurrent token generations
+
+// IssueTokens signs a new access and refresh token pair for a user
+func IssueTokens(userID uint) (*TokenResponse, error) {
+	// Limit concurrent token generations
+	select {
+	case tokenGenerationLimit <- struct{}{}:
+		defer func() { <-tokenGenerationLimit }()
+	default:
+		return nil, errors.New("token generation limit reached")
+	}
+
+	// Access token
+	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"exp":     time.Now().Add(config.JWT.AccessTokenDuration).Unix(),
+		"type":    "access",
+	})
+
+	accessTokenString, err := accessToken.SignedString(config.JWT.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refresh token
+	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"exp":     time.Now().Add(config.JWT.RefreshTokenDuration).Unix(),
+		"type":    "refresh",
+	})
+
+	refreshTokenString, err := refreshToken.SignedString(config.JWT.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken:  accessTokenString,
+		RefreshToken: refreshTokenString,
+		ExpiresIn:    time.Now().Add(config.JWT.AccessTokenDuration).Unix(),
+	}, nil
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/ledger"
+	"github.com/chandra-devs/subscription_app/middleware"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// GrantCreditRequest represents a promotional credit payload
+type GrantCreditRequest struct {
+	Amount   float64 `json:"amount" validate:"required,gt=0"`
+	Currency string  `json:"currency" validate:"required,len=3"`
+	Memo     string  `json:"memo"`
+}
+
+// GetMyBalance returns the caller's outstanding and credit balances per currency
+func GetMyBalance(c *fiber.Ctx) error {
+	userID, _ := middleware.UserID(c)
+	return sendBalances(c, userID)
+}
+
+// GetUserBalance returns a customer's outstanding and credit balances per currency
+func GetUserBalance(c *fiber.Ctx) error {
+	var user models.User
+	if result := config.DB.First(&user, c.Params("id")); result.Error != nil {
+		return apperror.NotFound("User not found")
+	}
+	return sendBalances(c, user.ID)
+}
+
+// GrantCredit adds promotional credit to a customer's balance
+func GrantCredit(c *fiber.Ctx) error {
+	var req GrantCreditRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	var user models.User
+	var entry *models.JournalEntry
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&user, c.Params("id")).Error; err != nil {
+			return err
+		}
+		var err error
+		entry, err = billing.GrantCredit(tx, &user, req.Amount, strings.ToUpper(req.Currency), req.Memo)
+		return err
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return apperror.NotFound("User not found")
+	case errors.Is(err, billing.ErrInvalidAmount):
+		return invalidField("amount", apperror.FieldOutOfRange, err.Error())
+	case errors.Is(err, billing.ErrInvalidCurrency):
+		return invalidField("currency", apperror.FieldUnsupported, err.Error())
+	case err != nil:
+		return apperror.Internal("Could not grant credit", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    entry,
+	})
+}
+
+func sendBalances(c *fiber.Ctx, userID uint) error {
+	balances, err := ledger.CustomerBalances(config.DB, userID)
+	if err != nil {
+		return apperror.Internal("Could not retrieve balance", err)
+	}
+	if balances == nil {
+		balances = []ledger.CustomerBalance{}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    balances,
+	})
+}
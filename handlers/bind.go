@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/validate"
+	"github.com/gofiber/fiber/v2"
+)
+
+// bind decodes the request body into out and checks it against out's
+// validate tags. JSON bodies may only contain fields out declares; an empty
+// body is read as an empty object. Every unknown, mistyped and invalid field
+// is reported in a single validation error. Other content types are parsed
+// by Fiber and only checked against the tags.
+func bind[T any](c *fiber.Ctx, out *T) error {
+	var fields []apperror.FieldError
+	if isJSON(c) {
+		body := bytes.TrimSpace(c.Body())
+		if len(body) == 0 {
+			body = []byte("{}")
+		}
+		if !json.Valid(body) {
+			return apperror.BadRequest("Invalid input format")
+		}
+
+		fields = validate.UnknownFields(body, out)
+		var typeErr *json.UnmarshalTypeError
+		if err := json.Unmarshal(body, out); errors.As(err, &typeErr) {
+			fields = append(fields, apperror.FieldError{
+				Field:   typeErr.Field,
+				Code:    apperror.FieldInvalid,
+				Message: typeErr.Field + " must be " + jsonType(typeErr.Type),
+			})
+		} else if err != nil {
+			return apperror.BadRequest("Invalid input format")
+		}
+	} else if err := c.BodyParser(out); err != nil {
+		return apperror.BadRequest("Invalid input format")
+	}
+
+	for _, field := range validate.Struct(out) {
+		if !hasField(fields, field.Field) {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) > 0 {
+		return apperror.Validation("The request is invalid", fields...)
+	}
+	return nil
+}
+
+// Bind is bind for the legacy controllers, which read request bodies by
+// the same rules and differ only in how they answer
+func Bind[T any](c *fiber.Ctx, out *T) error {
+	return bind(c, out)
+}
+
+func isJSON(c *fiber.Ctx) bool {
+	contentType := strings.ToLower(c.Get(fiber.HeaderContentType))
+	return contentType == "" || strings.HasPrefix(contentType, fiber.MIMEApplicationJSON)
+}
+
+// jsonType describes the JSON value a Go type is decoded from
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "a non-negative integer"
+	}
+	return "a number"
+}
+
+func hasField(fields []apperror.FieldError, name string) bool {
+	for _, field := range fields {
+		if field.Field == name {
+			return true
+		}
+	}
+	return false
+}
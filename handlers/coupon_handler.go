@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CouponRequest represents the coupon request payload
+type CouponRequest struct {
+	Name              string  `json:"name" validate:"required"`
+	PercentOff        float64 `json:"percent_off"`
+	AmountOff         float64 `json:"amount_off"`
+	Currency          string  `json:"currency"`
+	Duration          string  `json:"duration" validate:"required,oneof=once repeating forever"`
+	DurationInPeriods int     `json:"duration_in_periods"`
+}
+
+// PromotionCodeRequest represents the promotion code request payload
+type PromotionCodeRequest struct {
+	Code           string     `json:"code" validate:"required"`
+	CouponID       uint       `json:"coupon_id" validate:"required"`
+	MaxRedemptions int        `json:"max_redemptions" validate:"min=0"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+	PlanIDs        []uint     `json:"plan_ids,omitempty"`
+}
+
+// RedeemRequest carries a promotion code entered by a customer
+type RedeemRequest struct {
+	PromotionCode string `json:"promotion_code" validate:"required"`
+}
+
+// GetCoupons lists coupons, newest first by default
+func GetCoupons(c *fiber.Ctx) error {
+	q, err := couponList.Parse(c.Queries())
+	if err != nil {
+		return err
+	}
+
+	var coupons []models.Coupon
+	if err := q.Apply(config.DB).Find(&coupons).Error; err != nil {
+		return apperror.Internal("Could not retrieve coupons", err)
+	}
+	return sendPage(c, listquery.NewPage(q, coupons))
+}
+
+// CreateCoupon adds a new coupon
+func CreateCoupon(c *fiber.Ctx) error {
+	var req CouponRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	coupon := models.Coupon{
+		Name:              req.Name,
+		PercentOff:        req.PercentOff,
+		AmountOff:         req.AmountOff,
+		Currency:          req.Currency,
+		Duration:          req.Duration,
+		DurationInPeriods: req.DurationInPeriods,
+	}
+	if err := billing.ValidateCoupon(&coupon); err != nil {
+		return apperror.Validation(err.Error())
+	}
+	if err := config.DB.Create(&coupon).Error; err != nil {
+		return apperror.Internal("Could not create coupon", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    coupon,
+	})
+}
+
+// GetPromotionCodes lists promotion codes with their coupons, newest first
+// by default
+func GetPromotionCodes(c *fiber.Ctx) error {
+	q, err := promotionCodeList.Parse(c.Queries())
+	if err != nil {
+		return err
+	}
+
+	var codes []models.PromotionCode
+	if err := q.Apply(config.DB.Preload("Coupon").Preload("Plans")).Find(&codes).Error; err != nil {
+		return apperror.Internal("Could not retrieve promotion codes", err)
+	}
+	return sendPage(c, listquery.NewPage(q, codes))
+}
+
+// CreatePromotionCode adds a customer-facing code for a coupon
+func CreatePromotionCode(c *fiber.Ctx) error {
+	var req PromotionCodeRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	code := billing.NormalizePromotionCode(req.Code)
+	if code == "" {
+		return invalidField("code", apperror.FieldRequired, "A code is required")
+	}
+
+	var existing int64
+	config.DB.Model(&models.PromotionCode{}).Where("code = ?", code).Count(&existing)
+	if existing > 0 {
+		return apperror.Conflict("Promotion code already exists")
+	}
+
+	var coupon models.Coupon
+	if result := config.DB.First(&coupon, req.CouponID); result.Error != nil {
+		return apperror.NotFound("Coupon not found")
+	}
+
+	var plans []models.Plan
+	if len(req.PlanIDs) > 0 {
+		if err := config.DB.Find(&plans, req.PlanIDs).Error; err != nil || len(plans) != len(req.PlanIDs) {
+			return invalidField("plan_ids", apperror.FieldNotFound, "One or more plans were not found")
+		}
+	}
+
+	promo := models.PromotionCode{
+		Code:           code,
+		CouponID:       coupon.ID,
+		Coupon:         coupon,
+		Active:         true,
+		MaxRedemptions: req.MaxRedemptions,
+		ExpiresAt:      req.ExpiresAt,
+		Plans:          plans,
+	}
+	if err := config.DB.Omit("Coupon", "Plans.*").Create(&promo).Error; err != nil {
+		return apperror.Internal("Could not create promotion code", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    promo,
+	})
+}
+
+// ApplySubscriptionPromotionCode redeems a promotion code against the
+// caller's subscription. The discount applies from the next renewal.
+func (h *SubscriptionHandler) ApplySubscriptionPromotionCode(c *fiber.Ctx) error {
+	subscription, err := h.findCallerSubscription(c)
+	if err != nil {
+		return err
+	}
+
+	var req RedeemRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	err = h.Subscriptions.ApplyPromotionCode(c.UserContext(), subscription, req.PromotionCode)
+	if isPromotionCodeError(err) {
+		return invalidField("promotion_code", apperror.FieldInvalid, err.Error())
+	}
+	if err != nil {
+		return apperror.Internal("Could not apply promotion code", err)
+	}
+
+	return c.JSON(SubscriptionResponse{
+		Success: true,
+		Data:    subscription,
+	})
+}
+
+func isPromotionCodeError(err error) bool {
+	for _, target := range []error{
+		billing.ErrInvalidPromotionCode,
+		billing.ErrPromotionCodeExpired,
+		billing.ErrPromotionCodeExhausted,
+		billing.ErrPromotionCodeNotForPlan,
+		billing.ErrCouponCurrency,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
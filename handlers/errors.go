@@ -0,0 +1,9 @@
+package handlers
+
+import "github.com/chandra-devs/subscription_app/apperror"
+
+// invalidField reports a request rejected because of one of its fields,
+// which may be a body field or a query parameter
+func invalidField(field, code, message string) error {
+	return apperror.Validation(message, apperror.FieldError{Field: field, Code: code, Message: message})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// etag is the entity tag of a record at a version. A record served with
+// others embedded in it adds a digest of their versions, so the tag changes
+// whenever any part of the body does.
+func etag(version uint, embedded ...string) string {
+	tag := strconv.FormatUint(uint64(version), 10)
+	if len(embedded) > 0 {
+		digest := fnv.New64a()
+		for _, e := range embedded {
+			digest.Write([]byte(e))
+			digest.Write([]byte{0})
+		}
+		tag += "-" + strconv.FormatUint(digest.Sum64(), 36)
+	}
+	return `"` + tag + `"`
+}
+
+// planETag tags a plan together with the prices it carries. Prices have no
+// version of their own; every change to one moves its updated_at.
+func planETag(plan *models.Plan) string {
+	embedded := make([]string, len(plan.Prices))
+	for i, price := range plan.Prices {
+		embedded[i] = fmt.Sprintf("%d@%d", price.ID, price.UpdatedAt.UnixNano())
+	}
+	return etag(plan.Version, embedded...)
+}
+
+// userETag tags a user together with the subscriptions it carries
+func userETag(user *models.User) string {
+	embedded := make([]string, len(user.Subscriptions))
+	for i, subscription := range user.Subscriptions {
+		embedded[i] = fmt.Sprintf("%d@%d", subscription.ID, subscription.Version)
+	}
+	return etag(user.Version, embedded...)
+}
+
+// setETag tags the response with the entity tag of the body it carries
+func setETag(c *fiber.Ctx, tag string) {
+	c.Set(fiber.HeaderETag, tag)
+}
+
+// notModified tags the response and reports whether the client already
+// holds that tag, going by If-None-Match
+func notModified(c *fiber.Ctx, tag string) bool {
+	setETag(c, tag)
+	for _, held := range entityTags(c.Get(fiber.HeaderIfNoneMatch)) {
+		if held == "*" || strings.TrimPrefix(held, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifMatch returns the version an update expects the record to be at, read
+// from If-Match, or zero for *. Updates must carry the header, so a client
+// cannot overwrite changes it has not seen.
+func ifMatch(c *fiber.Ctx) (uint, error) {
+	header := c.Get(fiber.HeaderIfMatch)
+	if header == "" {
+		return 0, apperror.New(apperror.CodePreconditionRequired, "If-Match is required; send the ETag of the version being changed")
+	}
+
+	tags := entityTags(header)
+	if len(tags) != 1 {
+		return 0, apperror.BadRequest("If-Match must name a single ETag or *")
+	}
+	if tags[0] == "*" {
+		return 0, nil
+	}
+
+	// Weak and foreign tags never match a version. Updates only change the
+	// record itself, so the digest of embedded records is not compared.
+	if unquoted, err := strconv.Unquote(tags[0]); err == nil {
+		unquoted, _, _ = strings.Cut(unquoted, "-")
+		if version, err := strconv.ParseUint(unquoted, 10, 64); err == nil && version > 0 {
+			return uint(version), nil
+		}
+	}
+	return 0, versionConflict()
+}
+
+// entityTags splits an If-Match or If-None-Match header into its tags
+func entityTags(header string) []string {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func versionConflict() error {
+	return apperror.PreconditionFailed("The record has changed since it was read; fetch it again and retry")
+}
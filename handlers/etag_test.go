@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestPlanETagCoversPrices(t *testing.T) {
+	plan := &models.Plan{Version: 3}
+	bare := planETag(plan)
+	if bare != `"3"` {
+		t.Errorf("plan without prices tagged %s, want \"3\"", bare)
+	}
+
+	plan.Prices = []models.PlanPrice{{Currency: "EUR", Amount: 18}}
+	plan.Prices[0].ID = 7
+	plan.Prices[0].UpdatedAt = time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	priced := planETag(plan)
+	if priced == bare {
+		t.Error("adding a price did not change the ETag")
+	}
+
+	plan.Prices[0].UpdatedAt = plan.Prices[0].UpdatedAt.Add(time.Second)
+	if planETag(plan) == priced {
+		t.Error("changing a price did not change the ETag")
+	}
+}
+
+func TestIfMatchIgnoresEmbeddedDigest(t *testing.T) {
+	plan := &models.Plan{Version: 3, Prices: []models.PlanPrice{{Currency: "EUR", Amount: 18}}}
+
+	tests := []struct {
+		header  string
+		version uint
+		code    apperror.Code
+	}{
+		{planETag(plan), 3, ""},
+		{`"3"`, 3, ""},
+		{"*", 0, ""},
+		{`W/"3"`, 0, apperror.CodePreconditionFailed},
+		{`"three"`, 0, apperror.CodePreconditionFailed},
+		{`"3", "4"`, 0, apperror.CodeBadRequest},
+		{"", 0, apperror.CodePreconditionRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			app := fiber.New()
+			var version uint
+			var err error
+			app.Put("/", func(c *fiber.Ctx) error {
+				version, err = ifMatch(c)
+				return nil
+			})
+			req := httptest.NewRequest(fiber.MethodPut, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(fiber.HeaderIfMatch, tt.header)
+			}
+			if _, testErr := app.Test(req, -1); testErr != nil {
+				t.Fatal(testErr)
+			}
+
+			var code apperror.Code
+			var appErr *apperror.Error
+			if errors.As(err, &appErr) {
+				code = appErr.Code
+			} else if err != nil {
+				t.Fatalf("ifMatch(%s): %v", tt.header, err)
+			}
+			if version != tt.version || code != tt.code {
+				t.Errorf("ifMatch(%s) = %d, %q; want %d, %q", tt.header, version, code, tt.version, tt.code)
+			}
+		})
+	}
+}
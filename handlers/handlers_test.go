@@ -0,0 +1,205 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/handlers"
+	"github.com/chandra-devs/subscription_app/middleware"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/repository/memory"
+	"github.com/chandra-devs/subscription_app/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Users every fixture starts with, by ID
+const (
+	adminID uint = iota + 1
+	adaID
+	graceID
+)
+
+// callerHeader names the user a test request is made as, standing in for
+// an access token
+const callerHeader = "X-Test-Caller"
+
+// fixture is the user, plan and subscription routes served from the
+// in-memory repositories
+type fixture struct {
+	app    *fiber.App
+	users  *memory.Users
+	plans  *memory.Plans
+	subs   *memory.Subscriptions
+	biller *memory.Biller
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	config.InitBillingConfig()
+
+	f := &fixture{
+		users: memory.NewUsers(
+			models.User{Name: "Admin", Email: "admin@example.com", Role: models.RoleAdmin},
+			models.User{Name: "Ada Lovelace", Email: "ada@example.com", Role: models.RoleUser},
+			models.User{Name: "Grace Hopper", Email: "grace@example.com", Role: models.RoleUser},
+		),
+		plans: memory.NewPlans(models.Plan{Name: "Pro", Price: 20, Duration: 30}),
+		subs:  memory.NewSubscriptions(),
+	}
+	f.biller = &memory.Biller{Subscriptions: f.subs}
+	audit := memory.NewAudit()
+
+	users := service.NewUserService(f.users, f.subs, f.biller, audit)
+	plans := service.NewPlanService(f.plans, f.subs, audit)
+	subscriptions := service.NewSubscriptionService(f.users, f.plans, f.subs, f.biller, audit)
+	userHandler := handlers.NewUserHandler(users)
+	planHandler := handlers.NewPlanHandler(plans, users)
+	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptions)
+
+	f.app = fiber.New(fiber.Config{ErrorHandler: apperror.Handler})
+	f.app.Use(f.authenticate)
+
+	// The routes as routes.SetupRoutes mounts them, with authentication
+	// done by the caller header
+	u := f.app.Group("/users")
+	u.Get("/", middleware.AdminOnly(), userHandler.GetUsers)
+	u.Get("/:id", userHandler.GetUser)
+	u.Post("/", middleware.AdminOnly(), userHandler.CreateUser)
+	u.Put("/:id", userHandler.UpdateUser)
+	u.Patch("/:id", userHandler.UpdateUser)
+	u.Delete("/:id", userHandler.DeleteUser)
+
+	p := f.app.Group("/plans")
+	p.Get("/", planHandler.GetPlans)
+	p.Get("/:id", planHandler.GetPlanByID)
+	p.Post("/", middleware.AdminOnly(), planHandler.CreatePlan)
+	p.Put("/:id", middleware.AdminOnly(), planHandler.UpdatePlan)
+	p.Patch("/:id", middleware.AdminOnly(), planHandler.PatchPlan)
+	p.Delete("/:id", middleware.AdminOnly(), planHandler.DeletePlan)
+
+	s := f.app.Group("/subscriptions")
+	s.Get("/user/:userId", subscriptionHandler.GetUserSubscriptions)
+	s.Post("/", subscriptionHandler.CreateSubscription)
+	s.Post("/subscribe", subscriptionHandler.SubscribeUser)
+	s.Get("/:id", subscriptionHandler.GetSubscription)
+	s.Delete("/:id", subscriptionHandler.DeleteSubscription)
+	return f
+}
+
+// authenticate identifies the caller the way Protected does, from the
+// caller header instead of a token
+func (f *fixture) authenticate(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Get(callerHeader), 10, 64)
+	if err != nil {
+		return c.Next()
+	}
+	user, err := f.users.FindByID(c.UserContext(), uint(id))
+	if err != nil {
+		return apperror.Unauthorized("Unknown test caller")
+	}
+	c.Locals("user_id", user.ID)
+	c.Locals("is_admin", user.Role == models.RoleAdmin)
+	return c.Next()
+}
+
+// request is a call to the fixture's API
+type request struct {
+	method string
+	path   string
+	caller uint // zero for an anonymous request
+	body   any
+	header map[string]string
+}
+
+// response is what the API answered. Body holds the decoded JSON, if any.
+type response struct {
+	Status int
+	Header http.Header
+	Body   map[string]any
+}
+
+func (f *fixture) do(t *testing.T, r request) response {
+	t.Helper()
+	var body io.Reader
+	if r.body != nil {
+		encoded, err := json.Marshal(r.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req := httptest.NewRequest(r.method, r.path, body)
+	if r.body != nil {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	if r.caller != 0 {
+		req.Header.Set(callerHeader, strconv.FormatUint(uint64(r.caller), 10))
+	}
+	for name, value := range r.header {
+		req.Header.Set(name, value)
+	}
+
+	res, err := f.app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("%s %s: %v", r.method, r.path, err)
+	}
+	defer res.Body.Close()
+
+	out := response{Status: res.StatusCode, Header: res.Header}
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &out.Body); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", r.method, r.path, raw, err)
+		}
+	}
+	return out
+}
+
+// expect fails the test unless the response has the status and, for
+// errors, the problem code
+func (r response) expect(t *testing.T, status int, code apperror.Code) {
+	t.Helper()
+	if r.Status != status {
+		t.Fatalf("status %d, want %d; body %v", r.Status, status, r.Body)
+	}
+	if code != "" && r.Body["code"] != string(code) {
+		t.Fatalf("problem code %v, want %s; body %v", r.Body["code"], code, r.Body)
+	}
+}
+
+// data is the record in a successful response
+func (r response) data(t *testing.T) map[string]any {
+	t.Helper()
+	data, ok := r.Body["data"].(map[string]any)
+	if !ok {
+		t.Fatalf("response has no data: %v", r.Body)
+	}
+	return data
+}
+
+// fieldErrors maps each field the problem names to its code
+func (r response) fieldErrors() map[string]string {
+	fields := map[string]string{}
+	errs, _ := r.Body["errors"].([]any)
+	for _, e := range errs {
+		if fe, ok := e.(map[string]any); ok {
+			fields[fe["field"].(string)], _ = fe["code"].(string)
+		}
+	}
+	return fields
+}
+
+func path(prefix string, id uint) string {
+	return prefix + "/" + strconv.FormatUint(uint64(id), 10)
+}
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/middleware"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InvoiceResponse represents the standardized response for invoices
+type InvoiceResponse struct {
+	Success bool            `json:"success"`
+	Data    *models.Invoice `json:"data,omitempty"`
+}
+
+// CreditRequest represents a credit note or refund payload
+type CreditRequest struct {
+	Amount             float64 `json:"amount"`
+	Reason             string  `json:"reason" validate:"required,oneof=duplicate fraudulent requested_by_customer service_issue other"`
+	Memo               string  `json:"memo"`
+	CancelSubscription bool    `json:"cancel_subscription"`
+}
+
+// GetMyInvoices lists the caller's invoices, newest first by default
+func GetMyInvoices(c *fiber.Ctx) error {
+	userID, _ := middleware.UserID(c)
+	q, err := invoiceList.Parse(c.Queries())
+	if err != nil {
+		return err
+	}
+
+	var invoices []models.Invoice
+	query := config.DB.Where("user_id = ? AND status <> ?", userID, models.InvoiceStatusDraft)
+	if err := q.Apply(query).Find(&invoices).Error; err != nil {
+		return apperror.Internal("Could not retrieve invoices", err)
+	}
+	return sendPage(c, listquery.NewPage(q, invoices))
+}
+
+// GetMyInvoice returns one of the caller's invoices with its line items
+func GetMyInvoice(c *fiber.Ctx) error {
+	userID, _ := middleware.UserID(c)
+
+	var invoice models.Invoice
+	if result := config.DB.Preload("LineItems").Preload("Taxes").Preload("CreditNotes").
+		Where("user_id = ? AND status <> ?", userID, models.InvoiceStatusDraft).
+		First(&invoice, c.Params("id")); result.Error != nil {
+		return apperror.NotFound("Invoice not found")
+	}
+
+	return c.JSON(InvoiceResponse{
+		Success: true,
+		Data:    &invoice,
+	})
+}
+
+// GetMyInvoicePDF streams one of the caller's invoices as a PDF
+func GetMyInvoicePDF(c *fiber.Ctx) error {
+	userID, _ := middleware.UserID(c)
+
+	var invoice models.Invoice
+	if result := config.DB.Preload("LineItems").Preload("Taxes").Preload("CreditNotes").
+		Where("user_id = ? AND status <> ?", userID, models.InvoiceStatusDraft).
+		First(&invoice, c.Params("id")); result.Error != nil {
+		return apperror.NotFound("Invoice not found")
+	}
+
+	return sendInvoicePDF(c, invoice)
+}
+
+// PayMyInvoice charges the caller's default payment method for an open
+// invoice, bringing a past due subscription back once it is paid
+func PayMyInvoice(c *fiber.Ctx) error {
+	userID, _ := middleware.UserID(c)
+
+	var invoice models.Invoice
+	if result := config.DB.Where("user_id = ?", userID).First(&invoice, c.Params("id")); result.Error != nil {
+		return apperror.NotFound("Invoice not found")
+	}
+
+	err := billing.Collect(c.UserContext(), config.DB, &invoice, billing.ResumeOnPayment)
+	switch {
+	case errors.Is(err, billing.ErrInvalidInvoiceState):
+		return apperror.Conflict("Only open invoices can be paid")
+	case errors.Is(err, billing.ErrPaymentFailed), errors.Is(err, billing.ErrNoPaymentMethod):
+		return apperror.PaymentRequired(err.Error())
+	case err != nil:
+		return apperror.Internal("Could not collect payment", err)
+	}
+
+	return c.JSON(InvoiceResponse{
+		Success: true,
+		Data:    &invoice,
+	})
+}
+
+// GetInvoices lists invoices of every customer for administrators, newest
+// first by default
+func GetInvoices(c *fiber.Ctx) error {
+	q, err := invoiceList.Parse(c.Queries())
+	if err != nil {
+		return err
+	}
+
+	var invoices []models.Invoice
+	if err := q.Apply(config.DB.Model(&models.Invoice{})).Find(&invoices).Error; err != nil {
+		return apperror.Internal("Could not retrieve invoices", err)
+	}
+	return sendPage(c, listquery.NewPage(q, invoices))
+}
+
+// GetInvoice returns any invoice with its line items and credit notes for administrators
+func GetInvoice(c *fiber.Ctx) error {
+	var invoice models.Invoice
+	if result := config.DB.Preload("LineItems").Preload("Taxes").Preload("CreditNotes.Refund").First(&invoice, c.Params("id")); result.Error != nil {
+		return apperror.NotFound("Invoice not found")
+	}
+
+	return c.JSON(InvoiceResponse{
+		Success: true,
+		Data:    &invoice,
+	})
+}
+
+// GetInvoiceRevenueSchedules returns how the revenue of a paid invoice is
+// spread over the months of its service period
+func GetInvoiceRevenueSchedules(c *fiber.Ctx) error {
+	var schedules []models.RevenueSchedule
+	if err := config.DB.Preload("Entries", func(db *gorm.DB) *gorm.DB {
+		return db.Order("month")
+	}).Where("invoice_id = ?", c.Params("id")).Order("id").Find(&schedules).Error; err != nil {
+		return apperror.Internal("Could not retrieve revenue schedules", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    schedules,
+	})
+}
+
+// GetInvoicePDF streams any invoice as a PDF for administrators
+func GetInvoicePDF(c *fiber.Ctx) error {
+	var invoice models.Invoice
+	if result := config.DB.Preload("LineItems").Preload("Taxes").Preload("CreditNotes").First(&invoice, c.Params("id")); result.Error != nil {
+		return apperror.NotFound("Invoice not found")
+	}
+
+	return sendInvoicePDF(c, invoice)
+}
+
+// sendInvoicePDF renders the invoice in memory and sends it as the response body
+func sendInvoicePDF(c *fiber.Ctx, invoice models.Invoice) error {
+	var buf bytes.Buffer
+	if err := billing.RenderInvoicePDF(&buf, invoice, config.Billing.Company); err != nil {
+		return apperror.Internal("Could not render invoice", err)
+	}
+
+	name := invoice.Number
+	if name == "" {
+		name = fmt.Sprintf("draft-%d", invoice.ID)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`inline; filename="%s.pdf"`, name))
+	return c.Send(buf.Bytes())
+}
+
+// FinalizeInvoice issues a draft invoice
+func FinalizeInvoice(c *fiber.Ctx) error {
+	return transitionInvoice(c, billing.Finalize)
+}
+
+// PayInvoice marks an open invoice as paid, e.g. after a bank transfer
+func PayInvoice(c *fiber.Ctx) error {
+	return transitionInvoice(c, billing.MarkPaid)
+}
+
+// VoidInvoice cancels a draft or open invoice
+func VoidInvoice(c *fiber.Ctx) error {
+	return transitionInvoice(c, billing.Void)
+}
+
+// CreditInvoice issues a credit note against an open invoice
+func CreditInvoice(c *fiber.Ctx) error {
+	return issueCredit(c, func(tx *gorm.DB, invoice *models.Invoice, params billing.CreditParams) (*models.CreditNote, error) {
+		return billing.CreditInvoice(tx, invoice, params)
+	})
+}
+
+// RefundInvoice refunds all or part of a paid invoice
+func RefundInvoice(c *fiber.Ctx) error {
+	return issueCredit(c, func(tx *gorm.DB, invoice *models.Invoice, params billing.CreditParams) (*models.CreditNote, error) {
+		return billing.RefundInvoice(c.UserContext(), tx, invoice, params)
+	})
+}
+
+func issueCredit(c *fiber.Ctx, issue func(*gorm.DB, *models.Invoice, billing.CreditParams) (*models.CreditNote, error)) error {
+	var req CreditRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	approverID, _ := middleware.UserID(c)
+	params := billing.CreditParams{
+		Amount:             req.Amount,
+		Reason:             req.Reason,
+		Memo:               req.Memo,
+		ApprovedByID:       approverID,
+		CancelSubscription: req.CancelSubscription,
+	}
+
+	var invoice models.Invoice
+	var note *models.CreditNote
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&invoice, c.Params("id")).Error; err != nil {
+			return err
+		}
+		var err error
+		note, err = issue(tx, &invoice, params)
+		return err
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return apperror.NotFound("Invoice not found")
+	case errors.Is(err, billing.ErrInvalidAmount):
+		return invalidField("amount", apperror.FieldOutOfRange, err.Error())
+	case errors.Is(err, billing.ErrInvalidReason):
+		return invalidField("reason", apperror.FieldInvalid, err.Error())
+	case errors.Is(err, billing.ErrInvalidInvoiceState), errors.Is(err, billing.ErrNotRefundable):
+		return apperror.Conflict(err.Error())
+	case errors.Is(err, billing.ErrPaymentFailed):
+		return apperror.Upstream(err.Error(), err)
+	case err != nil:
+		return apperror.Internal("Could not credit invoice", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    note,
+		"invoice": invoice,
+	})
+}
+
+func transitionInvoice(c *fiber.Ctx, transition func(*gorm.DB, *models.Invoice) error) error {
+	var invoice models.Invoice
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&invoice, c.Params("id")).Error; err != nil {
+			return err
+		}
+		return transition(tx, &invoice)
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return apperror.NotFound("Invoice not found")
+	case errors.Is(err, billing.ErrInvalidInvoiceState):
+		return apperror.Conflict(err.Error())
+	case err != nil:
+		return apperror.Internal("Could not update invoice", err)
+	}
+
+	return c.JSON(InvoiceResponse{
+		Success: true,
+		Data:    &invoice,
+	})
+}
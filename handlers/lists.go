@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// What each listing can be filtered and sorted by. Every listing can be
+// sorted by id; created_from and created_before bound the creation time,
+// the first inclusively.
+
+// UserList is shared with the legacy user listing. Both listings must stay
+// behind AdminOnly: email_prefix would otherwise let anyone find out which
+// addresses have accounts.
+var UserList = listquery.Spec[models.User]{
+	Fields: map[string]listquery.Field[models.User]{
+		"id":         {Column: "id", Value: func(u *models.User) any { return u.ID }},
+		"created_at": {Column: "created_at", Value: func(u *models.User) any { return u.CreatedAt }},
+		"name":       {Column: "name", Value: func(u *models.User) any { return u.Name }},
+		"email":      {Column: "email", Value: func(u *models.User) any { return u.Email }},
+		"role":       {Column: "role", Value: func(u *models.User) any { return u.Role }},
+	},
+	Filters: map[string]listquery.Filter{
+		"email_prefix":   {Field: "email", Op: listquery.Prefix},
+		"role":           {Field: "role", Op: listquery.Equal},
+		"created_from":   {Field: "created_at", Op: listquery.From},
+		"created_before": {Field: "created_at", Op: listquery.Before},
+	},
+	Sorts:       []string{"created_at", "name", "email"},
+	DefaultSort: "id",
+}
+
+var planList = listquery.Spec[models.Plan]{
+	Fields: map[string]listquery.Field[models.Plan]{
+		"id":         {Column: "id", Value: func(p *models.Plan) any { return p.ID }},
+		"created_at": {Column: "created_at", Value: func(p *models.Plan) any { return p.CreatedAt }},
+		"name":       {Column: "name", Value: func(p *models.Plan) any { return p.Name }},
+		"price":      {Column: "price", Value: func(p *models.Plan) any { return p.Price }},
+	},
+	Filters: map[string]listquery.Filter{
+		"created_from":   {Field: "created_at", Op: listquery.From},
+		"created_before": {Field: "created_at", Op: listquery.Before},
+	},
+	Sorts:       []string{"created_at", "name", "price"},
+	DefaultSort: "id",
+}
+
+var subscriptionList = listquery.Spec[models.Subscription]{
+	Fields: map[string]listquery.Field[models.Subscription]{
+		"id":         {Column: "id", Value: func(s *models.Subscription) any { return s.ID }},
+		"created_at": {Column: "created_at", Value: func(s *models.Subscription) any { return s.CreatedAt }},
+		"expires_at": {Column: "expires_at", Value: func(s *models.Subscription) any { return s.ExpiresAt }},
+		"status":     {Column: "status", Value: func(s *models.Subscription) any { return s.Status }},
+		"user_id":    {Column: "user_id", Value: func(s *models.Subscription) any { return s.UserID }},
+		"plan_id":    {Column: "plan_id", Value: func(s *models.Subscription) any { return s.PlanID }},
+	},
+	Filters: map[string]listquery.Filter{
+		"status":         {Field: "status", Op: listquery.Equal},
+		"user_id":        {Field: "user_id", Op: listquery.Equal},
+		"plan_id":        {Field: "plan_id", Op: listquery.Equal},
+		"created_from":   {Field: "created_at", Op: listquery.From},
+		"created_before": {Field: "created_at", Op: listquery.Before},
+	},
+	Sorts:       []string{"created_at", "expires_at"},
+	DefaultSort: "id",
+}
+
+var invoiceList = listquery.Spec[models.Invoice]{
+	Fields: map[string]listquery.Field[models.Invoice]{
+		"id":              {Column: "id", Value: func(i *models.Invoice) any { return i.ID }},
+		"created_at":      {Column: "created_at", Value: func(i *models.Invoice) any { return i.CreatedAt }},
+		"status":          {Column: "status", Value: func(i *models.Invoice) any { return i.Status }},
+		"user_id":         {Column: "user_id", Value: func(i *models.Invoice) any { return i.UserID }},
+		"subscription_id": {Column: "subscription_id", Value: func(i *models.Invoice) any { return derefID(i.SubscriptionID) }},
+		"total":           {Column: "total", Value: func(i *models.Invoice) any { return i.Total }},
+	},
+	Filters: map[string]listquery.Filter{
+		"status":          {Field: "status", Op: listquery.Equal},
+		"user_id":         {Field: "user_id", Op: listquery.Equal},
+		"subscription_id": {Field: "subscription_id", Op: listquery.Equal},
+		"created_from":    {Field: "created_at", Op: listquery.From},
+		"created_before":  {Field: "created_at", Op: listquery.Before},
+	},
+	Sorts:       []string{"created_at", "total"},
+	DefaultSort: "-created_at",
+}
+
+var couponList = listquery.Spec[models.Coupon]{
+	Fields: map[string]listquery.Field[models.Coupon]{
+		"id":         {Column: "id", Value: func(c *models.Coupon) any { return c.ID }},
+		"created_at": {Column: "created_at", Value: func(c *models.Coupon) any { return c.CreatedAt }},
+		"name":       {Column: "name", Value: func(c *models.Coupon) any { return c.Name }},
+	},
+	Filters: map[string]listquery.Filter{
+		"created_from":   {Field: "created_at", Op: listquery.From},
+		"created_before": {Field: "created_at", Op: listquery.Before},
+	},
+	Sorts:       []string{"created_at", "name"},
+	DefaultSort: "-created_at",
+}
+
+var promotionCodeList = listquery.Spec[models.PromotionCode]{
+	Fields: map[string]listquery.Field[models.PromotionCode]{
+		"id":         {Column: "id", Value: func(p *models.PromotionCode) any { return p.ID }},
+		"created_at": {Column: "created_at", Value: func(p *models.PromotionCode) any { return p.CreatedAt }},
+		"code":       {Column: "code", Value: func(p *models.PromotionCode) any { return p.Code }},
+		"coupon_id":  {Column: "coupon_id", Value: func(p *models.PromotionCode) any { return p.CouponID }},
+		"active":     {Column: "active", Value: func(p *models.PromotionCode) any { return p.Active }},
+	},
+	Filters: map[string]listquery.Filter{
+		"coupon_id":      {Field: "coupon_id", Op: listquery.Equal},
+		"active":         {Field: "active", Op: listquery.Equal},
+		"code_prefix":    {Field: "code", Op: listquery.Prefix},
+		"created_from":   {Field: "created_at", Op: listquery.From},
+		"created_before": {Field: "created_at", Op: listquery.Before},
+	},
+	Sorts:       []string{"created_at", "code"},
+	DefaultSort: "-created_at",
+}
+
+var addOnList = listquery.Spec[models.AddOn]{
+	Fields: map[string]listquery.Field[models.AddOn]{
+		"id":         {Column: "id", Value: func(a *models.AddOn) any { return a.ID }},
+		"created_at": {Column: "created_at", Value: func(a *models.AddOn) any { return a.CreatedAt }},
+		"name":       {Column: "name", Value: func(a *models.AddOn) any { return a.Name }},
+		"price":      {Column: "price", Value: func(a *models.AddOn) any { return a.Price }},
+		"currency":   {Column: "currency", Value: func(a *models.AddOn) any { return a.Currency }},
+	},
+	Filters: map[string]listquery.Filter{
+		"currency": {Field: "currency", Op: listquery.Equal},
+	},
+	Sorts:       []string{"created_at", "name", "price"},
+	DefaultSort: "id",
+}
+
+var taxRateList = listquery.Spec[models.TaxRate]{
+	Fields: map[string]listquery.Field[models.TaxRate]{
+		"id":      {Column: "id", Value: func(r *models.TaxRate) any { return r.ID }},
+		"country": {Column: "country", Value: func(r *models.TaxRate) any { return r.Country }},
+		"region":  {Column: "region", Value: func(r *models.TaxRate) any { return r.Region }},
+	},
+	Filters: map[string]listquery.Filter{
+		"country": {Field: "country", Op: listquery.Equal},
+	},
+	Sorts:       []string{"country", "region"},
+	DefaultSort: "country,region",
+}
+
+var webhookEventList = listquery.Spec[models.WebhookEvent]{
+	Fields: map[string]listquery.Field[models.WebhookEvent]{
+		"id":         {Column: "id", Value: func(e *models.WebhookEvent) any { return e.ID }},
+		"created_at": {Column: "created_at", Value: func(e *models.WebhookEvent) any { return e.CreatedAt }},
+		"status":     {Column: "status", Value: func(e *models.WebhookEvent) any { return e.Status }},
+		"type":       {Column: "type", Value: func(e *models.WebhookEvent) any { return e.Type }},
+	},
+	Filters: map[string]listquery.Filter{
+		"status":         {Field: "status", Op: listquery.Equal},
+		"type":           {Field: "type", Op: listquery.Equal},
+		"created_from":   {Field: "created_at", Op: listquery.From},
+		"created_before": {Field: "created_at", Op: listquery.Before},
+	},
+	Sorts:       []string{"created_at"},
+	DefaultSort: "-created_at",
+}
+
+var auditLogList = listquery.Spec[models.AuditLog]{
+	Fields: map[string]listquery.Field[models.AuditLog]{
+		"id":          {Column: "id", Value: func(e *models.AuditLog) any { return e.ID }},
+		"created_at":  {Column: "created_at", Value: func(e *models.AuditLog) any { return e.CreatedAt }},
+		"entity_type": {Column: "entity_type", Value: func(e *models.AuditLog) any { return e.EntityType }},
+		"entity_id":   {Column: "entity_id", Value: func(e *models.AuditLog) any { return e.EntityID }},
+		"actor_id":    {Column: "actor_id", Value: func(e *models.AuditLog) any { return derefID(e.ActorID) }},
+	},
+	Filters: map[string]listquery.Filter{
+		"entity_type":    {Field: "entity_type", Op: listquery.Equal},
+		"entity_id":      {Field: "entity_id", Op: listquery.Equal},
+		"actor_id":       {Field: "actor_id", Op: listquery.Equal},
+		"created_from":   {Field: "created_at", Op: listquery.From},
+		"created_before": {Field: "created_at", Op: listquery.Before},
+	},
+	Sorts:       []string{"created_at"},
+	DefaultSort: "-created_at",
+}
+
+// sendPage responds with a page of a listing and where it sits
+func sendPage[T any](c *fiber.Ctx, page listquery.Page[T]) error {
+	return c.JSON(fiber.Map{
+		"success":    true,
+		"data":       page.Items,
+		"pagination": page.Pagination,
+	})
+}
+
+// derefID reads an optional ID, zero if it is unset
+func derefID(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/middleware"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/patch"
+	"github.com/gofiber/fiber/v2"
+)
+
+// fieldAllowList lists, by role, the patch fields a caller may change. A
+// listed object allows all of its members.
+type fieldAllowList map[string][]string
+
+// check rejects a patch that changes fields the caller's role may not,
+// naming every such field
+func (l fieldAllowList) check(c *fiber.Ctx, p any) error {
+	role := models.RoleUser
+	if middleware.IsAdmin(c) {
+		role = models.RoleAdmin
+	}
+
+	var fields []apperror.FieldError
+	for _, name := range patch.Present(p) {
+		if !allows(l[role], name) {
+			fields = append(fields, apperror.FieldError{
+				Field:   name,
+				Code:    apperror.FieldForbidden,
+				Message: name + " cannot be changed by the caller",
+			})
+		}
+	}
+	if len(fields) > 0 {
+		err := apperror.Forbidden("The request changes fields the caller may not change")
+		err.Fields = fields
+		return err
+	}
+	return nil
+}
+
+func allows(allowed []string, name string) bool {
+	for _, field := range allowed {
+		if name == field || strings.HasPrefix(name, field+".") {
+			return true
+		}
+	}
+	return false
+}
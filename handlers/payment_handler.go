@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/middleware"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/payments"
+	"github.com/gofiber/fiber/v2"
+)
+
+// PaymentMethodRequest carries a payment method token issued by the provider's client library
+type PaymentMethodRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// AddPaymentMethod stores a payment method for the caller and makes it their default
+func AddPaymentMethod(c *fiber.Ctx) error {
+	userID, _ := middleware.UserID(c)
+
+	var req PaymentMethodRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	var user models.User
+	if result := config.DB.First(&user, userID); result.Error != nil {
+		return apperror.NotFound("User not found")
+	}
+
+	method, err := billing.AddPaymentMethod(c.UserContext(), config.DB, &user, req.Token)
+	if errors.Is(err, payments.ErrInvalidRequest) {
+		return apperror.Validation(err.Error())
+	}
+	if err != nil {
+		return apperror.Upstream("Could not save payment method", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    method,
+	})
+}
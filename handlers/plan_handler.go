@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/middleware"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/patch"
+	"github.com/chandra-devs/subscription_app/pricing"
+	"github.com/chandra-devs/subscription_app/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// PlanRequest represents the plan request payload
+type PlanRequest struct {
+	Name          string  `json:"name" validate:"required"`
+	Description   string  `json:"description"`
+	Price         float64 `json:"price" validate:"required"`
+	Duration      int     `json:"duration"`
+	IntervalUnit  string  `json:"interval_unit" validate:"omitempty,oneof=day week month year"`
+	IntervalCount int     `json:"interval_count"`
+}
+
+func (req PlanRequest) params() service.PlanParams {
+	return service.PlanParams{
+		Name:          req.Name,
+		Description:   req.Description,
+		Price:         req.Price,
+		Duration:      req.Duration,
+		IntervalUnit:  req.IntervalUnit,
+		IntervalCount: req.IntervalCount,
+	}
+}
+
+// PlanPatch is a JSON merge patch of a plan's terms. Members left out are
+// unchanged.
+type PlanPatch struct {
+	Name          patch.Field[string]  `json:"name" validate:"required"`
+	Description   patch.Field[string]  `json:"description"`
+	Price         patch.Field[float64] `json:"price" validate:"required"`
+	IntervalUnit  patch.Field[string]  `json:"interval_unit" validate:"required,oneof=day week month year"`
+	IntervalCount patch.Field[int]     `json:"interval_count" validate:"required,min=1"`
+}
+
+// planPatchFields are the plan fields each role may change
+var planPatchFields = fieldAllowList{
+	models.RoleAdmin: {"name", "description", "price", "interval_unit", "interval_count"},
+}
+
+func (p PlanPatch) apply(params *service.PlanParams) {
+	p.Name.Apply(&params.Name)
+	p.Description.Apply(&params.Description)
+	p.Price.Apply(&params.Price)
+	p.IntervalUnit.Apply(&params.IntervalUnit)
+	p.IntervalCount.Apply(&params.IntervalCount)
+	// Plans created with only a duration bill every Duration days
+	if params.IntervalUnit == "" && p.IntervalCount.Set {
+		params.IntervalUnit = billing.IntervalDay
+	}
+}
+
+// PlanResponse represents the standardized response for plans
+type PlanResponse struct {
+	Success bool         `json:"success"`
+	Data    *models.Plan `json:"data,omitempty"`
+}
+
+// PricedPlan is a plan quoted in the caller's currency
+type PricedPlan struct {
+	ID            uint      `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Name          string    `json:"name"`
+	Description   string    `json:"description"`
+	Duration      int       `json:"duration"`
+	IntervalUnit  string    `json:"interval_unit"`
+	IntervalCount int       `json:"interval_count"`
+	pricing.Quote
+}
+
+func newPricedPlan(plan models.Plan, quote pricing.Quote) PricedPlan {
+	interval := billing.PlanInterval(plan)
+	return PricedPlan{
+		ID:            plan.ID,
+		CreatedAt:     plan.CreatedAt,
+		UpdatedAt:     plan.UpdatedAt,
+		Name:          plan.Name,
+		Description:   plan.Description,
+		Duration:      plan.Duration,
+		IntervalUnit:  interval.Unit,
+		IntervalCount: interval.Count,
+		Quote:         quote,
+	}
+}
+
+// PlanHandler serves the plan catalogue
+type PlanHandler struct {
+	Plans *service.PlanService
+	Users *service.UserService
+}
+
+func NewPlanHandler(plans *service.PlanService, users *service.UserService) *PlanHandler {
+	return &PlanHandler{Plans: plans, Users: users}
+}
+
+func (h *PlanHandler) CreatePlan(c *fiber.Ctx) error {
+	var req PlanRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	plan, err := h.Plans.Create(c.UserContext(), req.params())
+	var invalid *service.InvalidError
+	if errors.As(err, &invalid) {
+		return apperror.Validation(err.Error())
+	}
+	if err != nil {
+		return apperror.Internal("Could not create plan", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(PlanResponse{
+		Success: true,
+		Data:    plan,
+	})
+}
+
+// GetPlans lists plans priced for the caller, a page at a time. The
+// currency and country come from the query string, then the authenticated
+// user's billing preferences, and default to the base currency. Plans not
+// sold in the currency are left out, so a page can come back short.
+func (h *PlanHandler) GetPlans(c *fiber.Ctx) error {
+	currency, country, err := h.callerCurrency(c)
+	if err != nil {
+		return invalidField("currency", apperror.FieldUnsupported, err.Error())
+	}
+	q, err := planList.Parse(c.Queries())
+	if err != nil {
+		return err
+	}
+
+	page, err := h.Plans.List(c.UserContext(), q)
+	if err != nil {
+		return apperror.Internal("Could not retrieve plans", err)
+	}
+
+	priced := make([]PricedPlan, 0, len(page.Items))
+	for _, plan := range page.Items {
+		quote, ok := pricing.Resolve(plan, currency, country)
+		if !ok {
+			continue
+		}
+		priced = append(priced, newPricedPlan(plan, quote))
+	}
+
+	return c.JSON(fiber.Map{
+		"success":    true,
+		"currency":   currency,
+		"data":       priced,
+		"pagination": page.Pagination,
+	})
+}
+
+// callerCurrency works out which currency and country to quote prices in
+func (h *PlanHandler) callerCurrency(c *fiber.Ctx) (string, string, error) {
+	currency := strings.ToUpper(c.Query("currency"))
+	country := strings.ToUpper(c.Query("country"))
+
+	if userID, ok := middleware.UserID(c); ok && (currency == "" || country == "") {
+		if user, err := h.Users.Find(c.UserContext(), userID); err == nil {
+			if currency == "" {
+				currency = user.Billing.Currency
+			}
+			if country == "" {
+				country = user.Billing.Country
+			}
+		}
+	}
+
+	if currency == "" {
+		currency = config.Billing.BaseCurrency
+	}
+	if !config.Billing.IsSupportedCurrency(currency) {
+		return "", "", fmt.Errorf("currency %s is not supported", currency)
+	}
+
+	return currency, country, nil
+}
+
+func (h *PlanHandler) GetPlanByID(c *fiber.Ctx) error {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return planNotFound(c)
+	}
+
+	plan, err := h.Plans.Get(c.UserContext(), id)
+	if errors.Is(err, service.ErrPlanNotFound) {
+		return planNotFound(c)
+	}
+	if err != nil {
+		return apperror.Internal("Could not retrieve plan", err)
+	}
+	if notModified(c, planETag(plan)) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	return c.JSON(PlanResponse{
+		Success: true,
+		Data:    plan,
+	})
+}
+
+// UpdatePlan replaces a plan's terms. Subscribers move to them at their next
+// renewal. If-Match must carry the plan's ETag.
+func (h *PlanHandler) UpdatePlan(c *fiber.Ctx) error {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return planNotFound(c)
+	}
+	version, err := ifMatch(c)
+	if err != nil {
+		return err
+	}
+
+	var req PlanRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	callerID, _ := middleware.UserID(c)
+	plan, err := h.Plans.Update(c.UserContext(), callerID, id, version, req.params())
+	var invalid *service.InvalidError
+	switch {
+	case errors.Is(err, service.ErrPlanNotFound):
+		return planNotFound(c)
+	case errors.Is(err, service.ErrVersionConflict):
+		return versionConflict()
+	case errors.As(err, &invalid):
+		return apperror.Validation(err.Error())
+	case err != nil:
+		return apperror.Internal("Could not update plan", err)
+	}
+
+	setETag(c, planETag(plan))
+	return c.JSON(PlanResponse{
+		Success: true,
+		Data:    plan,
+	})
+}
+
+// PatchPlan applies a JSON merge patch to a plan's terms. Subscribers move
+// to them at their next renewal. If-Match must carry the plan's ETag.
+func (h *PlanHandler) PatchPlan(c *fiber.Ctx) error {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return planNotFound(c)
+	}
+	version, err := ifMatch(c)
+	if err != nil {
+		return err
+	}
+
+	var req PlanPatch
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+	if err := planPatchFields.check(c, &req); err != nil {
+		return err
+	}
+
+	callerID, _ := middleware.UserID(c)
+	plan, err := h.Plans.Patch(c.UserContext(), callerID, id, version, req.apply)
+	var invalid *service.InvalidError
+	switch {
+	case errors.Is(err, service.ErrPlanNotFound):
+		return planNotFound(c)
+	case errors.Is(err, service.ErrVersionConflict):
+		return versionConflict()
+	case errors.As(err, &invalid):
+		return apperror.Validation(err.Error())
+	case err != nil:
+		return apperror.Internal("Could not update plan", err)
+	}
+
+	setETag(c, planETag(plan))
+	return c.JSON(PlanResponse{
+		Success: true,
+		Data:    plan,
+	})
+}
+
+// DeletePlan retires a plan nobody is actively subscribed to
+func (h *PlanHandler) DeletePlan(c *fiber.Ctx) error {
+	id, ok := idParam(c, "id")
+	if !ok {
+		return planNotFound(c)
+	}
+
+	err := h.Plans.Delete(c.UserContext(), id)
+	switch {
+	case errors.Is(err, service.ErrPlanNotFound):
+		return planNotFound(c)
+	case errors.Is(err, service.ErrPlanInUse):
+		return apperror.Conflict("Plan has active subscriptions")
+	case err != nil:
+		return apperror.Internal("Could not delete plan", err)
+	}
+
+	return c.JSON(PlanResponse{Success: true})
+}
+
+func planNotFound(c *fiber.Ctx) error {
+	return apperror.NotFound("Plan not found")
+}
+
+// idParam reads a numeric route parameter
+func idParam(c *fiber.Ctx, name string) (uint, bool) {
+	id, err := c.ParamsInt(name)
+	if err != nil || id <= 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
@@ -0,0 +1,125 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+)
+
+func TestCreatePlan(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller uint
+		body   map[string]any
+		status int
+		code   apperror.Code
+	}{
+		{
+			name:   "admin",
+			caller: adminID,
+			body:   map[string]any{"name": "Team", "price": 50, "interval_unit": "month", "interval_count": 1},
+			status: http.StatusCreated,
+		},
+		{
+			name:   "customer",
+			caller: adaID,
+			body:   map[string]any{"name": "Team", "price": 50, "interval_unit": "month", "interval_count": 1},
+			status: http.StatusForbidden,
+			code:   apperror.CodeForbidden,
+		},
+		{
+			name:   "unknown interval",
+			caller: adminID,
+			body:   map[string]any{"name": "Team", "price": 50, "interval_unit": "fortnight"},
+			status: http.StatusBadRequest,
+			code:   apperror.CodeValidationFailed,
+		},
+		{
+			name:   "without a price",
+			caller: adminID,
+			body:   map[string]any{"name": "Team", "interval_unit": "month", "interval_count": 1},
+			status: http.StatusBadRequest,
+			code:   apperror.CodeValidationFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			res := f.do(t, request{method: http.MethodPost, path: "/plans", caller: tt.caller, body: tt.body})
+			res.expect(t, tt.status, tt.code)
+			if tt.status == http.StatusCreated && res.data(t)["name"] != "Team" {
+				t.Errorf("created plan %v", res.data(t))
+			}
+		})
+	}
+}
+
+func TestGetPlans(t *testing.T) {
+	f := newFixture(t)
+
+	res := f.do(t, request{method: http.MethodGet, path: "/plans"})
+	res.expect(t, http.StatusOK, "")
+	if res.Body["currency"] != "USD" {
+		t.Errorf("priced in %v, want the base currency USD", res.Body["currency"])
+	}
+	plans, _ := res.Body["data"].([]any)
+	if len(plans) != 1 {
+		t.Fatalf("%d plans listed, want 1", len(plans))
+	}
+	if plan := plans[0].(map[string]any); plan["name"] != "Pro" || plan["price"] != float64(20) {
+		t.Errorf("listed %v, want Pro at 20", plan)
+	}
+
+	f.do(t, request{method: http.MethodGet, path: "/plans?currency=XYZ"}).expect(t, http.StatusBadRequest, apperror.CodeValidationFailed)
+}
+
+func TestGetPlanByID(t *testing.T) {
+	f := newFixture(t)
+
+	res := f.do(t, request{method: http.MethodGet, path: "/plans/1"})
+	res.expect(t, http.StatusOK, "")
+	tag := res.Header.Get("ETag")
+	f.do(t, request{method: http.MethodGet, path: "/plans/1", header: map[string]string{"If-None-Match": tag}}).
+		expect(t, http.StatusNotModified, "")
+
+	f.do(t, request{method: http.MethodGet, path: "/plans/2"}).expect(t, http.StatusNotFound, apperror.CodeNotFound)
+}
+
+func TestUpdatePlan(t *testing.T) {
+	f := newFixture(t)
+	terms := map[string]any{"name": "Pro", "price": 25, "interval_unit": "month", "interval_count": 1}
+
+	res := f.do(t, request{method: http.MethodPut, path: "/plans/1", caller: adminID, body: terms, header: map[string]string{"If-Match": `"1"`}})
+	res.expect(t, http.StatusOK, "")
+	if res.data(t)["price"] != float64(25) || res.Header.Get("ETag") != `"2"` {
+		t.Errorf("updated to %v with ETag %s", res.data(t), res.Header.Get("ETag"))
+	}
+
+	// The ETag the first update was made against is stale now
+	f.do(t, request{method: http.MethodPut, path: "/plans/1", caller: adminID, body: terms, header: map[string]string{"If-Match": `"1"`}}).
+		expect(t, http.StatusPreconditionFailed, apperror.CodePreconditionFailed)
+	f.do(t, request{method: http.MethodPatch, path: "/plans/1", caller: adminID, body: map[string]any{"price": 30}}).
+		expect(t, http.StatusPreconditionRequired, apperror.CodePreconditionRequired)
+	f.do(t, request{method: http.MethodPatch, path: "/plans/1", caller: adaID, body: map[string]any{"price": 1}, header: map[string]string{"If-Match": "*"}}).
+		expect(t, http.StatusForbidden, apperror.CodeForbidden)
+
+	res = f.do(t, request{method: http.MethodPatch, path: "/plans/1", caller: adminID, body: map[string]any{"price": 30}, header: map[string]string{"If-Match": `"2"`}})
+	res.expect(t, http.StatusOK, "")
+	if res.data(t)["price"] != float64(30) || res.data(t)["name"] != "Pro" {
+		t.Errorf("patched to %v, want Pro at 30", res.data(t))
+	}
+}
+
+func TestDeletePlan(t *testing.T) {
+	f := newFixture(t)
+
+	f.do(t, request{method: http.MethodPost, path: "/subscriptions/subscribe", caller: adaID, body: map[string]any{"plan_id": 1}}).
+		expect(t, http.StatusCreated, "")
+	f.do(t, request{method: http.MethodDelete, path: "/plans/1", caller: adminID}).expect(t, http.StatusConflict, apperror.CodeConflict)
+
+	f.do(t, request{method: http.MethodDelete, path: "/subscriptions/1", caller: adaID}).expect(t, http.StatusOK, "")
+	f.do(t, request{method: http.MethodDelete, path: "/plans/1", caller: adaID}).expect(t, http.StatusForbidden, apperror.CodeForbidden)
+	f.do(t, request{method: http.MethodDelete, path: "/plans/1", caller: adminID}).expect(t, http.StatusOK, "")
+	f.do(t, request{method: http.MethodGet, path: "/plans/1"}).expect(t, http.StatusNotFound, apperror.CodeNotFound)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/clause"
+)
+
+// PlanPriceRequest represents a price book entry payload
+type PlanPriceRequest struct {
+	Currency string  `json:"currency" validate:"required,len=3"`
+	Country  string  `json:"country" validate:"omitempty,len=2"`
+	Amount   float64 `json:"amount" validate:"required"`
+}
+
+// GetPlanPrices lists every price book entry of a plan
+func GetPlanPrices(c *fiber.Ctx) error {
+	var plan models.Plan
+	if result := config.DB.Preload("Prices").First(&plan, c.Params("id")); result.Error != nil {
+		return apperror.NotFound("Plan not found")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    plan.Prices,
+	})
+}
+
+// SetPlanPrice creates or replaces a plan's price for a currency and country
+func SetPlanPrice(c *fiber.Ctx) error {
+	var plan models.Plan
+	if result := config.DB.First(&plan, c.Params("id")); result.Error != nil {
+		return apperror.NotFound("Plan not found")
+	}
+
+	var req PlanPriceRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	req.Currency = strings.ToUpper(req.Currency)
+	req.Country = strings.ToUpper(req.Country)
+	if !config.Billing.IsSupportedCurrency(req.Currency) {
+		return invalidField("currency", apperror.FieldUnsupported, "Currency is not supported")
+	}
+	if req.Amount <= 0 {
+		return invalidField("amount", apperror.FieldOutOfRange, "Amount must be positive")
+	}
+
+	price := models.PlanPrice{
+		PlanID:   plan.ID,
+		Currency: req.Currency,
+		Country:  req.Country,
+		Amount:   req.Amount,
+	}
+
+	if err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "plan_id"}, {Name: "currency"}, {Name: "country"}},
+		DoUpdates: clause.AssignmentColumns([]string{"amount", "updated_at"}),
+	}).Create(&price).Error; err != nil {
+		return apperror.Internal("Could not save price", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    price,
+	})
+}
+
+// DeletePlanPrice removes a plan's price for a currency and optional country
+func DeletePlanPrice(c *fiber.Ctx) error {
+	currency := strings.ToUpper(c.Params("currency"))
+	country := strings.ToUpper(c.Query("country"))
+
+	result := config.DB.Unscoped().
+		Where("plan_id = ? AND currency = ? AND country = ?", c.Params("id"), currency, country).
+		Delete(&models.PlanPrice{})
+	if result.Error != nil {
+		return apperror.Internal("Could not delete price", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return apperror.NotFound("Price not found")
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+	})
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/middleware"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/gofiber/fiber/v2"
+)
+
+// GetMyBillingProfile returns the details the caller is invoiced under
+func GetMyBillingProfile(c *fiber.Ctx) error {
+	user, err := loadCaller(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    user.Billing,
+	})
+}
+
+// UpdateMyBillingProfile replaces the caller's billing profile. Invoices
+// already issued keep the profile they were issued under.
+func UpdateMyBillingProfile(c *fiber.Ctx) error {
+	user, err := loadCaller(c)
+	if err != nil {
+		return err
+	}
+
+	var profile models.BillingProfile
+	if err := bind(c, &profile); err != nil {
+		return err
+	}
+	if err := billing.NormalizeProfile(&profile); err != nil {
+		return apperror.Validation(err.Error())
+	}
+
+	user.Billing = profile
+	if err := config.DB.Model(&user).Select(models.BillingProfileColumns("billing_")).Updates(&user).Error; err != nil {
+		return apperror.Internal("Could not update billing profile", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    user.Billing,
+	})
+}
+
+// loadCaller loads the authenticated user, failing with not found if the
+// account no longer exists
+func loadCaller(c *fiber.Ctx) (models.User, error) {
+	userID, _ := middleware.UserID(c)
+
+	var user models.User
+	if result := config.DB.First(&user, userID); result.Error != nil {
+		return user, apperror.NotFound("User not found")
+	}
+	return user, nil
+}
@@ -1,17 +1,33 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"time"
 
-	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/middleware"
 	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/patch"
+	"github.com/chandra-devs/subscription_app/service"
 	"github.com/gofiber/fiber/v2"
 )
 
 // SubscriptionRequest represents the subscription request payload
 type SubscriptionRequest struct {
-	UserID uint `json:"user_id" validate:"required"`
+	// UserID defaults to the caller; only administrators may name another
+	// user
+	UserID             uint       `json:"user_id,omitempty"`
+	PlanID             uint       `json:"plan_id" validate:"required"`
+	BillingCycleAnchor *time.Time `json:"billing_cycle_anchor,omitempty"`
+	PromotionCode      string     `json:"promotion_code,omitempty"`
+}
+
+// NewSubscriptionRequest represents a subscription described directly by the caller
+type NewSubscriptionRequest struct {
+	// UserID defaults to the caller; only administrators may name another
+	// user
+	UserID uint `json:"user_id,omitempty"`
 	PlanID uint `json:"plan_id" validate:"required"`
 }
 
@@ -19,192 +35,338 @@ type SubscriptionRequest struct {
 type SubscriptionResponse struct {
 	Success bool                 `json:"success"`
 	Data    *models.Subscription `json:"data,omitempty"`
-	Error   string               `json:"error,omitempty"`
+	Invoice *models.Invoice      `json:"invoice,omitempty"`
+	// PaymentError explains why an invoice raised by the request is still unpaid
+	PaymentError string `json:"payment_error,omitempty"`
 }
 
-// PlanRequest represents the plan request payload
-type PlanRequest struct {
-	Name     string  `json:"name" validate:"required"`
-	Price    float64 `json:"price" validate:"required"`
-	Duration int     `json:"duration" validate:"required"`
+// SubscriptionHandler serves subscription lifecycle requests
+type SubscriptionHandler struct {
+	Subscriptions *service.SubscriptionService
 }
 
-// PlanResponse represents the standardized response for plans
-type PlanResponse struct {
-	Success bool         `json:"success"`
-	Data    *models.Plan `json:"data,omitempty"`
-	Error   string       `json:"error,omitempty"`
+func NewSubscriptionHandler(subscriptions *service.SubscriptionService) *SubscriptionHandler {
+	return &SubscriptionHandler{Subscriptions: subscriptions}
 }
 
-func CreatePlan(c *fiber.Ctx) error {
-	var req PlanRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(PlanResponse{
-			Success: false,
-			Error:   "Invalid input format",
-		})
+// SubscribeUser handles user subscription requests
+func (h *SubscriptionHandler) SubscribeUser(c *fiber.Ctx) error {
+	var req SubscriptionRequest
+	if err := bind(c, &req); err != nil {
+		return err
 	}
 
-	plan := models.Plan{
-		Name:     req.Name,
-		Price:    req.Price,
-		Duration: req.Duration,
+	userID, ok := middleware.ActingFor(c, req.UserID)
+	if !ok {
+		return apperror.Forbidden("Only administrators can subscribe other users")
 	}
 
-	if err := config.DB.Create(&plan).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(PlanResponse{
-			Success: false,
-			Error:   "Could not create plan",
-		})
+	subscription, invoice, err := h.Subscriptions.Subscribe(c.UserContext(), service.SubscribeParams{
+		UserID:             userID,
+		PlanID:             req.PlanID,
+		BillingCycleAnchor: req.BillingCycleAnchor,
+		PromotionCode:      req.PromotionCode,
+	})
+	if err != nil {
+		return subscribeError(err)
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(PlanResponse{
+	return c.Status(fiber.StatusCreated).JSON(SubscriptionResponse{
 		Success: true,
-		Data:    &plan,
+		Data:    subscription,
+		Invoice: invoice,
 	})
 }
 
-func GetPlans(c *fiber.Ctx) error {
-	var plans []models.Plan
-	limit := 100 // Or use pagination parameters from request
-	if err := config.DB.Limit(limit).Find(&plans).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"error":   "Could not retrieve plans",
-		})
+// GetUserSubscriptions lists a user's subscriptions, a page at a time.
+// Customers may list only their own.
+func (h *SubscriptionHandler) GetUserSubscriptions(c *fiber.Ctx) error {
+	userID, ok := idParam(c, "userId")
+	callerID, _ := middleware.UserID(c)
+	if !ok || (userID != callerID && !middleware.IsAdmin(c)) {
+		return userNotFound(c)
 	}
+	q, err := subscriptionList.Parse(c.Queries())
+	if err != nil {
+		return err
+	}
+	q.Filter("user_id", userID)
 
-	return c.JSON(fiber.Map{
-		"success": true,
-		"data":    plans,
-	})
+	page, err := h.Subscriptions.List(c.UserContext(), q)
+	if err != nil {
+		return apperror.Internal("Could not retrieve subscriptions", err)
+	}
+	return sendPage(c, page)
 }
 
-func GetPlanByID(c *fiber.Ctx) error {
-	planID := c.Params("id")
-	var plan models.Plan
+// CreateSubscription starts a subscription for the caller, billed from now
+// for one period of its plan
+func (h *SubscriptionHandler) CreateSubscription(c *fiber.Ctx) error {
+	var req NewSubscriptionRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	userID, ok := middleware.ActingFor(c, req.UserID)
+	if !ok {
+		return apperror.Forbidden("Only administrators can subscribe other users")
+	}
 
-	if result := config.DB.First(&plan, planID); result.Error != nil {
-		return c.Status(fiber.StatusNotFound).JSON(PlanResponse{
-			Success: false,
-			Error:   "Plan not found",
-		})
+	subscription, invoice, err := h.Subscriptions.Subscribe(c.UserContext(), service.SubscribeParams{UserID: userID, PlanID: req.PlanID})
+	if err != nil {
+		return subscribeError(err)
 	}
 
-	return c.JSON(PlanResponse{
+	return c.Status(fiber.StatusCreated).JSON(SubscriptionResponse{
 		Success: true,
-		Data:    &plan,
+		Data:    subscription,
+		Invoice: invoice,
 	})
 }
 
-// SubscribeUser handles user subscription requests
-func SubscribeUser(c *fiber.Ctx) error {
-	var req SubscriptionRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(SubscriptionResponse{
-			Success: false,
-			Error:   "Invalid input format",
-		})
+// subscribeError maps a failed subscribe to its API error
+func subscribeError(err error) error {
+	var invalid *service.InvalidError
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		return apperror.NotFound("User not found")
+	case errors.Is(err, service.ErrPlanNotFound):
+		return apperror.NotFound("Plan not found")
+	case errors.Is(err, service.ErrPlanUnavailable):
+		return apperror.Validation("Plan is not available in the user's billing currency")
+	case errors.Is(err, service.ErrAlreadySubscribed):
+		return apperror.Conflict("User already has an active subscription")
+	case errors.As(err, &invalid), isPromotionCodeError(err):
+		return apperror.Validation(err.Error())
+	case errors.Is(err, billing.ErrPaymentFailed), errors.Is(err, billing.ErrNoPaymentMethod):
+		return apperror.PaymentRequired(err.Error())
+	default:
+		return apperror.Internal("Could not create subscription", err)
 	}
+}
 
-	// Validate request
-	if err := validateSubscriptionRequest(req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(SubscriptionResponse{
-			Success: false,
-			Error:   err.Error(),
-		})
+// GetSubscriptions lists every subscription with its user and plan, a page
+// at a time
+func (h *SubscriptionHandler) GetSubscriptions(c *fiber.Ctx) error {
+	q, err := subscriptionList.Parse(c.Queries())
+	if err != nil {
+		return err
 	}
 
-	// Check if user exists
-	var user models.User
-	if result := config.DB.First(&user, req.UserID); result.Error != nil {
-		return c.Status(fiber.StatusNotFound).JSON(SubscriptionResponse{
-			Success: false,
-			Error:   "User not found",
-		})
+	page, err := h.Subscriptions.List(c.UserContext(), q)
+	if err != nil {
+		return apperror.Internal("Could not retrieve subscriptions", err)
 	}
+	return sendPage(c, page)
+}
 
-	// Check if plan exists
-	var plan models.Plan
-	if result := config.DB.First(&plan, req.PlanID); result.Error != nil {
-		return c.Status(fiber.StatusNotFound).JSON(SubscriptionResponse{
-			Success: false,
-			Error:   "Plan not found",
-		})
+// GetSubscription returns one of the caller's subscriptions
+func (h *SubscriptionHandler) GetSubscription(c *fiber.Ctx) error {
+	subscription, err := h.loadCallerSubscription(c)
+	if err != nil {
+		return err
+	}
+	if notModified(c, etag(subscription.Version)) {
+		return c.SendStatus(fiber.StatusNotModified)
 	}
 
-	// Check if user already has an active subscription
-	var existingSubscription models.Subscription
-	if result := config.DB.Where("user_id = ? AND active = true", req.UserID).First(&existingSubscription); result.Error == nil {
-		return c.Status(fiber.StatusBadRequest).JSON(SubscriptionResponse{
-			Success: false,
-			Error:   "User already has an active subscription",
-		})
+	return c.JSON(SubscriptionResponse{
+		Success: true,
+		Data:    subscription,
+	})
+}
+
+// SubscriptionPatch is a JSON merge patch of a subscription. Members left
+// out are unchanged.
+type SubscriptionPatch struct {
+	PlanID patch.Field[uint]   `json:"plan_id" validate:"required"`
+	Status patch.Field[string] `json:"status" validate:"required,oneof=cancelled"`
+}
+
+// subscriptionPatchFields are the subscription fields each role may change
+var subscriptionPatchFields = fieldAllowList{
+	models.RoleAdmin: {"plan_id", "status"},
+	models.RoleUser:  {"status"},
+}
+
+// UpdateSubscription applies a JSON merge patch to a subscription, moving it
+// to another plan or cancelling it. Customers may only cancel their own
+// subscriptions. If-Match must carry the subscription's ETag.
+func (h *SubscriptionHandler) UpdateSubscription(c *fiber.Ctx) error {
+	subscription, err := h.loadCallerSubscription(c)
+	if err != nil {
+		return err
+	}
+	version, err := ifMatch(c)
+	if err != nil {
+		return err
 	}
 
-	subscription := models.Subscription{
-		UserID:    req.UserID,
-		PlanID:    req.PlanID,
-		Status:    "active",
-		StartDate: time.Now(),
-		ExpiresAt: time.Now().AddDate(0, 0, plan.Duration),
-		Active:    true,
+	var req SubscriptionPatch
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+	if err := subscriptionPatchFields.check(c, &req); err != nil {
+		return err
 	}
 
-	if err := config.DB.Create(&subscription).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(SubscriptionResponse{
-			Success: false,
-			Error:   "Could not create subscription",
-		})
+	callerID, _ := middleware.UserID(c)
+	change, err := h.Subscriptions.Update(c.UserContext(), callerID, subscription, version, service.SubscriptionUpdate{
+		PlanID: req.PlanID.Value,
+		Status: req.Status.Value,
+	})
+	var invalid *service.InvalidError
+	switch {
+	case errors.Is(err, service.ErrVersionConflict):
+		return versionConflict()
+	case errors.Is(err, service.ErrNotActive):
+		return apperror.Conflict("Subscription is not active")
+	case errors.Is(err, service.ErrPlanNotFound):
+		return apperror.NotFound("Plan not found")
+	case errors.Is(err, billing.ErrNoPrice):
+		return apperror.Validation("Plan is not available in the subscription currency")
+	case errors.As(err, &invalid):
+		return apperror.Validation(err.Error())
+	case err != nil:
+		return apperror.Internal("Could not update subscription", err)
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(SubscriptionResponse{
+	setETag(c, etag(subscription.Version))
+	return c.JSON(SubscriptionResponse{
+		Success:      true,
+		Data:         subscription,
+		Invoice:      change.Invoice,
+		PaymentError: change.PaymentError,
+	})
+}
+
+// DeleteSubscription cancels one of the caller's subscriptions immediately.
+// The subscription and its invoices are kept.
+func (h *SubscriptionHandler) DeleteSubscription(c *fiber.Ctx) error {
+	subscription, err := h.findCallerSubscription(c)
+	if err != nil {
+		return err
+	}
+
+	if err := h.Subscriptions.Cancel(c.UserContext(), subscription); err != nil {
+		return apperror.Internal("Could not cancel subscription", err)
+	}
+
+	return c.JSON(SubscriptionResponse{
 		Success: true,
-		Data:    &subscription,
+		Data:    subscription,
 	})
 }
 
-func validateSubscriptionRequest(req SubscriptionRequest) error {
-	if req.UserID == 0 {
-		return fmt.Errorf("user ID is required")
+// PlanChangeRequest represents a request to move a subscription to another plan
+type PlanChangeRequest struct {
+	PlanID uint `json:"plan_id" validate:"required"`
+}
+
+// ChangeSubscriptionPlan moves a subscription to another plan, invoicing the prorated difference
+func (h *SubscriptionHandler) ChangeSubscriptionPlan(c *fiber.Ctx) error {
+	subscription, err := h.findCallerSubscription(c)
+	if err != nil {
+		return err
+	}
+
+	var req PlanChangeRequest
+	if err := bind(c, &req); err != nil {
+		return err
 	}
-	if req.PlanID == 0 {
-		return fmt.Errorf("plan ID is required")
+
+	change, err := h.Subscriptions.ChangePlan(c.UserContext(), subscription, req.PlanID)
+	switch {
+	case errors.Is(err, service.ErrNotActive):
+		return apperror.Conflict("Subscription is not active")
+	case errors.Is(err, service.ErrVersionConflict):
+		return apperror.Conflict("Subscription changed plan while the request was made; fetch it again and retry")
+	case errors.Is(err, service.ErrSamePlan):
+		return invalidField("plan_id", apperror.FieldInvalid, "Subscription is already on this plan")
+	case errors.Is(err, service.ErrPlanNotFound):
+		return apperror.NotFound("Plan not found")
+	case errors.Is(err, billing.ErrNoPrice):
+		return apperror.Validation("Plan is not available in the subscription currency")
+	case err != nil:
+		return apperror.Internal("Could not change plan", err)
 	}
-	return nil
+
+	return c.JSON(SubscriptionResponse{
+		Success:      true,
+		Data:         subscription,
+		Invoice:      change.Invoice,
+		PaymentError: change.PaymentError,
+	})
 }
 
-// GetUserSubscriptions retrieves all subscriptions for a user
-func GetUserSubscriptions(c *fiber.Ctx) error {
-	userID := c.Params("userId")
-	var subscriptions []models.Subscription
-	if err := config.DB.Where("user_id = ?", userID).Find(&subscriptions).Error; err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Could not retrieve subscriptions"})
+// RenewSubscription starts the next billing period of a subscription and invoices it
+func (h *SubscriptionHandler) RenewSubscription(c *fiber.Ctx) error {
+	id, _ := idParam(c, "id")
+	subscription, err := h.Subscriptions.Get(c.UserContext(), id)
+	if err != nil {
+		return apperror.NotFound("Subscription not found")
 	}
-	return c.JSON(subscriptions)
+
+	change, err := h.Subscriptions.Renew(c.UserContext(), subscription)
+	if errors.Is(err, service.ErrNotActive) {
+		return apperror.Conflict("Only active subscriptions can be renewed")
+	}
+	if err != nil {
+		return apperror.Internal("Could not renew subscription", err)
+	}
+
+	return c.JSON(SubscriptionResponse{
+		Success:      true,
+		Data:         subscription,
+		Invoice:      change.Invoice,
+		PaymentError: change.PaymentError,
+	})
 }
 
-func CreateSubscription(c *fiber.Ctx) error {
-	subscription := new(models.Subscription)
-	if err := c.BodyParser(subscription); err != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid input"})
+// GetSubscriptionHistory lists the events in a subscription's history, oldest first
+func (h *SubscriptionHandler) GetSubscriptionHistory(c *fiber.Ctx) error {
+	subscription, err := h.loadCallerSubscription(c)
+	if err != nil {
+		return err
 	}
 
-	// Validate Plan exists
-	var plan models.Plan
-	if result := config.DB.First(&plan, subscription.PlanID); result.Error != nil {
-		return c.Status(400).JSON(fiber.Map{"error": "Invalid plan"})
+	events, err := h.Subscriptions.History(c.UserContext(), subscription)
+	if err != nil {
+		return apperror.Internal("Could not retrieve subscription history", err)
 	}
 
-	// Set subscription details
-	subscription.StartDate = time.Now()
-	subscription.ExpiresAt = subscription.StartDate.AddDate(0, 0, plan.Duration)
-	subscription.Status = "active"
-	subscription.Active = true
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    events,
+	})
+}
 
-	if result := config.DB.Create(&subscription); result.Error != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to create subscription"})
+// findCallerSubscription loads the active subscription named in the route,
+// provided it belongs to the caller or the caller is an administrator
+func (h *SubscriptionHandler) findCallerSubscription(c *fiber.Ctx) (*models.Subscription, error) {
+	subscription, err := h.loadCallerSubscription(c)
+	if err != nil {
+		return nil, err
+	}
+
+	if !subscription.Active {
+		return nil, apperror.Conflict("Subscription is not active")
+	}
+
+	return subscription, nil
+}
+
+// loadCallerSubscription is findCallerSubscription without the active check
+func (h *SubscriptionHandler) loadCallerSubscription(c *fiber.Ctx) (*models.Subscription, error) {
+	id, _ := idParam(c, "id")
+	userID, _ := middleware.UserID(c)
+	subscription, err := h.Subscriptions.GetForCaller(c.UserContext(), id, userID, middleware.IsAdmin(c))
+	if errors.Is(err, service.ErrSubscriptionNotFound) {
+		return nil, apperror.NotFound("Subscription not found")
+	}
+	if err != nil {
+		return nil, apperror.Internal("Could not retrieve subscription", err)
 	}
 
-	return c.Status(201).JSON(subscription)
+	return subscription, nil
 }
@@ -0,0 +1,205 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/models"
+)
+
+func TestSubscribeUser(t *testing.T) {
+	tests := []struct {
+		name         string
+		caller       uint
+		body         map[string]any
+		failPayments bool
+		status       int
+		code         apperror.Code
+		subscriber   uint
+	}{
+		{
+			name:       "customer",
+			caller:     adaID,
+			body:       map[string]any{"plan_id": 1},
+			status:     http.StatusCreated,
+			subscriber: adaID,
+		},
+		{
+			name:   "customer naming someone else",
+			caller: adaID,
+			body:   map[string]any{"plan_id": 1, "user_id": graceID},
+			status: http.StatusForbidden,
+			code:   apperror.CodeForbidden,
+		},
+		{
+			name:       "admin naming a customer",
+			caller:     adminID,
+			body:       map[string]any{"plan_id": 1, "user_id": graceID},
+			status:     http.StatusCreated,
+			subscriber: graceID,
+		},
+		{
+			name:   "admin naming nobody",
+			caller: adminID,
+			body:   map[string]any{"plan_id": 1, "user_id": 99},
+			status: http.StatusNotFound,
+			code:   apperror.CodeNotFound,
+		},
+		{
+			name:   "unknown plan",
+			caller: adaID,
+			body:   map[string]any{"plan_id": 2},
+			status: http.StatusNotFound,
+			code:   apperror.CodeNotFound,
+		},
+		{
+			name:   "without a plan",
+			caller: adaID,
+			body:   map[string]any{},
+			status: http.StatusBadRequest,
+			code:   apperror.CodeValidationFailed,
+		},
+		{
+			name:         "declined card",
+			caller:       adaID,
+			body:         map[string]any{"plan_id": 1},
+			failPayments: true,
+			status:       http.StatusPaymentRequired,
+			code:         apperror.CodePaymentRequired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			f.biller.FailPayments = tt.failPayments
+
+			res := f.do(t, request{method: http.MethodPost, path: "/subscriptions/subscribe", caller: tt.caller, body: tt.body})
+			res.expect(t, tt.status, tt.code)
+			if tt.status != http.StatusCreated {
+				if active, err := f.subs.FindActiveByUser(context.Background(), adaID); err == nil {
+					t.Errorf("refused subscribe left subscription %d active", active.ID)
+				}
+				return
+			}
+
+			sub := res.data(t)
+			if sub["user_id"] != float64(tt.subscriber) || sub["status"] != models.SubscriptionStatusActive || sub["active"] != true {
+				t.Errorf("subscription %v, want an active one for user %d", sub, tt.subscriber)
+			}
+			invoice, _ := res.Body["invoice"].(map[string]any)
+			if invoice["status"] != models.InvoiceStatusPaid {
+				t.Errorf("invoice %v, want a paid one", invoice)
+			}
+		})
+	}
+}
+
+func TestSubscribeUserTwice(t *testing.T) {
+	f := newFixture(t)
+	subscribe := request{method: http.MethodPost, path: "/subscriptions/subscribe", caller: adaID, body: map[string]any{"plan_id": 1}}
+
+	f.do(t, subscribe).expect(t, http.StatusCreated, "")
+	f.do(t, subscribe).expect(t, http.StatusConflict, apperror.CodeConflict)
+	if invoices := f.biller.Invoices(); len(invoices) != 1 {
+		t.Errorf("%d invoices raised, want 1", len(invoices))
+	}
+}
+
+func TestCreateSubscriptionInBillingCurrency(t *testing.T) {
+	f := newFixture(t)
+	ctx := context.Background()
+	ada, _ := f.users.FindByID(ctx, adaID)
+	ada.Billing.Currency = "EUR"
+	if err := f.users.Save(ctx, ada); err != nil {
+		t.Fatal(err)
+	}
+	plan, _ := f.plans.FindByID(ctx, 1)
+	plan.Prices = []models.PlanPrice{{Currency: "EUR", Amount: 18}}
+	if err := f.plans.Save(ctx, plan); err != nil {
+		t.Fatal(err)
+	}
+
+	res := f.do(t, request{method: http.MethodPost, path: "/subscriptions", caller: adaID, body: map[string]any{"plan_id": 1}})
+	res.expect(t, http.StatusCreated, "")
+	if currency := res.data(t)["currency"]; currency != "EUR" {
+		t.Errorf("subscription billed in %v, want the user's billing currency EUR", currency)
+	}
+	f.do(t, request{method: http.MethodPost, path: "/subscriptions", caller: adaID, body: map[string]any{"plan_id": 1}}).
+		expect(t, http.StatusConflict, apperror.CodeConflict)
+}
+
+func TestSubscribeUserDeclinedKeepsTheAttempt(t *testing.T) {
+	f := newFixture(t)
+	f.biller.FailPayments = true
+
+	f.do(t, request{method: http.MethodPost, path: "/subscriptions/subscribe", caller: adaID, body: map[string]any{"plan_id": 1}}).
+		expect(t, http.StatusPaymentRequired, apperror.CodePaymentRequired)
+
+	res := f.do(t, request{method: http.MethodGet, path: path("/subscriptions/user", adaID), caller: adaID})
+	res.expect(t, http.StatusOK, "")
+	subs, _ := res.Body["data"].([]any)
+	if len(subs) != 1 {
+		t.Fatalf("%d subscriptions listed, want the failed attempt", len(subs))
+	}
+	if sub := subs[0].(map[string]any); sub["status"] != models.SubscriptionStatusIncompleteExpired || sub["active"] != false {
+		t.Errorf("failed attempt is %v, want incomplete_expired and inactive", sub)
+	}
+	if invoices := f.biller.Invoices(); len(invoices) != 1 || invoices[0].Status != models.InvoiceStatusVoid {
+		t.Errorf("invoices %+v, want one void invoice", invoices)
+	}
+
+	// Once the card works the customer can subscribe again
+	f.biller.FailPayments = false
+	f.do(t, request{method: http.MethodPost, path: "/subscriptions/subscribe", caller: adaID, body: map[string]any{"plan_id": 1}}).
+		expect(t, http.StatusCreated, "")
+}
+
+func TestGetUserSubscriptions(t *testing.T) {
+	f := newFixture(t)
+	f.do(t, request{method: http.MethodPost, path: "/subscriptions/subscribe", caller: adaID, body: map[string]any{"plan_id": 1}}).
+		expect(t, http.StatusCreated, "")
+
+	for _, caller := range []uint{adaID, adminID} {
+		res := f.do(t, request{method: http.MethodGet, path: path("/subscriptions/user", adaID), caller: caller})
+		res.expect(t, http.StatusOK, "")
+		if subs, _ := res.Body["data"].([]any); len(subs) != 1 {
+			t.Errorf("user %d listed %d subscriptions, want 1", caller, len(subs))
+		}
+	}
+	// Other customers' subscriptions are not theirs to list
+	f.do(t, request{method: http.MethodGet, path: path("/subscriptions/user", adaID), caller: graceID}).
+		expect(t, http.StatusNotFound, apperror.CodeNotFound)
+}
+
+func TestGetSubscription(t *testing.T) {
+	f := newFixture(t)
+	f.do(t, request{method: http.MethodPost, path: "/subscriptions/subscribe", caller: adaID, body: map[string]any{"plan_id": 1}}).
+		expect(t, http.StatusCreated, "")
+
+	res := f.do(t, request{method: http.MethodGet, path: "/subscriptions/1", caller: adaID})
+	res.expect(t, http.StatusOK, "")
+	f.do(t, request{method: http.MethodGet, path: "/subscriptions/1", caller: adaID, header: map[string]string{"If-None-Match": res.Header.Get("ETag")}}).
+		expect(t, http.StatusNotModified, "")
+
+	// Other customers' subscriptions are not theirs to see
+	f.do(t, request{method: http.MethodGet, path: "/subscriptions/1", caller: graceID}).expect(t, http.StatusNotFound, apperror.CodeNotFound)
+	f.do(t, request{method: http.MethodGet, path: "/subscriptions/1", caller: adminID}).expect(t, http.StatusOK, "")
+	f.do(t, request{method: http.MethodGet, path: "/subscriptions/2", caller: adaID}).expect(t, http.StatusNotFound, apperror.CodeNotFound)
+}
+
+func TestDeleteSubscription(t *testing.T) {
+	f := newFixture(t)
+	f.do(t, request{method: http.MethodPost, path: "/subscriptions/subscribe", caller: adaID, body: map[string]any{"plan_id": 1}}).
+		expect(t, http.StatusCreated, "")
+
+	f.do(t, request{method: http.MethodDelete, path: "/subscriptions/1", caller: graceID}).expect(t, http.StatusNotFound, apperror.CodeNotFound)
+
+	res := f.do(t, request{method: http.MethodDelete, path: "/subscriptions/1", caller: adaID})
+	res.expect(t, http.StatusOK, "")
+	if sub := res.data(t); sub["active"] != false || sub["status"] != models.SubscriptionStatusCancelled {
+		t.Errorf("cancelled subscription is %v", sub)
+	}
+	f.do(t, request{method: http.MethodDelete, path: "/subscriptions/1", caller: adaID}).expect(t, http.StatusConflict, apperror.CodeConflict)
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/tax"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/clause"
+)
+
+// TaxRateRequest represents a tax rate payload
+type TaxRateRequest struct {
+	Country    string  `json:"country" validate:"required,len=2"`
+	Region     string  `json:"region"`
+	Name       string  `json:"name" validate:"required"`
+	Percentage float64 `json:"percentage" validate:"min=0,max=100"`
+	Inclusive  bool    `json:"inclusive"`
+	Active     *bool   `json:"active,omitempty"`
+}
+
+// GetTaxRates lists tax rates, by country and region by default
+func GetTaxRates(c *fiber.Ctx) error {
+	params := c.Queries()
+	params["country"] = strings.ToUpper(params["country"])
+	q, err := taxRateList.Parse(params)
+	if err != nil {
+		return err
+	}
+
+	var rates []models.TaxRate
+	if err := q.Apply(config.DB).Find(&rates).Error; err != nil {
+		return apperror.Internal("Could not retrieve tax rates", err)
+	}
+	return sendPage(c, listquery.NewPage(q, rates))
+}
+
+// SetTaxRate creates or replaces the tax rate for a country and region
+func SetTaxRate(c *fiber.Ctx) error {
+	var req TaxRateRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+
+	rate := models.TaxRate{
+		Country:    strings.ToUpper(req.Country),
+		Region:     strings.ToUpper(req.Region),
+		Name:       req.Name,
+		Percentage: req.Percentage,
+		Inclusive:  req.Inclusive,
+		Active:     req.Active == nil || *req.Active,
+	}
+	if err := tax.ValidateRate(rate); err != nil {
+		return apperror.Validation(err.Error())
+	}
+
+	// Issued invoices keep their own copy of the rate, so replacing it is safe
+	if err := config.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "country"}, {Name: "region"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "percentage", "inclusive", "active", "updated_at"}),
+	}).Create(&rate).Error; err != nil {
+		return apperror.Internal("Could not save tax rate", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    rate,
+	})
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/middleware"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/patch"
+	"github.com/chandra-devs/subscription_app/service"
+	"github.com/gofiber/fiber/v2"
+)
+
+// UserResponse represents the standardized response for users
+type UserResponse struct {
+	Success bool         `json:"success"`
+	Data    *models.User `json:"data,omitempty"`
+}
+
+// NewUserRequest is a user created by an administrator. Only these fields
+// can be set; the ID, role, version and payment references are the
+// server's.
+type NewUserRequest struct {
+	Name    string                `json:"name" validate:"required"`
+	Email   string                `json:"email" validate:"required,email"`
+	Billing models.BillingProfile `json:"billing"`
+}
+
+// User turns the request into the user to create
+func (r NewUserRequest) User() *models.User {
+	return &models.User{Name: r.Name, Email: r.Email, Billing: r.Billing}
+}
+
+// UserPatch is a JSON merge patch of a user. Members left out are unchanged.
+type UserPatch struct {
+	Name    patch.Field[string]       `json:"name" validate:"required"`
+	Email   patch.Field[string]       `json:"email" validate:"required,email"`
+	Role    patch.Field[string]       `json:"role" validate:"required,oneof=user admin"`
+	Billing patch.Field[BillingPatch] `json:"billing"`
+}
+
+// BillingPatch is a JSON merge patch of a billing profile. A null billing
+// profile clears every field.
+type BillingPatch struct {
+	CompanyName  patch.Field[string] `json:"company_name"`
+	Email        patch.Field[string] `json:"email" validate:"omitempty,email"`
+	AddressLine1 patch.Field[string] `json:"address_line1"`
+	AddressLine2 patch.Field[string] `json:"address_line2"`
+	City         patch.Field[string] `json:"city"`
+	PostalCode   patch.Field[string] `json:"postal_code"`
+	Region       patch.Field[string] `json:"region"`
+	Country      patch.Field[string] `json:"country" validate:"omitempty,len=2"`
+	TaxID        patch.Field[string] `json:"tax_id"`
+	Currency     patch.Field[string] `json:"currency" validate:"omitempty,len=3"`
+	Locale       patch.Field[string] `json:"locale"`
+}
+
+// userPatchFields are the user fields each role may change
+var userPatchFields = fieldAllowList{
+	models.RoleAdmin: {"name", "email", "role", "billing"},
+	models.RoleUser:  {"name", "email", "billing"},
+}
+
+// Apply writes the patch to a user
+func (p UserPatch) Apply(user *models.User) {
+	p.Name.Apply(&user.Name)
+	p.Email.Apply(&user.Email)
+	p.Role.Apply(&user.Role)
+	if p.Billing.Null {
+		user.Billing = models.BillingProfile{}
+	} else if p.Billing.Set {
+		p.Billing.Value.apply(&user.Billing)
+	}
+}
+
+func (p BillingPatch) apply(profile *models.BillingProfile) {
+	p.CompanyName.Apply(&profile.CompanyName)
+	p.Email.Apply(&profile.Email)
+	p.AddressLine1.Apply(&profile.AddressLine1)
+	p.AddressLine2.Apply(&profile.AddressLine2)
+	p.City.Apply(&profile.City)
+	p.PostalCode.Apply(&profile.PostalCode)
+	p.Region.Apply(&profile.Region)
+	p.Country.Apply(&profile.Country)
+	p.TaxID.Apply(&profile.TaxID)
+	p.Currency.Apply(&profile.Currency)
+	p.Locale.Apply(&profile.Locale)
+}
+
+// UserHandler manages user accounts
+type UserHandler struct {
+	Users *service.UserService
+}
+
+func NewUserHandler(users *service.UserService) *UserHandler {
+	return &UserHandler{Users: users}
+}
+
+// GetUsers lists users with their subscriptions, a page at a time
+func (h *UserHandler) GetUsers(c *fiber.Ctx) error {
+	q, err := UserList.Parse(c.Queries())
+	if err != nil {
+		return err
+	}
+
+	page, err := h.Users.List(c.UserContext(), q)
+	if err != nil {
+		return apperror.Internal("Could not retrieve users", err)
+	}
+	return sendPage(c, page)
+}
+
+// GetUser returns a user with their subscriptions. Customers may read only
+// their own account.
+func (h *UserHandler) GetUser(c *fiber.Ctx) error {
+	id, ok := idParam(c, "id")
+	callerID, _ := middleware.UserID(c)
+	if !ok || (id != callerID && !middleware.IsAdmin(c)) {
+		return userNotFound(c)
+	}
+
+	user, err := h.Users.Get(c.UserContext(), id)
+	if errors.Is(err, service.ErrUserNotFound) {
+		return userNotFound(c)
+	}
+	if err != nil {
+		return apperror.Internal("Could not retrieve user", err)
+	}
+	if notModified(c, userETag(user)) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	return c.JSON(UserResponse{
+		Success: true,
+		Data:    user,
+	})
+}
+
+// CreateUser adds a user on behalf of an administrator
+func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
+	var req NewUserRequest
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+	user := req.User()
+
+	var invalid *service.InvalidError
+	if err := h.Users.Create(c.UserContext(), user); errors.As(err, &invalid) {
+		return apperror.Validation(err.Error())
+	} else if err != nil {
+		return apperror.Internal("Could not create user", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(UserResponse{
+		Success: true,
+		Data:    user,
+	})
+}
+
+// UpdateUser applies a JSON merge patch to a user. Customers may change
+// their own name, email and billing profile; administrators may change
+// anyone's, including their role. If-Match must carry the user's ETag.
+func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
+	id, ok := idParam(c, "id")
+	callerID, _ := middleware.UserID(c)
+	if !ok || (id != callerID && !middleware.IsAdmin(c)) {
+		return userNotFound(c)
+	}
+	version, err := ifMatch(c)
+	if err != nil {
+		return err
+	}
+
+	var req UserPatch
+	if err := bind(c, &req); err != nil {
+		return err
+	}
+	if err := userPatchFields.check(c, &req); err != nil {
+		return err
+	}
+
+	user, err := h.Users.Patch(c.UserContext(), callerID, id, version, req.Apply)
+	var invalid *service.InvalidError
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		return userNotFound(c)
+	case errors.Is(err, service.ErrVersionConflict):
+		return versionConflict()
+	case errors.Is(err, service.ErrEmailTaken):
+		return apperror.Conflict("Email already registered")
+	case errors.As(err, &invalid):
+		return apperror.Validation(err.Error())
+	case err != nil:
+		return apperror.Internal("Could not update user", err)
+	}
+
+	setETag(c, userETag(user))
+	return c.JSON(UserResponse{
+		Success: true,
+		Data:    user,
+	})
+}
+
+// DeleteUser removes a user and cancels their subscriptions. Customers may
+// delete their own account; administrators may delete anyone's.
+func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
+	id, ok := idParam(c, "id")
+	callerID, _ := middleware.UserID(c)
+	if !ok || (id != callerID && !middleware.IsAdmin(c)) {
+		return userNotFound(c)
+	}
+
+	err := h.Users.Delete(c.UserContext(), id)
+	if errors.Is(err, service.ErrUserNotFound) {
+		return userNotFound(c)
+	}
+	if err != nil {
+		return apperror.Internal("Could not delete user", err)
+	}
+
+	return c.JSON(UserResponse{Success: true})
+}
+
+func userNotFound(c *fiber.Ctx) error {
+	return apperror.NotFound("User not found")
+}
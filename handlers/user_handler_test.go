@@ -0,0 +1,287 @@
+package handlers_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/models"
+)
+
+func TestGetUser(t *testing.T) {
+	f := newFixture(t)
+
+	for _, caller := range []uint{adaID, adminID} {
+		res := f.do(t, request{method: http.MethodGet, path: path("/users", adaID), caller: caller})
+		res.expect(t, http.StatusOK, "")
+		if got := res.data(t)["email"]; got != "ada@example.com" {
+			t.Errorf("email %v, want ada@example.com", got)
+		}
+		if _, ok := res.data(t)["password"]; ok {
+			t.Error("response carries the password hash")
+		}
+	}
+
+	// Other customers' accounts are not theirs to see
+	f.do(t, request{method: http.MethodGet, path: path("/users", adaID), caller: graceID}).expect(t, http.StatusNotFound, apperror.CodeNotFound)
+	f.do(t, request{method: http.MethodGet, path: path("/users", adaID)}).expect(t, http.StatusNotFound, apperror.CodeNotFound)
+	f.do(t, request{method: http.MethodGet, path: "/users/99", caller: adminID}).expect(t, http.StatusNotFound, apperror.CodeNotFound)
+	f.do(t, request{method: http.MethodGet, path: "/users/ada", caller: adminID}).expect(t, http.StatusNotFound, apperror.CodeNotFound)
+}
+
+func TestGetUsers(t *testing.T) {
+	f := newFixture(t)
+
+	res := f.do(t, request{method: http.MethodGet, path: "/users", caller: adminID})
+	res.expect(t, http.StatusOK, "")
+	if users, _ := res.Body["data"].([]any); len(users) != 3 {
+		t.Errorf("%d users listed, want 3", len(users))
+	}
+	f.do(t, request{method: http.MethodGet, path: "/users", caller: adaID}).expect(t, http.StatusForbidden, apperror.CodeForbidden)
+	f.do(t, request{method: http.MethodGet, path: "/users"}).expect(t, http.StatusForbidden, apperror.CodeForbidden)
+}
+
+func TestGetUsersByEmailPrefix(t *testing.T) {
+	f := newFixture(t)
+
+	res := f.do(t, request{method: http.MethodGet, path: "/users?email_prefix=GRACE", caller: adminID})
+	res.expect(t, http.StatusOK, "")
+	users, _ := res.Body["data"].([]any)
+	if len(users) != 1 || users[0].(map[string]any)["email"] != "grace@example.com" {
+		t.Errorf("listed %v, want grace@example.com", users)
+	}
+
+	// Probing for addresses is refused to anyone else, whatever matches
+	for _, prefix := range []string{"grace", "nobody"} {
+		f.do(t, request{method: http.MethodGet, path: "/users?email_prefix=" + prefix, caller: adaID}).
+			expect(t, http.StatusForbidden, apperror.CodeForbidden)
+		f.do(t, request{method: http.MethodGet, path: "/users?email_prefix=" + prefix}).
+			expect(t, http.StatusForbidden, apperror.CodeForbidden)
+	}
+}
+
+func TestGetUserETagCoversSubscriptions(t *testing.T) {
+	f := newFixture(t)
+
+	first := f.do(t, request{method: http.MethodGet, path: path("/users", adaID), caller: adaID})
+	tag := first.Header.Get("ETag")
+	if tag == "" {
+		t.Fatal("no ETag")
+	}
+	f.do(t, request{method: http.MethodGet, path: path("/users", adaID), caller: adaID, header: map[string]string{"If-None-Match": tag}}).
+		expect(t, http.StatusNotModified, "")
+
+	// Subscribing changes the embedded subscriptions but not the user
+	f.do(t, request{method: http.MethodPost, path: "/subscriptions/subscribe", caller: adaID, body: map[string]any{"plan_id": 1}}).
+		expect(t, http.StatusCreated, "")
+
+	res := f.do(t, request{method: http.MethodGet, path: path("/users", adaID), caller: adaID, header: map[string]string{"If-None-Match": tag}})
+	res.expect(t, http.StatusOK, "")
+	if res.Header.Get("ETag") == tag {
+		t.Errorf("ETag %s did not change when a subscription was added", tag)
+	}
+	if subs, _ := res.data(t)["subscriptions"].([]any); len(subs) != 1 {
+		t.Errorf("%d subscriptions embedded, want 1", len(subs))
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	tests := []struct {
+		name   string
+		caller uint
+		body   map[string]any
+		status int
+		code   apperror.Code
+		fields map[string]string
+	}{
+		{
+			name:   "admin",
+			caller: adminID,
+			body:   map[string]any{"name": "Alan Turing", "email": "alan@example.com"},
+			status: http.StatusCreated,
+		},
+		{
+			name:   "customer",
+			caller: adaID,
+			body:   map[string]any{"name": "Alan Turing", "email": "alan@example.com"},
+			status: http.StatusForbidden,
+			code:   apperror.CodeForbidden,
+		},
+		{
+			name:   "anonymous",
+			body:   map[string]any{"name": "Alan Turing", "email": "alan@example.com"},
+			status: http.StatusForbidden,
+			code:   apperror.CodeForbidden,
+		},
+		{
+			name:   "role is not a request field",
+			caller: adminID,
+			body:   map[string]any{"name": "Alan Turing", "email": "alan@example.com", "role": "admin"},
+			status: http.StatusBadRequest,
+			code:   apperror.CodeValidationFailed,
+			fields: map[string]string{"role": apperror.FieldUnknown},
+		},
+		{
+			name:   "invalid email",
+			caller: adminID,
+			body:   map[string]any{"name": "Alan Turing", "email": "alan"},
+			status: http.StatusBadRequest,
+			code:   apperror.CodeValidationFailed,
+			fields: map[string]string{"email": apperror.FieldInvalid},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			res := f.do(t, request{method: http.MethodPost, path: "/users", caller: tt.caller, body: tt.body})
+			res.expect(t, tt.status, tt.code)
+			for field, code := range tt.fields {
+				if got := res.fieldErrors()[field]; got != code {
+					t.Errorf("field %s has code %q, want %q; errors %v", field, got, code, res.fieldErrors())
+				}
+			}
+			if tt.status != http.StatusCreated {
+				return
+			}
+			if role := res.data(t)["role"]; role != models.RoleUser {
+				t.Errorf("new user has role %v, want %s", role, models.RoleUser)
+			}
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	tests := []struct {
+		name    string
+		caller  uint
+		target  uint
+		body    map[string]any
+		ifMatch string
+		status  int
+		code    apperror.Code
+	}{
+		{
+			name:    "own name",
+			caller:  adaID,
+			target:  adaID,
+			body:    map[string]any{"name": "Augusta Ada King"},
+			ifMatch: `"1"`,
+			status:  http.StatusOK,
+		},
+		{
+			name:    "any match",
+			caller:  adaID,
+			target:  adaID,
+			body:    map[string]any{"name": "Augusta Ada King"},
+			ifMatch: "*",
+			status:  http.StatusOK,
+		},
+		{
+			name:   "without If-Match",
+			caller: adaID,
+			target: adaID,
+			body:   map[string]any{"name": "Augusta Ada King"},
+			status: http.StatusPreconditionRequired,
+			code:   apperror.CodePreconditionRequired,
+		},
+		{
+			name:    "stale If-Match",
+			caller:  adaID,
+			target:  adaID,
+			body:    map[string]any{"name": "Augusta Ada King"},
+			ifMatch: `"2"`,
+			status:  http.StatusPreconditionFailed,
+			code:    apperror.CodePreconditionFailed,
+		},
+		{
+			name:    "customer changing their role",
+			caller:  adaID,
+			target:  adaID,
+			body:    map[string]any{"role": "admin"},
+			ifMatch: `"1"`,
+			status:  http.StatusForbidden,
+			code:    apperror.CodeForbidden,
+		},
+		{
+			name:    "customer changing someone else",
+			caller:  adaID,
+			target:  graceID,
+			body:    map[string]any{"name": "Ada"},
+			ifMatch: `"1"`,
+			status:  http.StatusNotFound,
+			code:    apperror.CodeNotFound,
+		},
+		{
+			name:    "admin changing a role",
+			caller:  adminID,
+			target:  graceID,
+			body:    map[string]any{"role": "admin"},
+			ifMatch: `"1"`,
+			status:  http.StatusOK,
+		},
+		{
+			name:    "null name",
+			caller:  adaID,
+			target:  adaID,
+			body:    map[string]any{"name": nil},
+			ifMatch: `"1"`,
+			status:  http.StatusBadRequest,
+			code:    apperror.CodeValidationFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			header := map[string]string{}
+			if tt.ifMatch != "" {
+				header["If-Match"] = tt.ifMatch
+			}
+			res := f.do(t, request{method: http.MethodPatch, path: path("/users", tt.target), caller: tt.caller, body: tt.body, header: header})
+			res.expect(t, tt.status, tt.code)
+
+			stored, err := f.users.FindByID(context.Background(), tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.status != http.StatusOK {
+				if stored.Version != 1 {
+					t.Errorf("refused update saved the user at version %d", stored.Version)
+				}
+				return
+			}
+			if stored.Version != 2 || res.Header.Get("ETag") != `"2"` {
+				t.Errorf("user at version %d with ETag %s, want 2 and \"2\"", stored.Version, res.Header.Get("ETag"))
+			}
+			for field, value := range tt.body {
+				if got := res.data(t)[field]; got != value {
+					t.Errorf("%s = %v, want %v", field, got, value)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	f := newFixture(t)
+
+	f.do(t, request{method: http.MethodDelete, path: path("/users", graceID), caller: adaID}).expect(t, http.StatusNotFound, apperror.CodeNotFound)
+	f.do(t, request{method: http.MethodDelete, path: path("/users", graceID), caller: adminID}).expect(t, http.StatusOK, "")
+	f.do(t, request{method: http.MethodGet, path: path("/users", graceID), caller: adminID}).expect(t, http.StatusNotFound, apperror.CodeNotFound)
+	f.do(t, request{method: http.MethodDelete, path: path("/users", graceID), caller: adminID}).expect(t, http.StatusNotFound, apperror.CodeNotFound)
+}
+
+func TestDeleteUserCancelsSubscriptions(t *testing.T) {
+	f := newFixture(t)
+	f.do(t, request{method: http.MethodPost, path: "/subscriptions/subscribe", caller: adaID, body: map[string]any{"plan_id": 1}}).
+		expect(t, http.StatusCreated, "")
+
+	f.do(t, request{method: http.MethodDelete, path: path("/users", adaID), caller: adaID}).expect(t, http.StatusOK, "")
+	sub, err := f.subs.FindByID(context.Background(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Active || sub.Status != models.SubscriptionStatusCancelled {
+		t.Errorf("deleted user's subscription is %s, active %v; want it cancelled", sub.Status, sub.Active)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/webhooks"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ReceivePaymentWebhook accepts event notifications from the payment provider.
+// Only events with a valid, fresh signature are stored. A 2xx response tells
+// the provider to stop redelivering, so processing failures answer 500.
+func ReceivePaymentWebhook(c *fiber.Ctx) error {
+	if len(config.Billing.WebhookSecret) == 0 {
+		return apperror.New(apperror.CodeUnavailable, "Webhooks are not configured")
+	}
+
+	payload := c.Body()
+	if err := webhooks.Verify(payload, c.Get(webhooks.SignatureHeader), config.Billing.WebhookSecret, config.Billing.WebhookTolerance, time.Now()); err != nil {
+		return apperror.BadRequest(err.Error())
+	}
+
+	event, err := webhooks.Parse(payload)
+	if err != nil {
+		return apperror.BadRequest("Invalid event payload")
+	}
+
+	stored, err := webhooks.Store(config.DB, billing.Payments.Name(), event, payload)
+	if err != nil {
+		return apperror.Internal("Could not store event", err)
+	}
+
+	if stored, err = webhooks.Process(config.DB, stored.ID, false); err != nil {
+		return apperror.Internal("Could not process event", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"received": true,
+		"status":   stored.Status,
+	})
+}
+
+// GetWebhookEvents lists stored webhook events for administrators, newest
+// first by default
+func GetWebhookEvents(c *fiber.Ctx) error {
+	q, err := webhookEventList.Parse(c.Queries())
+	if err != nil {
+		return err
+	}
+
+	var events []models.WebhookEvent
+	if err := q.Apply(config.DB.Model(&models.WebhookEvent{})).Find(&events).Error; err != nil {
+		return apperror.Internal("Could not retrieve webhook events", err)
+	}
+	return sendPage(c, listquery.NewPage(q, events))
+}
+
+// ReplayWebhookEvent processes a stored event again
+func ReplayWebhookEvent(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return apperror.BadRequest("Invalid event ID")
+	}
+
+	event, err := webhooks.Process(config.DB, uint(id), true)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return apperror.NotFound("Webhook event not found")
+	}
+	if event == nil {
+		return apperror.Internal("Could not replay webhook event", err)
+	}
+	if err != nil {
+		return apperror.Wrap(apperror.CodeUnprocessable, "Webhook event could not be processed: "+err.Error(), err)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    event,
+	})
+}
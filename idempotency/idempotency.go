@@ -0,0 +1,142 @@
+// Package idempotency stores the outcome of requests sent with an
+// idempotency key, so a client retrying a request after a timeout gets the
+// original response instead of repeating its effect.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LockTimeout is how long a claimed key stays locked without word from the
+// request holding it. A running request keeps extending its lock with Hold,
+// so a retry only takes a key over once that request has stopped, e.g.
+// because the server did.
+const LockTimeout = time.Minute
+
+// heartbeatInterval is how often Hold extends a lock
+var heartbeatInterval = LockTimeout / 3
+
+var (
+	ErrKeyReused  = errors.New("idempotency key was used for a different request")
+	ErrInProgress = errors.New("a request with this idempotency key is still in progress")
+)
+
+// Fingerprint identifies a request by its method, path and body
+func Fingerprint(method, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Claim takes key within scope for the request with the given fingerprint,
+// to be kept until ttl from now. If the key is new, expired, or was left
+// locked by a request that never finished, it returns the claimed key and
+// true; the caller handles the request and then calls Complete or Release.
+// If the same request already succeeded, it returns the stored key, with
+// its response, and false. A key in use by another request fails with
+// ErrKeyReused, and one whose request is still running with ErrInProgress.
+func Claim(db *gorm.DB, scope, key, fingerprint string, ttl time.Duration, now time.Time) (*models.IdempotencyKey, bool, error) {
+	lockedUntil := now.Add(LockTimeout)
+	claimed := models.IdempotencyKey{
+		Scope:       scope,
+		Key:         key,
+		Fingerprint: fingerprint,
+		ExpiresAt:   now.Add(ttl),
+		LockedUntil: &lockedUntil,
+	}
+
+	// Insert the key, or take over an expired or abandoned one in the same
+	// statement so two requests cannot both claim it
+	result := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "scope"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"created_at", "fingerprint", "expires_at", "locked_until", "status_code", "headers", "body"}),
+		Where: clause.Where{Exprs: []clause.Expression{gorm.Expr(
+			"idempotency_keys.expires_at <= ? OR (idempotency_keys.status_code = 0 AND idempotency_keys.locked_until <= ? AND idempotency_keys.fingerprint = ?)",
+			now, now, fingerprint,
+		)}},
+	}).Create(&claimed)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return &claimed, true, nil
+	}
+
+	var stored models.IdempotencyKey
+	err := db.Where("scope = ? AND key = ?", scope, key).First(&stored).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		// Released between the insert and the read
+		return nil, false, ErrInProgress
+	case err != nil:
+		return nil, false, err
+	case stored.Fingerprint != fingerprint:
+		return nil, false, ErrKeyReused
+	case stored.StatusCode == 0:
+		return nil, false, ErrInProgress
+	}
+	return &stored, false, nil
+}
+
+// Hold keeps a claimed key locked while its request is handled, extending
+// the lock every heartbeatInterval until the returned function is called.
+// Call that before Complete or Release.
+func Hold(db *gorm.DB, claimed *models.IdempotencyKey) (stop func()) {
+	done, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				if err := extend(db, claimed.ID, now); err != nil {
+					log.Printf("Could not extend the lock on idempotency key %d: %v", claimed.ID, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// extend pushes back the lock of a key whose request is still running
+func extend(db *gorm.DB, id uint, now time.Time) error {
+	return db.Model(&models.IdempotencyKey{}).
+		Where("id = ? AND status_code = 0", id).
+		Update("locked_until", now.Add(LockTimeout)).Error
+}
+
+// Complete stores the response of a claimed request and unlocks its key
+func Complete(db *gorm.DB, claimed *models.IdempotencyKey, statusCode int, headers map[string]string, body []byte) error {
+	claimed.StatusCode = statusCode
+	claimed.Headers = headers
+	claimed.Body = body
+	claimed.LockedUntil = nil
+	return db.Model(claimed).Select("status_code", "headers", "body", "locked_until").Updates(claimed).Error
+}
+
+// Release gives up a claimed key without storing a response, so the
+// request can be retried with it
+func Release(db *gorm.DB, claimed *models.IdempotencyKey) error {
+	return db.Delete(claimed).Error
+}
+
+// Prune deletes expired keys
+func Prune(ctx context.Context, db *gorm.DB, now time.Time) error {
+	return db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{}).Error
+}
@@ -0,0 +1,60 @@
+//go:build integration
+
+package idempotency
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/testdb"
+)
+
+func TestHoldKeepsARunningRequestLocked(t *testing.T) {
+	db := testdb.Open(t)
+	heartbeatInterval = 10 * time.Millisecond
+	t.Cleanup(func() { heartbeatInterval = LockTimeout / 3 })
+
+	// Claimed a lock timeout ago, so the lock lapses now unless it is held
+	claimed, ok, err := Claim(db, "user:1", "key", "fingerprint", time.Hour, time.Now().Add(-LockTimeout))
+	if err != nil || !ok {
+		t.Fatalf("Claim = %v, %v; want the key claimed", ok, err)
+	}
+
+	stop := Hold(db, claimed)
+	time.Sleep(5 * heartbeatInterval)
+	if _, _, err := Claim(db, "user:1", "key", "fingerprint", time.Hour, time.Now()); !errors.Is(err, ErrInProgress) {
+		t.Fatalf("retry while held: err = %v, want ErrInProgress", err)
+	}
+	stop()
+
+	// Once nothing holds it, a retry after the lock timeout takes it over
+	if _, ok, err := Claim(db, "user:1", "key", "fingerprint", time.Hour, time.Now().Add(2*LockTimeout)); err != nil || !ok {
+		t.Fatalf("retry after the request stopped = %v, %v; want the key claimed", ok, err)
+	}
+}
+
+func TestHoldNeverRelocksACompletedKey(t *testing.T) {
+	db := testdb.Open(t)
+	heartbeatInterval = 10 * time.Millisecond
+	t.Cleanup(func() { heartbeatInterval = LockTimeout / 3 })
+
+	claimed, _, err := Claim(db, "user:1", "key", "fingerprint", time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := Hold(db, claimed)
+	if err := Complete(db, claimed, 201, nil, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * heartbeatInterval)
+	stop()
+
+	stored, ok, err := Claim(db, "user:1", "key", "fingerprint", time.Hour, time.Now())
+	if err != nil || ok {
+		t.Fatalf("Claim = %v, %v; want the stored response", ok, err)
+	}
+	if stored.LockedUntil != nil || stored.StatusCode != 201 {
+		t.Errorf("stored key is locked until %v with status %d, want unlocked with 201", stored.LockedUntil, stored.StatusCode)
+	}
+}
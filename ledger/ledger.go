@@ -0,0 +1,208 @@
+// Package ledger keeps the double-entry record of every charge, payment,
+// refund and credit. Postings are in minor units and every journal entry
+// balances to zero.
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Account codes
+const (
+	AccountCash               = "cash"
+	AccountReceivable         = "accounts_receivable" // per customer
+	AccountCustomerCredit     = "customer_credit"     // per customer
+	AccountTaxPayable         = "tax_payable"
+	AccountDeferredRevenue    = "deferred_revenue"
+	AccountRevenue            = "revenue"
+	AccountProration          = "revenue_proration"
+	AccountDiscounts          = "discounts"
+	AccountRefunds            = "refunds"
+	AccountCreditNotes        = "credit_notes"
+	AccountWriteOffs          = "write_offs"
+	AccountPromotionalCredits = "promotional_credits"
+)
+
+var accountTypes = map[string]string{
+	AccountCash:               models.AccountTypeAsset,
+	AccountReceivable:         models.AccountTypeAsset,
+	AccountCustomerCredit:     models.AccountTypeLiability,
+	AccountTaxPayable:         models.AccountTypeLiability,
+	AccountDeferredRevenue:    models.AccountTypeLiability,
+	AccountRevenue:            models.AccountTypeRevenue,
+	AccountProration:          models.AccountTypeRevenue,
+	AccountDiscounts:          models.AccountTypeRevenue,
+	AccountRefunds:            models.AccountTypeRevenue,
+	AccountCreditNotes:        models.AccountTypeRevenue,
+	AccountWriteOffs:          models.AccountTypeExpense,
+	AccountPromotionalCredits: models.AccountTypeExpense,
+}
+
+var ErrUnbalanced = errors.New("journal entry does not balance")
+
+// Line is one side of a journal entry before it is posted
+type Line struct {
+	Account string
+	UserID  uint // zero for company-wide accounts
+	Amount  int64
+}
+
+// Debit and Credit build lines from a decimal amount
+func Debit(account string, userID uint, amount float64) Line {
+	return Line{Account: account, UserID: userID, Amount: ToMinor(amount)}
+}
+
+func Credit(account string, userID uint, amount float64) Line {
+	return Line{Account: account, UserID: userID, Amount: -ToMinor(amount)}
+}
+
+// ToMinor converts a decimal amount to minor units
+func ToMinor(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// FromMinor converts minor units back to a decimal amount
+func FromMinor(amount int64) float64 {
+	return float64(amount) / 100
+}
+
+// Post records a journal entry. Entries that do not balance are rejected.
+// An event identified by source type and ID is only ever posted once; posting
+// it again returns the existing entry.
+func Post(tx *gorm.DB, currency, description, sourceType string, sourceID uint, lines ...Line) (*models.JournalEntry, error) {
+	var sum int64
+	nonZero := lines[:0:0]
+	for _, line := range lines {
+		sum += line.Amount
+		if line.Amount != 0 {
+			nonZero = append(nonZero, line)
+		}
+	}
+	if sum != 0 {
+		return nil, fmt.Errorf("%w: %s is off by %d", ErrUnbalanced, description, sum)
+	}
+
+	if sourceID != 0 {
+		var existing models.JournalEntry
+		err := tx.Where("source_type = ? AND source_id = ?", sourceType, sourceID).First(&existing).Error
+		if err == nil {
+			return &existing, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+	if len(nonZero) == 0 {
+		return nil, nil
+	}
+
+	entry := models.JournalEntry{
+		Description: description,
+		SourceType:  sourceType,
+		SourceID:    sourceID,
+		Currency:    currency,
+	}
+	for _, line := range nonZero {
+		account, err := findOrCreateAccount(tx, line.Account, line.UserID, currency)
+		if err != nil {
+			return nil, err
+		}
+		entry.Postings = append(entry.Postings, models.Posting{AccountID: account.ID, Amount: line.Amount})
+	}
+
+	if err := tx.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// Balance is the sum of every posting to an account, in minor units.
+// Asset and expense accounts carry positive balances, liability and revenue
+// accounts negative ones.
+func Balance(tx *gorm.DB, code string, userID uint, currency string) (int64, error) {
+	var balance int64
+	err := tx.Model(&models.Posting{}).
+		Joins("JOIN ledger_accounts ON ledger_accounts.id = postings.account_id").
+		Where("ledger_accounts.code = ? AND ledger_accounts.user_id = ? AND ledger_accounts.currency = ?", code, userID, currency).
+		Select("COALESCE(SUM(postings.amount), 0)").
+		Scan(&balance).Error
+	return balance, err
+}
+
+// CustomerBalance is what a customer owes and holds in one currency
+type CustomerBalance struct {
+	Currency   string  `json:"currency"`
+	Receivable float64 `json:"receivable"` // invoiced but not yet paid
+	Credit     float64 `json:"credit"`     // available to apply to future invoices
+}
+
+// CustomerBalances returns a customer's balances in every currency they have used
+func CustomerBalances(tx *gorm.DB, userID uint) ([]CustomerBalance, error) {
+	var rows []struct {
+		Code     string
+		Currency string
+		Balance  int64
+	}
+	err := tx.Model(&models.Posting{}).
+		Joins("JOIN ledger_accounts ON ledger_accounts.id = postings.account_id").
+		Where("ledger_accounts.user_id = ?", userID).
+		Group("ledger_accounts.code, ledger_accounts.currency").
+		Order("ledger_accounts.currency").
+		Select("ledger_accounts.code AS code, ledger_accounts.currency AS currency, COALESCE(SUM(postings.amount), 0) AS balance").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var balances []CustomerBalance
+	byCurrency := make(map[string]int)
+	for _, row := range rows {
+		i, ok := byCurrency[row.Currency]
+		if !ok {
+			i = len(balances)
+			byCurrency[row.Currency] = i
+			balances = append(balances, CustomerBalance{Currency: row.Currency})
+		}
+		switch row.Code {
+		case AccountReceivable:
+			balances[i].Receivable = FromMinor(row.Balance)
+		case AccountCustomerCredit:
+			balances[i].Credit = FromMinor(-row.Balance)
+		}
+	}
+	return balances, nil
+}
+
+// LockAccount locks a customer account row until the transaction ends, so
+// its balance can be read and spent without racing another transaction
+func LockAccount(tx *gorm.DB, code string, userID uint, currency string) error {
+	account, err := findOrCreateAccount(tx, code, userID, currency)
+	if err != nil {
+		return err
+	}
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.LedgerAccount{}, account.ID).Error
+}
+
+func findOrCreateAccount(tx *gorm.DB, code string, userID uint, currency string) (*models.LedgerAccount, error) {
+	accountType, ok := accountTypes[code]
+	if !ok {
+		return nil, fmt.Errorf("unknown ledger account %q", code)
+	}
+
+	account := models.LedgerAccount{Code: code, UserID: userID, Currency: currency, Type: accountType}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&account).Error; err != nil {
+		return nil, err
+	}
+	if account.ID == 0 {
+		if err := tx.Where("code = ? AND user_id = ? AND currency = ?", code, userID, currency).First(&account).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &account, nil
+}
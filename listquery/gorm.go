@@ -0,0 +1,63 @@
+package listquery
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// likeEscaper escapes the wildcards of a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Apply filters, orders and limits db to the page the query asks for. It
+// fetches one record more than the limit; pass the records found to
+// NewPage.
+func (q Query[T]) Apply(db *gorm.DB) *gorm.DB {
+	for _, condition := range q.Where {
+		column := condition.Field.Column
+		switch condition.Op {
+		case Equal:
+			db = db.Where(column+" = ?", condition.Value)
+		case Prefix:
+			db = db.Where(column+" ILIKE ?", likeEscaper.Replace(condition.Value.(string))+"%")
+		case From:
+			db = db.Where(column+" >= ?", condition.Value)
+		case Before:
+			db = db.Where(column+" < ?", condition.Value)
+		}
+	}
+
+	if q.After != nil {
+		db = db.Where(q.afterSQL())
+	}
+	for _, order := range q.Sort {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: order.Field.Column}, Desc: order.Desc})
+	}
+	if q.Offset > 0 {
+		db = db.Offset(q.Offset)
+	}
+	return db.Limit(q.Limit + 1)
+}
+
+// afterSQL matches the records that sort after q.After. For an order a, b
+// that is a > ? OR (a = ? AND b > ?), with < for descending fields.
+func (q Query[T]) afterSQL() clause.Expr {
+	var alternatives []string
+	var args []any
+	for i, order := range q.Sort {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, q.Sort[j].Field.Column+" = ?")
+			args = append(args, q.After[j])
+		}
+		op := " > ?"
+		if order.Desc {
+			op = " < ?"
+		}
+		terms = append(terms, order.Field.Column+op)
+		args = append(args, q.After[i])
+		alternatives = append(alternatives, "("+strings.Join(terms, " AND ")+")")
+	}
+	return gorm.Expr(strings.Join(alternatives, " OR "), args...)
+}
@@ -0,0 +1,363 @@
+// Package listquery reads the paging, filtering and sorting parameters of a
+// list request and applies them to a GORM query or to records in memory.
+//
+// Pages are cut with keyset cursors: a cursor holds the sort values of the
+// last record of a page, and the next page starts after it, so records added
+// or removed meanwhile never shift a page. Each listing declares a Spec of
+// the fields clients may filter and sort by; everything else is refused.
+//
+// A list request takes these query parameters:
+//
+//	limit   records per page, DefaultLimit by default and at most MaxLimit
+//	cursor  the next_cursor of the previous page
+//	sort    comma-separated fields, each prefixed with - for descending order
+//
+// plus the filters its Spec declares.
+package listquery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+)
+
+const (
+	// DefaultLimit is the page size when a request names none
+	DefaultLimit = 50
+	// MaxLimit is the largest page a listing returns
+	MaxLimit = 100
+)
+
+// tieBreaker is the field added to every sort order so no two records sort
+// alike and a cursor names exactly one position
+const tieBreaker = "id"
+
+// Field is a field of T that a listing can be filtered or sorted by
+type Field[T any] struct {
+	// Column is the database column holding the field
+	Column string
+	// Value reads the field from a record. The type it returns decides how
+	// filter and cursor values are parsed: a string, bool, integer, float or
+	// time.Time.
+	Value func(*T) any
+}
+
+// Op is how a filter compares a field with the value it is given
+type Op string
+
+const (
+	Equal  Op = "eq"     // the field equals the value
+	Prefix Op = "prefix" // the field starts with the value, ignoring case
+	From   Op = "gte"    // the field is at or after the value
+	Before Op = "lt"     // the field is before the value
+)
+
+// Filter is a query parameter that narrows a listing down by one field
+type Filter struct {
+	Field string
+	Op    Op
+}
+
+// Spec declares what a listing of T can be filtered and sorted by. Fields
+// must include "id", which breaks ties between records that sort alike.
+type Spec[T any] struct {
+	Fields map[string]Field[T]
+	// Filters maps query parameters to the filters they apply
+	Filters map[string]Filter
+	// Sorts are the fields clients may sort by
+	Sorts []string
+	// DefaultSort is the order used when a request names none, in the form
+	// of the sort parameter
+	DefaultSort string
+}
+
+// Order sorts records by a field
+type Order[T any] struct {
+	Name  string
+	Field Field[T]
+	Desc  bool
+}
+
+// Condition is a filter with the value it compares against
+type Condition[T any] struct {
+	Name  string
+	Field Field[T]
+	Op    Op
+	Value any
+}
+
+// Query is a parsed list request
+type Query[T any] struct {
+	// Limit is the page size
+	Limit int
+	// Offset skips records before the page; only legacy page-numbered
+	// listings set it
+	Offset int
+	Sort   []Order[T]
+	Where  []Condition[T]
+	// After holds the sort values of the record the page starts after, one
+	// per Order, or nil for the first page
+	After []any
+
+	fields map[string]Field[T]
+}
+
+// Pagination describes where a page sits in its listing
+type Pagination struct {
+	Limit   int  `json:"limit"`
+	HasMore bool `json:"has_more"`
+	// NextCursor is passed as cursor to fetch the next page; it is left
+	// out on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Page is one page of a listing
+type Page[T any] struct {
+	Items      []T
+	Pagination Pagination
+}
+
+// cursor is the decoded form of an opaque cursor. Sort records the order
+// the cursor was cut in, so it cannot be used with another.
+type cursor struct {
+	Sort  string            `json:"s"`
+	After []json.RawMessage `json:"a"`
+}
+
+// Parse reads a list request from its query parameters. Parameters the Spec
+// does not declare are left to the caller. Malformed values, unknown sort
+// fields and cursors cut in another order are reported as validation
+// errors.
+func (s Spec[T]) Parse(params map[string]string) (Query[T], error) {
+	q := Query[T]{Limit: DefaultLimit, fields: s.Fields}
+	if limit, err := strconv.Atoi(params["limit"]); err == nil && limit > 0 {
+		q.Limit = min(limit, MaxLimit)
+	}
+
+	var errs []apperror.FieldError
+	for _, param := range s.filterParams() {
+		filter, raw := s.Filters[param], params[param]
+		if raw == "" {
+			continue
+		}
+		field := s.field(filter.Field)
+		value, err := parseValue(field.Value(new(T)), raw)
+		if err != nil {
+			errs = append(errs, apperror.FieldError{Field: param, Code: apperror.FieldInvalid, Message: param + " " + err.Error()})
+			continue
+		}
+		q.Where = append(q.Where, Condition[T]{Name: filter.Field, Field: field, Op: filter.Op, Value: value})
+	}
+
+	sortParam := params["sort"]
+	if sortParam == "" {
+		sortParam = s.DefaultSort
+	}
+	if err := s.parseSort(&q, sortParam); err != nil {
+		errs = append(errs, *err)
+	} else if raw := params["cursor"]; raw != "" {
+		if q.After, err = s.decodeCursor(q, raw); err != nil {
+			errs = append(errs, *err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return Query[T]{}, apperror.Validation("The list request is invalid", errs...)
+	}
+	return q, nil
+}
+
+func (s Spec[T]) parseSort(q *Query[T], param string) *apperror.FieldError {
+	tied := false
+	for _, name := range strings.Split(param, ",") {
+		name = strings.TrimSpace(name)
+		desc := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		if name == "" {
+			continue
+		}
+		if !contains(s.Sorts, name) && name != tieBreaker {
+			return &apperror.FieldError{
+				Field:   "sort",
+				Code:    apperror.FieldUnsupported,
+				Message: "sort must name fields among " + strings.Join(s.Sorts, ", "),
+			}
+		}
+		q.Sort = append(q.Sort, Order[T]{Name: name, Field: s.field(name), Desc: desc})
+		if name == tieBreaker {
+			// Nothing after a unique field changes the order
+			tied = true
+			break
+		}
+	}
+	if !tied {
+		desc := len(q.Sort) > 0 && q.Sort[len(q.Sort)-1].Desc
+		q.Sort = append(q.Sort, Order[T]{Name: tieBreaker, Field: s.field(tieBreaker), Desc: desc})
+	}
+	return nil
+}
+
+func (s Spec[T]) decodeCursor(q Query[T], raw string) ([]any, *apperror.FieldError) {
+	invalid := &apperror.FieldError{Field: "cursor", Code: apperror.FieldInvalid, Message: "cursor is not one this listing issued"}
+
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, invalid
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, invalid
+	}
+	if c.Sort != sortKey(q.Sort) {
+		return nil, &apperror.FieldError{Field: "cursor", Code: apperror.FieldInvalid, Message: "cursor was issued for another sort order"}
+	}
+	if len(c.After) != len(q.Sort) {
+		return nil, invalid
+	}
+
+	after := make([]any, len(q.Sort))
+	for i, order := range q.Sort {
+		value := reflect.New(reflect.TypeOf(order.Field.Value(new(T))))
+		if err := json.Unmarshal(c.After[i], value.Interface()); err != nil {
+			return nil, invalid
+		}
+		after[i] = value.Elem().Interface()
+	}
+	return after, nil
+}
+
+// filterParams returns the filter parameters in order, so conditions and
+// errors come out the same way every time
+func (s Spec[T]) filterParams() []string {
+	params := make([]string, 0, len(s.Filters))
+	for param := range s.Filters {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	return params
+}
+
+// field looks up a field the Spec must declare
+func (s Spec[T]) field(name string) Field[T] {
+	field, ok := s.Fields[name]
+	if !ok {
+		panic(fmt.Sprintf("listquery: field %q is not declared", name))
+	}
+	return field
+}
+
+// Filter narrows the query down to records whose field equals value. It is
+// for conditions set by the server, such as the owner of the records.
+func (q *Query[T]) Filter(name string, value any) {
+	field, ok := q.fields[name]
+	if !ok {
+		panic(fmt.Sprintf("listquery: field %q is not declared", name))
+	}
+	q.Where = append(q.Where, Condition[T]{Name: name, Field: field, Op: Equal, Value: value})
+}
+
+// NewPage makes a page from the records a query found. Queries fetch one
+// record more than their limit to learn whether another page follows; that
+// record is dropped here.
+func NewPage[T any](q Query[T], items []T) Page[T] {
+	page := Page[T]{Items: items, Pagination: Pagination{Limit: q.Limit}}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if len(items) <= q.Limit {
+		return page
+	}
+
+	page.Items = items[:q.Limit]
+	page.Pagination.HasMore = true
+	page.Pagination.NextCursor = encodeCursor(q.Sort, &page.Items[q.Limit-1])
+	return page
+}
+
+func encodeCursor[T any](orders []Order[T], last *T) string {
+	c := cursor{Sort: sortKey(orders)}
+	for _, order := range orders {
+		value, err := json.Marshal(order.Field.Value(last))
+		if err != nil {
+			panic(fmt.Sprintf("listquery: cannot encode %s: %v", order.Name, err))
+		}
+		c.After = append(c.After, value)
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// sortKey writes an order in the form of the sort parameter
+func sortKey[T any](orders []Order[T]) string {
+	names := make([]string, len(orders))
+	for i, order := range orders {
+		names[i] = order.Name
+		if order.Desc {
+			names[i] = "-" + order.Name
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// parseValue parses raw into the type of sample
+func parseValue(sample any, raw string) (any, error) {
+	t := reflect.TypeOf(sample)
+	if t == reflect.TypeOf(time.Time{}) {
+		if at, err := time.Parse(time.RFC3339, raw); err == nil {
+			return at, nil
+		}
+		if day, err := time.Parse(time.DateOnly, raw); err == nil {
+			return day, nil
+		}
+		return nil, fmt.Errorf("must be an RFC 3339 time or a date")
+	}
+
+	var value any
+	var err error
+	switch t.Kind() {
+	case reflect.String:
+		value = raw
+	case reflect.Bool:
+		value, err = strconv.ParseBool(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err = strconv.ParseInt(raw, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err = strconv.ParseUint(raw, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		value, err = strconv.ParseFloat(raw, 64)
+	default:
+		panic(fmt.Sprintf("listquery: cannot filter on a %s", t))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("must be a %s", kindName(t.Kind()))
+	}
+	return reflect.ValueOf(value).Convert(t).Interface(), nil
+}
+
+func kindName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "whole number"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "non-negative whole number"
+	}
+	return "number"
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
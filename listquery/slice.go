@@ -0,0 +1,104 @@
+package listquery
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Slice applies the query to records held in memory and returns the page
+// it asks for
+func Slice[T any](items []T, q Query[T]) Page[T] {
+	var matched []T
+	for i := range items {
+		if q.matches(&items[i]) {
+			matched = append(matched, items[i])
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		return q.compare(&matched[i], q.values(&matched[j])) < 0
+	})
+
+	start := sort.Search(len(matched), func(i int) bool {
+		return q.After == nil || q.compare(&matched[i], q.After) > 0
+	})
+	matched = matched[min(start+q.Offset, len(matched)):]
+	return NewPage(q, matched[:min(q.Limit+1, len(matched))])
+}
+
+func (q Query[T]) matches(item *T) bool {
+	for _, condition := range q.Where {
+		value := condition.Field.Value(item)
+		var ok bool
+		switch condition.Op {
+		case Equal:
+			ok = compareValues(value, condition.Value) == 0
+		case Prefix:
+			ok = strings.HasPrefix(strings.ToLower(value.(string)), strings.ToLower(condition.Value.(string)))
+		case From:
+			ok = compareValues(value, condition.Value) >= 0
+		case Before:
+			ok = compareValues(value, condition.Value) < 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// values returns the sort values of a record
+func (q Query[T]) values(item *T) []any {
+	values := make([]any, len(q.Sort))
+	for i, order := range q.Sort {
+		values[i] = order.Field.Value(item)
+	}
+	return values
+}
+
+// compare returns -1, 0 or 1 as the record sorts before, with or after the
+// given sort values
+func (q Query[T]) compare(item *T, values []any) int {
+	for i, order := range q.Sort {
+		c := compareValues(order.Field.Value(item), values[i])
+		if order.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// compareValues compares two values of the same type
+func compareValues(a, b any) int {
+	if at, ok := a.(time.Time); ok {
+		return at.Compare(b.(time.Time))
+	}
+
+	x, y := reflect.ValueOf(a), reflect.ValueOf(b)
+	switch x.Kind() {
+	case reflect.String:
+		return strings.Compare(x.String(), y.String())
+	case reflect.Bool:
+		return cmp.Compare(boolInt(x.Bool()), boolInt(y.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cmp.Compare(x.Int(), y.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cmp.Compare(x.Uint(), y.Uint())
+	case reflect.Float32, reflect.Float64:
+		return cmp.Compare(x.Float(), y.Float())
+	}
+	panic(fmt.Sprintf("listquery: cannot compare a %s", x.Type()))
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
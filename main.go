@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -8,11 +9,17 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/billing"
 	"github.com/chandra-devs/subscription_app/config"
-	"github.com/chandra-devs/subscription_app/controllers"
+	"github.com/chandra-devs/subscription_app/idempotency"
+	"github.com/chandra-devs/subscription_app/migrations"
+	"github.com/chandra-devs/subscription_app/payments"
 	"github.com/chandra-devs/subscription_app/routes"
+	"github.com/chandra-devs/subscription_app/scheduler"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 )
 
 const banner = `
@@ -38,10 +45,17 @@ func main() {
 		ReadTimeout:     15 * time.Second,
 		WriteTimeout:    15 * time.Second,
 		IdleTimeout:     60 * time.Second,
+		ErrorHandler:    apperror.Handler,
 	})
 
-	// Configure CORS
-	app.Use(cors.New())
+	// Tag every request so errors can be traced in the logs
+	app.Use(requestid.New())
+
+	// Configure CORS; browsers need the ETag to send it back in If-Match,
+	// and may want to know whether a retried request was replayed
+	app.Use(cors.New(cors.Config{
+		ExposeHeaders: fiber.HeaderETag + ", Idempotent-Replayed",
+	}))
 
 	// Connect to database
 	if err := config.ConnectDB(); err != nil {
@@ -56,9 +70,59 @@ func main() {
 	// Initialize JWT configuration
 	config.InitJWTConfig()
 
+	// Initialize billing configuration
+	config.InitBillingConfig()
+
+	// Initialize API configuration
+	config.InitAPIConfig()
+
+	// Set up the payment provider
+	provider, err := payments.New(config.Billing.PaymentProvider, config.Billing.AllowFakePayments)
+	if err != nil {
+		log.Fatalf("Failed to set up payment provider: %v", err)
+	}
+	billing.Payments = provider
+
+	// Run a maintenance command instead of the server when one is given
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatalf("Command failed: %v", err)
+		}
+		return
+	}
+
+	// Bring the schema up to date when the deployment asks for it; replicas
+	// starting together wait on the migration lock
+	if os.Getenv("DB_AUTO_MIGRATE") == "true" {
+		if err := migrateOnStart(); err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+	}
+
 	// Setup routes
 	routes.SetupRoutes(app)
 
+	// Start background billing jobs
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	scheduler.Start(jobs, config.Billing.SchedulerInterval,
+		scheduler.Job{Name: "renewals", Run: func(ctx context.Context, now time.Time) error {
+			return billing.RenewDue(ctx, config.DB, now)
+		}},
+		scheduler.Job{Name: "payment-retries", Run: func(ctx context.Context, now time.Time) error {
+			return billing.RetryDuePayments(ctx, config.DB, now)
+		}},
+		scheduler.Job{Name: "grace-periods", Run: func(ctx context.Context, now time.Time) error {
+			return billing.RevokeExpiredGrace(ctx, config.DB, now)
+		}},
+		scheduler.Job{Name: "revenue-recognition", Run: func(ctx context.Context, now time.Time) error {
+			return billing.RecognizeRevenue(ctx, config.DB, now)
+		}},
+		scheduler.Job{Name: "idempotency-keys", Run: func(ctx context.Context, now time.Time) error {
+			return idempotency.Prune(ctx, config.DB, now)
+		}},
+	)
+
 	// Create channel for graceful shutdown
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
@@ -73,6 +137,7 @@ func main() {
 	// Wait for shutdown signal
 	<-shutdown
 	log.Println("Shutting down server...")
+	stopJobs()
 
 	// Cleanup and graceful shutdown
 	if err := app.Shutdown(); err != nil {
@@ -80,14 +145,14 @@ func main() {
 	}
 }
 
-// routes/setup.go - update only the SetupUserRoutes function
-func SetupUserRoutes(router fiber.Router) {
-	users := router.Group("/users")
-	users.Get("/", controllers.GetUsers)
-	users.Get("/:id", controllers.GetUser)
-	users.Post("/", controllers.CreateUser)
-	users.Put("/:id", controllers.UpdateUser)
-	users.Delete("/:id", controllers.DeleteUser) // Add the missing DELETE route
-	users.Get("/:id/subscriptions", controllers.GetUserSubscriptions)
-	users.Post("/:id/subscriptions", controllers.AddSubscription)
+func migrateOnStart() error {
+	db, err := config.DB.DB()
+	if err != nil {
+		return err
+	}
+	applied, err := migrations.Up(context.Background(), db)
+	for _, m := range applied {
+		log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+	}
+	return err
 }
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	userIDKey  = "user_id"
+	isAdminKey = "is_admin"
+)
+
+// Protected rejects requests that do not carry a valid access token
+func Protected() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, err := parseAccessToken(c.Get(fiber.HeaderAuthorization))
+		if err != nil {
+			return apperror.Unauthorized("Invalid or missing access token")
+		}
+		c.Locals(userIDKey, userID)
+		return c.Next()
+	}
+}
+
+// OptionalAuth identifies the caller when a valid access token is present
+// but lets anonymous requests through
+func OptionalAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if userID, err := parseAccessToken(c.Get(fiber.HeaderAuthorization)); err == nil {
+			c.Locals(userIDKey, userID)
+		}
+		return c.Next()
+	}
+}
+
+// UserID returns the authenticated caller's ID
+func UserID(c *fiber.Ctx) (uint, bool) {
+	userID, ok := c.Locals(userIDKey).(uint)
+	return userID, ok
+}
+
+// ActingFor returns the user a request acts on: the caller, or the user it
+// names when the caller is an administrator. It reports false when anyone
+// else names another user. It must run after Protected.
+func ActingFor(c *fiber.Ctx, requested uint) (uint, bool) {
+	callerID, _ := UserID(c)
+	if requested == 0 || requested == callerID {
+		return callerID, true
+	}
+	if !IsAdmin(c) {
+		return 0, false
+	}
+	return requested, true
+}
+
+func parseAccessToken(header string) (uint, error) {
+	tokenString, found := strings.CutPrefix(header, "Bearer ")
+	if !found || tokenString == "" {
+		return 0, errors.New("missing bearer token")
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return config.JWT.Secret, nil
+	})
+	if err != nil || !token.Valid {
+		return 0, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["type"] != "access" {
+		return 0, errors.New("not an access token")
+	}
+
+	userID, ok := claims["user_id"].(float64)
+	if !ok || userID <= 0 {
+		return 0, errors.New("invalid user claim")
+	}
+
+	return uint(userID), nil
+}
+
+// AdminOnly rejects callers that are not administrators. It must run after Protected.
+func AdminOnly() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !IsAdmin(c) {
+			return apperror.Forbidden("Administrator access required")
+		}
+		return c.Next()
+	}
+}
+
+// IsAdmin reports whether the authenticated caller has the admin role
+func IsAdmin(c *fiber.Ctx) bool {
+	if isAdmin, ok := c.Locals(isAdminKey).(bool); ok {
+		return isAdmin
+	}
+
+	userID, ok := UserID(c)
+	if !ok {
+		return false
+	}
+
+	var user models.User
+	isAdmin := config.DB.Select("role").First(&user, userID).Error == nil && user.Role == models.RoleAdmin
+	c.Locals(isAdminKey, isAdmin)
+	return isAdmin
+}
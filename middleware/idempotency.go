@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/idempotency"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// replayedHeaders are the response headers stored with a response and sent
+// again when it is replayed
+var replayedHeaders = []string{fiber.HeaderContentType, fiber.HeaderETag, fiber.HeaderLocation}
+
+// Idempotency makes POST, PUT, PATCH and DELETE requests sent with an
+// Idempotency-Key header safe to retry. The first request with a key is
+// handled as usual and, if it succeeds, its response is kept for
+// config.API.IdempotencyTTL; retries with the same key, path and body get
+// that response again instead of being handled twice. A key sent with a
+// different request is refused, as is a retry while the first request is
+// still running, however long it takes. Failed requests keep nothing, so
+// they can be retried with the same key. Keys are scoped to the caller:
+// requests without a valid access token, and responses marked
+// Cache-Control: no-store such as those carrying tokens, are never kept.
+func Idempotency() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(idempotencyKeyHeader)
+		if key == "" || !isMutating(c.Method()) {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return apperror.BadRequest("Idempotency-Key must be at most " + strconv.Itoa(maxIdempotencyKeyLength) + " characters")
+		}
+
+		// Runs ahead of Protected, so the caller is read from the token here.
+		// Anonymous callers cannot be told apart, so they would share keys.
+		userID, err := parseAccessToken(c.Get(fiber.HeaderAuthorization))
+		if err != nil {
+			return c.Next()
+		}
+		scope := "user:" + strconv.FormatUint(uint64(userID), 10)
+
+		db := config.DB.WithContext(c.UserContext())
+		fingerprint := idempotency.Fingerprint(c.Method(), c.OriginalURL(), c.Body())
+		stored, claimed, err := idempotency.Claim(db, scope, key, fingerprint, config.API.IdempotencyTTL, time.Now())
+		switch {
+		case errors.Is(err, idempotency.ErrKeyReused):
+			return apperror.New(apperror.CodeUnprocessable, "Idempotency-Key was already used for a different request")
+		case errors.Is(err, idempotency.ErrInProgress):
+			c.Set(fiber.HeaderRetryAfter, "1")
+			return apperror.Conflict("A request with this Idempotency-Key is still being processed")
+		case err != nil:
+			return apperror.Internal("Could not check the Idempotency-Key", err)
+		}
+
+		if !claimed {
+			for name, value := range stored.Headers {
+				c.Set(name, value)
+			}
+			c.Set(idempotentReplayedHeader, "true")
+			return c.Status(stored.StatusCode).Send(stored.Body)
+		}
+
+		// Keep the key locked for as long as the request runs, so a retry is
+		// refused rather than handled a second time alongside it. Render
+		// errors now so the response can be inspected.
+		stop := idempotency.Hold(db, stored)
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+		stop()
+
+		status := c.Response().StatusCode()
+		if status < fiber.StatusOK || status >= fiber.StatusMultipleChoices || noStore(c) {
+			if err := idempotency.Release(db, stored); err != nil {
+				log.Printf("Could not release idempotency key %s: %v", key, err)
+			}
+			return nil
+		}
+
+		headers := map[string]string{}
+		for _, name := range replayedHeaders {
+			if value := c.GetRespHeader(name); value != "" {
+				headers[name] = value
+			}
+		}
+		if err := idempotency.Complete(db, stored, status, headers, c.Response().Body()); err != nil {
+			log.Printf("Could not store the response for idempotency key %s: %v", key, err)
+		}
+		return nil
+	}
+}
+
+// noStore reports whether the response must not be kept, as responses
+// carrying credentials are marked
+func noStore(c *fiber.Ctx) bool {
+	for _, directive := range strings.Split(c.GetRespHeader(fiber.HeaderCacheControl), ",") {
+		if strings.EqualFold(strings.TrimSpace(directive), "no-store") {
+			return true
+		}
+	}
+	return false
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+//go:build integration
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/testdb"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// idempotentApp serves POST /orders behind Idempotency, counting how often
+// the handler runs. When gate is set the handler waits on it.
+func idempotentApp(t *testing.T, gate chan struct{}, entered chan struct{}, calls *atomic.Int32) *fiber.App {
+	t.Helper()
+	config.DB = testdb.Open(t)
+	config.InitJWTConfig()
+	config.API = &config.APIConfig{IdempotencyTTL: time.Hour}
+
+	app := fiber.New(fiber.Config{ErrorHandler: apperror.Handler})
+	app.Post("/orders", Idempotency(), func(c *fiber.Ctx) error {
+		calls.Add(1)
+		if entered != nil {
+			entered <- struct{}{}
+		}
+		if gate != nil {
+			<-gate
+		}
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true})
+	})
+	return app
+}
+
+func accessToken(t *testing.T, userID uint) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"exp":     time.Now().Add(time.Hour).Unix(),
+		"type":    "access",
+	}).SignedString(config.JWT.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + token
+}
+
+func orderRequest(authorization, key string) *http.Request {
+	req := httptest.NewRequest(fiber.MethodPost, "/orders", nil)
+	req.Header.Set(idempotencyKeyHeader, key)
+	if authorization != "" {
+		req.Header.Set(fiber.HeaderAuthorization, authorization)
+	}
+	return req
+}
+
+func TestIdempotencyRefusesADuplicateWhileTheFirstRuns(t *testing.T) {
+	var calls atomic.Int32
+	gate, entered := make(chan struct{}), make(chan struct{}, 1)
+	app := idempotentApp(t, gate, entered, &calls)
+	token := accessToken(t, 1)
+
+	first := make(chan *http.Response, 1)
+	go func() {
+		resp, err := app.Test(orderRequest(token, "order-1"), -1)
+		if err != nil {
+			t.Error(err)
+		}
+		first <- resp
+	}()
+	<-entered
+
+	resp, err := app.Test(orderRequest(token, "order-1"), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusConflict || resp.Header.Get(fiber.HeaderRetryAfter) == "" {
+		t.Errorf("duplicate while running: status %d, Retry-After %q; want 409 with Retry-After", resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+
+	close(gate)
+	if resp := <-first; resp == nil || resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("first request did not succeed: %v", resp)
+	}
+
+	resp, err = app.Test(orderRequest(token, "order-1"), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusCreated || resp.Header.Get(idempotentReplayedHeader) != "true" {
+		t.Errorf("retry after completion: status %d, replayed %q; want the stored 201", resp.StatusCode, resp.Header.Get(idempotentReplayedHeader))
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("handler ran %d times, want once", n)
+	}
+}
+
+func TestIdempotencyKeepsNothingForAnonymousCallers(t *testing.T) {
+	var calls atomic.Int32
+	app := idempotentApp(t, nil, nil, &calls)
+
+	for i := 0; i < 2; i++ {
+		resp, err := app.Test(orderRequest("", "order-1"), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusCreated || resp.Header.Get(idempotentReplayedHeader) != "" {
+			t.Errorf("anonymous request %d: status %d, replayed %q; want it handled", i, resp.StatusCode, resp.Header.Get(idempotentReplayedHeader))
+		}
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("handler ran %d times, want twice", n)
+	}
+
+	var stored int64
+	config.DB.Model(&models.IdempotencyKey{}).Count(&stored)
+	if stored != 0 {
+		t.Errorf("%d keys stored for anonymous requests, want none", stored)
+	}
+}
+
+func TestIdempotencyNeverKeepsNoStoreResponses(t *testing.T) {
+	config.DB = testdb.Open(t)
+	config.InitJWTConfig()
+	config.API = &config.APIConfig{IdempotencyTTL: time.Hour}
+
+	app := fiber.New(fiber.Config{ErrorHandler: apperror.Handler})
+	app.Post("/orders", Idempotency(), func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		return c.JSON(fiber.Map{"access_token": "secret"})
+	})
+
+	resp, err := app.Test(orderRequest(accessToken(t, 1), "order-1"), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status %d, want 200", resp.StatusCode)
+	}
+
+	var stored int64
+	config.DB.Model(&models.IdempotencyKey{}).Count(&stored)
+	if stored != 0 {
+		t.Errorf("%d keys stored for a no-store response, want none", stored)
+	}
+}
@@ -0,0 +1,57 @@
+CREATE TABLE users (
+    id                        BIGSERIAL PRIMARY KEY,
+    created_at                TIMESTAMPTZ,
+    updated_at                TIMESTAMPTZ,
+    deleted_at                TIMESTAMPTZ,
+    name                      VARCHAR(255) NOT NULL,
+    email                     VARCHAR(255) NOT NULL CONSTRAINT uni_users_email UNIQUE,
+    password                  VARCHAR(255) NOT NULL,
+    role                      VARCHAR(20) NOT NULL DEFAULT 'user',
+    billing_company_name      VARCHAR(255),
+    billing_email             VARCHAR(255),
+    billing_address_line1     VARCHAR(255),
+    billing_address_line2     VARCHAR(255),
+    billing_city              VARCHAR(100),
+    billing_postal_code       VARCHAR(20),
+    billing_region            VARCHAR(10),
+    billing_country           VARCHAR(2),
+    billing_tax_id            VARCHAR(20),
+    billing_currency          VARCHAR(3),
+    billing_locale            VARCHAR(10),
+    payment_customer_id       VARCHAR(255),
+    default_payment_method_id VARCHAR(255)
+);
+
+CREATE TABLE plans (
+    id             BIGSERIAL PRIMARY KEY,
+    created_at     TIMESTAMPTZ,
+    updated_at     TIMESTAMPTZ,
+    deleted_at     TIMESTAMPTZ,
+    name           VARCHAR(255) NOT NULL CONSTRAINT uni_plans_name UNIQUE,
+    description    VARCHAR(1000),
+    price          NUMERIC NOT NULL,
+    duration       BIGINT NOT NULL,
+    interval_unit  VARCHAR(10),
+    interval_count BIGINT
+);
+
+CREATE TABLE subscriptions (
+    id                   BIGSERIAL PRIMARY KEY,
+    created_at           TIMESTAMPTZ,
+    updated_at           TIMESTAMPTZ,
+    deleted_at           TIMESTAMPTZ,
+    user_id              BIGINT NOT NULL CONSTRAINT fk_users_subscriptions REFERENCES users (id),
+    plan_id              BIGINT NOT NULL CONSTRAINT fk_subscriptions_plan REFERENCES plans (id),
+    status               VARCHAR(50) NOT NULL,
+    start_date           TIMESTAMPTZ,
+    expires_at           TIMESTAMPTZ,
+    active               BOOLEAN DEFAULT TRUE,
+    billing_cycle_anchor TIMESTAMPTZ,
+    current_period_start TIMESTAMPTZ,
+    currency             VARCHAR(3),
+    past_due_since       TIMESTAMPTZ,
+    ended_at             TIMESTAMPTZ
+);
+
+CREATE INDEX idx_subscriptions_user_id ON subscriptions (user_id);
+CREATE INDEX idx_subscriptions_status_expires_at ON subscriptions (status, expires_at);
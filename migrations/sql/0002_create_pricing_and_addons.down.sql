@@ -0,0 +1,4 @@
+DROP TABLE subscription_events;
+DROP TABLE subscription_add_ons;
+DROP TABLE add_ons;
+DROP TABLE plan_prices;
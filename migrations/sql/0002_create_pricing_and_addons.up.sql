@@ -0,0 +1,50 @@
+CREATE TABLE plan_prices (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    plan_id    BIGINT NOT NULL CONSTRAINT fk_plans_prices REFERENCES plans (id),
+    currency   VARCHAR(3) NOT NULL,
+    country    VARCHAR(2) NOT NULL DEFAULT '',
+    amount     NUMERIC NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_plan_prices_plan_currency_country ON plan_prices (plan_id, currency, country);
+
+CREATE TABLE add_ons (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ,
+    deleted_at  TIMESTAMPTZ,
+    name        VARCHAR(255) NOT NULL CONSTRAINT uni_add_ons_name UNIQUE,
+    description VARCHAR(1000),
+    price       NUMERIC NOT NULL,
+    currency    VARCHAR(3) NOT NULL
+);
+
+CREATE TABLE subscription_add_ons (
+    id              BIGSERIAL PRIMARY KEY,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    subscription_id BIGINT NOT NULL CONSTRAINT fk_subscriptions_add_ons REFERENCES subscriptions (id),
+    add_on_id       BIGINT NOT NULL CONSTRAINT fk_subscription_add_ons_add_on REFERENCES add_ons (id),
+    quantity        BIGINT NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_subscription_addons_subscription_addon ON subscription_add_ons (subscription_id, add_on_id);
+
+CREATE TABLE subscription_events (
+    id              BIGSERIAL PRIMARY KEY,
+    created_at      TIMESTAMPTZ,
+    subscription_id BIGINT NOT NULL,
+    type            VARCHAR(50) NOT NULL,
+    from_status     VARCHAR(50),
+    to_status       VARCHAR(50),
+    from_plan_id    BIGINT,
+    to_plan_id      BIGINT,
+    invoice_id      BIGINT,
+    message         VARCHAR(500)
+);
+
+CREATE INDEX idx_subscription_events_subscription_id ON subscription_events (subscription_id);
+CREATE INDEX idx_subscription_events_created_at ON subscription_events (created_at);
@@ -0,0 +1,5 @@
+DROP TABLE credit_notes;
+DROP TABLE refunds;
+DROP TABLE invoice_sequences;
+DROP TABLE invoice_line_items;
+DROP TABLE invoices;
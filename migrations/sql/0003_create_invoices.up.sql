@@ -0,0 +1,110 @@
+CREATE TABLE invoices (
+    id                      BIGSERIAL PRIMARY KEY,
+    created_at              TIMESTAMPTZ,
+    updated_at              TIMESTAMPTZ,
+    deleted_at              TIMESTAMPTZ,
+    number                  VARCHAR(32),
+    user_id                 BIGINT NOT NULL,
+    subscription_id         BIGINT,
+    status                  VARCHAR(20) NOT NULL,
+    billing_reason          VARCHAR(50) NOT NULL,
+    currency                VARCHAR(3) NOT NULL,
+    subtotal                NUMERIC NOT NULL,
+    tax                     NUMERIC NOT NULL DEFAULT 0,
+    reverse_charge          BOOLEAN NOT NULL DEFAULT FALSE,
+    total                   NUMERIC NOT NULL,
+    amount_paid             NUMERIC NOT NULL DEFAULT 0,
+    amount_due              NUMERIC NOT NULL,
+    credit_applied          NUMERIC NOT NULL DEFAULT 0,
+    amount_credited         NUMERIC NOT NULL DEFAULT 0,
+    amount_refunded         NUMERIC NOT NULL DEFAULT 0,
+    period_start            TIMESTAMPTZ,
+    period_end              TIMESTAMPTZ,
+    issued_at               TIMESTAMPTZ,
+    due_at                  TIMESTAMPTZ,
+    paid_at                 TIMESTAMPTZ,
+    voided_at               TIMESTAMPTZ,
+    charge_id               VARCHAR(255),
+    payment_attempts        BIGINT NOT NULL DEFAULT 0,
+    last_payment_error      VARCHAR(500),
+    dunning_retries         BIGINT NOT NULL DEFAULT 0,
+    next_payment_attempt_at TIMESTAMPTZ,
+    customer_name           VARCHAR(255),
+    customer_company_name   VARCHAR(255),
+    customer_email          VARCHAR(255),
+    customer_address_line1  VARCHAR(255),
+    customer_address_line2  VARCHAR(255),
+    customer_city           VARCHAR(100),
+    customer_postal_code    VARCHAR(20),
+    customer_region         VARCHAR(10),
+    customer_country        VARCHAR(2),
+    customer_tax_id         VARCHAR(20),
+    customer_currency       VARCHAR(3),
+    customer_locale         VARCHAR(10)
+);
+
+CREATE UNIQUE INDEX idx_invoices_number ON invoices (number) WHERE number <> '';
+CREATE INDEX idx_invoices_user_id ON invoices (user_id);
+CREATE INDEX idx_invoices_subscription_id ON invoices (subscription_id);
+CREATE INDEX idx_invoices_charge_id ON invoices (charge_id);
+CREATE INDEX idx_invoices_next_payment_attempt_at ON invoices (next_payment_attempt_at);
+
+CREATE TABLE invoice_line_items (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ,
+    invoice_id   BIGINT NOT NULL CONSTRAINT fk_invoices_line_items REFERENCES invoices (id),
+    description  VARCHAR(500) NOT NULL,
+    plan_id      BIGINT,
+    add_on_id    BIGINT,
+    discount_id  BIGINT,
+    quantity     BIGINT NOT NULL DEFAULT 1,
+    unit_amount  NUMERIC NOT NULL,
+    amount       NUMERIC NOT NULL,
+    proration    BOOLEAN NOT NULL DEFAULT FALSE,
+    period_start TIMESTAMPTZ,
+    period_end   TIMESTAMPTZ
+);
+
+CREATE INDEX idx_invoice_line_items_invoice_id ON invoice_line_items (invoice_id);
+
+CREATE TABLE invoice_sequences (
+    prefix      VARCHAR(10),
+    year        BIGINT,
+    last_number BIGINT NOT NULL,
+    PRIMARY KEY (prefix, year)
+);
+
+CREATE TABLE refunds (
+    id                 BIGSERIAL PRIMARY KEY,
+    created_at         TIMESTAMPTZ,
+    updated_at         TIMESTAMPTZ,
+    invoice_id         BIGINT NOT NULL,
+    user_id            BIGINT NOT NULL,
+    amount             NUMERIC NOT NULL,
+    currency           VARCHAR(3) NOT NULL,
+    reason             VARCHAR(50) NOT NULL,
+    approved_by_id     BIGINT NOT NULL,
+    provider_refund_id VARCHAR(255) NOT NULL
+);
+
+CREATE INDEX idx_refunds_invoice_id ON refunds (invoice_id);
+CREATE INDEX idx_refunds_user_id ON refunds (user_id);
+
+CREATE TABLE credit_notes (
+    id             BIGSERIAL PRIMARY KEY,
+    created_at     TIMESTAMPTZ,
+    updated_at     TIMESTAMPTZ,
+    number         VARCHAR(32) NOT NULL CONSTRAINT uni_credit_notes_number UNIQUE,
+    invoice_id     BIGINT NOT NULL CONSTRAINT fk_invoices_credit_notes REFERENCES invoices (id),
+    user_id        BIGINT NOT NULL,
+    amount         NUMERIC NOT NULL,
+    currency       VARCHAR(3) NOT NULL,
+    reason         VARCHAR(50) NOT NULL,
+    memo           VARCHAR(1000),
+    approved_by_id BIGINT NOT NULL,
+    refund_id      BIGINT CONSTRAINT fk_credit_notes_refund REFERENCES refunds (id)
+);
+
+CREATE INDEX idx_credit_notes_invoice_id ON credit_notes (invoice_id);
+CREATE INDEX idx_credit_notes_user_id ON credit_notes (user_id);
@@ -0,0 +1,16 @@
+CREATE TABLE webhook_events (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ,
+    updated_at   TIMESTAMPTZ,
+    provider     VARCHAR(50) NOT NULL,
+    event_id     VARCHAR(255) NOT NULL,
+    type         VARCHAR(100) NOT NULL,
+    payload      TEXT NOT NULL,
+    status       VARCHAR(20) NOT NULL,
+    attempts     BIGINT NOT NULL DEFAULT 0,
+    last_error   VARCHAR(1000),
+    processed_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_webhook_events_provider_event ON webhook_events (provider, event_id);
+CREATE INDEX idx_webhook_events_status ON webhook_events (status);
@@ -0,0 +1,32 @@
+CREATE TABLE ledger_accounts (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    code       VARCHAR(50) NOT NULL,
+    user_id    BIGINT NOT NULL DEFAULT 0,
+    currency   VARCHAR(3) NOT NULL,
+    type       VARCHAR(20) NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_ledger_accounts_code_user_currency ON ledger_accounts (code, user_id, currency);
+
+CREATE TABLE journal_entries (
+    id          BIGSERIAL PRIMARY KEY,
+    created_at  TIMESTAMPTZ,
+    description VARCHAR(500) NOT NULL,
+    source_type VARCHAR(50) NOT NULL,
+    source_id   BIGINT NOT NULL,
+    currency    VARCHAR(3) NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_journal_entries_source ON journal_entries (source_type, source_id) WHERE source_id <> 0;
+CREATE INDEX idx_journal_entries_created_at ON journal_entries (created_at);
+
+CREATE TABLE postings (
+    id               BIGSERIAL PRIMARY KEY,
+    journal_entry_id BIGINT NOT NULL CONSTRAINT fk_journal_entries_postings REFERENCES journal_entries (id),
+    account_id       BIGINT NOT NULL CONSTRAINT fk_postings_account REFERENCES ledger_accounts (id),
+    amount           BIGINT NOT NULL
+);
+
+CREATE INDEX idx_postings_journal_entry_id ON postings (journal_entry_id);
+CREATE INDEX idx_postings_account_id ON postings (account_id);
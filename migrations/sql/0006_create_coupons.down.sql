@@ -0,0 +1,4 @@
+DROP TABLE discounts;
+DROP TABLE promotion_code_plans;
+DROP TABLE promotion_codes;
+DROP TABLE coupons;
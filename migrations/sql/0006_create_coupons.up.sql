@@ -0,0 +1,47 @@
+CREATE TABLE coupons (
+    id                  BIGSERIAL PRIMARY KEY,
+    created_at          TIMESTAMPTZ,
+    updated_at          TIMESTAMPTZ,
+    deleted_at          TIMESTAMPTZ,
+    name                VARCHAR(255) NOT NULL,
+    percent_off         NUMERIC,
+    amount_off          NUMERIC,
+    currency            VARCHAR(3),
+    duration            VARCHAR(20) NOT NULL,
+    duration_in_periods BIGINT
+);
+
+CREATE TABLE promotion_codes (
+    id              BIGSERIAL PRIMARY KEY,
+    created_at      TIMESTAMPTZ,
+    updated_at      TIMESTAMPTZ,
+    code            VARCHAR(50) NOT NULL,
+    coupon_id       BIGINT NOT NULL CONSTRAINT fk_promotion_codes_coupon REFERENCES coupons (id),
+    active          BOOLEAN NOT NULL DEFAULT TRUE,
+    max_redemptions BIGINT,
+    times_redeemed  BIGINT NOT NULL DEFAULT 0,
+    expires_at      TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_promotion_codes_code ON promotion_codes (code);
+CREATE INDEX idx_promotion_codes_coupon_id ON promotion_codes (coupon_id);
+
+CREATE TABLE promotion_code_plans (
+    promotion_code_id BIGINT CONSTRAINT fk_promotion_code_plans_promotion_code REFERENCES promotion_codes (id),
+    plan_id           BIGINT CONSTRAINT fk_promotion_code_plans_plan REFERENCES plans (id),
+    PRIMARY KEY (promotion_code_id, plan_id)
+);
+
+CREATE TABLE discounts (
+    id                BIGSERIAL PRIMARY KEY,
+    created_at        TIMESTAMPTZ,
+    subscription_id   BIGINT NOT NULL CONSTRAINT fk_subscriptions_discount REFERENCES subscriptions (id),
+    coupon_id         BIGINT NOT NULL CONSTRAINT fk_discounts_coupon REFERENCES coupons (id),
+    promotion_code_id BIGINT CONSTRAINT fk_discounts_promotion_code REFERENCES promotion_codes (id),
+    periods_remaining BIGINT,
+    ended_at          TIMESTAMPTZ
+);
+
+-- A subscription has at most one discount in effect
+CREATE UNIQUE INDEX idx_discounts_subscription ON discounts (subscription_id) WHERE ended_at IS NULL;
+CREATE INDEX idx_discounts_coupon_id ON discounts (coupon_id);
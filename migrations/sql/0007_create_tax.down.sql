@@ -0,0 +1,2 @@
+DROP TABLE invoice_taxes;
+DROP TABLE tax_rates;
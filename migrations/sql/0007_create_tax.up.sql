@@ -0,0 +1,30 @@
+CREATE TABLE tax_rates (
+    id         BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    country    VARCHAR(2) NOT NULL,
+    region     VARCHAR(10) NOT NULL DEFAULT '',
+    name       VARCHAR(50) NOT NULL,
+    percentage NUMERIC NOT NULL,
+    inclusive  BOOLEAN NOT NULL DEFAULT FALSE,
+    active     BOOLEAN NOT NULL DEFAULT TRUE
+);
+
+CREATE UNIQUE INDEX idx_tax_rates_country_region ON tax_rates (country, region);
+
+CREATE TABLE invoice_taxes (
+    id             BIGSERIAL PRIMARY KEY,
+    created_at     TIMESTAMPTZ,
+    invoice_id     BIGINT NOT NULL CONSTRAINT fk_invoices_taxes REFERENCES invoices (id),
+    tax_rate_id    BIGINT,
+    name           VARCHAR(50) NOT NULL,
+    country        VARCHAR(2) NOT NULL,
+    region         VARCHAR(10),
+    percentage     NUMERIC NOT NULL,
+    inclusive      BOOLEAN NOT NULL DEFAULT FALSE,
+    taxable_amount NUMERIC NOT NULL,
+    amount         NUMERIC NOT NULL,
+    reverse_charge BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX idx_invoice_taxes_invoice_id ON invoice_taxes (invoice_id);
@@ -0,0 +1,2 @@
+DROP TABLE revenue_schedule_entries;
+DROP TABLE revenue_schedules;
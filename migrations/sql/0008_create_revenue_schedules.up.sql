@@ -0,0 +1,32 @@
+CREATE TABLE revenue_schedules (
+    id              BIGSERIAL PRIMARY KEY,
+    created_at      TIMESTAMPTZ,
+    invoice_id      BIGINT NOT NULL,
+    line_item_id    BIGINT NOT NULL,
+    subscription_id BIGINT,
+    user_id         BIGINT NOT NULL,
+    currency        VARCHAR(3) NOT NULL,
+    amount          NUMERIC NOT NULL,
+    period_start    TIMESTAMPTZ,
+    period_end      TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX idx_revenue_schedules_line_item_id ON revenue_schedules (line_item_id);
+CREATE INDEX idx_revenue_schedules_invoice_id ON revenue_schedules (invoice_id);
+CREATE INDEX idx_revenue_schedules_subscription_id ON revenue_schedules (subscription_id);
+CREATE INDEX idx_revenue_schedules_user_id ON revenue_schedules (user_id);
+CREATE INDEX idx_revenue_schedules_created_at ON revenue_schedules (created_at);
+
+CREATE TABLE revenue_schedule_entries (
+    id            BIGSERIAL PRIMARY KEY,
+    created_at    TIMESTAMPTZ,
+    updated_at    TIMESTAMPTZ,
+    schedule_id   BIGINT NOT NULL CONSTRAINT fk_revenue_schedules_entries REFERENCES revenue_schedules (id),
+    month         DATE NOT NULL,
+    amount        NUMERIC NOT NULL,
+    recognized_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_revenue_schedule_entries_schedule_id ON revenue_schedule_entries (schedule_id);
+CREATE INDEX idx_revenue_schedule_entries_month ON revenue_schedule_entries (month);
+CREATE INDEX idx_revenue_schedule_entries_recognized_at ON revenue_schedule_entries (recognized_at);
@@ -0,0 +1,8 @@
+DROP TRIGGER subscriptions_bump_version ON subscriptions;
+DROP TRIGGER plans_bump_version ON plans;
+DROP TRIGGER users_bump_version ON users;
+DROP FUNCTION bump_version();
+
+ALTER TABLE subscriptions DROP COLUMN version;
+ALTER TABLE plans DROP COLUMN version;
+ALTER TABLE users DROP COLUMN version;
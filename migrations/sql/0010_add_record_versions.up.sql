@@ -0,0 +1,19 @@
+ALTER TABLE users ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE plans ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+ALTER TABLE subscriptions ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
+
+-- Every update bumps the version, whichever code path makes it, so an ETag
+-- always changes with the record
+CREATE FUNCTION bump_version() RETURNS trigger AS $$
+BEGIN
+    NEW.version := OLD.version + 1;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_bump_version BEFORE UPDATE ON users
+    FOR EACH ROW EXECUTE FUNCTION bump_version();
+CREATE TRIGGER plans_bump_version BEFORE UPDATE ON plans
+    FOR EACH ROW EXECUTE FUNCTION bump_version();
+CREATE TRIGGER subscriptions_bump_version BEFORE UPDATE ON subscriptions
+    FOR EACH ROW EXECUTE FUNCTION bump_version();
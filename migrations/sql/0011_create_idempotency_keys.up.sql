@@ -0,0 +1,15 @@
+CREATE TABLE idempotency_keys (
+    id           BIGSERIAL PRIMARY KEY,
+    created_at   TIMESTAMPTZ,
+    scope        VARCHAR(50) NOT NULL,
+    key          VARCHAR(255) NOT NULL,
+    fingerprint  VARCHAR(64) NOT NULL,
+    expires_at   TIMESTAMPTZ NOT NULL,
+    locked_until TIMESTAMPTZ,
+    status_code  INTEGER NOT NULL DEFAULT 0,
+    headers      TEXT,
+    body         BYTEA
+);
+
+CREATE UNIQUE INDEX idx_idempotency_keys_scope_key ON idempotency_keys (scope, key);
+CREATE INDEX idx_idempotency_keys_expires_at ON idempotency_keys (expires_at);
@@ -0,0 +1 @@
+DROP INDEX idx_subscriptions_active_user_id;
@@ -0,0 +1,4 @@
+-- A user holds at most one active subscription. Creating the index fails if
+-- a user already has several; end the extra ones first.
+CREATE UNIQUE INDEX idx_subscriptions_active_user_id ON subscriptions (user_id)
+    WHERE active AND deleted_at IS NULL;
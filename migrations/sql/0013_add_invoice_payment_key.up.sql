@@ -0,0 +1,3 @@
+-- The idempotency key of an invoice's collection in progress, kept across
+-- attempts until the provider declines one
+ALTER TABLE invoices ADD COLUMN payment_key VARCHAR(64) NOT NULL DEFAULT '';
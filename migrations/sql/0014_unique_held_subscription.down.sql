@@ -0,0 +1,2 @@
+DROP INDEX idx_subscriptions_held_user_id;
+CREATE UNIQUE INDEX idx_subscriptions_active_user_id ON subscriptions (user_id) WHERE active AND deleted_at IS NULL;
@@ -0,0 +1,5 @@
+-- A subscription waiting on its first payment holds the user's one
+-- subscription just as an active one does
+DROP INDEX idx_subscriptions_active_user_id;
+CREATE UNIQUE INDEX idx_subscriptions_held_user_id ON subscriptions (user_id)
+    WHERE (active OR status = 'incomplete') AND deleted_at IS NULL;
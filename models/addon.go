@@ -0,0 +1,37 @@
+// models/addon.go
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AddOn represents an optional extra that can be attached to a subscription
+// @Description Add-on information
+type AddOn struct {
+	// Standard fields from gorm.Model
+	ID        uint           `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time      `json:"created_at" example:"2024-01-01T00:00:00Z"`
+	UpdatedAt time.Time      `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" swaggertype:"string" format:"date-time"`
+
+	// Add-on specific fields
+	Name        string  `json:"name" gorm:"size:255;not null;unique" example:"Extra Seat"`
+	Description string  `json:"description" gorm:"size:1000" example:"One additional team member"`
+	Price       float64 `json:"price" gorm:"not null" example:"5.00"` // per unit and billing period
+	Currency    string  `json:"currency" gorm:"size:3;not null" example:"USD"`
+}
+
+// SubscriptionAddOn represents the quantity of an add-on on a subscription
+// @Description Subscription add-on
+type SubscriptionAddOn struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2024-01-01T00:00:00Z"`
+	UpdatedAt time.Time `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+
+	SubscriptionID uint  `json:"subscription_id" gorm:"not null;uniqueIndex:idx_subscription_addons_subscription_addon" example:"1"`
+	AddOnID        uint  `json:"addon_id" gorm:"not null;uniqueIndex:idx_subscription_addons_subscription_addon" example:"1"`
+	AddOn          AddOn `json:"addon,omitempty" gorm:"foreignKey:AddOnID"`
+	Quantity       int   `json:"quantity" gorm:"not null" example:"2"`
+}
@@ -0,0 +1,32 @@
+// models/audit_log.go
+package models
+
+import (
+	"time"
+
+	"github.com/chandra-devs/subscription_app/patch"
+)
+
+// Audited record types
+const (
+	AuditEntityUser         = "user"
+	AuditEntityPlan         = "plan"
+	AuditEntitySubscription = "subscription"
+)
+
+// AuditActionUpdate is recorded when a record's fields are changed
+const AuditActionUpdate = "update"
+
+// AuditLog records who changed which fields of a record, and from what
+// @Description Audit trail entry
+type AuditLog struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" gorm:"index" example:"2024-01-01T00:00:00Z"`
+
+	// ActorID is the user who made the change; nil for unauthenticated requests
+	ActorID    *uint         `json:"actor_id,omitempty" gorm:"index" example:"1"`
+	EntityType string        `json:"entity_type" gorm:"size:50;not null;index:idx_audit_logs_entity" example:"user"`
+	EntityID   uint          `json:"entity_id" gorm:"not null;index:idx_audit_logs_entity" example:"2"`
+	Action     string        `json:"action" gorm:"size:50;not null" example:"update"`
+	Changes    patch.Changes `json:"changes" gorm:"type:text;not null;serializer:json" swaggertype:"object"`
+}
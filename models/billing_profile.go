@@ -0,0 +1,31 @@
+// models/billing_profile.go
+package models
+
+// BillingProfile holds the details a customer is invoiced under. Users
+// store it with the column prefix billing_; invoices keep a copy taken when
+// they are issued, prefixed customer_.
+// @Description Billing profile
+type BillingProfile struct {
+	CompanyName  string `json:"company_name,omitempty" gorm:"size:255" example:"Acme GmbH"`
+	Email        string `json:"email,omitempty" gorm:"size:255" example:"accounts@acme.example"` // overrides the account email for billing
+	AddressLine1 string `json:"address_line1,omitempty" gorm:"size:255" example:"Hauptstrasse 1"`
+	AddressLine2 string `json:"address_line2,omitempty" gorm:"size:255" example:""`
+	City         string `json:"city,omitempty" gorm:"size:100" example:"Munich"`
+	PostalCode   string `json:"postal_code,omitempty" gorm:"size:20" example:"80331"`
+	Region       string `json:"region,omitempty" gorm:"size:10" example:"BY"`
+	Country      string `json:"country,omitempty" gorm:"size:2" example:"DE"`
+	// VAT or other tax registration number; a valid EU VAT ID triggers reverse charge
+	TaxID    string `json:"tax_id,omitempty" gorm:"size:20" example:"DE123456789"`
+	Currency string `json:"currency,omitempty" gorm:"size:3" example:"EUR"`
+	Locale   string `json:"locale,omitempty" gorm:"size:10" example:"de-DE"`
+}
+
+// BillingProfileColumns lists the columns of a billing profile stored under
+// a column prefix, for selective updates
+func BillingProfileColumns(prefix string) []string {
+	columns := []string{"company_name", "email", "address_line1", "address_line2", "city", "postal_code", "region", "country", "tax_id", "currency", "locale"}
+	for i, column := range columns {
+		columns[i] = prefix + column
+	}
+	return columns
+}
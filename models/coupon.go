@@ -0,0 +1,74 @@
+// models/coupon.go
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// How long a coupon's discount lasts once applied
+const (
+	CouponDurationOnce      = "once"
+	CouponDurationRepeating = "repeating"
+	CouponDurationForever   = "forever"
+)
+
+// Coupon represents a discount that can be applied to subscriptions. It
+// takes either a percentage or a fixed amount off each discounted invoice.
+// @Description Coupon information
+type Coupon struct {
+	// Standard fields from gorm.Model
+	ID        uint           `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time      `json:"created_at" example:"2024-01-01T00:00:00Z"`
+	UpdatedAt time.Time      `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" swaggertype:"string" format:"date-time"`
+
+	// Coupon specific fields
+	Name       string  `json:"name" gorm:"size:255;not null" example:"Spring sale"`
+	PercentOff float64 `json:"percent_off,omitempty" example:"20"`
+	AmountOff  float64 `json:"amount_off,omitempty" example:"5.00"`
+	Currency   string  `json:"currency,omitempty" gorm:"size:3" example:"USD"` // required with AmountOff
+	Duration   string  `json:"duration" gorm:"size:20;not null" example:"repeating" validate:"oneof=once repeating forever"`
+	// Number of billing periods a repeating coupon discounts
+	DurationInPeriods int `json:"duration_in_periods,omitempty" example:"3"`
+}
+
+// PromotionCode represents a customer-facing code redeeming a coupon
+// @Description Promotion code information
+type PromotionCode struct {
+	// Standard fields from gorm.Model
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2024-01-01T00:00:00Z"`
+	UpdatedAt time.Time `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+
+	// Promotion code specific fields
+	Code     string `json:"code" gorm:"size:50;not null;uniqueIndex" example:"SPRING20"`
+	CouponID uint   `json:"coupon_id" gorm:"not null;index" example:"1"`
+	Coupon   Coupon `json:"coupon,omitempty" gorm:"foreignKey:CouponID"`
+	Active   bool   `json:"active" gorm:"not null;default:true" example:"true"`
+	// Zero means unlimited
+	MaxRedemptions int        `json:"max_redemptions,omitempty" example:"100"`
+	TimesRedeemed  int        `json:"times_redeemed" gorm:"not null;default:0" example:"12"`
+	ExpiresAt      *time.Time `json:"expires_at,omitempty" example:"2024-06-01T00:00:00Z"`
+
+	// Relationships; when set the code only applies to these plans
+	Plans []Plan `json:"plans,omitempty" gorm:"many2many:promotion_code_plans"`
+}
+
+// Discount represents a coupon applied to a subscription. A subscription
+// has at most one discount that has not ended.
+// @Description Subscription discount
+type Discount struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2024-01-01T00:00:00Z"`
+
+	SubscriptionID  uint           `json:"subscription_id" gorm:"not null;index:idx_discounts_subscription,unique,where:ended_at IS NULL" example:"1"`
+	CouponID        uint           `json:"coupon_id" gorm:"not null;index" example:"1"`
+	Coupon          Coupon         `json:"coupon,omitempty" gorm:"foreignKey:CouponID"`
+	PromotionCodeID *uint          `json:"promotion_code_id,omitempty" example:"1"`
+	PromotionCode   *PromotionCode `json:"promotion_code,omitempty" gorm:"foreignKey:PromotionCodeID"`
+	// Billing periods still to discount; unused for forever coupons
+	PeriodsRemaining int        `json:"periods_remaining" example:"2"`
+	EndedAt          *time.Time `json:"ended_at,omitempty" example:"2024-04-01T00:00:00Z"`
+}
@@ -0,0 +1,51 @@
+// models/credit_note.go
+package models
+
+import (
+	"time"
+)
+
+// Refund and credit reasons
+const (
+	CreditReasonDuplicate           = "duplicate"
+	CreditReasonFraudulent          = "fraudulent"
+	CreditReasonRequestedByCustomer = "requested_by_customer"
+	CreditReasonServiceIssue        = "service_issue"
+	CreditReasonOther               = "other"
+)
+
+// CreditNote represents a reduction of an invoice, either lowering what is
+// still owed or documenting money refunded
+// @Description Credit note information
+type CreditNote struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2024-01-01T00:00:00Z"`
+	UpdatedAt time.Time `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+
+	Number       string  `json:"number" gorm:"size:32;not null;unique" example:"CN-2024-000001"`
+	InvoiceID    uint    `json:"invoice_id" gorm:"not null;index" example:"1"`
+	UserID       uint    `json:"user_id" gorm:"not null;index" example:"1"`
+	Amount       float64 `json:"amount" gorm:"not null" example:"10.00"`
+	Currency     string  `json:"currency" gorm:"size:3;not null" example:"USD"`
+	Reason       string  `json:"reason" gorm:"size:50;not null" example:"service_issue"`
+	Memo         string  `json:"memo,omitempty" gorm:"size:1000" example:"Outage on Jan 12"`
+	ApprovedByID uint    `json:"approved_by_id" gorm:"not null" example:"2"`
+	RefundID     *uint   `json:"refund_id,omitempty" example:"1"`
+	Refund       *Refund `json:"refund,omitempty" gorm:"foreignKey:RefundID"`
+}
+
+// Refund represents money returned to a customer through the payment provider
+// @Description Refund information
+type Refund struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2024-01-01T00:00:00Z"`
+	UpdatedAt time.Time `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+
+	InvoiceID        uint    `json:"invoice_id" gorm:"not null;index" example:"1"`
+	UserID           uint    `json:"user_id" gorm:"not null;index" example:"1"`
+	Amount           float64 `json:"amount" gorm:"not null" example:"10.00"`
+	Currency         string  `json:"currency" gorm:"size:3;not null" example:"USD"`
+	Reason           string  `json:"reason" gorm:"size:50;not null" example:"requested_by_customer"`
+	ApprovedByID     uint    `json:"approved_by_id" gorm:"not null" example:"2"`
+	ProviderRefundID string  `json:"provider_refund_id" gorm:"size:255;not null" example:"re_000004"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// IdempotencyKey is a request sent with an Idempotency-Key header and, once
+// it has succeeded, its response, kept so retries get the same response
+type IdempotencyKey struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2024-01-01T00:00:00Z"`
+
+	// Scope is who sent the key, so keys of different callers never clash
+	Scope       string    `json:"scope" gorm:"size:50;not null;uniqueIndex:idx_idempotency_keys_scope_key" example:"user:1"`
+	Key         string    `json:"key" gorm:"size:255;not null;uniqueIndex:idx_idempotency_keys_scope_key" example:"9b2f7c1e-0d4a-4f43-8f0e-1c2d3e4f5a6b"`
+	Fingerprint string    `json:"fingerprint" gorm:"size:64;not null"` // SHA-256 of the method, path and body
+	ExpiresAt   time.Time `json:"expires_at" gorm:"not null;index" example:"2024-01-02T00:00:00Z"`
+	// LockedUntil is set while the request is being handled. A request that
+	// never finished, e.g. because the server stopped, frees its key then.
+	LockedUntil *time.Time `json:"locked_until,omitempty" example:"2024-01-01T00:01:00Z"`
+
+	// The stored response; StatusCode is zero until the request succeeds
+	StatusCode int               `json:"status_code" gorm:"not null;default:0" example:"201"`
+	Headers    map[string]string `json:"headers,omitempty" gorm:"type:text;serializer:json"`
+	Body       []byte            `json:"-"`
+}
@@ -0,0 +1,101 @@
+// models/invoice.go
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invoice states
+const (
+	InvoiceStatusDraft = "draft"
+	InvoiceStatusOpen  = "open"
+	InvoiceStatusPaid  = "paid"
+	InvoiceStatusVoid  = "void"
+)
+
+// Invoice represents an amount billed to a customer
+// @Description Invoice information. Drafts have no number; one is assigned when the invoice is finalized.
+type Invoice struct {
+	// Standard fields from gorm.Model
+	ID        uint           `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time      `json:"created_at" example:"2024-01-01T00:00:00Z"`
+	UpdatedAt time.Time      `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" swaggertype:"string" format:"date-time"`
+
+	// Invoice specific fields
+	Number         string  `json:"number,omitempty" gorm:"size:32;index:idx_invoices_number,unique,where:number <> ''" example:"INV-2024-000001"`
+	UserID         uint    `json:"user_id" gorm:"not null;index" example:"1"`
+	SubscriptionID *uint   `json:"subscription_id,omitempty" gorm:"index" example:"1"`
+	Status         string  `json:"status" gorm:"size:20;not null" example:"open"`
+	BillingReason  string  `json:"billing_reason" gorm:"size:50;not null" example:"subscription_create"`
+	Currency       string  `json:"currency" gorm:"size:3;not null" example:"USD"`
+	Subtotal       float64 `json:"subtotal" gorm:"not null" example:"29.99"`
+	Tax            float64 `json:"tax" gorm:"not null;default:0" example:"0"`
+	ReverseCharge  bool    `json:"reverse_charge" gorm:"not null;default:false" example:"false"`
+	Total          float64 `json:"total" gorm:"not null" example:"29.99"`
+	AmountPaid     float64 `json:"amount_paid" gorm:"not null;default:0" example:"0"`
+	AmountDue      float64 `json:"amount_due" gorm:"not null" example:"29.99"`
+	CreditApplied  float64 `json:"credit_applied" gorm:"not null;default:0" example:"0"` // customer credit balance used
+	AmountCredited float64 `json:"amount_credited" gorm:"not null;default:0" example:"0"`
+	AmountRefunded float64 `json:"amount_refunded" gorm:"not null;default:0" example:"0"`
+
+	PeriodStart time.Time  `json:"period_start" example:"2024-01-01T00:00:00Z"`
+	PeriodEnd   time.Time  `json:"period_end" example:"2024-02-01T00:00:00Z"`
+	IssuedAt    *time.Time `json:"issued_at,omitempty" example:"2024-01-01T00:00:00Z"`
+	DueAt       *time.Time `json:"due_at,omitempty" example:"2024-01-15T00:00:00Z"`
+	PaidAt      *time.Time `json:"paid_at,omitempty" example:"2024-01-02T00:00:00Z"`
+	VoidedAt    *time.Time `json:"voided_at,omitempty"`
+
+	// Payment collection
+	ChargeID         string `json:"charge_id,omitempty" gorm:"size:255;index" example:"ch_000003"`
+	PaymentAttempts  int    `json:"payment_attempts" gorm:"not null;default:0" example:"1"`
+	LastPaymentError string `json:"last_payment_error,omitempty" gorm:"size:500" example:"card declined"`
+	// PaymentKey is the idempotency key of the collection in progress. It
+	// is kept until the provider declines, so a retry after a timeout finds
+	// the charge that may have gone through instead of making another.
+	PaymentKey string `json:"-" gorm:"size:64;not null;default:''"`
+
+	// Dunning: retries made so far and when the next one is due
+	DunningRetries       int        `json:"dunning_retries" gorm:"not null;default:0" example:"1"`
+	NextPaymentAttemptAt *time.Time `json:"next_payment_attempt_at,omitempty" gorm:"index" example:"2024-02-04T00:00:00Z"`
+
+	// Customer details captured when the invoice is issued
+	CustomerName string         `json:"customer_name,omitempty" gorm:"size:255" example:"John Doe"`
+	Customer     BillingProfile `json:"customer" gorm:"embedded;embeddedPrefix:customer_"`
+
+	// Relationships
+	LineItems   []InvoiceLineItem `json:"line_items,omitempty" gorm:"foreignKey:InvoiceID"`
+	Taxes       []InvoiceTax      `json:"taxes,omitempty" gorm:"foreignKey:InvoiceID"`
+	CreditNotes []CreditNote      `json:"credit_notes,omitempty" gorm:"foreignKey:InvoiceID"`
+}
+
+// InvoiceLineItem represents a single charge or credit on an invoice
+// @Description Invoice line item
+type InvoiceLineItem struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2024-01-01T00:00:00Z"`
+	UpdatedAt time.Time `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+
+	InvoiceID   uint      `json:"invoice_id" gorm:"not null;index" example:"1"`
+	Description string    `json:"description" gorm:"size:500;not null" example:"Premium Plan (Jan 1, 2024 - Feb 1, 2024)"`
+	PlanID      *uint     `json:"plan_id,omitempty" example:"1"`
+	AddOnID     *uint     `json:"addon_id,omitempty"`
+	DiscountID  *uint     `json:"discount_id,omitempty"`
+	Quantity    int       `json:"quantity" gorm:"not null;default:1" example:"1"`
+	UnitAmount  float64   `json:"unit_amount" gorm:"not null" example:"29.99"`
+	Amount      float64   `json:"amount" gorm:"not null" example:"29.99"`
+	Proration   bool      `json:"proration" gorm:"not null;default:false" example:"false"`
+	PeriodStart time.Time `json:"period_start" example:"2024-01-01T00:00:00Z"`
+	PeriodEnd   time.Time `json:"period_end" example:"2024-02-01T00:00:00Z"`
+}
+
+// InvoiceSequence holds the last document number issued in a year for a
+// prefix (INV for invoices, CN for credit notes). The row is locked while a
+// number is taken so numbering stays gap-free.
+type InvoiceSequence struct {
+	Prefix     string `json:"prefix" gorm:"size:10;primarykey"`
+	Year       int    `json:"year" gorm:"primarykey;autoIncrement:false"`
+	LastNumber int    `json:"last_number" gorm:"not null"`
+}
@@ -0,0 +1,55 @@
+// models/ledger.go
+package models
+
+import (
+	"time"
+)
+
+// Ledger account types
+const (
+	AccountTypeAsset     = "asset"
+	AccountTypeLiability = "liability"
+	AccountTypeRevenue   = "revenue"
+	AccountTypeExpense   = "expense"
+)
+
+// LedgerAccount represents an account in the double-entry ledger. Customer
+// accounts carry the customer's user ID; company-wide accounts use zero.
+// @Description Ledger account
+type LedgerAccount struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2024-01-01T00:00:00Z"`
+
+	Code     string `json:"code" gorm:"size:50;not null;uniqueIndex:idx_ledger_accounts_code_user_currency" example:"accounts_receivable"`
+	UserID   uint   `json:"user_id" gorm:"not null;default:0;uniqueIndex:idx_ledger_accounts_code_user_currency" example:"1"`
+	Currency string `json:"currency" gorm:"size:3;not null;uniqueIndex:idx_ledger_accounts_code_user_currency" example:"USD"`
+	Type     string `json:"type" gorm:"size:20;not null" example:"asset"`
+}
+
+// JournalEntry represents a balanced set of postings recording one financial event
+// @Description Journal entry
+type JournalEntry struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" gorm:"index" example:"2024-01-01T00:00:00Z"`
+
+	Description string `json:"description" gorm:"size:500;not null" example:"Invoice INV-2024-000001"`
+	// The event recorded; an event is only ever posted once
+	SourceType string `json:"source_type" gorm:"size:50;not null;index:idx_journal_entries_source,unique,where:source_id <> 0" example:"invoice"`
+	SourceID   uint   `json:"source_id" gorm:"not null;index:idx_journal_entries_source,unique,where:source_id <> 0" example:"1"`
+	Currency   string `json:"currency" gorm:"size:3;not null" example:"USD"`
+
+	// Relationships
+	Postings []Posting `json:"postings,omitempty" gorm:"foreignKey:JournalEntryID"`
+}
+
+// Posting represents one side of a journal entry. Amounts are in minor
+// units (cents); debits are positive and credits negative, so the postings
+// of an entry always sum to zero.
+// @Description Ledger posting
+type Posting struct {
+	ID             uint          `json:"id" gorm:"primarykey" example:"1"`
+	JournalEntryID uint          `json:"journal_entry_id" gorm:"not null;index" example:"1"`
+	AccountID      uint          `json:"account_id" gorm:"not null;index" example:"1"`
+	Account        LedgerAccount `json:"account,omitempty" gorm:"foreignKey:AccountID"`
+	Amount         int64         `json:"amount" gorm:"not null" example:"2999"`
+}
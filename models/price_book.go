@@ -0,0 +1,25 @@
+// models/price_book.go
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PlanPrice represents a price book entry for a plan
+// @Description Regional plan price. All entries sharing a currency form that currency's price book;
+// @Description an entry without a country applies to every country billed in that currency.
+type PlanPrice struct {
+	// Standard fields from gorm.Model
+	ID        uint           `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time      `json:"created_at" example:"2024-01-01T00:00:00Z"`
+	UpdatedAt time.Time      `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" swaggertype:"string" format:"date-time"`
+
+	// Price book specific fields
+	PlanID   uint    `json:"plan_id" gorm:"not null;uniqueIndex:idx_plan_prices_plan_currency_country" example:"1"`
+	Currency string  `json:"currency" gorm:"size:3;not null;uniqueIndex:idx_plan_prices_plan_currency_country" example:"EUR"`
+	Country  string  `json:"country,omitempty" gorm:"size:2;not null;default:'';uniqueIndex:idx_plan_prices_plan_currency_country" example:"DE"`
+	Amount   float64 `json:"amount" gorm:"not null" example:"27.99"`
+}
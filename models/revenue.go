@@ -0,0 +1,41 @@
+// models/revenue.go
+package models
+
+import (
+	"time"
+)
+
+// RevenueSchedule represents the revenue of a paid invoice line spread over
+// the months of its service period
+// @Description Revenue recognition schedule
+type RevenueSchedule struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" gorm:"index" example:"2024-01-01T00:00:00Z"`
+
+	InvoiceID      uint      `json:"invoice_id" gorm:"not null;index" example:"1"`
+	LineItemID     uint      `json:"line_item_id" gorm:"not null;uniqueIndex" example:"1"`
+	SubscriptionID *uint     `json:"subscription_id,omitempty" gorm:"index" example:"1"`
+	UserID         uint      `json:"user_id" gorm:"not null;index" example:"1"`
+	Currency       string    `json:"currency" gorm:"size:3;not null" example:"USD"`
+	Amount         float64   `json:"amount" gorm:"not null" example:"299.00"` // net of tax and credits
+	PeriodStart    time.Time `json:"period_start" example:"2024-01-15T00:00:00Z"`
+	PeriodEnd      time.Time `json:"period_end" example:"2025-01-15T00:00:00Z"`
+
+	// Relationships
+	Entries []RevenueScheduleEntry `json:"entries,omitempty" gorm:"foreignKey:ScheduleID"`
+}
+
+// RevenueScheduleEntry represents the revenue of a schedule falling in one
+// month. It is recognized once the month has ended; refunds lower and
+// cancellations bring forward the entries not yet recognized.
+// @Description Revenue recognition schedule entry
+type RevenueScheduleEntry struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2024-01-01T00:00:00Z"`
+	UpdatedAt time.Time `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+
+	ScheduleID   uint       `json:"schedule_id" gorm:"not null;index" example:"1"`
+	Month        time.Time  `json:"month" gorm:"type:date;not null;index" example:"2024-01-01T00:00:00Z"` // first day of the month, UTC
+	Amount       float64    `json:"amount" gorm:"not null" example:"13.95"`
+	RecognizedAt *time.Time `json:"recognized_at,omitempty" gorm:"index" example:"2024-02-01T00:00:00Z"`
+}
@@ -7,6 +7,17 @@ import (
 	"gorm.io/gorm"
 )
 
+// Subscription states. A subscription is incomplete until its first invoice
+// is paid, and incomplete_expired if that payment fails.
+const (
+	SubscriptionStatusIncomplete        = "incomplete"
+	SubscriptionStatusIncompleteExpired = "incomplete_expired"
+	SubscriptionStatusActive            = "active"
+	SubscriptionStatusPastDue           = "past_due"
+	SubscriptionStatusExpired           = "expired"
+	SubscriptionStatusCancelled         = "cancelled"
+)
+
 // Subscription represents the subscription model
 // @Description Subscription information
 type Subscription struct {
@@ -16,15 +27,33 @@ type Subscription struct {
 	UpdatedAt time.Time      `json:"updated_at" example:"2024-01-01T00:00:00Z"`
 	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" swaggertype:"string" format:"date-time"`
 
+	// Version goes up by one with every update of the row; it is served as
+	// the ETag
+	Version uint `json:"version" gorm:"not null;default:1" example:"1"`
+
 	// Subscription specific fields
 	UserID    uint      `json:"user_id" gorm:"not null" example:"1" validate:"required"`
 	User      User      `json:"user,omitempty" gorm:"foreignKey:UserID"`
 	PlanID    uint      `json:"plan_id" gorm:"not null" example:"1" validate:"required"`
 	Plan      Plan      `json:"plan,omitempty" gorm:"foreignKey:PlanID"`
-	Status    string    `json:"status" gorm:"size:50;not null" example:"active" validate:"required,oneof=active expired cancelled"`
+	Status    string    `json:"status" gorm:"size:50;not null" example:"active" validate:"required,oneof=incomplete incomplete_expired active past_due expired cancelled"`
 	StartDate time.Time `json:"start_date" example:"2024-01-01T00:00:00Z"`
 	ExpiresAt time.Time `json:"expires_at" example:"2024-02-01T00:00:00Z"`
 	Active    bool      `json:"active" gorm:"default:true" example:"true"`
+
+	// Billing cycle; ExpiresAt is the end of the current period
+	BillingCycleAnchor time.Time `json:"billing_cycle_anchor" example:"2024-01-01T00:00:00Z"`
+	CurrentPeriodStart time.Time `json:"current_period_start" example:"2024-01-01T00:00:00Z"`
+	Currency           string    `json:"currency" gorm:"size:3" example:"USD"`
+
+	// Dunning; set while payment of the current period is overdue
+	PastDueSince *time.Time `json:"past_due_since,omitempty" example:"2024-02-01T00:00:00Z"`
+	// EndedAt is when the subscription was cancelled or expired
+	EndedAt *time.Time `json:"ended_at,omitempty" example:"2024-06-01T00:00:00Z"`
+
+	// Relationships
+	AddOns   []SubscriptionAddOn `json:"addons,omitempty" gorm:"foreignKey:SubscriptionID"`
+	Discount *Discount           `json:"discount,omitempty" gorm:"foreignKey:SubscriptionID"`
 }
 
 // Plan represents the subscription plan model
@@ -36,9 +65,20 @@ type Plan struct {
 	UpdatedAt time.Time      `json:"updated_at" example:"2024-01-01T00:00:00Z"`
 	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" swaggertype:"string" format:"date-time"`
 
+	// Version goes up by one with every update of the row; it is served as
+	// the ETag
+	Version uint `json:"version" gorm:"not null;default:1" example:"1"`
+
 	// Plan specific fields
 	Name        string  `json:"name" gorm:"size:255;not null;unique" example:"Premium Plan"`
 	Description string  `json:"description" gorm:"size:1000" example:"Premium features included"`
 	Price       float64 `json:"price" gorm:"not null" example:"29.99"`
-	Duration    int     `json:"duration" gorm:"not null" example:"30"` // duration in days
+	Duration    int     `json:"duration" gorm:"not null" example:"30"` // duration in days, approximate when billed by interval
+
+	// Billing interval, e.g. every 1 month; plans without a unit bill every Duration days
+	IntervalUnit  string `json:"interval_unit,omitempty" gorm:"size:10" example:"month"`
+	IntervalCount int    `json:"interval_count,omitempty" example:"1"`
+
+	// Relationships
+	Prices []PlanPrice `json:"prices,omitempty" gorm:"foreignKey:PlanID"`
 }
@@ -0,0 +1,34 @@
+// models/subscription_event.go
+package models
+
+import (
+	"time"
+)
+
+// Subscription history event types
+const (
+	SubscriptionEventCreated       = "created"
+	SubscriptionEventRenewed       = "renewed"
+	SubscriptionEventPlanChanged   = "plan_changed"
+	SubscriptionEventStatusChanged = "status_changed"
+	SubscriptionEventPaymentFailed = "payment_failed"
+	SubscriptionEventPaymentRetry  = "payment_retry"
+	SubscriptionEventAccessRevoked = "access_revoked"
+	SubscriptionEventDiscounted    = "discount_applied"
+)
+
+// SubscriptionEvent represents an entry in a subscription's history
+// @Description Subscription history entry
+type SubscriptionEvent struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" gorm:"index" example:"2024-01-01T00:00:00Z"`
+
+	SubscriptionID uint   `json:"subscription_id" gorm:"not null;index" example:"1"`
+	Type           string `json:"type" gorm:"size:50;not null" example:"status_changed"`
+	FromStatus     string `json:"from_status,omitempty" gorm:"size:50" example:"active"`
+	ToStatus       string `json:"to_status,omitempty" gorm:"size:50" example:"past_due"`
+	FromPlanID     *uint  `json:"from_plan_id,omitempty" example:"1"`
+	ToPlanID       *uint  `json:"to_plan_id,omitempty" example:"2"`
+	InvoiceID      *uint  `json:"invoice_id,omitempty" example:"3"`
+	Message        string `json:"message,omitempty" gorm:"size:500" example:"Payment failed: card declined"`
+}
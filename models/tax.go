@@ -0,0 +1,42 @@
+// models/tax.go
+package models
+
+import (
+	"time"
+)
+
+// TaxRate represents the sales tax charged to customers in a country, or in
+// a region of it. A rate without a region applies to the whole country.
+// @Description Tax rate information
+type TaxRate struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2024-01-01T00:00:00Z"`
+	UpdatedAt time.Time `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+
+	Country    string  `json:"country" gorm:"size:2;not null;uniqueIndex:idx_tax_rates_country_region" example:"DE"`
+	Region     string  `json:"region" gorm:"size:10;not null;default:'';uniqueIndex:idx_tax_rates_country_region" example:""`
+	Name       string  `json:"name" gorm:"size:50;not null" example:"VAT"`
+	Percentage float64 `json:"percentage" gorm:"not null" example:"19"`
+	// Inclusive rates are already part of the price; exclusive rates are added to it
+	Inclusive bool `json:"inclusive" gorm:"not null;default:false" example:"false"`
+	Active    bool `json:"active" gorm:"not null;default:true" example:"true"`
+}
+
+// InvoiceTax represents the tax charged on an invoice at one rate
+// @Description Invoice tax breakdown
+type InvoiceTax struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2024-01-01T00:00:00Z"`
+
+	InvoiceID     uint    `json:"invoice_id" gorm:"not null;index" example:"1"`
+	TaxRateID     *uint   `json:"tax_rate_id,omitempty" example:"1"`
+	Name          string  `json:"name" gorm:"size:50;not null" example:"VAT"`
+	Country       string  `json:"country" gorm:"size:2;not null" example:"DE"`
+	Region        string  `json:"region,omitempty" gorm:"size:10" example:""`
+	Percentage    float64 `json:"percentage" gorm:"not null" example:"19"`
+	Inclusive     bool    `json:"inclusive" gorm:"not null;default:false" example:"false"`
+	TaxableAmount float64 `json:"taxable_amount" gorm:"not null" example:"29.99"`
+	Amount        float64 `json:"amount" gorm:"not null" example:"5.70"`
+	// ReverseCharge means the customer accounts for the tax; Amount is zero
+	ReverseCharge bool `json:"reverse_charge" gorm:"not null;default:false" example:"false"`
+}
@@ -16,11 +16,30 @@ type User struct {
 	UpdatedAt time.Time      `json:"updated_at" example:"2024-01-01T00:00:00Z"`
 	DeletedAt gorm.DeletedAt `json:"deleted_at,omitempty" swaggertype:"string" format:"date-time"`
 
+	// Version goes up by one with every update of the row; it is served as
+	// the ETag
+	Version uint `json:"version" gorm:"not null;default:1" example:"1"`
+
 	// User specific fields
 	Name     string `json:"name" gorm:"size:255;not null" example:"John Doe"`
 	Email    string `json:"email" gorm:"size:255;not null;unique" example:"john@example.com"`
 	Password string `json:"-" gorm:"size:255;not null"` // Password is not exposed in JSON
+	Role     string `json:"role" gorm:"size:20;not null;default:user" example:"user"`
+
+	// Billing profile; its country and currency also pick the price book and tax rate
+	Billing BillingProfile `json:"billing" gorm:"embedded;embeddedPrefix:billing_"`
+
+	// Payment provider references; set only by the billing engine, never
+	// read from or written to request bodies
+	PaymentCustomerID      string `json:"-" gorm:"size:255"`
+	DefaultPaymentMethodID string `json:"-" gorm:"size:255"`
 
 	// Relationships
 	Subscriptions []Subscription `json:"subscriptions,omitempty" gorm:"foreignKey:UserID"`
 }
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
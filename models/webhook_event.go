@@ -0,0 +1,31 @@
+// models/webhook_event.go
+package models
+
+import (
+	"time"
+)
+
+// Webhook event processing states
+const (
+	WebhookStatusReceived  = "received"
+	WebhookStatusProcessed = "processed"
+	WebhookStatusFailed    = "failed"
+	WebhookStatusIgnored   = "ignored"
+)
+
+// WebhookEvent represents a notification received from the payment provider
+// @Description Stored webhook event. The raw payload is kept so events can be replayed.
+type WebhookEvent struct {
+	ID        uint      `json:"id" gorm:"primarykey" example:"1"`
+	CreatedAt time.Time `json:"created_at" example:"2024-01-01T00:00:00Z"`
+	UpdatedAt time.Time `json:"updated_at" example:"2024-01-01T00:00:00Z"`
+
+	Provider    string     `json:"provider" gorm:"size:50;not null;uniqueIndex:idx_webhook_events_provider_event" example:"fake"`
+	EventID     string     `json:"event_id" gorm:"size:255;not null;uniqueIndex:idx_webhook_events_provider_event" example:"evt_000001"`
+	Type        string     `json:"type" gorm:"size:100;not null" example:"charge.succeeded"`
+	Payload     string     `json:"payload" gorm:"type:text;not null"`
+	Status      string     `json:"status" gorm:"size:20;not null;index" example:"processed"`
+	Attempts    int        `json:"attempts" gorm:"not null;default:0" example:"1"`
+	LastError   string     `json:"last_error,omitempty" gorm:"size:1000"`
+	ProcessedAt *time.Time `json:"processed_at,omitempty" example:"2024-01-01T00:00:00Z"`
+}
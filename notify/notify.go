@@ -0,0 +1,39 @@
+// Package notify delivers customer notifications about their billing.
+package notify
+
+import (
+	"context"
+	"log"
+)
+
+// Notification types
+const (
+	PaymentFailed         = "payment_failed"
+	PaymentRetryFailed    = "payment_retry_failed"
+	PaymentRecovered      = "payment_recovered"
+	AccessSuspended       = "access_suspended"
+	SubscriptionCancelled = "subscription_cancelled"
+	SubscriptionDowngrade = "subscription_downgraded"
+)
+
+// Notification is a message to a customer
+type Notification struct {
+	Type    string
+	To      string
+	Subject string
+	Body    string
+}
+
+// Notifier sends notifications
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// LogNotifier writes notifications to the application log. It stands in for
+// an email sender until one is configured.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, n Notification) error {
+	log.Printf("Notification %s to %s: %s - %s", n.Type, n.To, n.Subject, n.Body)
+	return nil
+}
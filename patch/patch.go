@@ -0,0 +1,183 @@
+// Package patch reads JSON merge patches (RFC 7396) into typed fields that
+// tell a member left out of the patch apart from one set to null, and
+// describes what an update changed.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Field is a member of a merge patch. A member left out of the patch is not
+// Set; null sets the zero value.
+type Field[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+// UnmarshalJSON is only called for members present in the patch
+func (f *Field[T]) UnmarshalJSON(data []byte) error {
+	f.Set = true
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		var zero T
+		f.Null, f.Value = true, zero
+		return nil
+	}
+	f.Null = false
+	return json.Unmarshal(data, &f.Value)
+}
+
+// Lookup returns the field's value, nil if it was null, and whether it was
+// present in the patch
+func (f Field[T]) Lookup() (any, bool) {
+	if !f.Set || f.Null {
+		return nil, f.Set
+	}
+	return f.Value, true
+}
+
+// ValueType is the type the field's value decodes into
+func (f Field[T]) ValueType() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// Apply writes the field to dst if it was present in the patch
+func (f Field[T]) Apply(dst *T) {
+	if f.Set {
+		*dst = f.Value
+	}
+}
+
+// optional is implemented by every Field
+type optional interface {
+	Lookup() (any, bool)
+}
+
+// Present returns the JSON names of the members present in the patch p
+// points to. Members of a nested patch are named parent.child; a nested
+// patch set to null is named by itself.
+func Present(p any) []string {
+	var names []string
+	present(reflect.Indirect(reflect.ValueOf(p)), "", &names)
+	return names
+}
+
+func present(value reflect.Value, prefix string, names *[]string) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		f, ok := value.Field(i).Interface().(optional)
+		if !field.IsExported() || !ok {
+			continue
+		}
+		v, set := f.Lookup()
+		if !set {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+		if nested := reflect.ValueOf(v); v != nil && nested.Kind() == reflect.Struct && hasFields(nested) {
+			present(nested, prefix+name+".", names)
+			continue
+		}
+		*names = append(*names, prefix+name)
+	}
+}
+
+func hasFields(value reflect.Value) bool {
+	for i := 0; i < value.NumField(); i++ {
+		if _, ok := value.Field(i).Interface().(optional); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Change is the value of a field before and after an update
+type Change struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Changes maps the JSON names of changed fields to their old and new values
+type Changes map[string]Change
+
+// Fields returns the names of the changed fields in order
+func (c Changes) Fields() []string {
+	names := make([]string, 0, len(c))
+	for name := range c {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Diff compares two values by their JSON encoding and returns the fields
+// that differ. Nested objects are compared member by member and named
+// parent.child; arrays are compared whole. Fields named in ignore, or
+// nested under them, are skipped.
+func Diff(before, after any, ignore ...string) (Changes, error) {
+	from, err := toJSONObject(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := toJSONObject(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := Changes{}
+	diff(from, to, "", ignore, changes)
+	return changes, nil
+}
+
+func diff(from, to map[string]any, prefix string, ignore []string, changes Changes) {
+	keys := map[string]bool{}
+	for key := range from {
+		keys[key] = true
+	}
+	for key := range to {
+		keys[key] = true
+	}
+
+	for key := range keys {
+		name := prefix + key
+		if contains(ignore, name) {
+			continue
+		}
+		before, after := from[key], to[key]
+		beforeObject, ok1 := before.(map[string]any)
+		afterObject, ok2 := after.(map[string]any)
+		if ok1 && ok2 {
+			diff(beforeObject, afterObject, name+".", ignore, changes)
+			continue
+		}
+		if !reflect.DeepEqual(before, after) {
+			changes[name] = Change{From: before, To: after}
+		}
+	}
+}
+
+func toJSONObject(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]any
+	err = json.Unmarshal(data, &object)
+	return object, err
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Test tokens understood by the fake provider. A payment method attached with
+// one of the failing tokens fails every charge with the matching error.
+const (
+	TokenVisa              = "tok_visa"
+	TokenCardDeclined      = "tok_card_declined"
+	TokenInsufficientFunds = "tok_insufficient_funds"
+	TokenNetworkTimeout    = "tok_network_timeout"
+)
+
+var tokenFailures = map[string]error{
+	TokenCardDeclined:      ErrCardDeclined,
+	TokenInsufficientFunds: ErrInsufficientFunds,
+	TokenNetworkTimeout:    ErrNetworkTimeout,
+}
+
+// FakeProvider is a deterministic in-memory payment provider. IDs are
+// sequential, so the same calls always produce the same results.
+type FakeProvider struct {
+	mu             sync.Mutex
+	seq            int
+	customers      map[string]*Customer
+	paymentMethods map[string]*PaymentMethod
+	methodTokens   map[string]string
+	charges        map[string]*Charge
+	idempotent     map[string]*Charge
+	refunds        []Refund
+	failNext       []error
+	failAfter      []error
+}
+
+// NewFakeProvider returns an empty fake provider
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{
+		customers:      make(map[string]*Customer),
+		paymentMethods: make(map[string]*PaymentMethod),
+		methodTokens:   make(map[string]string),
+		charges:        make(map[string]*Charge),
+		idempotent:     make(map[string]*Charge),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+// FailNext makes the next calls to Charge or Refund fail with the given
+// errors, in order, regardless of the payment method used
+func (p *FakeProvider) FailNext(errs ...error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failNext = append(p.failNext, errs...)
+}
+
+// FailNextAfterCharge makes the next charges go through but report the
+// given errors, in order, as when the provider's response is lost. Charging
+// again with the same idempotency key returns the charge made.
+func (p *FakeProvider) FailNextAfterCharge(errs ...error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.failAfter = append(p.failAfter, errs...)
+}
+
+func (p *FakeProvider) CreateCustomer(ctx context.Context, email, name string) (*Customer, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	customer := &Customer{ID: p.nextID("cus"), Email: email, Name: name}
+	p.customers[customer.ID] = customer
+	return customer, nil
+}
+
+func (p *FakeProvider) AttachPaymentMethod(ctx context.Context, customerID, token string) (*PaymentMethod, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.customers[customerID]; !ok {
+		return nil, ErrNotFound
+	}
+	if token != TokenVisa && tokenFailures[token] == nil {
+		return nil, fmt.Errorf("%w: unknown token %q", ErrInvalidRequest, token)
+	}
+
+	method := &PaymentMethod{ID: p.nextID("pm"), CustomerID: customerID, Brand: "visa", Last4: last4(token)}
+	p.paymentMethods[method.ID] = method
+	p.methodTokens[method.ID] = token
+	return method, nil
+}
+
+func (p *FakeProvider) Charge(ctx context.Context, params ChargeParams) (*Charge, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if params.IdempotencyKey != "" {
+		if charge, ok := p.idempotent[params.IdempotencyKey]; ok {
+			return charge, nil
+		}
+	}
+	if err := p.popFailure(); err != nil {
+		return nil, err
+	}
+
+	method, ok := p.paymentMethods[params.PaymentMethodID]
+	if !ok || method.CustomerID != params.CustomerID {
+		return nil, ErrNotFound
+	}
+	if params.Amount <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalidRequest)
+	}
+	if err := tokenFailures[p.methodTokens[method.ID]]; err != nil {
+		return nil, err
+	}
+
+	charge := &Charge{
+		ID:         p.nextID("ch"),
+		CustomerID: params.CustomerID,
+		Amount:     params.Amount,
+		Currency:   params.Currency,
+		Status:     ChargeSucceeded,
+		Metadata:   params.Metadata,
+	}
+	p.charges[charge.ID] = charge
+	if params.IdempotencyKey != "" {
+		p.idempotent[params.IdempotencyKey] = charge
+	}
+	if len(p.failAfter) > 0 {
+		err := p.failAfter[0]
+		p.failAfter = p.failAfter[1:]
+		return nil, err
+	}
+	return charge, nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, chargeID string, amount float64, reason string) (*Refund, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.popFailure(); err != nil {
+		return nil, err
+	}
+
+	charge, ok := p.charges[chargeID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	remaining := math.Round((charge.Amount-charge.AmountRefunded)*100) / 100
+	if amount <= 0 || amount > remaining {
+		return nil, fmt.Errorf("%w: refund exceeds the unrefunded amount", ErrInvalidRequest)
+	}
+
+	charge.AmountRefunded += amount
+	refund := Refund{ID: p.nextID("re"), ChargeID: chargeID, Amount: amount, Reason: reason}
+	p.refunds = append(p.refunds, refund)
+	return &refund, nil
+}
+
+// Charges returns a copy of every successful charge, for inspection in tests
+func (p *FakeProvider) Charges() []Charge {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	charges := make([]Charge, 0, len(p.charges))
+	for i := 1; i <= p.seq; i++ {
+		if charge, ok := p.charges[fmt.Sprintf("ch_%06d", i)]; ok {
+			charges = append(charges, *charge)
+		}
+	}
+	return charges
+}
+
+func (p *FakeProvider) popFailure() error {
+	if len(p.failNext) == 0 {
+		return nil
+	}
+	err := p.failNext[0]
+	p.failNext = p.failNext[1:]
+	return err
+}
+
+func (p *FakeProvider) nextID(prefix string) string {
+	p.seq++
+	return fmt.Sprintf("%s_%06d", prefix, p.seq)
+}
+
+func last4(token string) string {
+	switch token {
+	case TokenCardDeclined:
+		return "0002"
+	case TokenInsufficientFunds:
+		return "9995"
+	case TokenNetworkTimeout:
+		return "0119"
+	default:
+		return "4242"
+	}
+}
@@ -0,0 +1,175 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// card attaches a payment method made from token to a new customer
+func card(t *testing.T, p *FakeProvider, token string) ChargeParams {
+	t.Helper()
+	ctx := context.Background()
+	customer, err := p.CreateCustomer(ctx, "ada@example.com", "Ada Lovelace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	method, err := p.AttachPaymentMethod(ctx, customer.ID, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ChargeParams{CustomerID: customer.ID, PaymentMethodID: method.ID, Amount: 20, Currency: "USD", IdempotencyKey: "invoice-1-collection-1"}
+}
+
+func TestFakeProviderTokens(t *testing.T) {
+	tests := []struct {
+		token     string
+		want      error
+		declined  bool
+		retryable bool
+	}{
+		{TokenVisa, nil, false, false},
+		{TokenCardDeclined, ErrCardDeclined, true, false},
+		{TokenInsufficientFunds, ErrInsufficientFunds, true, true},
+		{TokenNetworkTimeout, ErrNetworkTimeout, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			p := NewFakeProvider()
+			charge, err := p.Charge(context.Background(), card(t, p, tt.token))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Charge: err = %v, want %v", err, tt.want)
+			}
+			if (charge != nil) != (tt.want == nil) {
+				t.Errorf("Charge returned %+v with err %v", charge, err)
+			}
+			if charges := p.Charges(); (len(charges) == 1) != (tt.want == nil) {
+				t.Errorf("%d charges made", len(charges))
+			}
+			if tt.want == nil {
+				return
+			}
+			if got := IsDeclined(err); got != tt.declined {
+				t.Errorf("IsDeclined = %v, want %v", got, tt.declined)
+			}
+			if got := IsRetryable(err); got != tt.retryable {
+				t.Errorf("IsRetryable = %v, want %v", got, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestFakeProviderRejectsUnknownTokens(t *testing.T) {
+	p := NewFakeProvider()
+	customer, err := p.CreateCustomer(context.Background(), "ada@example.com", "Ada Lovelace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.AttachPaymentMethod(context.Background(), customer.ID, "tok_mastercard"); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("err = %v, want ErrInvalidRequest", err)
+	}
+}
+
+func TestFakeProviderReplaysIdempotentCharges(t *testing.T) {
+	p := NewFakeProvider()
+	params := card(t, p, TokenVisa)
+
+	first, err := p.Charge(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.Charge(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID != first.ID || len(p.Charges()) != 1 {
+		t.Errorf("charged %s then %s with %d charges made, want one charge replayed", first.ID, second.ID, len(p.Charges()))
+	}
+
+	params.IdempotencyKey = "invoice-1-collection-2"
+	if third, err := p.Charge(context.Background(), params); err != nil || third.ID == first.ID {
+		t.Errorf("a new key replayed charge %v (err %v)", third, err)
+	}
+}
+
+func TestFakeProviderFailNext(t *testing.T) {
+	p := NewFakeProvider()
+	params := card(t, p, TokenVisa)
+	p.FailNext(ErrCardDeclined)
+
+	if _, err := p.Charge(context.Background(), params); !errors.Is(err, ErrCardDeclined) {
+		t.Fatalf("err = %v, want ErrCardDeclined", err)
+	}
+	if len(p.Charges()) != 0 {
+		t.Error("a failed charge was made")
+	}
+	// The failure is not kept under the key, so trying again charges
+	if _, err := p.Charge(context.Background(), params); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Charges()) != 1 {
+		t.Errorf("%d charges made, want 1", len(p.Charges()))
+	}
+}
+
+func TestFakeProviderFailNextAfterCharge(t *testing.T) {
+	p := NewFakeProvider()
+	params := card(t, p, TokenVisa)
+	p.FailNextAfterCharge(ErrNetworkTimeout)
+
+	if _, err := p.Charge(context.Background(), params); !errors.Is(err, ErrNetworkTimeout) {
+		t.Fatalf("err = %v, want ErrNetworkTimeout", err)
+	}
+	charges := p.Charges()
+	if len(charges) != 1 {
+		t.Fatalf("%d charges made, want the one whose response was lost", len(charges))
+	}
+
+	replayed, err := p.Charge(context.Background(), params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.ID != charges[0].ID || len(p.Charges()) != 1 {
+		t.Errorf("retry charged %s, want %s replayed", replayed.ID, charges[0].ID)
+	}
+}
+
+func TestIsDeclined(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{ErrCardDeclined, true},
+		{ErrInsufficientFunds, true},
+		{ErrInvalidRequest, true},
+		{ErrNotFound, true},
+		{fmt.Errorf("charging: %w", ErrCardDeclined), true},
+		{ErrNetworkTimeout, false},
+		{errors.New("connection reset"), false},
+	}
+	for _, tt := range tests {
+		if got := IsDeclined(tt.err); got != tt.want {
+			t.Errorf("IsDeclined(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		allowFake bool
+		ok        bool
+	}{
+		{"fake", true, true},
+		{"fake", false, false},
+		{"", true, false},
+		{"stripe", true, false},
+	}
+	for _, tt := range tests {
+		provider, err := New(tt.name, tt.allowFake)
+		if (err == nil) != tt.ok || (provider != nil) != tt.ok {
+			t.Errorf("New(%q, %v) = %v, %v", tt.name, tt.allowFake, provider, err)
+		}
+	}
+}
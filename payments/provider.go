@@ -0,0 +1,108 @@
+// Package payments defines the interface to payment processors used by the
+// billing flows, along with an in-memory fake for offline use.
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Charge states
+const (
+	ChargeSucceeded = "succeeded"
+	ChargeFailed    = "failed"
+)
+
+var (
+	ErrCardDeclined      = errors.New("card declined")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrNetworkTimeout    = errors.New("payment provider timed out")
+	ErrNotFound          = errors.New("payment provider resource not found")
+	ErrInvalidRequest    = errors.New("invalid payment request")
+)
+
+// Customer is the provider's record of a paying user
+type Customer struct {
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// PaymentMethod is a card or other instrument stored with the provider
+type PaymentMethod struct {
+	ID         string `json:"id"`
+	CustomerID string `json:"customer_id"`
+	Brand      string `json:"brand"`
+	Last4      string `json:"last4"`
+}
+
+// ChargeParams describes an amount to collect from a customer
+type ChargeParams struct {
+	CustomerID      string
+	PaymentMethodID string
+	Amount          float64
+	Currency        string
+	Description     string
+	// IdempotencyKey makes retries of the same charge safe
+	IdempotencyKey string
+	Metadata       map[string]string
+}
+
+// Charge is the result of a successful collection
+type Charge struct {
+	ID             string            `json:"id"`
+	CustomerID     string            `json:"customer_id"`
+	Amount         float64           `json:"amount"`
+	AmountRefunded float64           `json:"amount_refunded"`
+	Currency       string            `json:"currency"`
+	Status         string            `json:"status"`
+	Metadata       map[string]string `json:"metadata,omitempty"`
+}
+
+// Refund is money returned against a charge
+type Refund struct {
+	ID       string  `json:"id"`
+	ChargeID string  `json:"charge_id"`
+	Amount   float64 `json:"amount"`
+	Reason   string  `json:"reason"`
+}
+
+// Provider is a payment processor
+type Provider interface {
+	Name() string
+	CreateCustomer(ctx context.Context, email, name string) (*Customer, error)
+	AttachPaymentMethod(ctx context.Context, customerID, token string) (*PaymentMethod, error)
+	Charge(ctx context.Context, params ChargeParams) (*Charge, error)
+	Refund(ctx context.Context, chargeID string, amount float64, reason string) (*Refund, error)
+}
+
+// IsRetryable reports whether a failed payment may succeed if tried again later
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrNetworkTimeout) || errors.Is(err, ErrInsufficientFunds)
+}
+
+// IsDeclined reports whether the provider refused a charge outright, so no
+// money moved and a new attempt is a new charge. Any other failure, such as
+// a timeout, leaves it unknown whether the charge went through.
+func IsDeclined(err error) bool {
+	return errors.Is(err, ErrCardDeclined) || errors.Is(err, ErrInsufficientFunds) ||
+		errors.Is(err, ErrInvalidRequest) || errors.Is(err, ErrNotFound)
+}
+
+// New returns the provider configured by name. The fake provider approves
+// test tokens without moving any money, so it is returned only when
+// allowFake says the setup is for development or tests.
+func New(name string, allowFake bool) (Provider, error) {
+	switch name {
+	case "":
+		return nil, errors.New("no payment provider configured")
+	case "fake":
+		if !allowFake {
+			return nil, errors.New("the fake payment provider is for development and tests only")
+		}
+		return NewFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown payment provider %q", name)
+	}
+}
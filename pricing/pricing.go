@@ -0,0 +1,65 @@
+// Package pricing resolves plan prices from the regional price books.
+package pricing
+
+import (
+	"strings"
+
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/models"
+)
+
+// Price sources reported on a Quote
+const (
+	SourceRegional = "regional" // price book entry for the currency and country
+	SourceCurrency = "currency" // price book entry for the currency, any country
+	SourceBase     = "base"     // plan base price, used as a fallback
+)
+
+// Quote is a plan price resolved for a particular currency and country
+type Quote struct {
+	Amount   float64 `json:"price"`
+	Currency string  `json:"currency"`
+	Source   string  `json:"price_source"`
+}
+
+// Resolve picks the price of plan for the given currency and country.
+// A country-specific entry wins over a currency-wide one. When the currency
+// has no entry the configured fallback policy decides: the base policy quotes
+// the plan's base price in the base currency, the omit policy reports false.
+func Resolve(plan models.Plan, currency, country string) (Quote, bool) {
+	currency = strings.ToUpper(currency)
+	country = strings.ToUpper(country)
+
+	var currencyWide *models.PlanPrice
+	for i := range plan.Prices {
+		price := &plan.Prices[i]
+		if !strings.EqualFold(price.Currency, currency) {
+			continue
+		}
+		if country != "" && strings.EqualFold(price.Country, country) {
+			return Quote{Amount: price.Amount, Currency: currency, Source: SourceRegional}, true
+		}
+		if price.Country == "" {
+			currencyWide = price
+		}
+	}
+
+	if currencyWide != nil {
+		return Quote{Amount: currencyWide.Amount, Currency: currency, Source: SourceCurrency}, true
+	}
+
+	if currency == config.Billing.BaseCurrency || config.Billing.PriceFallback == config.PriceFallbackBase {
+		return Quote{Amount: plan.Price, Currency: config.Billing.BaseCurrency, Source: SourceBase}, true
+	}
+
+	return Quote{}, false
+}
+
+// ForUser resolves the price of plan using the user's billing preferences
+func ForUser(plan models.Plan, user models.User) (Quote, bool) {
+	currency := user.Billing.Currency
+	if currency == "" {
+		currency = config.Billing.BaseCurrency
+	}
+	return Resolve(plan, currency, user.Billing.Country)
+}
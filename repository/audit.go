@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+)
+
+type gormAudit struct {
+	db *gorm.DB
+}
+
+// NewAuditRepository returns an AuditRepository backed by db
+func NewAuditRepository(db *gorm.DB) AuditRepository {
+	return &gormAudit{db: db}
+}
+
+func (r *gormAudit) Record(ctx context.Context, entry *models.AuditLog) error {
+	return r.db.WithContext(ctx).Create(entry).Error
+}
@@ -0,0 +1,223 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/service"
+)
+
+// Biller is an in-memory service.Biller. It records subscription changes in
+// Subscriptions and raises invoices without tax, proration or a ledger.
+// While FailPayments is set every charge fails as a declined card would.
+type Biller struct {
+	Subscriptions *Subscriptions
+	FailPayments  bool
+
+	mu       sync.Mutex
+	invoices []models.Invoice
+}
+
+// Invoices returns every invoice raised so far
+func (b *Biller) Invoices() []models.Invoice {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return append([]models.Invoice(nil), b.invoices...)
+}
+
+func (b *Biller) Start(ctx context.Context, sub *models.Subscription, promotionCode string) (*models.Invoice, error) {
+	invoice := b.invoice(sub, billing.ReasonSubscriptionCreate)
+	var paymentErr error
+	err := b.Subscriptions.start(sub, func() error {
+		paymentErr = b.Collect(ctx, invoice)
+		return paymentErr
+	})
+	if err != nil && paymentErr == nil {
+		return nil, err
+	}
+
+	if promotionCode != "" && paymentErr == nil {
+		b.Subscriptions.save(sub, models.SubscriptionEventDiscounted, "Promotion code "+promotionCode+" applied")
+	}
+	invoice.SubscriptionID = &sub.ID
+	if paymentErr != nil {
+		now := time.Now()
+		invoice.Status = models.InvoiceStatusVoid
+		invoice.VoidedAt = &now
+	}
+	b.record(invoice)
+	return invoice, paymentErr
+}
+
+func (b *Biller) ChangePlan(ctx context.Context, sub *models.Subscription, plan models.Plan) (*models.Invoice, error) {
+	sub.PlanID = plan.ID
+	b.Subscriptions.save(sub, models.SubscriptionEventPlanChanged, fmt.Sprintf("Changed to plan %d", plan.ID))
+
+	invoice := b.invoice(sub, billing.ReasonSubscriptionUpdate)
+	b.record(invoice)
+	return invoice, nil
+}
+
+func (b *Biller) ChangeAddOn(ctx context.Context, sub *models.Subscription, addOn models.AddOn, quantity int) (*models.Invoice, error) {
+	if addOn.Currency != sub.Currency {
+		return nil, billing.ErrCurrencyMismatch
+	}
+
+	addOns := sub.AddOns[:0]
+	for _, item := range sub.AddOns {
+		if item.AddOnID != addOn.ID {
+			addOns = append(addOns, item)
+		}
+	}
+	if quantity > 0 {
+		addOns = append(addOns, models.SubscriptionAddOn{SubscriptionID: sub.ID, AddOnID: addOn.ID, AddOn: addOn, Quantity: quantity})
+	}
+	sub.AddOns = addOns
+	b.Subscriptions.save(sub, models.SubscriptionEventPlanChanged, fmt.Sprintf("%s quantity set to %d", addOn.Name, quantity))
+
+	invoice := b.invoice(sub, billing.ReasonSubscriptionUpdate)
+	b.record(invoice)
+	return invoice, nil
+}
+
+func (b *Biller) Update(ctx context.Context, sub *models.Subscription, version uint, plan *models.Plan, cancel bool) (*models.Invoice, error) {
+	stored, err := b.Subscriptions.FindByID(ctx, sub.ID)
+	if err != nil {
+		return nil, err
+	}
+	if version != 0 && stored.Version != version {
+		return nil, service.ErrVersionConflict
+	}
+	*sub = *stored
+
+	var invoice *models.Invoice
+	if plan != nil && plan.ID != sub.PlanID {
+		if !sub.Active {
+			return nil, service.ErrNotActive
+		}
+		invoice, _ = b.ChangePlan(ctx, sub, *plan)
+	}
+	if cancel && sub.Status != models.SubscriptionStatusCancelled {
+		if !sub.Active {
+			return nil, service.ErrNotActive
+		}
+		return invoice, b.Cancel(ctx, sub, "Subscription cancelled")
+	}
+	return invoice, nil
+}
+
+func (b *Biller) RedeemPromotionCode(ctx context.Context, sub *models.Subscription, code string) error {
+	b.Subscriptions.save(sub, models.SubscriptionEventDiscounted, "Promotion code "+code+" applied")
+	return nil
+}
+
+func (b *Biller) Renew(ctx context.Context, sub *models.Subscription) (*models.Invoice, error) {
+	period := sub.ExpiresAt.Sub(sub.CurrentPeriodStart)
+	sub.CurrentPeriodStart = sub.ExpiresAt
+	sub.ExpiresAt = sub.ExpiresAt.Add(period)
+	b.Subscriptions.save(sub, models.SubscriptionEventRenewed, "Renewed")
+
+	invoice := b.invoice(sub, billing.ReasonSubscriptionCycle)
+	b.record(invoice)
+	return invoice, nil
+}
+
+func (b *Biller) Collect(ctx context.Context, invoice *models.Invoice) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	invoice.PaymentAttempts++
+	if b.FailPayments {
+		invoice.LastPaymentError = "card declined"
+		return fmt.Errorf("%w: card declined", billing.ErrPaymentFailed)
+	}
+
+	now := time.Now()
+	invoice.Status = models.InvoiceStatusPaid
+	invoice.AmountPaid = invoice.AmountDue
+	invoice.PaidAt = &now
+	invoice.LastPaymentError = ""
+	for i := range b.invoices {
+		if b.invoices[i].ID == invoice.ID {
+			b.invoices[i] = *invoice
+		}
+	}
+	return nil
+}
+
+func (b *Biller) StartDunning(ctx context.Context, sub *models.Subscription, invoice *models.Invoice, reason string) error {
+	now := time.Now()
+	sub.Status = models.SubscriptionStatusPastDue
+	sub.PastDueSince = &now
+	b.Subscriptions.save(sub, models.SubscriptionEventPaymentFailed, "Payment failed: "+reason)
+	return nil
+}
+
+func (b *Biller) Cancel(ctx context.Context, sub *models.Subscription, message string) error {
+	now := time.Now()
+	sub.Status = models.SubscriptionStatusCancelled
+	sub.Active = false
+	sub.PastDueSince = nil
+	sub.EndedAt = &now
+	b.Subscriptions.save(sub, models.SubscriptionEventStatusChanged, message)
+	return nil
+}
+
+// invoice raises an open invoice for a subscription. Amounts are left at
+// zero; tests that care about them set them on the returned invoice.
+func (b *Biller) invoice(sub *models.Subscription, reason string) *models.Invoice {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	return &models.Invoice{
+		ID:             uint(len(b.invoices) + 1),
+		CreatedAt:      now,
+		UserID:         sub.UserID,
+		SubscriptionID: &sub.ID,
+		Status:         models.InvoiceStatusOpen,
+		BillingReason:  reason,
+		Currency:       sub.Currency,
+		IssuedAt:       &now,
+		PeriodStart:    sub.CurrentPeriodStart,
+		PeriodEnd:      sub.ExpiresAt,
+	}
+}
+
+func (b *Biller) record(invoice *models.Invoice) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.invoices = append(b.invoices, *invoice)
+}
+
+// start creates a subscription, active once pay has succeeded and
+// incomplete_expired if it fails, unless its user already holds an active
+// or incomplete one. The check and the insert happen under one lock, as the
+// real biller makes them under a lock on the user.
+func (r *Subscriptions) start(subscription *models.Subscription, pay func() error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.subscriptions {
+		if existing.UserID == subscription.UserID && (existing.Active || existing.Status == models.SubscriptionStatusIncomplete) {
+			return service.ErrAlreadySubscribed
+		}
+	}
+	err := pay()
+	if err != nil {
+		now := time.Now()
+		subscription.Status = models.SubscriptionStatusIncompleteExpired
+		subscription.Active = false
+		subscription.EndedAt = &now
+	}
+	r.saveLocked(subscription, models.SubscriptionEventCreated, "Subscription created")
+	return err
+}
+
+var _ service.Biller = (*Biller)(nil)
@@ -0,0 +1,350 @@
+// Package memory provides in-memory implementations of the repository
+// interfaces and of service.Biller for exercising services and handlers
+// without a database. They keep no indexes and suit small data sets only.
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/repository"
+)
+
+// Users is an in-memory repository.UserRepository
+type Users struct {
+	mu     sync.Mutex
+	users  map[uint]models.User
+	nextID uint
+}
+
+func NewUsers(users ...models.User) *Users {
+	r := &Users{users: map[uint]models.User{}}
+	for _, user := range users {
+		r.Create(context.Background(), &user)
+	}
+	return r
+}
+
+func (r *Users) List(ctx context.Context, q listquery.Query[models.User]) (listquery.Page[models.User], error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := make([]models.User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, user)
+	}
+	return listquery.Slice(users, q), nil
+}
+
+func (r *Users) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *Users) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if strings.EqualFold(user.Email, email) {
+			return &user, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *Users) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	user.ID = r.nextID
+	user.CreatedAt = time.Now()
+	user.UpdatedAt = user.CreatedAt
+	user.Version = 1
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *Users) Save(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[user.ID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if stored.Version != user.Version {
+		return repository.ErrVersionConflict
+	}
+	user.UpdatedAt = time.Now()
+	user.Version++
+	stored = *user
+	stored.Subscriptions = nil
+	r.users[user.ID] = stored
+	return nil
+}
+
+func (r *Users) Delete(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.users[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// Plans is an in-memory repository.PlanRepository
+type Plans struct {
+	mu     sync.Mutex
+	plans  map[uint]models.Plan
+	addOns map[uint]models.AddOn
+	nextID uint
+}
+
+func NewPlans(plans ...models.Plan) *Plans {
+	r := &Plans{plans: map[uint]models.Plan{}, addOns: map[uint]models.AddOn{}}
+	for _, plan := range plans {
+		r.Create(context.Background(), &plan)
+	}
+	return r
+}
+
+// AddAddOn adds an add-on to the catalogue
+func (r *Plans) AddAddOn(addOn models.AddOn) models.AddOn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	addOn.ID = r.nextID
+	r.addOns[addOn.ID] = addOn
+	return addOn
+}
+
+func (r *Plans) List(ctx context.Context, q listquery.Query[models.Plan]) (listquery.Page[models.Plan], error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	plans := make([]models.Plan, 0, len(r.plans))
+	for _, plan := range r.plans {
+		plans = append(plans, plan)
+	}
+	return listquery.Slice(plans, q), nil
+}
+
+func (r *Plans) FindByID(ctx context.Context, id uint) (*models.Plan, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	plan, ok := r.plans[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &plan, nil
+}
+
+func (r *Plans) Create(ctx context.Context, plan *models.Plan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	plan.ID = r.nextID
+	plan.CreatedAt = time.Now()
+	plan.UpdatedAt = plan.CreatedAt
+	plan.Version = 1
+	r.plans[plan.ID] = *plan
+	return nil
+}
+
+func (r *Plans) Save(ctx context.Context, plan *models.Plan) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.plans[plan.ID]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if stored.Version != plan.Version {
+		return repository.ErrVersionConflict
+	}
+	plan.UpdatedAt = time.Now()
+	plan.Version++
+	r.plans[plan.ID] = *plan
+	return nil
+}
+
+func (r *Plans) Delete(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.plans[id]; !ok {
+		return repository.ErrNotFound
+	}
+	delete(r.plans, id)
+	return nil
+}
+
+func (r *Plans) FindAddOn(ctx context.Context, id uint) (*models.AddOn, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	addOn, ok := r.addOns[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &addOn, nil
+}
+
+// Subscriptions is an in-memory repository.SubscriptionRepository. Biller
+// adds to it.
+type Subscriptions struct {
+	mu            sync.Mutex
+	subscriptions map[uint]models.Subscription
+	events        map[uint][]models.SubscriptionEvent
+	nextID        uint
+}
+
+func NewSubscriptions() *Subscriptions {
+	return &Subscriptions{subscriptions: map[uint]models.Subscription{}, events: map[uint][]models.SubscriptionEvent{}}
+}
+
+func (r *Subscriptions) List(ctx context.Context, q listquery.Query[models.Subscription]) (listquery.Page[models.Subscription], error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subscriptions := make([]models.Subscription, 0, len(r.subscriptions))
+	for _, subscription := range r.subscriptions {
+		subscriptions = append(subscriptions, subscription)
+	}
+	return listquery.Slice(subscriptions, q), nil
+}
+
+func (r *Subscriptions) FindByID(ctx context.Context, id uint) (*models.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	subscription, ok := r.subscriptions[id]
+	if !ok {
+		return nil, repository.ErrNotFound
+	}
+	return &subscription, nil
+}
+
+func (r *Subscriptions) ListByUser(ctx context.Context, userID uint) ([]models.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var subscriptions []models.Subscription
+	for _, subscription := range r.subscriptions {
+		if subscription.UserID == userID {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	sort.Slice(subscriptions, func(i, j int) bool { return subscriptions[i].ID < subscriptions[j].ID })
+	return subscriptions, nil
+}
+
+func (r *Subscriptions) FindActiveByUser(ctx context.Context, userID uint) (*models.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, subscription := range r.subscriptions {
+		if subscription.UserID == userID && subscription.Active {
+			return &subscription, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (r *Subscriptions) CountActiveByPlan(ctx context.Context, planID uint) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var total int64
+	for _, subscription := range r.subscriptions {
+		if subscription.PlanID == planID && subscription.Active {
+			total++
+		}
+	}
+	return total, nil
+}
+
+func (r *Subscriptions) Events(ctx context.Context, subscriptionID uint) ([]models.SubscriptionEvent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]models.SubscriptionEvent(nil), r.events[subscriptionID]...), nil
+}
+
+func (r *Subscriptions) save(subscription *models.Subscription, eventType, message string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.saveLocked(subscription, eventType, message)
+}
+
+func (r *Subscriptions) saveLocked(subscription *models.Subscription, eventType, message string) {
+	now := time.Now()
+	if subscription.ID == 0 {
+		r.nextID++
+		subscription.ID = r.nextID
+		subscription.CreatedAt = now
+	}
+	subscription.UpdatedAt = now
+	subscription.Version++
+	r.subscriptions[subscription.ID] = *subscription
+	r.events[subscription.ID] = append(r.events[subscription.ID], models.SubscriptionEvent{
+		ID:             uint(len(r.events[subscription.ID]) + 1),
+		CreatedAt:      now,
+		SubscriptionID: subscription.ID,
+		Type:           eventType,
+		Message:        message,
+	})
+}
+
+// Audit is an in-memory repository.AuditRepository
+type Audit struct {
+	mu      sync.Mutex
+	entries []models.AuditLog
+}
+
+func NewAudit() *Audit {
+	return &Audit{}
+}
+
+func (r *Audit) Record(ctx context.Context, entry *models.AuditLog) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry.ID = uint(len(r.entries) + 1)
+	entry.CreatedAt = time.Now()
+	r.entries = append(r.entries, *entry)
+	return nil
+}
+
+// Entries returns everything recorded so far, oldest first
+func (r *Audit) Entries() []models.AuditLog {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]models.AuditLog(nil), r.entries...)
+}
+
+var (
+	_ repository.UserRepository         = (*Users)(nil)
+	_ repository.PlanRepository         = (*Plans)(nil)
+	_ repository.SubscriptionRepository = (*Subscriptions)(nil)
+)
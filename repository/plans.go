@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormPlans struct {
+	db *gorm.DB
+}
+
+// NewPlanRepository returns a PlanRepository backed by db
+func NewPlanRepository(db *gorm.DB) PlanRepository {
+	return &gormPlans{db: db}
+}
+
+func (r *gormPlans) List(ctx context.Context, q listquery.Query[models.Plan]) (listquery.Page[models.Plan], error) {
+	var plans []models.Plan
+	err := q.Apply(r.db.WithContext(ctx).Preload("Prices")).Find(&plans).Error
+	return listquery.NewPage(q, plans), err
+}
+
+func (r *gormPlans) FindByID(ctx context.Context, id uint) (*models.Plan, error) {
+	var plan models.Plan
+	if err := r.db.WithContext(ctx).Preload("Prices").First(&plan, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &plan, nil
+}
+
+func (r *gormPlans) Create(ctx context.Context, plan *models.Plan) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Create(plan).Error
+}
+
+func (r *gormPlans) Save(ctx context.Context, plan *models.Plan) error {
+	return saveVersioned(r.db.WithContext(ctx), plan, &plan.Version)
+}
+
+func (r *gormPlans) Delete(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.Plan{}, id)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return result.Error
+}
+
+func (r *gormPlans) FindAddOn(ctx context.Context, id uint) (*models.AddOn, error) {
+	var addOn models.AddOn
+	if err := r.db.WithContext(ctx).First(&addOn, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &addOn, nil
+}
@@ -0,0 +1,94 @@
+// Package repository defines how users, plans, subscriptions and the audit
+// trail are stored and provides the GORM implementations used by the
+// server. Handlers and services depend on the interfaces so they can be
+// exercised against the in-memory implementations in repository/memory.
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrNotFound is returned when no record matches
+	ErrNotFound = errors.New("record not found")
+	// ErrVersionConflict is returned when a record changed after it was read
+	ErrVersionConflict = errors.New("record was changed by another update")
+)
+
+// UserRepository stores user accounts
+type UserRepository interface {
+	// List returns a page of users with their subscriptions
+	List(ctx context.Context, q listquery.Query[models.User]) (listquery.Page[models.User], error)
+	FindByID(ctx context.Context, id uint) (*models.User, error)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+	Create(ctx context.Context, user *models.User) error
+	// Save updates every column of an existing user, leaving its associations
+	// alone, provided it is still at the version it was read at. The user is
+	// left at its new version.
+	Save(ctx context.Context, user *models.User) error
+	Delete(ctx context.Context, id uint) error
+}
+
+// PlanRepository stores the catalogue of plans and add-ons
+type PlanRepository interface {
+	// List returns a page of plans with their regional prices
+	List(ctx context.Context, q listquery.Query[models.Plan]) (listquery.Page[models.Plan], error)
+	// FindByID returns a plan with its regional prices
+	FindByID(ctx context.Context, id uint) (*models.Plan, error)
+	Create(ctx context.Context, plan *models.Plan) error
+	// Save updates every column of an existing plan, leaving its prices
+	// alone, provided it is still at the version it was read at. The plan is
+	// left at its new version.
+	Save(ctx context.Context, plan *models.Plan) error
+	Delete(ctx context.Context, id uint) error
+	FindAddOn(ctx context.Context, id uint) (*models.AddOn, error)
+}
+
+// SubscriptionRepository reads subscriptions and their history. Changes to
+// subscriptions go through the billing engine, which invoices them.
+type SubscriptionRepository interface {
+	// List returns a page of subscriptions with their user and plan
+	List(ctx context.Context, q listquery.Query[models.Subscription]) (listquery.Page[models.Subscription], error)
+	FindByID(ctx context.Context, id uint) (*models.Subscription, error)
+	ListByUser(ctx context.Context, userID uint) ([]models.Subscription, error)
+	// FindActiveByUser returns the user's active subscription, if any
+	FindActiveByUser(ctx context.Context, userID uint) (*models.Subscription, error)
+	// CountActiveByPlan counts the active subscriptions on a plan
+	CountActiveByPlan(ctx context.Context, planID uint) (int64, error)
+	// Events returns a subscription's history, oldest first
+	Events(ctx context.Context, subscriptionID uint) ([]models.SubscriptionEvent, error)
+}
+
+// AuditRepository keeps the audit trail of changes to records
+type AuditRepository interface {
+	Record(ctx context.Context, entry *models.AuditLog) error
+}
+
+// saveVersioned updates every column of record, leaving its associations
+// alone, provided the row is still at *version. The database bumps the
+// version on every update, so *version is advanced to match.
+func saveVersioned(db *gorm.DB, record any, version *uint) error {
+	result := db.Model(record).Where("version = ?", *version).Select("*").Omit(clause.Associations).Updates(record)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVersionConflict
+	}
+	*version++
+	return nil
+}
+
+// notFound translates GORM's missing-record error into ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
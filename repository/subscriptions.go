@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+)
+
+type gormSubscriptions struct {
+	db *gorm.DB
+}
+
+// NewSubscriptionRepository returns a SubscriptionRepository backed by db
+func NewSubscriptionRepository(db *gorm.DB) SubscriptionRepository {
+	return &gormSubscriptions{db: db}
+}
+
+func (r *gormSubscriptions) List(ctx context.Context, q listquery.Query[models.Subscription]) (listquery.Page[models.Subscription], error) {
+	var subscriptions []models.Subscription
+	err := q.Apply(r.db.WithContext(ctx).Preload("User").Preload("Plan")).Find(&subscriptions).Error
+	return listquery.NewPage(q, subscriptions), err
+}
+
+func (r *gormSubscriptions) FindByID(ctx context.Context, id uint) (*models.Subscription, error) {
+	var subscription models.Subscription
+	if err := r.db.WithContext(ctx).First(&subscription, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &subscription, nil
+}
+
+func (r *gormSubscriptions) ListByUser(ctx context.Context, userID uint) ([]models.Subscription, error) {
+	var subscriptions []models.Subscription
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&subscriptions).Error
+	return subscriptions, err
+}
+
+func (r *gormSubscriptions) FindActiveByUser(ctx context.Context, userID uint) (*models.Subscription, error) {
+	var subscription models.Subscription
+	if err := r.db.WithContext(ctx).Where("user_id = ? AND active = ?", userID, true).First(&subscription).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &subscription, nil
+}
+
+func (r *gormSubscriptions) CountActiveByPlan(ctx context.Context, planID uint) (int64, error) {
+	var total int64
+	err := r.db.WithContext(ctx).Model(&models.Subscription{}).Where("plan_id = ? AND active = ?", planID, true).Count(&total).Error
+	return total, err
+}
+
+func (r *gormSubscriptions) Events(ctx context.Context, subscriptionID uint) ([]models.SubscriptionEvent, error) {
+	var events []models.SubscriptionEvent
+	err := r.db.WithContext(ctx).Where("subscription_id = ?", subscriptionID).Order("created_at, id").Find(&events).Error
+	return events, err
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormUsers struct {
+	db *gorm.DB
+}
+
+// NewUserRepository returns a UserRepository backed by db
+func NewUserRepository(db *gorm.DB) UserRepository {
+	return &gormUsers{db: db}
+}
+
+func (r *gormUsers) List(ctx context.Context, q listquery.Query[models.User]) (listquery.Page[models.User], error) {
+	var users []models.User
+	err := q.Apply(r.db.WithContext(ctx).Preload("Subscriptions")).Find(&users).Error
+	return listquery.NewPage(q, users), err
+}
+
+func (r *gormUsers) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).First(&user, id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUsers) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	if err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUsers) Create(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Omit(clause.Associations).Create(user).Error
+}
+
+func (r *gormUsers) Save(ctx context.Context, user *models.User) error {
+	return saveVersioned(r.db.WithContext(ctx), user, &user.Version)
+}
+
+func (r *gormUsers) Delete(ctx context.Context, id uint) error {
+	result := r.db.WithContext(ctx).Delete(&models.User{}, id)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return result.Error
+}
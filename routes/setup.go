@@ -1,13 +1,68 @@
 package routes
 
 import (
+	"github.com/chandra-devs/subscription_app/config"
 	"github.com/chandra-devs/subscription_app/controllers"
 	"github.com/chandra-devs/subscription_app/handlers"
+	"github.com/chandra-devs/subscription_app/middleware"
+	"github.com/chandra-devs/subscription_app/repository"
+	"github.com/chandra-devs/subscription_app/service"
 	"github.com/gofiber/fiber/v2"
 )
 
+// Handlers holds the request handlers that are built on services. Legacy
+// is set when clients still expect the response shapes the API had before
+// the handlers package became canonical.
+type Handlers struct {
+	Auth          *handlers.AuthHandler
+	Users         *handlers.UserHandler
+	Plans         *handlers.PlanHandler
+	Subscriptions *handlers.SubscriptionHandler
+	Legacy        *LegacyHandlers
+}
+
+// LegacyHandlers serve the endpoints whose legacy response shape differs
+// from the canonical one
+type LegacyHandlers struct {
+	Auth          *controllers.AuthController
+	Users         *controllers.UserController
+	Subscriptions *controllers.SubscriptionController
+}
+
+// NewHandlers builds the handlers on repositories and a biller backed by
+// the application database
+func NewHandlers() *Handlers {
+	users := repository.NewUserRepository(config.DB)
+	plans := repository.NewPlanRepository(config.DB)
+	subscriptions := repository.NewSubscriptionRepository(config.DB)
+	audit := repository.NewAuditRepository(config.DB)
+
+	biller := service.NewBiller(config.DB)
+
+	userService := service.NewUserService(users, subscriptions, biller, audit)
+	planService := service.NewPlanService(plans, subscriptions, audit)
+	subscriptionService := service.NewSubscriptionService(users, plans, subscriptions, biller, audit)
+
+	h := &Handlers{
+		Auth:          handlers.NewAuthHandler(userService),
+		Users:         handlers.NewUserHandler(userService),
+		Plans:         handlers.NewPlanHandler(planService, userService),
+		Subscriptions: handlers.NewSubscriptionHandler(subscriptionService),
+	}
+	if config.API.LegacyResponses {
+		h.Legacy = &LegacyHandlers{
+			Auth:          controllers.NewAuthController(userService),
+			Users:         controllers.NewUserController(userService),
+			Subscriptions: controllers.NewSubscriptionController(subscriptionService),
+		}
+	}
+	return h
+}
+
 // SetupRoutes initializes all application routes
 func SetupRoutes(app *fiber.App) {
+	h := NewHandlers()
+
 	// Serve static files from the "public" directory
 	app.Static("/", "./public")
 
@@ -27,44 +82,160 @@ func SetupRoutes(app *fiber.App) {
 	// Generate PDF route
 	app.Get("/generate-pdf", controllers.GeneratePDF)
 
-	api := app.Group("/api/v1")
+	// Payment provider webhooks, authenticated by signature
+	app.Post("/webhooks/payments", handlers.ReceivePaymentWebhook)
+
+	// Mutating requests sent with an Idempotency-Key are safe to retry
+	api := app.Group("/api/v1", middleware.Idempotency())
 
 	// Setup all route groups
-	SetupAuthRoutes(api)
-	SetupUserRoutes(api)
-	SetupSubscriptionRoutes(api)
-	SetupPlanRoutes(api)
+	SetupAuthRoutes(api, h)
+	SetupUserRoutes(api, h)
+	SetupSubscriptionRoutes(api, h)
+	SetupPlanRoutes(api, h.Plans)
+	SetupAddOnRoutes(api)
+	SetupInvoiceRoutes(api)
+	SetupPaymentRoutes(api)
+	SetupAdminRoutes(api)
 }
 
 // SetupAuthRoutes configures authentication routes
-func SetupAuthRoutes(router fiber.Router) {
+func SetupAuthRoutes(router fiber.Router, h *Handlers) {
 	auth := router.Group("/auth")
-	auth.Post("/register", controllers.Register)
-	auth.Post("/login", controllers.Login)
+	if h.Legacy != nil {
+		auth.Post("/register", h.Legacy.Auth.Register)
+		auth.Post("/login", h.Legacy.Auth.Login)
+		return
+	}
+	auth.Post("/register", h.Auth.Register)
+	auth.Post("/login", h.Auth.Login)
 }
 
 // SetupUserRoutes configures user management routes
-func SetupUserRoutes(router fiber.Router) {
+func SetupUserRoutes(router fiber.Router, h *Handlers) {
 	users := router.Group("/users")
-	users.Get("/", controllers.GetUsers)
-	users.Get("/:id", controllers.GetUser)
-	users.Post("/", controllers.CreateUser)
-	users.Put("/:id", controllers.UpdateUser)
-	users.Delete("/:id", controllers.DeleteUser)
+	if h.Legacy != nil {
+		users.Get("/", middleware.Protected(), middleware.AdminOnly(), h.Legacy.Users.GetUsers)
+		users.Get("/:id", middleware.Protected(), h.Legacy.Users.GetUser)
+		users.Post("/", middleware.Protected(), middleware.AdminOnly(), h.Legacy.Users.CreateUser)
+		users.Put("/:id", middleware.Protected(), h.Legacy.Users.UpdateUser)
+		users.Delete("/:id", middleware.Protected(), h.Legacy.Users.DeleteUser)
+		return
+	}
+	users.Get("/", middleware.Protected(), middleware.AdminOnly(), h.Users.GetUsers)
+	users.Get("/:id", middleware.Protected(), h.Users.GetUser)
+	users.Post("/", middleware.Protected(), middleware.AdminOnly(), h.Users.CreateUser)
+	users.Put("/:id", middleware.Protected(), h.Users.UpdateUser)
+	users.Patch("/:id", middleware.Protected(), h.Users.UpdateUser)
+	users.Delete("/:id", middleware.Protected(), h.Users.DeleteUser)
 }
 
 // SetupSubscriptionRoutes configures subscription management routes
-func SetupSubscriptionRoutes(router fiber.Router) {
+func SetupSubscriptionRoutes(router fiber.Router, h *Handlers) {
 	subscriptions := router.Group("/subscriptions")
-	subscriptions.Get("/user/:userId", handlers.GetUserSubscriptions)
-	subscriptions.Post("/subscribe", handlers.SubscribeUser)
-	subscriptions.Post("/", handlers.CreateSubscription)
+	if h.Legacy != nil {
+		subscriptions.Get("/user/:userId", middleware.Protected(), h.Legacy.Subscriptions.GetUserSubscriptions)
+		subscriptions.Post("/", middleware.Protected(), h.Legacy.Subscriptions.CreateSubscription)
+	} else {
+		subscriptions.Get("/user/:userId", middleware.Protected(), h.Subscriptions.GetUserSubscriptions)
+		subscriptions.Post("/", middleware.Protected(), h.Subscriptions.CreateSubscription)
+	}
+	subscriptions.Get("/", middleware.Protected(), middleware.AdminOnly(), h.Subscriptions.GetSubscriptions)
+	subscriptions.Get("/stats", middleware.Protected(), middleware.AdminOnly(), handlers.GetSubscriptionStats)
+	subscriptions.Get("/cohorts", middleware.Protected(), middleware.AdminOnly(), handlers.GetCohortRetention)
+	subscriptions.Post("/subscribe", middleware.Protected(), h.Subscriptions.SubscribeUser)
+	subscriptions.Get("/:id", middleware.Protected(), h.Subscriptions.GetSubscription)
+	subscriptions.Put("/:id", middleware.Protected(), middleware.AdminOnly(), h.Subscriptions.UpdateSubscription)
+	subscriptions.Patch("/:id", middleware.Protected(), h.Subscriptions.UpdateSubscription)
+	subscriptions.Delete("/:id", middleware.Protected(), h.Subscriptions.DeleteSubscription)
+	subscriptions.Post("/:id/change-plan", middleware.Protected(), h.Subscriptions.ChangeSubscriptionPlan)
+	subscriptions.Put("/:id/addons/:addonId", middleware.Protected(), h.Subscriptions.SetSubscriptionAddOn)
+	subscriptions.Post("/:id/discount", middleware.Protected(), h.Subscriptions.ApplySubscriptionPromotionCode)
+	subscriptions.Get("/:id/history", middleware.Protected(), h.Subscriptions.GetSubscriptionHistory)
+	subscriptions.Post("/:id/renew", middleware.Protected(), middleware.AdminOnly(), h.Subscriptions.RenewSubscription)
 }
 
 // SetupPlanRoutes configures plan management routes
-func SetupPlanRoutes(router fiber.Router) {
+func SetupPlanRoutes(router fiber.Router, h *handlers.PlanHandler) {
 	plans := router.Group("/plans")
-	plans.Get("/", handlers.GetPlans)
-	plans.Get("/:id", handlers.GetPlanByID)
-	plans.Post("/", handlers.CreatePlan)
+	plans.Get("/", middleware.OptionalAuth(), h.GetPlans)
+	plans.Get("/:id", h.GetPlanByID)
+	plans.Post("/", middleware.Protected(), middleware.AdminOnly(), h.CreatePlan)
+	plans.Put("/:id", middleware.Protected(), middleware.AdminOnly(), h.UpdatePlan)
+	plans.Patch("/:id", middleware.Protected(), middleware.AdminOnly(), h.PatchPlan)
+	plans.Delete("/:id", middleware.Protected(), middleware.AdminOnly(), h.DeletePlan)
+
+	// Regional price books
+	plans.Get("/:id/prices", handlers.GetPlanPrices)
+	plans.Put("/:id/prices", middleware.Protected(), middleware.AdminOnly(), handlers.SetPlanPrice)
+	plans.Delete("/:id/prices/:currency", middleware.Protected(), middleware.AdminOnly(), handlers.DeletePlanPrice)
+}
+
+// SetupAddOnRoutes configures add-on catalogue routes
+func SetupAddOnRoutes(router fiber.Router) {
+	addOns := router.Group("/addons")
+	addOns.Get("/", handlers.GetAddOns)
+	addOns.Post("/", middleware.Protected(), middleware.AdminOnly(), handlers.CreateAddOn)
+}
+
+// SetupInvoiceRoutes configures the caller's invoice routes
+func SetupInvoiceRoutes(router fiber.Router) {
+	invoices := router.Group("/invoices", middleware.Protected())
+	invoices.Get("/", handlers.GetMyInvoices)
+	invoices.Get("/:id", handlers.GetMyInvoice)
+	invoices.Get("/:id/pdf", handlers.GetMyInvoicePDF)
+	invoices.Post("/:id/pay", handlers.PayMyInvoice)
+}
+
+// SetupPaymentRoutes configures the caller's payment method, balance and
+// billing profile routes
+func SetupPaymentRoutes(router fiber.Router) {
+	paymentMethods := router.Group("/payment-methods", middleware.Protected())
+	paymentMethods.Post("/", handlers.AddPaymentMethod)
+
+	router.Get("/balance", middleware.Protected(), handlers.GetMyBalance)
+
+	profile := router.Group("/profile", middleware.Protected())
+	profile.Get("/billing", handlers.GetMyBillingProfile)
+	profile.Put("/billing", handlers.UpdateMyBillingProfile)
+}
+
+// SetupAdminRoutes configures administrator-only routes
+func SetupAdminRoutes(router fiber.Router) {
+	admin := router.Group("/admin", middleware.Protected(), middleware.AdminOnly())
+
+	invoices := admin.Group("/invoices")
+	invoices.Get("/", handlers.GetInvoices)
+	invoices.Get("/:id", handlers.GetInvoice)
+	invoices.Get("/:id/pdf", handlers.GetInvoicePDF)
+	invoices.Get("/:id/revenue-schedules", handlers.GetInvoiceRevenueSchedules)
+	invoices.Post("/:id/finalize", handlers.FinalizeInvoice)
+	invoices.Post("/:id/pay", handlers.PayInvoice)
+	invoices.Post("/:id/void", handlers.VoidInvoice)
+	invoices.Post("/:id/credit-notes", handlers.CreditInvoice)
+	invoices.Post("/:id/refunds", handlers.RefundInvoice)
+
+	coupons := admin.Group("/coupons")
+	coupons.Get("/", handlers.GetCoupons)
+	coupons.Post("/", handlers.CreateCoupon)
+
+	promotionCodes := admin.Group("/promotion-codes")
+	promotionCodes.Get("/", handlers.GetPromotionCodes)
+	promotionCodes.Post("/", handlers.CreatePromotionCode)
+
+	taxRates := admin.Group("/tax-rates")
+	taxRates.Get("/", handlers.GetTaxRates)
+	taxRates.Put("/", handlers.SetTaxRate)
+
+	admin.Get("/revenue", handlers.GetRevenueReport)
+
+	users := admin.Group("/users")
+	users.Get("/:id/balance", handlers.GetUserBalance)
+	users.Post("/:id/credit", handlers.GrantCredit)
+
+	webhookEvents := admin.Group("/webhooks")
+	webhookEvents.Get("/", handlers.GetWebhookEvents)
+	webhookEvents.Post("/:id/replay", handlers.ReplayWebhookEvent)
+
+	admin.Get("/audit-logs", handlers.GetAuditLogs)
 }
@@ -0,0 +1,49 @@
+// Package scheduler runs recurring background jobs such as renewals and
+// payment retries.
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Job is a unit of recurring work
+type Job struct {
+	Name string
+	Run  func(ctx context.Context, now time.Time) error
+}
+
+// Start runs the jobs once straight away and then every interval, in order,
+// until ctx is cancelled. Jobs must be safe to run on several replicas at once.
+func Start(ctx context.Context, interval time.Duration, jobs ...Job) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			runAll(ctx, jobs)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func runAll(ctx context.Context, jobs []Job) {
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		started := time.Now()
+		if err := job.Run(ctx, started); err != nil {
+			log.Printf("Scheduled job %s failed: %v", job.Name, err)
+			continue
+		}
+		log.Printf("Scheduled job %s finished in %v", job.Name, time.Since(started))
+	}
+}
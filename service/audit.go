@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/patch"
+	"github.com/chandra-devs/subscription_app/repository"
+)
+
+// recordUpdate adds the fields an update changed to the audit trail by
+// comparing the record before and after it. Fields named in ignore, such as
+// associations, are left out, as are the update time and version that
+// every update changes; an update that changed nothing else is not
+// recorded. actorID is zero when the caller is not known.
+func recordUpdate(ctx context.Context, audit repository.AuditRepository, actorID uint, entityType string, entityID uint, before, after any, ignore ...string) error {
+	changes, err := patch.Diff(before, after, append(ignore, "updated_at", "version")...)
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+
+	entry := &models.AuditLog{
+		EntityType: entityType,
+		EntityID:   entityID,
+		Action:     models.AuditActionUpdate,
+		Changes:    changes,
+	}
+	if actorID != 0 {
+		entry.ActorID = &actorID
+	}
+	return audit.Record(ctx, entry)
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/payments"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// firstPaymentAttempts is how often Start charges the first invoice while
+// the outcome of each charge is unknown, waiting a multiple of
+// firstPaymentBackoff longer after each
+const firstPaymentAttempts = 3
+
+var firstPaymentBackoff = 500 * time.Millisecond
+
+// uniqueViolation is the SQLSTATE Postgres reports when an insert breaks a
+// unique index
+const uniqueViolation = "23505"
+
+// Biller applies subscription changes that raise invoices. Each method
+// makes its change and the invoice in one transaction; payments are
+// collected after it commits.
+type Biller interface {
+	// Start creates a subscription, redeems the promotion code if one is
+	// given, and raises and collects the first invoice. The subscription is
+	// incomplete until the invoice is paid; if the payment fails the
+	// invoice is voided, the subscription left incomplete_expired and the
+	// payment error returned. A payment that may have gone through is
+	// tried again before it counts as failed. Nothing is kept for a user without a payment
+	// method. It fails with ErrUserNotFound if the user does not exist and
+	// with ErrAlreadySubscribed if they already hold an active or incomplete
+	// subscription, even when two starts for a user race.
+	Start(ctx context.Context, sub *models.Subscription, promotionCode string) (*models.Invoice, error)
+	ChangePlan(ctx context.Context, sub *models.Subscription, plan models.Plan) (*models.Invoice, error)
+	// ChangeAddOn sets the quantity of an add-on and reloads the
+	// subscription's add-ons
+	ChangeAddOn(ctx context.Context, sub *models.Subscription, addOn models.AddOn, quantity int) (*models.Invoice, error)
+	// Update applies a direct change in one transaction, provided the
+	// subscription is still at version; zero skips the check, and a
+	// subscription that has moved on fails with ErrVersionConflict. A plan,
+	// if given, is changed to as ChangePlan does, and cancel ends the
+	// subscription.
+	Update(ctx context.Context, sub *models.Subscription, version uint, plan *models.Plan, cancel bool) (*models.Invoice, error)
+	RedeemPromotionCode(ctx context.Context, sub *models.Subscription, code string) error
+	Renew(ctx context.Context, sub *models.Subscription) (*models.Invoice, error)
+	// Collect charges an open invoice. A failed attempt stays recorded on the
+	// invoice.
+	Collect(ctx context.Context, invoice *models.Invoice) error
+	StartDunning(ctx context.Context, sub *models.Subscription, invoice *models.Invoice, reason string) error
+	// Cancel ends a subscription immediately
+	Cancel(ctx context.Context, sub *models.Subscription, message string) error
+}
+
+type gormBiller struct {
+	db *gorm.DB
+}
+
+// NewBiller returns a Biller running the billing engine against db
+func NewBiller(db *gorm.DB) Biller {
+	return &gormBiller{db: db}
+}
+
+func (b *gormBiller) Start(ctx context.Context, sub *models.Subscription, promotionCode string) (*models.Invoice, error) {
+	db := b.db.WithContext(ctx)
+
+	var invoice *models.Invoice
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user so concurrent starts for them run one at a time and
+		// the second sees the subscription the first created
+		var user models.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, sub.UserID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var held int64
+		if err := tx.Model(&models.Subscription{}).
+			Where("user_id = ? AND (active OR status = ?)", sub.UserID, models.SubscriptionStatusIncomplete).
+			Count(&held).Error; err != nil {
+			return err
+		}
+		if held > 0 {
+			return ErrAlreadySubscribed
+		}
+
+		// The subscription gives no access until its first invoice is paid.
+		// The unique index on held subscriptions backs up the check for
+		// writers that do not take the lock.
+		sub.Status = models.SubscriptionStatusIncomplete
+		if err := tx.Create(sub).Error; err != nil {
+			if isUniqueViolation(err) {
+				return ErrAlreadySubscribed
+			}
+			return err
+		}
+		// Created with the column default; cleared here since gorm does not
+		// insert a false default
+		sub.Active = false
+		if err := tx.Model(sub).Update("active", false).Error; err != nil {
+			return err
+		}
+
+		if promotionCode != "" {
+			if _, err := billing.RedeemPromotionCode(tx, sub, promotionCode); err != nil {
+				return err
+			}
+		}
+		if invoice, err = billing.InvoiceSubscriptionStart(tx, sub); err != nil {
+			return err
+		}
+		if invoice.Status != models.InvoiceStatusOpen {
+			return billing.SetSubscriptionStatus(tx, sub, models.SubscriptionStatusActive, "Nothing to pay for the first period")
+		}
+		// Keep nothing, not even an invoice number, for a customer who cannot pay
+		if user.PaymentCustomerID == "" || user.DefaultPaymentMethodID == "" {
+			return billing.ErrNoPaymentMethod
+		}
+		return nil
+	})
+	if err != nil || invoice.Status != models.InvoiceStatusOpen {
+		return invoice, err
+	}
+
+	// The first invoice is charged with nothing locked; the outcome either
+	// starts the subscription or ends it with the invoice voided. A charge
+	// whose outcome is unknown, such as one that timed out, is made again
+	// under the same idempotency key first, so a charge that went through
+	// is found rather than voided with the invoice.
+	for attempt := 1; ; attempt++ {
+		unknown := false
+		err = billing.Collect(ctx, db, invoice, func(tx *gorm.DB, invoice *models.Invoice, paymentErr error) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(sub, sub.ID).Error; err != nil {
+				return err
+			}
+			if paymentErr == nil {
+				return billing.SetSubscriptionStatus(tx, sub, models.SubscriptionStatusActive, "First invoice paid")
+			}
+			if attempt < firstPaymentAttempts && !payments.IsDeclined(paymentErr) && !errors.Is(paymentErr, billing.ErrNoPaymentMethod) {
+				unknown = true
+				return nil
+			}
+			if err := billing.Void(tx, invoice); err != nil {
+				return err
+			}
+			return billing.SetSubscriptionStatus(tx, sub, models.SubscriptionStatusIncompleteExpired, "First payment failed: "+paymentErr.Error())
+		})
+		if !unknown {
+			return invoice, err
+		}
+		// A request that goes away leaves the subscription incomplete and
+		// its invoice open rather than voided, since the charge may have
+		// gone through; paying the invoice starts it
+		select {
+		case <-ctx.Done():
+			return invoice, ctx.Err()
+		case <-time.After(time.Duration(attempt) * firstPaymentBackoff):
+		}
+	}
+}
+
+// isUniqueViolation reports whether err is Postgres refusing a row that
+// breaks a unique index
+func isUniqueViolation(err error) bool {
+	var pgErr interface{ SQLState() string }
+	return errors.As(err, &pgErr) && pgErr.SQLState() == uniqueViolation
+}
+
+func (b *gormBiller) ChangePlan(ctx context.Context, sub *models.Subscription, plan models.Plan) (*models.Invoice, error) {
+	var invoice *models.Invoice
+	err := b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		invoice, err = billing.ChangePlan(tx, sub, plan)
+		return err
+	})
+	return invoice, changeError(err)
+}
+
+func (b *gormBiller) ChangeAddOn(ctx context.Context, sub *models.Subscription, addOn models.AddOn, quantity int) (*models.Invoice, error) {
+	var invoice *models.Invoice
+	err := b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if invoice, err = billing.ChangeAddOn(tx, sub, addOn, quantity); err != nil {
+			return err
+		}
+		return tx.Preload("AddOns.AddOn").First(sub, sub.ID).Error
+	})
+	return invoice, changeError(err)
+}
+
+func (b *gormBiller) Update(ctx context.Context, sub *models.Subscription, version uint, plan *models.Plan, cancel bool) (*models.Invoice, error) {
+	var invoice *models.Invoice
+	err := b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The version is compared under the lock, so of two updates made
+		// against the same version only the first is applied
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(sub, sub.ID).Error; err != nil {
+			return err
+		}
+		if err := checkVersion(sub.Version, version); err != nil {
+			return err
+		}
+
+		if plan != nil && plan.ID != sub.PlanID {
+			var err error
+			if invoice, err = billing.ChangePlan(tx, sub, *plan); err != nil {
+				return err
+			}
+		}
+		if cancel && sub.Status != models.SubscriptionStatusCancelled {
+			if !sub.Active {
+				return ErrNotActive
+			}
+			return billing.CancelSubscription(tx, sub, "Subscription cancelled")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, changeError(err)
+	}
+	return invoice, nil
+}
+
+// changeError translates the billing engine's refusal of a change to a
+// subscription that moved on since it was read
+func changeError(err error) error {
+	switch {
+	case errors.Is(err, billing.ErrNotActive):
+		return ErrNotActive
+	case errors.Is(err, billing.ErrPlanChanged):
+		return ErrVersionConflict
+	}
+	return err
+}
+
+func (b *gormBiller) RedeemPromotionCode(ctx context.Context, sub *models.Subscription, code string) error {
+	return b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		_, err := billing.RedeemPromotionCode(tx, sub, code)
+		return err
+	})
+}
+
+func (b *gormBiller) Renew(ctx context.Context, sub *models.Subscription) (*models.Invoice, error) {
+	var invoice *models.Invoice
+	err := b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		invoice, err = billing.Renew(tx, sub)
+		return err
+	})
+	return invoice, err
+}
+
+func (b *gormBiller) Collect(ctx context.Context, invoice *models.Invoice) error {
+	return billing.Collect(ctx, b.db.WithContext(ctx), invoice, nil)
+}
+
+func (b *gormBiller) StartDunning(ctx context.Context, sub *models.Subscription, invoice *models.Invoice, reason string) error {
+	return b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return billing.StartDunning(ctx, tx, sub, invoice, reason)
+	})
+}
+
+func (b *gormBiller) Cancel(ctx context.Context, sub *models.Subscription, message string) error {
+	return b.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return billing.CancelSubscription(tx, sub, message)
+	})
+}
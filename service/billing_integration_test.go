@@ -0,0 +1,359 @@
+//go:build integration
+
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/config"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/payments"
+	"github.com/chandra-devs/subscription_app/repository"
+	"github.com/chandra-devs/subscription_app/testdb"
+	"gorm.io/gorm"
+)
+
+// billingFixture is a migrated database with a customer whose card behaves
+// as the token it was attached with, a monthly plan, and the fake provider
+// charging it
+type billingFixture struct {
+	db            *gorm.DB
+	provider      *payments.FakeProvider
+	user          *models.User
+	plan          *models.Plan
+	subscriptions *SubscriptionService
+}
+
+func newBillingFixture(t *testing.T, token string) *billingFixture {
+	t.Helper()
+	config.InitBillingConfig()
+	db := testdb.Open(t)
+	provider := payments.NewFakeProvider()
+	previous := billing.Payments
+	billing.Payments = provider
+	t.Cleanup(func() { billing.Payments = previous })
+
+	user := &models.User{Name: "Ada Lovelace", Email: "ada@example.com", Password: "not a real hash"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := billing.AddPaymentMethod(context.Background(), db, user, token); err != nil {
+		t.Fatal(err)
+	}
+	plan := &models.Plan{Name: "Pro", Price: 20, Duration: 30, IntervalUnit: billing.IntervalMonth, IntervalCount: 1}
+	if err := db.Create(plan).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	subscriptions := NewSubscriptionService(
+		repository.NewUserRepository(db),
+		repository.NewPlanRepository(db),
+		repository.NewSubscriptionRepository(db),
+		NewBiller(db),
+		repository.NewAuditRepository(db),
+	)
+	return &billingFixture{db: db, provider: provider, user: user, plan: plan, subscriptions: subscriptions}
+}
+
+func TestStartLetsOneOfConcurrentSubscribesWin(t *testing.T) {
+	f := newBillingFixture(t, payments.TokenVisa)
+
+	const attempts = 8
+	var ready sync.WaitGroup
+	ready.Add(1)
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		go func() {
+			ready.Wait()
+			_, _, err := f.subscriptions.Subscribe(context.Background(), SubscribeParams{UserID: f.user.ID, PlanID: f.plan.ID})
+			errs <- err
+		}()
+	}
+	ready.Done()
+
+	var won, refused int
+	for i := 0; i < attempts; i++ {
+		switch err := <-errs; {
+		case err == nil:
+			won++
+		case errors.Is(err, ErrAlreadySubscribed):
+			refused++
+		default:
+			t.Errorf("Subscribe: %v", err)
+		}
+	}
+	if won != 1 || refused != attempts-1 {
+		t.Errorf("%d subscribes won and %d were refused, want 1 and %d", won, refused, attempts-1)
+	}
+
+	var stored int64
+	f.db.Model(&models.Subscription{}).Where("user_id = ?", f.user.ID).Count(&stored)
+	if stored != 1 {
+		t.Errorf("%d subscriptions stored, want 1", stored)
+	}
+	if charges := f.provider.Charges(); len(charges) != 1 {
+		t.Errorf("customer charged %d times, want once", len(charges))
+	}
+}
+
+func TestHeldSubscriptionIndexRefusesASecondOne(t *testing.T) {
+	f := newBillingFixture(t, payments.TokenVisa)
+
+	held := func() *models.Subscription {
+		now := time.Now()
+		return &models.Subscription{
+			UserID:             f.user.ID,
+			PlanID:             f.plan.ID,
+			Status:             models.SubscriptionStatusIncomplete,
+			StartDate:          now,
+			BillingCycleAnchor: now,
+			CurrentPeriodStart: now,
+			ExpiresAt:          now.AddDate(0, 1, 0),
+			Currency:           config.Billing.BaseCurrency,
+		}
+	}
+	if err := f.db.Create(held()).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// A writer that skips Start's lock is stopped by the index, and the
+	// error it gets is the one Start reports as ErrAlreadySubscribed
+	err := f.db.Create(held()).Error
+	if !isUniqueViolation(err) {
+		t.Fatalf("second held subscription: err = %v, want a unique violation", err)
+	}
+}
+
+func TestSubscribeThroughTheFakeProvider(t *testing.T) {
+	previousBackoff := firstPaymentBackoff
+	firstPaymentBackoff = 0
+	t.Cleanup(func() { firstPaymentBackoff = previousBackoff })
+
+	tests := []struct {
+		name  string
+		token string
+		// fail makes the provider fail charges on top of the card's token
+		fail         func(*payments.FakeProvider)
+		wantErr      error
+		wantAttempts int // charges tried for the first invoice
+		wantKey      int // the collection the invoice is left under, 0 for none
+	}{
+		{
+			name:         "paid",
+			token:        payments.TokenVisa,
+			wantAttempts: 1,
+			wantKey:      1,
+		},
+		{
+			name:         "card declined",
+			token:        payments.TokenCardDeclined,
+			wantErr:      payments.ErrCardDeclined,
+			wantAttempts: 1,
+		},
+		{
+			name:         "insufficient funds",
+			token:        payments.TokenInsufficientFunds,
+			wantErr:      payments.ErrInsufficientFunds,
+			wantAttempts: 1,
+		},
+		{
+			// Every attempt shares the key, since none is known to have failed
+			name:         "timeout",
+			token:        payments.TokenNetworkTimeout,
+			wantErr:      payments.ErrNetworkTimeout,
+			wantAttempts: firstPaymentAttempts,
+			wantKey:      1,
+		},
+		{
+			name:         "timeout then paid",
+			token:        payments.TokenVisa,
+			fail:         func(p *payments.FakeProvider) { p.FailNext(payments.ErrNetworkTimeout) },
+			wantAttempts: 2,
+			wantKey:      1,
+		},
+		{
+			// The retry finds the charge whose response was lost
+			name:         "timeout once charged",
+			token:        payments.TokenVisa,
+			fail:         func(p *payments.FakeProvider) { p.FailNextAfterCharge(payments.ErrNetworkTimeout) },
+			wantAttempts: 2,
+			wantKey:      1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newBillingFixture(t, tt.token)
+			if tt.fail != nil {
+				tt.fail(f.provider)
+			}
+
+			_, _, err := f.subscriptions.Subscribe(context.Background(), SubscribeParams{UserID: f.user.ID, PlanID: f.plan.ID})
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("Subscribe: %v", err)
+			}
+			if tt.wantErr != nil && (!errors.Is(err, billing.ErrPaymentFailed) || !errors.Is(err, tt.wantErr)) {
+				t.Fatalf("Subscribe: err = %v, want ErrPaymentFailed wrapping %v", err, tt.wantErr)
+			}
+
+			var sub models.Subscription
+			if err := f.db.Where("user_id = ?", f.user.ID).First(&sub).Error; err != nil {
+				t.Fatal(err)
+			}
+			var invoice models.Invoice
+			if err := f.db.Where("subscription_id = ?", sub.ID).First(&invoice).Error; err != nil {
+				t.Fatal(err)
+			}
+			charges := f.provider.Charges()
+
+			wantKey := ""
+			if tt.wantKey > 0 {
+				wantKey = fmt.Sprintf("invoice-%d-collection-%d", invoice.ID, tt.wantKey)
+			}
+			if invoice.PaymentAttempts != tt.wantAttempts || invoice.PaymentKey != wantKey {
+				t.Errorf("invoice tried %d times under key %q, want %d under %q", invoice.PaymentAttempts, invoice.PaymentKey, tt.wantAttempts, wantKey)
+			}
+
+			if tt.wantErr != nil {
+				if sub.Status != models.SubscriptionStatusIncompleteExpired || sub.Active || invoice.Status != models.InvoiceStatusVoid {
+					t.Errorf("subscription %s (active %v) and invoice %s, want incomplete_expired and void", sub.Status, sub.Active, invoice.Status)
+				}
+				if len(charges) != 0 {
+					t.Errorf("customer charged %d times for a failed subscribe", len(charges))
+				}
+				return
+			}
+			if sub.Status != models.SubscriptionStatusActive || !sub.Active || invoice.Status != models.InvoiceStatusPaid {
+				t.Errorf("subscription %s (active %v) and invoice %s, want active and paid", sub.Status, sub.Active, invoice.Status)
+			}
+			if len(charges) != 1 || invoice.ChargeID != charges[0].ID {
+				t.Errorf("customer charged %d times, invoice records %q", len(charges), invoice.ChargeID)
+			}
+		})
+	}
+}
+
+func TestSubscribeStopsRetryingWhenTheRequestEnds(t *testing.T) {
+	previousBackoff := firstPaymentBackoff
+	firstPaymentBackoff = time.Hour
+	t.Cleanup(func() { firstPaymentBackoff = previousBackoff })
+
+	f := newBillingFixture(t, payments.TokenVisa)
+	f.provider.FailNextAfterCharge(payments.ErrNetworkTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, _, err := f.subscriptions.Subscribe(ctx, SubscribeParams{UserID: f.user.ID, PlanID: f.plan.ID})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Subscribe: err = %v, want the request's deadline", err)
+	}
+
+	// The charge went through, so the invoice is kept open for paying
+	var sub models.Subscription
+	if err := f.db.Where("user_id = ?", f.user.ID).First(&sub).Error; err != nil {
+		t.Fatal(err)
+	}
+	var invoice models.Invoice
+	if err := f.db.Where("subscription_id = ?", sub.ID).First(&invoice).Error; err != nil {
+		t.Fatal(err)
+	}
+	if sub.Status != models.SubscriptionStatusIncomplete || invoice.Status != models.InvoiceStatusOpen {
+		t.Errorf("subscription %s and invoice %s, want incomplete and open", sub.Status, invoice.Status)
+	}
+}
+
+func TestConcurrentPlanChangesCreditUnusedTimeOnce(t *testing.T) {
+	f := newBillingFixture(t, payments.TokenVisa)
+	sub, _, err := f.subscriptions.Subscribe(context.Background(), SubscribeParams{UserID: f.user.ID, PlanID: f.plan.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targets []*models.Plan
+	for _, price := range []float64{10, 50} {
+		plan := &models.Plan{Name: fmt.Sprintf("Plan at %.0f", price), Price: price, IntervalUnit: billing.IntervalMonth, IntervalCount: 1}
+		if err := f.db.Create(plan).Error; err != nil {
+			t.Fatal(err)
+		}
+		targets = append(targets, plan)
+	}
+
+	// Both requests read the subscription on the old plan before either
+	// changes it
+	errs := make(chan error, len(targets))
+	var ready sync.WaitGroup
+	ready.Add(1)
+	for _, plan := range targets {
+		read, err := f.subscriptions.Get(context.Background(), sub.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func(plan *models.Plan) {
+			ready.Wait()
+			_, err := f.subscriptions.ChangePlan(context.Background(), read, plan.ID)
+			errs <- err
+		}(plan)
+	}
+	ready.Done()
+
+	var changed, refused int
+	for range targets {
+		switch err := <-errs; {
+		case err == nil:
+			changed++
+		case errors.Is(err, ErrVersionConflict):
+			refused++
+		default:
+			t.Errorf("ChangePlan: %v", err)
+		}
+	}
+	if changed != 1 || refused != 1 {
+		t.Errorf("%d plan changes made and %d refused, want one of each", changed, refused)
+	}
+
+	var credits int64
+	f.db.Model(&models.InvoiceLineItem{}).Where("plan_id = ? AND unit_amount < 0", f.plan.ID).Count(&credits)
+	if credits != 1 {
+		t.Errorf("unused time on the old plan credited %d times, want once", credits)
+	}
+}
+
+func TestUpdatesAgainstTheSameVersionApplyOnce(t *testing.T) {
+	f := newBillingFixture(t, payments.TokenVisa)
+	sub, _, err := f.subscriptions.Subscribe(context.Background(), SubscribeParams{UserID: f.user.ID, PlanID: f.plan.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	team := &models.Plan{Name: "Team", Price: 50, IntervalUnit: billing.IntervalMonth, IntervalCount: 1}
+	if err := f.db.Create(team).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Both requests carry the ETag of the version they read
+	first, err := f.subscriptions.Get(context.Background(), sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := *first
+	version := first.Version
+
+	if _, err := f.subscriptions.Update(context.Background(), f.user.ID, first, version, SubscriptionUpdate{PlanID: team.ID}); err != nil {
+		t.Fatalf("first update: %v", err)
+	}
+	_, err = f.subscriptions.Update(context.Background(), f.user.ID, &second, version, SubscriptionUpdate{Status: models.SubscriptionStatusCancelled})
+	if !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("second update: err = %v, want ErrVersionConflict", err)
+	}
+
+	stored, err := f.subscriptions.Get(context.Background(), sub.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.PlanID != team.ID || !stored.Active {
+		t.Errorf("subscription on plan %d (active %v), want the first update only", stored.PlanID, stored.Active)
+	}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/repository"
+)
+
+// PlanService manages the plan catalogue
+type PlanService struct {
+	plans         repository.PlanRepository
+	subscriptions repository.SubscriptionRepository
+	audit         repository.AuditRepository
+}
+
+func NewPlanService(plans repository.PlanRepository, subscriptions repository.SubscriptionRepository, audit repository.AuditRepository) *PlanService {
+	return &PlanService{plans: plans, subscriptions: subscriptions, audit: audit}
+}
+
+// PlanParams describes a plan. A plan given only a duration bills every
+// Duration days.
+type PlanParams struct {
+	Name          string
+	Description   string
+	Price         float64
+	Duration      int
+	IntervalUnit  string
+	IntervalCount int
+}
+
+// List returns a page of plans with their regional prices
+func (s *PlanService) List(ctx context.Context, q listquery.Query[models.Plan]) (listquery.Page[models.Plan], error) {
+	return s.plans.List(ctx, q)
+}
+
+// Get returns a plan with its regional prices
+func (s *PlanService) Get(ctx context.Context, id uint) (*models.Plan, error) {
+	plan, err := s.plans.FindByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrPlanNotFound
+	}
+	return plan, err
+}
+
+// Create adds a plan billed at the given interval
+func (s *PlanService) Create(ctx context.Context, params PlanParams) (*models.Plan, error) {
+	plan := &models.Plan{}
+	if err := applyPlanParams(plan, params); err != nil {
+		return nil, err
+	}
+	if err := s.plans.Create(ctx, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Update replaces a plan's name, description, price and interval and
+// records the change in the audit trail. Existing subscriptions are billed
+// the new terms from their next renewal. actorID is the user making the
+// change, zero if unknown. version is the version of the plan the caller
+// last read; the update fails with ErrVersionConflict if the plan has
+// changed since. Zero skips the check.
+func (s *PlanService) Update(ctx context.Context, actorID, id, version uint, params PlanParams) (*models.Plan, error) {
+	plan, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(plan.Version, version); err != nil {
+		return nil, err
+	}
+	return s.save(ctx, actorID, plan, params)
+}
+
+// Patch changes some of a plan's terms. apply edits the plan's current
+// terms; the result must be a valid plan as for Update.
+func (s *PlanService) Patch(ctx context.Context, actorID, id, version uint, apply func(*PlanParams)) (*models.Plan, error) {
+	plan, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(plan.Version, version); err != nil {
+		return nil, err
+	}
+
+	params := PlanParams{
+		Name:          plan.Name,
+		Description:   plan.Description,
+		Price:         plan.Price,
+		Duration:      plan.Duration,
+		IntervalUnit:  plan.IntervalUnit,
+		IntervalCount: plan.IntervalCount,
+	}
+	apply(&params)
+	return s.save(ctx, actorID, plan, params)
+}
+
+func (s *PlanService) save(ctx context.Context, actorID uint, plan *models.Plan, params PlanParams) (*models.Plan, error) {
+	before := *plan
+	if err := applyPlanParams(plan, params); err != nil {
+		return nil, err
+	}
+	if err := s.plans.Save(ctx, plan); err != nil {
+		return nil, saveConflict(err)
+	}
+	if err := recordUpdate(ctx, s.audit, actorID, models.AuditEntityPlan, plan.ID, before, plan, "prices"); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Delete retires a plan. Plans with active subscriptions cannot be deleted.
+func (s *PlanService) Delete(ctx context.Context, id uint) error {
+	active, err := s.subscriptions.CountActiveByPlan(ctx, id)
+	if err != nil {
+		return err
+	}
+	if active > 0 {
+		return ErrPlanInUse
+	}
+
+	err = s.plans.Delete(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrPlanNotFound
+	}
+	return err
+}
+
+func applyPlanParams(plan *models.Plan, params PlanParams) error {
+	interval := billing.Interval{Unit: params.IntervalUnit, Count: params.IntervalCount}
+	if interval.Unit == "" {
+		interval = billing.Interval{Unit: billing.IntervalDay, Count: params.Duration}
+	} else if interval.Count == 0 {
+		interval.Count = 1
+	}
+	if err := interval.Validate(); err != nil {
+		return invalid(err)
+	}
+
+	plan.Name = params.Name
+	plan.Description = params.Description
+	plan.Price = params.Price
+	plan.Duration = interval.ApproxDays()
+	plan.IntervalUnit = interval.Unit
+	plan.IntervalCount = interval.Count
+	return nil
+}
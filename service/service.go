@@ -0,0 +1,67 @@
+// Package service holds the business rules for users, plans and
+// subscriptions. Services read and write through the repository interfaces
+// and hand anything that must be invoiced to a Biller, so they can run
+// against in-memory fakes as well as the database.
+package service
+
+import (
+	"errors"
+
+	"github.com/chandra-devs/subscription_app/repository"
+)
+
+var (
+	ErrUserNotFound         = errors.New("user not found")
+	ErrPlanNotFound         = errors.New("plan not found")
+	ErrAddOnNotFound        = errors.New("add-on not found")
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+
+	ErrPlanInUse = errors.New("plan has active subscriptions")
+
+	// ErrVersionConflict is returned when a record is no longer at the
+	// version an update expects
+	ErrVersionConflict = errors.New("record has changed since it was read")
+
+	ErrEmailTaken         = errors.New("email already registered")
+	ErrPasswordTooShort   = errors.New("password must be at least 8 characters long")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+
+	ErrAlreadySubscribed = errors.New("user already has an active subscription")
+	ErrPlanUnavailable   = errors.New("plan is not available in the user's billing currency")
+	ErrSamePlan          = errors.New("subscription is already on this plan")
+	ErrNotActive         = errors.New("subscription is not active")
+	ErrInvalidQuantity   = errors.New("quantity must be zero or more")
+)
+
+// InvalidError reports a request the business rules reject. Its message is
+// meant for the caller.
+type InvalidError struct {
+	Err error
+}
+
+func (e *InvalidError) Error() string { return e.Err.Error() }
+
+func (e *InvalidError) Unwrap() error { return e.Err }
+
+func invalid(err error) error {
+	return &InvalidError{Err: err}
+}
+
+// checkVersion fails with ErrVersionConflict unless a record at version
+// current may be updated by a caller expecting version expected. An
+// expected version of zero matches any.
+func checkVersion(current, expected uint) error {
+	if expected != 0 && current != expected {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// saveConflict translates the repository's version conflict into
+// ErrVersionConflict
+func saveConflict(err error) error {
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return ErrVersionConflict
+	}
+	return err
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/pricing"
+	"github.com/chandra-devs/subscription_app/repository"
+)
+
+// SubscriptionService manages the lifecycle of subscriptions
+type SubscriptionService struct {
+	users         repository.UserRepository
+	plans         repository.PlanRepository
+	subscriptions repository.SubscriptionRepository
+	biller        Biller
+	audit         repository.AuditRepository
+}
+
+func NewSubscriptionService(users repository.UserRepository, plans repository.PlanRepository, subscriptions repository.SubscriptionRepository, biller Biller, audit repository.AuditRepository) *SubscriptionService {
+	return &SubscriptionService{users: users, plans: plans, subscriptions: subscriptions, biller: biller, audit: audit}
+}
+
+// SubscribeParams describes a new subscription
+type SubscribeParams struct {
+	UserID             uint
+	PlanID             uint
+	BillingCycleAnchor *time.Time
+	PromotionCode      string
+}
+
+// Change is the outcome of a subscription change: the invoice it raised,
+// if any, and why that invoice is still unpaid if it could not be collected
+type Change struct {
+	Invoice      *models.Invoice
+	PaymentError string
+}
+
+// Subscribe starts a subscription in the user's billing currency and
+// collects its first invoice. A user can hold one active subscription; the
+// biller enforces that when it creates the subscription, so of concurrent
+// subscribes for a user exactly one succeeds.
+func (s *SubscriptionService) Subscribe(ctx context.Context, params SubscribeParams) (*models.Subscription, *models.Invoice, error) {
+	user, err := s.users.FindByID(ctx, params.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plan, err := s.findPlan(ctx, params.PlanID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Lock in the price book currency for the life of the subscription
+	quote, ok := pricing.ForUser(*plan, *user)
+	if !ok {
+		return nil, nil, ErrPlanUnavailable
+	}
+
+	now := time.Now()
+	anchor, periodStart, periodEnd, err := billing.PlanInterval(*plan).FirstPeriod(now, params.BillingCycleAnchor)
+	if err != nil {
+		return nil, nil, invalid(err)
+	}
+
+	subscription := &models.Subscription{
+		UserID:             user.ID,
+		PlanID:             plan.ID,
+		Status:             models.SubscriptionStatusActive,
+		StartDate:          now,
+		ExpiresAt:          periodEnd,
+		Active:             true,
+		BillingCycleAnchor: anchor,
+		CurrentPeriodStart: periodStart,
+		Currency:           quote.Currency,
+	}
+	invoice, err := s.biller.Start(ctx, subscription, params.PromotionCode)
+	if err != nil {
+		return nil, nil, err
+	}
+	return subscription, invoice, nil
+}
+
+// List returns a page of subscriptions with their users and plans
+func (s *SubscriptionService) List(ctx context.Context, q listquery.Query[models.Subscription]) (listquery.Page[models.Subscription], error) {
+	return s.subscriptions.List(ctx, q)
+}
+
+// ListForUser returns every subscription of a user
+func (s *SubscriptionService) ListForUser(ctx context.Context, userID uint) ([]models.Subscription, error) {
+	return s.subscriptions.ListByUser(ctx, userID)
+}
+
+// Get returns a subscription
+func (s *SubscriptionService) Get(ctx context.Context, id uint) (*models.Subscription, error) {
+	subscription, err := s.subscriptions.FindByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrSubscriptionNotFound
+	}
+	return subscription, err
+}
+
+// GetForCaller returns a subscription provided it belongs to the caller or
+// the caller is an administrator. Other users' subscriptions are reported
+// as not found.
+func (s *SubscriptionService) GetForCaller(ctx context.Context, id, callerID uint, isAdmin bool) (*models.Subscription, error) {
+	subscription, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if subscription.UserID != callerID && !isAdmin {
+		return nil, ErrSubscriptionNotFound
+	}
+	return subscription, nil
+}
+
+// ChangePlan moves an active subscription to another plan, invoicing the
+// prorated difference
+func (s *SubscriptionService) ChangePlan(ctx context.Context, subscription *models.Subscription, planID uint) (Change, error) {
+	if !subscription.Active {
+		return Change{}, ErrNotActive
+	}
+	if planID == subscription.PlanID {
+		return Change{}, ErrSamePlan
+	}
+
+	plan, err := s.findPlan(ctx, planID)
+	if err != nil {
+		return Change{}, err
+	}
+
+	invoice, err := s.biller.ChangePlan(ctx, subscription, *plan)
+	if err != nil {
+		return Change{}, err
+	}
+	return s.collect(ctx, invoice), nil
+}
+
+// SetAddOn changes the quantity of an add-on on an active subscription. A
+// quantity of zero removes the add-on.
+func (s *SubscriptionService) SetAddOn(ctx context.Context, subscription *models.Subscription, addOnID uint, quantity int) (Change, error) {
+	if !subscription.Active {
+		return Change{}, ErrNotActive
+	}
+
+	addOn, err := s.plans.FindAddOn(ctx, addOnID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return Change{}, ErrAddOnNotFound
+	}
+	if err != nil {
+		return Change{}, err
+	}
+	if quantity < 0 {
+		return Change{}, ErrInvalidQuantity
+	}
+
+	invoice, err := s.biller.ChangeAddOn(ctx, subscription, *addOn, quantity)
+	if err != nil {
+		return Change{}, err
+	}
+	return s.collect(ctx, invoice), nil
+}
+
+// ApplyPromotionCode redeems a promotion code against an active
+// subscription. The discount applies from the next renewal.
+func (s *SubscriptionService) ApplyPromotionCode(ctx context.Context, subscription *models.Subscription, code string) error {
+	if !subscription.Active {
+		return ErrNotActive
+	}
+	return s.biller.RedeemPromotionCode(ctx, subscription, code)
+}
+
+// Renew starts the next billing period of an active subscription and
+// invoices it. If the invoice cannot be collected, payment retries are
+// scheduled.
+func (s *SubscriptionService) Renew(ctx context.Context, subscription *models.Subscription) (Change, error) {
+	if subscription.Status != models.SubscriptionStatusActive {
+		return Change{}, ErrNotActive
+	}
+
+	invoice, err := s.biller.Renew(ctx, subscription)
+	if err != nil {
+		return Change{}, err
+	}
+
+	change := s.collect(ctx, invoice)
+	if change.PaymentError != "" {
+		if err := s.biller.StartDunning(ctx, subscription, invoice, change.PaymentError); err != nil {
+			return change, err
+		}
+	}
+	return change, nil
+}
+
+// SubscriptionUpdate is a change made directly to a subscription. Zero
+// fields are left alone.
+type SubscriptionUpdate struct {
+	PlanID uint
+	// Status may only be set to cancelled; other transitions follow payments
+	Status string
+}
+
+// Update applies a change to a subscription and records what changed in
+// the audit trail. A new plan is invoiced as a plan change, and a cancelled
+// status ends the subscription; both are applied together or not at all.
+// actorID is the user making the change, zero if unknown. version is the
+// version of the subscription the caller last read; the update fails with
+// ErrVersionConflict unless the subscription is still at it. Zero skips the
+// check.
+func (s *SubscriptionService) Update(ctx context.Context, actorID uint, subscription *models.Subscription, version uint, update SubscriptionUpdate) (Change, error) {
+	if err := checkVersion(subscription.Version, version); err != nil {
+		return Change{}, err
+	}
+	if update.Status != "" && update.Status != subscription.Status && update.Status != models.SubscriptionStatusCancelled {
+		return Change{}, invalid(fmt.Errorf("status can only be changed to %s", models.SubscriptionStatusCancelled))
+	}
+
+	var plan *models.Plan
+	if update.PlanID != 0 && update.PlanID != subscription.PlanID {
+		if !subscription.Active {
+			return Change{}, ErrNotActive
+		}
+		var err error
+		if plan, err = s.findPlan(ctx, update.PlanID); err != nil {
+			return Change{}, err
+		}
+	}
+	cancel := update.Status == models.SubscriptionStatusCancelled
+
+	before := *subscription
+	invoice, err := s.biller.Update(ctx, subscription, version, plan, cancel)
+	if err != nil {
+		return Change{}, err
+	}
+	// Every change the billing engine writes bumps the stored version
+	if stored, findErr := s.subscriptions.FindByID(ctx, subscription.ID); findErr == nil {
+		subscription.Version = stored.Version
+	}
+	change := s.collect(ctx, invoice)
+	return change, recordUpdate(ctx, s.audit, actorID, models.AuditEntitySubscription, subscription.ID, before, subscription, "user", "plan", "addons", "discount")
+}
+
+// Cancel ends an active subscription immediately
+func (s *SubscriptionService) Cancel(ctx context.Context, subscription *models.Subscription) error {
+	if !subscription.Active {
+		return ErrNotActive
+	}
+	return s.biller.Cancel(ctx, subscription, "Subscription cancelled")
+}
+
+// History returns the events of a subscription, oldest first
+func (s *SubscriptionService) History(ctx context.Context, subscription *models.Subscription) ([]models.SubscriptionEvent, error) {
+	return s.subscriptions.Events(ctx, subscription.ID)
+}
+
+// collect tries to charge an invoice raised by a subscription change. A
+// failed payment leaves the invoice open and is reported rather than
+// undoing the change.
+func (s *SubscriptionService) collect(ctx context.Context, invoice *models.Invoice) Change {
+	change := Change{Invoice: invoice}
+	if invoice == nil || invoice.Status != models.InvoiceStatusOpen {
+		return change
+	}
+	if err := s.biller.Collect(ctx, invoice); err != nil {
+		change.PaymentError = err.Error()
+	}
+	return change
+}
+
+func (s *SubscriptionService) findPlan(ctx context.Context, id uint) (*models.Plan, error) {
+	plan, err := s.plans.FindByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrPlanNotFound
+	}
+	return plan, err
+}
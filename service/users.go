@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/listquery"
+	"github.com/chandra-devs/subscription_app/models"
+	"github.com/chandra-devs/subscription_app/repository"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 8
+	passwordCost      = 12
+)
+
+// UserService manages user accounts and their credentials
+type UserService struct {
+	users         repository.UserRepository
+	subscriptions repository.SubscriptionRepository
+	biller        Biller
+	audit         repository.AuditRepository
+}
+
+func NewUserService(users repository.UserRepository, subscriptions repository.SubscriptionRepository, biller Biller, audit repository.AuditRepository) *UserService {
+	return &UserService{users: users, subscriptions: subscriptions, biller: biller, audit: audit}
+}
+
+// Registration is what a new customer signs up with
+type Registration struct {
+	Name     string
+	Email    string
+	Password string
+	Billing  models.BillingProfile
+}
+
+// Register creates a customer account with a hashed password
+func (s *UserService) Register(ctx context.Context, reg Registration) (*models.User, error) {
+	if len(reg.Password) < minPasswordLength {
+		return nil, ErrPasswordTooShort
+	}
+
+	if _, err := s.users.FindByEmail(ctx, reg.Email); err == nil {
+		return nil, ErrEmailTaken
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(reg.Password), passwordCost)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &models.User{
+		Name:     reg.Name,
+		Email:    reg.Email,
+		Password: string(hashedPassword),
+		Role:     models.RoleUser,
+		Billing:  reg.Billing,
+	}
+	if err := billing.NormalizeProfile(&user.Billing); err != nil {
+		return nil, invalid(err)
+	}
+	if err := s.users.Create(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Authenticate returns the user with the given email and password
+func (s *UserService) Authenticate(ctx context.Context, email, password string) (*models.User, error) {
+	user, err := s.users.FindByEmail(ctx, email)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return user, nil
+}
+
+// List returns a page of users with their subscriptions
+func (s *UserService) List(ctx context.Context, q listquery.Query[models.User]) (listquery.Page[models.User], error) {
+	return s.users.List(ctx, q)
+}
+
+// Get returns a user with their subscriptions
+func (s *UserService) Get(ctx context.Context, id uint) (*models.User, error) {
+	user, err := s.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Subscriptions, err = s.subscriptions.ListByUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Create adds a user on behalf of an administrator. New users always get
+// the user role; roles are never granted through this path.
+func (s *UserService) Create(ctx context.Context, user *models.User) error {
+	if err := billing.NormalizeProfile(&user.Billing); err != nil {
+		return invalid(err)
+	}
+	user.Role = models.RoleUser
+	return s.users.Create(ctx, user)
+}
+
+// Patch changes a user's details and records the change in the audit
+// trail. apply edits the stored user; which fields it may touch is decided
+// by the caller, but the ID, creation time, version and password always
+// keep their stored values. actorID is the user making the change, zero if
+// unknown. version is the version of the user the caller last read; the
+// update fails with ErrVersionConflict if the user has changed since. Zero
+// skips the check.
+func (s *UserService) Patch(ctx context.Context, actorID, id, version uint, apply func(*models.User)) (*models.User, error) {
+	user, err := s.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkVersion(user.Version, version); err != nil {
+		return nil, err
+	}
+	before := *user
+
+	apply(user)
+	user.ID = before.ID
+	user.CreatedAt = before.CreatedAt
+	user.Version = before.Version
+	user.Password = before.Password
+	if user.Role != models.RoleUser && user.Role != models.RoleAdmin {
+		return nil, invalid(fmt.Errorf("role must be %s or %s", models.RoleUser, models.RoleAdmin))
+	}
+	if err := billing.NormalizeProfile(&user.Billing); err != nil {
+		return nil, invalid(err)
+	}
+	if !strings.EqualFold(user.Email, before.Email) {
+		if _, err := s.users.FindByEmail(ctx, user.Email); err == nil {
+			return nil, ErrEmailTaken
+		} else if !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	if err := s.users.Save(ctx, user); err != nil {
+		return nil, saveConflict(err)
+	}
+	if err := recordUpdate(ctx, s.audit, actorID, models.AuditEntityUser, user.ID, before, user, "subscriptions"); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Delete cancels a user's active subscriptions, so they are not renewed
+// and charged after the account is gone, and removes the user
+func (s *UserService) Delete(ctx context.Context, id uint) error {
+	if _, err := s.Find(ctx, id); err != nil {
+		return err
+	}
+	subscriptions, err := s.subscriptions.ListByUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	for i := range subscriptions {
+		if !subscriptions[i].Active {
+			continue
+		}
+		if err := s.biller.Cancel(ctx, &subscriptions[i], "Subscription cancelled: user deleted"); err != nil {
+			return err
+		}
+	}
+
+	err = s.users.Delete(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrUserNotFound
+	}
+	return err
+}
+
+// Find returns a user without their subscriptions
+func (s *UserService) Find(ctx context.Context, id uint) (*models.User, error) {
+	user, err := s.users.FindByID(ctx, id)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrUserNotFound
+	}
+	return user, err
+}
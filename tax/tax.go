@@ -0,0 +1,52 @@
+// Package tax looks up the sales tax that applies to a customer and
+// calculates it on invoice amounts.
+package tax
+
+import (
+	"errors"
+	"math"
+
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidRate = errors.New("a tax rate needs a two-letter country, a name and a percentage between 0 and 100")
+
+// FindRate returns the active rate for a customer's region, falling back to
+// the country-wide rate. It returns nil when no tax applies.
+func FindRate(tx *gorm.DB, country, region string) (*models.TaxRate, error) {
+	if country == "" {
+		return nil, nil
+	}
+
+	var rates []models.TaxRate
+	err := tx.Where("country = ? AND region IN ? AND active = true", country, []string{region, ""}).
+		Order("region DESC").
+		Limit(1).
+		Find(&rates).Error
+	if err != nil || len(rates) == 0 {
+		return nil, err
+	}
+	return &rates[0], nil
+}
+
+// Amount calculates the tax at a rate on an amount. For inclusive rates the
+// tax is the share of the amount that is tax; for exclusive rates it is added
+// on top. The result is rounded to the cent.
+func Amount(rate models.TaxRate, amount float64) float64 {
+	var tax float64
+	if rate.Inclusive {
+		tax = amount - amount/(1+rate.Percentage/100)
+	} else {
+		tax = amount * rate.Percentage / 100
+	}
+	return math.Round(tax*100) / 100
+}
+
+// ValidateRate checks a tax rate before it is stored
+func ValidateRate(rate models.TaxRate) error {
+	if len(rate.Country) != 2 || rate.Name == "" || rate.Percentage < 0 || rate.Percentage > 100 {
+		return ErrInvalidRate
+	}
+	return nil
+}
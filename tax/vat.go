@@ -0,0 +1,95 @@
+package tax
+
+import (
+	"regexp"
+	"strings"
+)
+
+// euCountries are the EU member states, by ISO 3166-1 alpha-2 code
+var euCountries = map[string]bool{
+	"AT": true, "BE": true, "BG": true, "CY": true, "CZ": true, "DE": true,
+	"DK": true, "EE": true, "ES": true, "FI": true, "FR": true, "GR": true,
+	"HR": true, "HU": true, "IE": true, "IT": true, "LT": true, "LU": true,
+	"LV": true, "MT": true, "NL": true, "PL": true, "PT": true, "RO": true,
+	"SE": true, "SI": true, "SK": true,
+}
+
+// vatFormats are the national VAT ID formats after the two-letter prefix.
+// Greece uses the prefix EL rather than its ISO code.
+var vatFormats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^U\d{8}$`),
+	"BE": regexp.MustCompile(`^[01]\d{9}$`),
+	"BG": regexp.MustCompile(`^\d{9,10}$`),
+	"CY": regexp.MustCompile(`^\d{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^\d{8,10}$`),
+	"DE": regexp.MustCompile(`^\d{9}$`),
+	"DK": regexp.MustCompile(`^\d{8}$`),
+	"EE": regexp.MustCompile(`^\d{9}$`),
+	"EL": regexp.MustCompile(`^\d{9}$`),
+	"ES": regexp.MustCompile(`^[A-Z0-9]\d{7}[A-Z0-9]$`),
+	"FI": regexp.MustCompile(`^\d{8}$`),
+	"FR": regexp.MustCompile(`^[A-HJ-NP-Z0-9]{2}\d{9}$`),
+	"HR": regexp.MustCompile(`^\d{11}$`),
+	"HU": regexp.MustCompile(`^\d{8}$`),
+	"IE": regexp.MustCompile(`^(\d{7}[A-W][A-I]?|\d[A-Z+*]\d{5}[A-W])$`),
+	"IT": regexp.MustCompile(`^\d{11}$`),
+	"LT": regexp.MustCompile(`^(\d{9}|\d{12})$`),
+	"LU": regexp.MustCompile(`^\d{8}$`),
+	"LV": regexp.MustCompile(`^\d{11}$`),
+	"MT": regexp.MustCompile(`^\d{8}$`),
+	"NL": regexp.MustCompile(`^\d{9}B\d{2}$`),
+	"PL": regexp.MustCompile(`^\d{10}$`),
+	"PT": regexp.MustCompile(`^\d{9}$`),
+	"RO": regexp.MustCompile(`^\d{2,10}$`),
+	"SE": regexp.MustCompile(`^\d{10}01$`),
+	"SI": regexp.MustCompile(`^\d{8}$`),
+	"SK": regexp.MustCompile(`^\d{10}$`),
+}
+
+// IsEU reports whether a country is an EU member state
+func IsEU(country string) bool {
+	return euCountries[strings.ToUpper(country)]
+}
+
+// NormalizeVATID upper-cases a VAT ID and strips the spaces, dots and
+// dashes customers commonly type
+func NormalizeVATID(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '.', '-':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(strings.TrimSpace(id)))
+}
+
+// ValidVATID reports whether a normalized ID has the format of an EU VAT ID.
+// Only the format is checked, not whether the number is registered.
+func ValidVATID(id string) bool {
+	if len(id) < 4 {
+		return false
+	}
+	format, ok := vatFormats[id[:2]]
+	return ok && format.MatchString(id[2:])
+}
+
+// VATCountry returns the ISO country code of an EU VAT ID
+func VATCountry(id string) string {
+	if len(id) < 2 {
+		return ""
+	}
+	if prefix := id[:2]; prefix != "EL" {
+		return prefix
+	}
+	return "GR"
+}
+
+// ReverseCharge reports whether a sale from the seller's country to a
+// business customer is reverse charged: both are in the EU, in different
+// member states, and the customer holds a VAT ID of their own country
+func ReverseCharge(sellerCountry, customerCountry, customerVATID string) bool {
+	customerCountry = strings.ToUpper(customerCountry)
+	return IsEU(sellerCountry) && IsEU(customerCountry) &&
+		!strings.EqualFold(sellerCountry, customerCountry) &&
+		ValidVATID(customerVATID) && VATCountry(customerVATID) == customerCountry
+}
@@ -0,0 +1,323 @@
+// Package validate checks request payloads against the rules in their
+// validate struct tags and finds JSON fields a payload does not declare.
+//
+// Supported rules are required, omitempty, email, min, max, len, gt and
+// oneof. min, max and len count characters in strings and elements in
+// slices and maps, and compare the value of numbers. Fields are reported by
+// their JSON name; fields of nested structs as parent.child.
+package validate
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chandra-devs/subscription_app/apperror"
+)
+
+// Optional is implemented by fields that may be left out of a payload, such
+// as the members of a merge patch. Rules only apply to fields that are
+// present, and a present null counts as empty.
+type Optional interface {
+	// Lookup returns the value, nil if it is null, and whether the field
+	// is present
+	Lookup() (any, bool)
+	// ValueType is the type the value decodes into
+	ValueType() reflect.Type
+}
+
+var optionalType = reflect.TypeOf((*Optional)(nil)).Elem()
+
+// Struct checks every field of the struct v points to against its validate
+// tag and returns all violations. Once a rule fails, the remaining rules of
+// that field are skipped.
+func Struct(v any) []apperror.FieldError {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	return checkStruct(value, "")
+}
+
+func checkStruct(value reflect.Value, prefix string) []apperror.FieldError {
+	var errs []apperror.FieldError
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, ok := jsonName(field)
+		if !ok {
+			continue
+		}
+		fieldValue := value.Field(i)
+		if optional, ok := fieldValue.Interface().(Optional); ok {
+			v, present := optional.Lookup()
+			if !present {
+				continue
+			}
+			fieldValue = reflect.Zero(optional.ValueType())
+			if v != nil {
+				fieldValue = reflect.ValueOf(v)
+			}
+		}
+		nested := reflect.Indirect(fieldValue)
+		isStruct := nested.Kind() == reflect.Struct && !isOpaque(nested.Type())
+		if field.Anonymous && field.Tag.Get("json") == "" && isStruct {
+			errs = append(errs, checkStruct(nested, prefix)...)
+			continue
+		}
+
+		path := prefix + name
+		if tag := field.Tag.Get("validate"); tag != "" && tag != "-" {
+			if err, failed := checkField(fieldValue, path, tag); failed {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		if isStruct {
+			errs = append(errs, checkStruct(nested, path+".")...)
+		}
+	}
+	return errs
+}
+
+// checkField applies the comma-separated rules of a tag to a value and
+// reports the first one it breaks
+func checkField(value reflect.Value, path, tag string) (apperror.FieldError, bool) {
+	rules := strings.Split(tag, ",")
+	if isZero(value) {
+		for _, rule := range rules {
+			switch rule {
+			case "required":
+				return apperror.FieldError{Field: path, Code: apperror.FieldRequired, Message: path + " is required"}, true
+			case "omitempty":
+				return apperror.FieldError{}, false
+			}
+		}
+	}
+
+	value = reflect.Indirect(value)
+	for _, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		var code, message string
+		switch name {
+		case "required", "omitempty":
+			continue
+		case "email":
+			if !isEmail(value.String()) {
+				code, message = apperror.FieldInvalid, "must be a valid email address"
+			}
+		case "min":
+			if compare(value, param) < 0 {
+				code, message = apperror.FieldOutOfRange, "must be at least "+param+unit(value)
+			}
+		case "max":
+			if compare(value, param) > 0 {
+				code, message = apperror.FieldOutOfRange, "must be at most "+param+unit(value)
+			}
+		case "gt":
+			if compare(value, param) <= 0 {
+				code, message = apperror.FieldOutOfRange, "must be greater than "+param
+			}
+		case "len":
+			if compare(value, param) != 0 {
+				code, message = apperror.FieldInvalid, "must be exactly "+param+unit(value)
+			}
+		case "oneof":
+			options := strings.Fields(param)
+			if !contains(options, fmt.Sprint(value.Interface())) {
+				code, message = apperror.FieldUnsupported, "must be one of "+strings.Join(options, ", ")
+			}
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q on %s", name, path))
+		}
+		if code != "" {
+			return apperror.FieldError{Field: path, Code: code, Message: path + " " + message}, true
+		}
+	}
+	return apperror.FieldError{}, false
+}
+
+// compare returns -1, 0 or 1 as the value, or its length for strings,
+// slices and maps, is below, equal to or above param
+func compare(value reflect.Value, param string) int {
+	var n float64
+	switch value.Kind() {
+	case reflect.String:
+		n = float64(utf8.RuneCountInString(value.String()))
+	case reflect.Slice, reflect.Map, reflect.Array:
+		n = float64(value.Len())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(value.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = value.Float()
+	default:
+		panic(fmt.Sprintf("validate: cannot compare a %s", value.Kind()))
+	}
+
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validate: invalid rule parameter %q", param))
+	}
+	switch {
+	case n < limit:
+		return -1
+	case n > limit:
+		return 1
+	}
+	return 0
+}
+
+// unit names what a length rule counts
+func unit(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.String:
+		return " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return " items"
+	}
+	return ""
+}
+
+func isZero(value reflect.Value) bool {
+	if value.Kind() == reflect.Pointer {
+		return value.IsNil()
+	}
+	return value.IsZero()
+}
+
+func isEmail(s string) bool {
+	address, err := mail.ParseAddress(s)
+	return err == nil && address.Address == s
+}
+
+func contains(options []string, s string) bool {
+	for _, option := range options {
+		if option == s {
+			return true
+		}
+	}
+	return false
+}
+
+// UnknownFields returns every object key in data, at any depth, that the
+// struct v points to has no field for. Keys are matched to fields the way
+// encoding/json matches them. data must be valid JSON.
+func UnknownFields(data []byte, v any) []apperror.FieldError {
+	errs := unknownFields(data, reflect.TypeOf(v), "")
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+func unknownFields(data []byte, t reflect.Type, prefix string) []apperror.FieldError {
+	for {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		} else if t.Implements(optionalType) {
+			t = reflect.Zero(t).Interface().(Optional).ValueType()
+		} else {
+			break
+		}
+	}
+	var errs []apperror.FieldError
+	switch {
+	case t.Kind() == reflect.Struct && !isOpaque(t):
+		var object map[string]json.RawMessage
+		if json.Unmarshal(data, &object) != nil {
+			return nil
+		}
+		fields := jsonFields(t)
+		for key, raw := range object {
+			path := prefix + key
+			field, ok := lookup(fields, key)
+			if !ok {
+				errs = append(errs, apperror.FieldError{Field: path, Code: apperror.FieldUnknown, Message: path + " is not a known field"})
+				continue
+			}
+			errs = append(errs, unknownFields(raw, field.Type, path+".")...)
+		}
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		var items []json.RawMessage
+		if json.Unmarshal(data, &items) != nil {
+			return nil
+		}
+		for i, item := range items {
+			errs = append(errs, unknownFields(item, t.Elem(), fmt.Sprintf("%s%d.", prefix, i))...)
+		}
+	}
+	return errs
+}
+
+// jsonFields returns the fields encoding/json decodes into, by JSON name,
+// including those promoted from embedded structs
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, ok := jsonName(field)
+		if !ok {
+			continue
+		}
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for name, promoted := range jsonFields(embedded) {
+					if _, taken := fields[name]; !taken {
+						fields[name] = promoted
+					}
+				}
+				continue
+			}
+		}
+		if field.IsExported() {
+			fields[name] = field
+		}
+	}
+	return fields
+}
+
+// lookup finds a field by key, preferring an exact match and otherwise
+// ignoring case as encoding/json does
+func lookup(fields map[string]reflect.StructField, key string) (reflect.StructField, bool) {
+	if field, ok := fields[key]; ok {
+		return field, true
+	}
+	for name, field := range fields {
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// jsonName returns the name a field is encoded under, and false for fields
+// encoding/json ignores
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, true
+	}
+	return field.Name, true
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// isOpaque reports whether a struct decodes itself, like time.Time, and so
+// is not checked field by field
+func isOpaque(t reflect.Type) bool {
+	return t.Implements(unmarshalerType) || reflect.PointerTo(t).Implements(unmarshalerType)
+}
@@ -0,0 +1,233 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chandra-devs/subscription_app/billing"
+	"github.com/chandra-devs/subscription_app/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Event types acted upon
+const (
+	EventChargeSucceeded = "charge.succeeded"
+	EventChargeFailed    = "charge.failed"
+)
+
+// Event is the envelope of every provider webhook
+type Event struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Created int64     `json:"created"`
+	Data    EventData `json:"data"`
+}
+
+// EventData describes the charge an event is about
+type EventData struct {
+	ChargeID       string            `json:"charge_id"`
+	Amount         float64           `json:"amount"`
+	Currency       string            `json:"currency"`
+	FailureMessage string            `json:"failure_message"`
+	Metadata       map[string]string `json:"metadata"`
+}
+
+var (
+	errUnhandled      = errors.New("event type not handled")
+	errAmountMismatch = errors.New("charge does not match the invoice")
+)
+
+// Parse decodes an event envelope
+func Parse(payload []byte) (Event, error) {
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return event, err
+	}
+	if event.ID == "" || event.Type == "" {
+		return event, errors.New("event id and type are required")
+	}
+	return event, nil
+}
+
+// Store persists a verified event's raw payload. Events are deduplicated by
+// provider event ID; a redelivered event returns the row stored the first time.
+func Store(db *gorm.DB, provider string, event Event, payload []byte) (*models.WebhookEvent, error) {
+	stored := models.WebhookEvent{
+		Provider: provider,
+		EventID:  event.ID,
+		Type:     event.Type,
+		Payload:  string(payload),
+		Status:   models.WebhookStatusReceived,
+	}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&stored).Error; err != nil {
+		return nil, err
+	}
+	if stored.ID == 0 {
+		if err := db.Where("provider = ? AND event_id = ?", provider, event.ID).First(&stored).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &stored, nil
+}
+
+// Process applies a stored event. The event row is locked for the duration,
+// so concurrent deliveries of the same event are applied once; processed
+// events are skipped unless replay is set. The state changes themselves are
+// idempotent, so replaying an event is always safe.
+func Process(db *gorm.DB, id uint, replay bool) (*models.WebhookEvent, error) {
+	var stored models.WebhookEvent
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&stored, id).Error; err != nil {
+			return err
+		}
+		if !replay && (stored.Status == models.WebhookStatusProcessed || stored.Status == models.WebhookStatusIgnored) {
+			return nil
+		}
+
+		stored.Attempts++
+		applyErr := tx.Transaction(func(inner *gorm.DB) error {
+			event, err := Parse([]byte(stored.Payload))
+			if err != nil {
+				return err
+			}
+			return apply(inner, event)
+		})
+
+		now := time.Now()
+		switch {
+		case errors.Is(applyErr, errUnhandled):
+			stored.Status = models.WebhookStatusIgnored
+			stored.LastError = ""
+			stored.ProcessedAt = &now
+		case applyErr != nil:
+			stored.Status = models.WebhookStatusFailed
+			stored.LastError = applyErr.Error()
+		default:
+			stored.Status = models.WebhookStatusProcessed
+			stored.LastError = ""
+			stored.ProcessedAt = &now
+		}
+
+		return tx.Model(&stored).Select("status", "attempts", "last_error", "processed_at").Updates(&stored).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stored.Status == models.WebhookStatusFailed {
+		return &stored, fmt.Errorf("processing event %s: %s", stored.EventID, stored.LastError)
+	}
+	return &stored, nil
+}
+
+func apply(tx *gorm.DB, event Event) error {
+	switch event.Type {
+	case EventChargeSucceeded:
+		return chargeSucceeded(tx, event.Data)
+	case EventChargeFailed:
+		return chargeFailed(tx, event.Data)
+	default:
+		return errUnhandled
+	}
+}
+
+// chargeSucceeded pays the invoice and starts an incomplete subscription or
+// brings a past due one back, unless it has been replaced
+func chargeSucceeded(tx *gorm.DB, data EventData) error {
+	invoice, err := findInvoice(tx, data)
+	if err != nil {
+		return err
+	}
+	if invoice.Status != models.InvoiceStatusOpen {
+		return nil
+	}
+
+	// A charge for another amount or currency does not settle the invoice;
+	// the event fails and stays listed for an administrator to look into
+	outstanding := invoice.AmountDue - invoice.AmountPaid
+	if !strings.EqualFold(data.Currency, invoice.Currency) || math.Abs(data.Amount-outstanding) >= 0.005 {
+		return fmt.Errorf("%w: charge %s of %.2f %s, invoice %s has %.2f %s due",
+			errAmountMismatch, data.ChargeID, data.Amount, data.Currency, invoice.Number, outstanding, invoice.Currency)
+	}
+
+	invoice.ChargeID = data.ChargeID
+	invoice.LastPaymentError = ""
+	if err := tx.Model(invoice).Select("charge_id", "last_payment_error").Updates(invoice).Error; err != nil {
+		return err
+	}
+	if err := billing.MarkPaid(tx, invoice); err != nil {
+		return err
+	}
+
+	sub, err := findSubscription(tx, invoice)
+	if err != nil || sub == nil {
+		return err
+	}
+	_, err = billing.ResumeSubscription(tx, sub, invoice, "Payment received")
+	return err
+}
+
+// chargeFailed records the failure and starts dunning
+func chargeFailed(tx *gorm.DB, data EventData) error {
+	invoice, err := findInvoice(tx, data)
+	if err != nil {
+		return err
+	}
+	if invoice.Status != models.InvoiceStatusOpen {
+		return nil
+	}
+
+	invoice.LastPaymentError = data.FailureMessage
+	if err := tx.Model(invoice).Update("last_payment_error", invoice.LastPaymentError).Error; err != nil {
+		return err
+	}
+
+	sub, err := findSubscription(tx, invoice)
+	if err != nil || sub == nil {
+		return err
+	}
+	if sub.Status == models.SubscriptionStatusActive {
+		return billing.StartDunning(context.Background(), tx, sub, invoice, data.FailureMessage)
+	}
+	return nil
+}
+
+// findInvoice locks the invoice an event refers to, by the invoice ID set in
+// the charge metadata or else by charge ID
+func findInvoice(tx *gorm.DB, data EventData) (*models.Invoice, error) {
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	if raw, ok := data.Metadata["invoice_id"]; ok {
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid invoice_id metadata %q", raw)
+		}
+		query = query.Where("id = ?", id)
+	} else if data.ChargeID != "" {
+		query = query.Where("charge_id = ?", data.ChargeID)
+	} else {
+		return nil, errors.New("event does not reference an invoice")
+	}
+
+	var invoice models.Invoice
+	if err := query.First(&invoice).Error; err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+func findSubscription(tx *gorm.DB, invoice *models.Invoice) (*models.Subscription, error) {
+	if invoice.SubscriptionID == nil {
+		return nil, nil
+	}
+	var sub models.Subscription
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sub, *invoice.SubscriptionID).Error; err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}